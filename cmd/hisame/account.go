@@ -0,0 +1,205 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/config"
+	"github.com/StarTerrarium/hisame/internal/library"
+	"github.com/StarTerrarium/hisame/internal/store"
+)
+
+// mediaTypeLabels names the lists in the status output.
+var mediaTypeLabels = map[anilist.MediaType]string{
+	anilist.MediaTypeAnime: "Anime",
+	anilist.MediaTypeManga: "Manga",
+}
+
+// listStatusOutput summarises a cached list for status --json.
+type listStatusOutput struct {
+	Entries    int        `json:"entries"`
+	Current    int        `json:"current"`
+	LastSynced *time.Time `json:"lastSynced"`
+}
+
+// statusOutput is the result of status --json.
+type statusOutput struct {
+	LoggedIn     bool                                   `json:"loggedIn"`
+	Account      *accountOutput                         `json:"account"`
+	Accounts     []accountOutput                        `json:"accounts"`
+	Mode         string                                 `json:"mode"`
+	PendingEdits int                                    `json:"pendingEdits"`
+	Lists        map[anilist.MediaType]listStatusOutput `json:"lists"`
+}
+
+// runStatus shows the logged in accounts, whether changes are sent to AniList, and the state of the active
+// account's cached lists.  It works offline, so is quick enough for status bars.  The exit code is 1 when not
+// logged in.
+func runStatus(cfg *config.UserConfig, args []string) int {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	jsonOutput := flags.Bool("json", false, "Print JSON")
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: hisame status [--json]")
+		return 2
+	}
+	_, accounts, err := loadAccounts()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	status := statusOutput{Mode: mutationMode(cfg).String(), Accounts: []accountOutput{}, Lists: map[anilist.MediaType]listStatusOutput{}}
+	for _, name := range accounts.Names() {
+		status.Accounts = append(status.Accounts, newAccountOutput(accounts.Sessions[name], name == accounts.Active))
+	}
+	session := accounts.ActiveSession()
+	if session != nil {
+		status.LoggedIn = true
+		account := newAccountOutput(session, true)
+		status.Account = &account
+		if baseDir, err := store.DefaultDir(); err == nil {
+			if s, err := store.Open(baseDir, session.CacheKey()); err == nil {
+				status.PendingEdits, status.Lists = cachedStatus(s)
+			}
+		}
+	}
+
+	code := 0
+	if !status.LoggedIn {
+		code = 1
+	}
+	if *jsonOutput {
+		if printJSON(status) != 0 {
+			return 1
+		}
+		return code
+	}
+
+	if !status.LoggedIn {
+		fmt.Println("Not logged in")
+		return code
+	}
+	fmt.Printf("Logged in as %s (user %d)", session.Username, session.UserID)
+	if !session.ExpiresAt.IsZero() {
+		fmt.Printf(", until %s", session.ExpiresAt.Local().Format("2 Jan 2006"))
+	}
+	fmt.Println()
+	if len(status.Accounts) > 1 {
+		var others []string
+		for _, account := range status.Accounts {
+			if !account.Active {
+				others = append(others, account.Username)
+			}
+		}
+		fmt.Printf("Other accounts: %s\n", strings.Join(others, ", "))
+	}
+	fmt.Printf("Mode: %s\n", status.Mode)
+	fmt.Printf("Edits waiting to be sent: %d\n", status.PendingEdits)
+	for _, mediaType := range []anilist.MediaType{anilist.MediaTypeAnime, anilist.MediaTypeManga} {
+		list, ok := status.Lists[mediaType]
+		if !ok {
+			continue
+		}
+		fmt.Printf("%s: %d entries, %d current", mediaTypeLabels[mediaType], list.Entries, list.Current)
+		if list.LastSynced != nil {
+			fmt.Printf(", synced %s", list.LastSynced.Local().Format("2 Jan 2006 15:04"))
+		}
+		fmt.Println()
+	}
+	return code
+}
+
+// cachedStatus reads the pending edits and cached lists the app left in the account's store.
+func cachedStatus(s *store.Store) (int, map[anilist.MediaType]listStatusOutput) {
+	pending := 0
+	if queue, err := library.OpenQueue(library.QueuePath(s), nil); err == nil {
+		pending = len(queue.Pending())
+	}
+	lists := map[anilist.MediaType]listStatusOutput{}
+	for _, mediaType := range []anilist.MediaType{anilist.MediaTypeAnime, anilist.MediaTypeManga} {
+		collection, fetchedAt, err := s.LoadListCollection(mediaType)
+		if err != nil || collection == nil {
+			continue
+		}
+		var list listStatusOutput
+		for _, entry := range collection.Entries() {
+			list.Entries++
+			if entry.Status == anilist.StatusCurrent || entry.Status == anilist.StatusRepeating {
+				list.Current++
+			}
+		}
+		if _, syncedAt, err := s.LoadSyncCursor(mediaType); err == nil && !syncedAt.IsZero() {
+			fetchedAt = syncedAt
+		}
+		if !fetchedAt.IsZero() {
+			list.LastSynced = &fetchedAt
+		}
+		lists[mediaType] = list
+	}
+	return pending, lists
+}
+
+// runLogout forgets the saved session of the active account, a named account, or every account.
+func runLogout(args []string) int {
+	flags := flag.NewFlagSet("logout", flag.ContinueOnError)
+	all := flags.Bool("all", false, "Log out of every account")
+	jsonOutput := flags.Bool("json", false, "Print JSON")
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) > 1 || (*all && len(positional) > 0) {
+		fmt.Fprintln(os.Stderr, "Usage: hisame logout [--all | account] [--json]")
+		return 2
+	}
+	sessions, accounts, err := loadAccounts()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var names []string
+	switch {
+	case *all:
+		names = accounts.Names()
+	case len(positional) == 1:
+		if _, ok := accounts.Sessions[positional[0]]; !ok {
+			fmt.Fprintf(os.Stderr, "Not logged in to %s\n", positional[0])
+			return 1
+		}
+		names = positional
+	case accounts.Active != "":
+		names = []string{accounts.Active}
+	}
+	for _, name := range names {
+		accounts.Remove(name)
+	}
+	if err := sessions.Save(accounts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving accounts: %v\n", err)
+		return 1
+	}
+
+	if *jsonOutput {
+		return printJSON(struct {
+			LoggedOut []string `json:"loggedOut"`
+			Active    string   `json:"active"`
+		}{append([]string{}, names...), accounts.Active})
+	}
+	if len(names) == 0 {
+		fmt.Println("Not logged in")
+		return 0
+	}
+	fmt.Printf("Logged out of %s\n", strings.Join(names, ", "))
+	if accounts.Active != "" {
+		fmt.Printf("Now using %s\n", accounts.Active)
+	}
+	return 0
+}
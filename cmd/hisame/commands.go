@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/config"
+	"github.com/StarTerrarium/hisame/internal/instance"
+	"github.com/sirupsen/logrus"
+)
+
+// usage lists the headless commands.
+const usage = `Usage: hisame [--read-only | --dry-run] <command>
+
+Commands:
+  list [--status watching] [--type anime|manga]   Show your lists
+  progress <media id|title> <+N|-N|N>             Change an entry's progress
+  search [--type anime|manga] <query>             Search AniList
+  status                                          Show the account, mode and pending edits
+  login [--token-stdin]                           Log in with the browser, or a pasted token
+  logout [--all] [account]                        Log out of the active or named account
+  export [--format json|csv|xml]                  Export your lists to a file
+  restore <backup.json>                           Restore your lists from a Hisame backup
+  import [--dry-run] [--yes] <file>               Import a MyAnimeList export
+
+Run with a hisame:// or AniList link instead of a command, the app opens on that page.
+
+list, progress, search, status, login and logout take --json for output to use in scripts.`
+
+// commands are the headless subcommands, each run with the arguments after its name.
+var commands = map[string]func(cfg *config.UserConfig, args []string) int{
+	"list":     runList,
+	"progress": runProgress,
+	"search":   runSearch,
+	"status":   runStatus,
+	"login":    runLogin,
+	"logout":   func(_ *config.UserConfig, args []string) int { return runLogout(args) },
+	"export":   runExport,
+	"restore":  runRestore,
+	"import":   runImport,
+}
+
+// runCommand runs a headless subcommand without starting the GUI, and returns the process exit code.
+func runCommand(cfg *config.UserConfig, args []string) int {
+	switch args[0] {
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return 0
+	}
+	run, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s\n", args[0], usage)
+		return 2
+	}
+
+	// Commands use the same lists, pending edits and audit log as the app, so they hold the single instance lock
+	// to never write them at the same time as it or another command.
+	running, code := lockCommand(args[0])
+	if running == nil && code >= 0 {
+		return code
+	}
+	if running != nil {
+		defer running.Release()
+	}
+
+	switch {
+	case cfg.ReadOnly:
+		logrus.Info("Read-only mode is on, so nothing will be changed on AniList")
+	case cfg.DryRun:
+		logrus.Info("Dry run: changes are recorded in the audit log but not sent to AniList")
+	}
+	return run(cfg, args[1:])
+}
+
+// lockCommand takes the single instance lock for a command.  When the app or another command holds it, the
+// command can't run and the exit code is returned.  A negative code means the command should run without the
+// lock, as it couldn't be taken for another reason.
+func lockCommand(command string) (*instance.Instance, int) {
+	dir, err := instance.DefaultDir()
+	if err != nil {
+		return nil, -1
+	}
+	running, err := instance.Acquire(dir)
+	if err == nil {
+		return running, 0
+	}
+	if errors.Is(err, instance.ErrRunning) {
+		fmt.Fprintf(os.Stderr, "Hisame is already running.  Close it to run %s, as commands use the same lists and pending edits.\n", command)
+		return nil, 1
+	}
+	logrus.Warnf("Unable to check for a running instance: %v", err)
+	return nil, -1
+}
+
+// signedNumber matches progress changes such as +1 and -2, which would otherwise be taken for flags.
+var signedNumber = regexp.MustCompile(`^[+-]?\d+$`)
+
+// parseArgs parses flags wherever they appear among the arguments, so they can be added to the end of a command
+// line, and returns the other arguments.  Everything after -- is an argument.
+func parseArgs(flags *flag.FlagSet, args []string) ([]string, error) {
+	var flagArgs, positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			positional = append(positional, args[i+1:]...)
+			i = len(args)
+		case signedNumber.MatchString(arg) || !strings.HasPrefix(arg, "-") || arg == "-":
+			positional = append(positional, arg)
+		default:
+			flagArgs = append(flagArgs, arg)
+			// A flag's value may be the next argument, unless it is a boolean flag or given with =.
+			name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+			if f := flags.Lookup(name); f != nil && !strings.Contains(arg, "=") && !isBoolFlag(f) && i+1 < len(args) {
+				i++
+				flagArgs = append(flagArgs, args[i])
+			}
+		}
+	}
+	if err := flags.Parse(flagArgs); err != nil {
+		return nil, err
+	}
+	return positional, nil
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// parseMediaType reads a --type flag.  An empty value means both lists.
+func parseMediaType(value string) (anilist.MediaType, error) {
+	mediaType := anilist.MediaType(strings.ToUpper(value))
+	if mediaType != "" && mediaType != anilist.MediaTypeAnime && mediaType != anilist.MediaTypeManga {
+		return "", fmt.Errorf("unknown list type %q.  Use anime or manga", value)
+	}
+	return mediaType, nil
+}
+
+// printJSON writes a command's result to standard output for scripts.
+func printJSON(value interface{}) int {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		return 1
+	}
+	return 0
+}
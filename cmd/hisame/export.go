@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/backup"
+	"github.com/StarTerrarium/hisame/internal/config"
+	"github.com/StarTerrarium/hisame/internal/store"
+)
+
+// runExport writes the active account's lists to a file, as a backup or for use in other programs.
+func runExport(cfg *config.UserConfig, args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", string(backup.FormatJSON), "File format: json (lossless backup), csv or xml (MyAnimeList)")
+	listType := flags.String("type", "", "Export only the anime or manga list.  Required for xml")
+	output := flags.String("o", "", "File to write, or - for standard output.  Defaults to a dated file name")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: hisame export [--format json|csv|xml] [--type anime|manga] [-o file]")
+		return 2
+	}
+
+	exportFormat := backup.Format(strings.ToLower(*format))
+	if !isFormat(exportFormat) {
+		fmt.Fprintf(os.Stderr, "Unknown format %q.  Use json, csv or xml.\n", *format)
+		return 2
+	}
+	mediaType := anilist.MediaType(strings.ToUpper(*listType))
+	if mediaType != "" && mediaType != anilist.MediaTypeAnime && mediaType != anilist.MediaTypeManga {
+		fmt.Fprintf(os.Stderr, "Unknown list type %q.  Use anime or manga.\n", *listType)
+		return 2
+	}
+	if exportFormat == backup.FormatMAL && mediaType == "" {
+		fmt.Fprintln(os.Stderr, "MyAnimeList exports hold a single list.  Add --type anime or --type manga.")
+		return 2
+	}
+
+	session, code := activeSession()
+	if session == nil {
+		return code
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	client := newClient(cfg, session)
+
+	viewer, err := client.Viewer(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error fetching account: %v\n", err)
+		return 1
+	}
+	b, err := backup.Create(ctx, viewer, func(ctx context.Context, mediaType anilist.MediaType) (*anilist.MediaListCollection, error) {
+		return client.MediaListCollection(ctx, session.UserID, mediaType)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error exporting: %v\n", err)
+		return 1
+	}
+
+	var buffer bytes.Buffer
+	if err := b.Export(&buffer, exportFormat, mediaType); err != nil {
+		fmt.Fprintf(os.Stderr, "Error exporting: %v\n", err)
+		return 1
+	}
+	path := *output
+	if path == "-" {
+		os.Stdout.Write(buffer.Bytes())
+		return 0
+	}
+	if path == "" {
+		path = backup.FileName(exportFormat, mediaType, time.Now())
+	}
+	if err := store.WriteFileAtomic(path, buffer.Bytes()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", path, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Exported to %s\n", path)
+	return 0
+}
+
+func isFormat(format backup.Format) bool {
+	for _, known := range backup.Formats {
+		if format == known {
+			return true
+		}
+	}
+	return false
+}
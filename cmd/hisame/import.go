@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/audit"
+	"github.com/StarTerrarium/hisame/internal/auth"
+	"github.com/StarTerrarium/hisame/internal/config"
+	"github.com/StarTerrarium/hisame/internal/mal"
+	"github.com/StarTerrarium/hisame/internal/store"
+)
+
+// runImport imports a MyAnimeList list export into the active account.  A preview of the changes is always
+// printed first, and nothing is written without confirmation.
+func runImport(cfg *config.UserConfig, args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "Only show what would change")
+	yes := flags.Bool("yes", false, "Don't ask for confirmation")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: hisame import [--dry-run] [--yes] <animelist.xml[.gz]>")
+		return 2
+	}
+	if cfg.ReadOnly && !*dryRun {
+		fmt.Fprintln(os.Stderr, "Read-only mode is on, so only showing what would change.")
+		*dryRun = true
+	}
+	path := flags.Arg(0)
+
+	export, err := mal.ParseFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+		return 1
+	}
+
+	session, code := activeSession()
+	if session == nil {
+		return code
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	client := newClient(cfg, session)
+
+	viewer, err := client.Viewer(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error fetching account settings: %v\n", err)
+		return 1
+	}
+	current, err := client.MediaListCollection(ctx, session.UserID, export.Type)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error fetching your %s list: %v\n", export.Type, err)
+		return 1
+	}
+	plan, err := mal.BuildPlan(ctx, client, export, current, viewer.MediaListOptions.ScoreFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error planning import: %v\n", err)
+		return 1
+	}
+	printPlan(plan)
+
+	if *dryRun || len(plan.Writes()) == 0 {
+		return 0
+	}
+	if !*yes && !confirm(fmt.Sprintf("Import %d entries?", len(plan.Writes()))) {
+		fmt.Fprintln(os.Stderr, "Nothing imported.")
+		return 1
+	}
+
+	checkpointPath := ""
+	if baseDir, err := store.DefaultDir(); err == nil {
+		checkpointPath, err = mal.CheckpointPath(filepath.Join(baseDir, "accounts", session.CacheKey()), path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Progress won't be resumable: %v\n", err)
+		}
+	}
+
+	result, err := mal.Apply(ctx, client, plan, checkpointPath, func(progress mal.Progress) {
+		fmt.Fprintf(os.Stderr, "\r[%d/%d] %s\033[K", progress.Done, progress.Total, progress.Current.Source.Title)
+	})
+	fmt.Fprintln(os.Stderr)
+	if result != nil {
+		fmt.Printf("Saved %d entries", len(result.Saved))
+		if result.Resumed > 0 {
+			fmt.Printf(", %d already saved by an earlier run", result.Resumed)
+		}
+		fmt.Println()
+		for _, failure := range result.Failed {
+			fmt.Printf("  FAILED  %d  %s: %v\n", failure.Source.MalID, failure.Source.Title, failure.Err)
+		}
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) || anilist.IsTemporary(err) {
+			fmt.Fprintf(os.Stderr, "%v\nRun the same command again to resume.\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error importing: %v\n", err)
+		}
+		return 1
+	}
+	if len(result.Failed) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// printPlan prints a preview of an import, listing the entries that need resolving by hand.
+func printPlan(plan *mal.Plan) {
+	fmt.Printf("%s import: %d to create, %d to update, %d unchanged, %d unmapped\n",
+		plan.Type, len(plan.Creates), len(plan.Updates), len(plan.Skips), len(plan.Unmapped))
+	for _, item := range plan.Creates {
+		fmt.Printf("  CREATE  %s (%s, %d)\n", item.Source.Title, item.Source.Status, item.Source.Progress)
+	}
+	for _, item := range plan.Updates {
+		fmt.Printf("  UPDATE  %s\n", item.Source.Title)
+		for _, diff := range item.Diffs {
+			fmt.Printf("            %s: %s -> %s\n", diff.Field, diff.Entry, diff.Input)
+		}
+	}
+	if len(plan.Unmapped) > 0 {
+		fmt.Println("These entries could not be matched and must be added by hand:")
+		for _, unmapped := range plan.Unmapped {
+			fmt.Printf("  %d  %s: %s\n", unmapped.Source.MalID, unmapped.Source.Title, unmapped.Reason)
+		}
+	}
+}
+
+// newClient creates a client for the session, recording every mutation it sends in the audit log.  Nothing is
+// sent in read-only or dry run mode.
+func newClient(cfg *config.UserConfig, session *auth.Session) *anilist.Client {
+	client := anilist.NewClient(session.Token)
+	client.SetMutationMode(mutationMode(cfg))
+	if path, err := audit.DefaultPath(); err == nil {
+		client.SetMutationHandler(audit.Recorder(audit.Open(path), session.Name(), session.UserID, nil))
+	}
+	return client
+}
+
+// mutationMode returns whether the config, with the global flags applied, lets changes be sent to AniList.
+func mutationMode(cfg *config.UserConfig) anilist.MutationMode {
+	switch {
+	case cfg.ReadOnly:
+		return anilist.MutationsReadOnly
+	case cfg.DryRun:
+		return anilist.MutationsDryRun
+	default:
+		return anilist.MutationsEnabled
+	}
+}
+
+// activeSession loads the session of the active account for a headless command.  When there isn't one the error
+// is printed and the exit code returned.
+func activeSession() (*auth.Session, int) {
+	session, err := loadActiveSession()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return nil, 1
+	}
+	if session == nil {
+		fmt.Fprintln(os.Stderr, "Not logged in.  Run hisame login, or log in from the app.")
+		return nil, 1
+	}
+	return session, 0
+}
+
+// loadActiveSession returns the session of the active account, or nil when not logged in.
+func loadActiveSession() (*auth.Session, error) {
+	_, accounts, err := loadAccounts()
+	if err != nil {
+		return nil, err
+	}
+	return accounts.ActiveSession(), nil
+}
+
+// loadAccounts opens the session store and loads the accounts saved in it.
+func loadAccounts() (*auth.SessionStore, *auth.Accounts, error) {
+	sessions, err := auth.NewSessionStore()
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't open session store: %w", err)
+	}
+	accounts, err := sessions.Load()
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't load saved accounts: %w", err)
+	}
+	return sessions, accounts, nil
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/auth"
+	"github.com/StarTerrarium/hisame/internal/config"
+)
+
+// commandTimeout bounds the requests made by the quick headless commands.
+const commandTimeout = time.Minute
+
+// statusMediaTypes are the statuses that only make sense for one media type, so imply it.
+var statusMediaTypes = map[string]anilist.MediaType{
+	"watching":   anilist.MediaTypeAnime,
+	"rewatching": anilist.MediaTypeAnime,
+	"reading":    anilist.MediaTypeManga,
+	"rereading":  anilist.MediaTypeManga,
+}
+
+// entryOutput is a list entry as written by --json.
+type entryOutput struct {
+	ID       int                     `json:"id"`
+	MediaID  int                     `json:"mediaId"`
+	Type     anilist.MediaType       `json:"type"`
+	Title    string                  `json:"title"`
+	Status   anilist.MediaListStatus `json:"status"`
+	Progress int                     `json:"progress"`
+	Total    *int                    `json:"total"`
+	Score    float64                 `json:"score"`
+	SiteURL  string                  `json:"siteUrl,omitempty"`
+}
+
+func newEntryOutput(mediaType anilist.MediaType, entry *anilist.MediaListEntry, titleLanguage string) entryOutput {
+	output := entryOutput{
+		ID:       entry.ID,
+		MediaID:  entry.MediaID,
+		Type:     mediaType,
+		Title:    entryTitle(entry, titleLanguage),
+		Status:   entry.Status,
+		Progress: entry.Progress,
+		Total:    entryTotal(entry),
+		Score:    entry.Score,
+	}
+	if entry.Media != nil {
+		output.SiteURL = entry.Media.SiteURL
+	}
+	return output
+}
+
+// entryTitle returns the title of the entry's media in the user's preferred language.
+func entryTitle(entry *anilist.MediaListEntry, titleLanguage string) string {
+	if entry.Media == nil {
+		return fmt.Sprintf("Media %d", entry.MediaID)
+	}
+	return entry.Media.Title.Preferred(titleLanguage)
+}
+
+// entryTotal returns the number of episodes or chapters of the entry's media, when known.
+func entryTotal(entry *anilist.MediaListEntry) *int {
+	if entry.Media == nil {
+		return nil
+	}
+	if entry.Media.Type == anilist.MediaTypeManga {
+		return entry.Media.Chapters
+	}
+	return entry.Media.Episodes
+}
+
+// formatProgress formats progress against the total, when known.
+func formatProgress(progress int, total *int) string {
+	if total == nil {
+		return fmt.Sprintf("%d/?", progress)
+	}
+	return fmt.Sprintf("%d/%d", progress, *total)
+}
+
+// listedEntry is an entry along with the list it is on.
+type listedEntry struct {
+	mediaType anilist.MediaType
+	entry     *anilist.MediaListEntry
+}
+
+// fetchEntries fetches every entry on the session's lists of the given type, or both lists when it is empty.
+func fetchEntries(ctx context.Context, client *anilist.Client, session *auth.Session, mediaType anilist.MediaType) ([]listedEntry, error) {
+	mediaTypes := []anilist.MediaType{anilist.MediaTypeAnime, anilist.MediaTypeManga}
+	if mediaType != "" {
+		mediaTypes = []anilist.MediaType{mediaType}
+	}
+	var entries []listedEntry
+	for _, mediaType := range mediaTypes {
+		collection, err := client.MediaListCollection(ctx, session.UserID, mediaType)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't fetch your %s list: %w", strings.ToLower(string(mediaType)), err)
+		}
+		for _, entry := range collection.Entries() {
+			entries = append(entries, listedEntry{mediaType: mediaType, entry: entry})
+		}
+	}
+	return entries, nil
+}
+
+// runList prints the active account's lists, optionally only the entries with one status.
+func runList(cfg *config.UserConfig, args []string) int {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	status := flags.String("status", "", "Only show entries with this status, such as watching, planning or completed")
+	listType := flags.String("type", "", "Only show the anime or manga list")
+	jsonOutput := flags.Bool("json", false, "Print JSON")
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: hisame list [--status watching] [--type anime|manga] [--json]")
+		return 2
+	}
+	mediaType, err := parseMediaType(*listType)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+	var wantStatus anilist.MediaListStatus
+	if *status != "" {
+		var ok bool
+		if wantStatus, ok = anilist.ParseMediaListStatus(*status); !ok {
+			fmt.Fprintf(os.Stderr, "Unknown status %q.  Use watching, reading, planning, completed, rewatching, paused or dropped.\n", *status)
+			return 2
+		}
+		if implied, ok := statusMediaTypes[strings.ToLower(*status)]; ok && mediaType == "" {
+			mediaType = implied
+		}
+	}
+
+	session, code := activeSession()
+	if session == nil {
+		return code
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	entries, err := fetchEntries(ctx, newClient(cfg, session), session, mediaType)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	titleLanguage := cfg.AnimeConfig.TitleLanguage
+	outputs := []entryOutput{}
+	for _, listed := range entries {
+		if wantStatus == "" || listed.entry.Status == wantStatus {
+			outputs = append(outputs, newEntryOutput(listed.mediaType, listed.entry, titleLanguage))
+		}
+	}
+	if *jsonOutput {
+		return printJSON(outputs)
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "MEDIA ID\tTYPE\tSTATUS\tPROGRESS\tSCORE\tTITLE")
+	for _, output := range outputs {
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%g\t%s\n", output.MediaID, strings.ToLower(string(output.Type)),
+			strings.ToLower(string(output.Status)), formatProgress(output.Progress, output.Total), output.Score, output.Title)
+	}
+	writer.Flush()
+	return 0
+}
+
+// runProgress changes the progress of an entry, found by media ID or title.  A leading + or - changes the progress
+// by that much, otherwise it is set.
+func runProgress(cfg *config.UserConfig, args []string) int {
+	flags := flag.NewFlagSet("progress", flag.ContinueOnError)
+	listType := flags.String("type", "", "Only look for the title on the anime or manga list")
+	jsonOutput := flags.Bool("json", false, "Print JSON")
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) < 2 || !signedNumber.MatchString(positional[len(positional)-1]) {
+		fmt.Fprintln(os.Stderr, "Usage: hisame progress [--type anime|manga] [--json] <media id|title> <+N|-N|N>")
+		return 2
+	}
+	mediaType, err := parseMediaType(*listType)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+	change := positional[len(positional)-1]
+	amount, _ := strconv.Atoi(strings.TrimPrefix(change, "+"))
+	query := strings.Join(positional[:len(positional)-1], " ")
+
+	session, code := activeSession()
+	if session == nil {
+		return code
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	client := newClient(cfg, session)
+	entries, err := fetchEntries(ctx, client, session, mediaType)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	titleLanguage := cfg.AnimeConfig.TitleLanguage
+	listed, err := findEntry(entries, query)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		var ambiguous *ambiguousEntryError
+		if errors.As(err, &ambiguous) {
+			for _, candidate := range ambiguous.candidates {
+				fmt.Fprintf(os.Stderr, "  %d  %s (%s)\n", candidate.entry.MediaID, entryTitle(candidate.entry, titleLanguage), strings.ToLower(string(candidate.entry.Status)))
+			}
+		}
+		return 1
+	}
+
+	entry := listed.entry
+	progress := amount
+	if strings.HasPrefix(change, "+") || strings.HasPrefix(change, "-") {
+		progress = entry.Progress + amount
+	}
+	progress = max(progress, 0)
+	if total := entryTotal(entry); total != nil && *total > 0 {
+		progress = min(progress, *total)
+	}
+
+	input := anilist.SaveMediaListEntryInput{MediaID: &entry.MediaID, Progress: &progress}
+	saved, err := client.SaveMediaListEntry(anilist.WithPreviousEntry(ctx, entry), input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving progress for %s: %v\n", entryTitle(entry, titleLanguage), err)
+		return 1
+	}
+	if saved.Media == nil {
+		saved.Media = entry.Media
+	}
+
+	if *jsonOutput {
+		return printJSON(newEntryOutput(listed.mediaType, saved, titleLanguage))
+	}
+	fmt.Printf("%s: %s → %s\n", entryTitle(saved, titleLanguage), formatProgress(entry.Progress, entryTotal(entry)),
+		formatProgress(saved.Progress, entryTotal(saved)))
+	return 0
+}
+
+// ambiguousEntryError is returned when a title matches more than one entry.
+type ambiguousEntryError struct {
+	query      string
+	candidates []listedEntry
+}
+
+func (e *ambiguousEntryError) Error() string {
+	return fmt.Sprintf("%q matches %d entries.  Use the media ID, or more of the title:", e.query, len(e.candidates))
+}
+
+// findEntry finds the entry for a media ID, or a title.  A title matching several entries is narrowed to the
+// exact match, then to the entries being watched or read.
+func findEntry(entries []listedEntry, query string) (listedEntry, error) {
+	if mediaID, err := strconv.Atoi(query); err == nil {
+		for _, listed := range entries {
+			if listed.entry.MediaID == mediaID {
+				return listed, nil
+			}
+		}
+		return listedEntry{}, fmt.Errorf("media %d isn't on your lists", mediaID)
+	}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	var exact, partial []listedEntry
+	for _, listed := range entries {
+		if listed.entry.Media == nil {
+			continue
+		}
+		title := listed.entry.Media.Title
+		for _, candidate := range []string{title.Romaji, title.English, title.Native, title.UserPreferred} {
+			candidate = strings.ToLower(candidate)
+			if candidate == "" || !strings.Contains(candidate, query) {
+				continue
+			}
+			if candidate == query {
+				exact = append(exact, listed)
+			} else {
+				partial = append(partial, listed)
+			}
+			break
+		}
+	}
+
+	for _, matches := range [][]listedEntry{exact, partial} {
+		if len(matches) == 1 {
+			return matches[0], nil
+		}
+		var active []listedEntry
+		for _, listed := range matches {
+			if listed.entry.Status == anilist.StatusCurrent || listed.entry.Status == anilist.StatusRepeating {
+				active = append(active, listed)
+			}
+		}
+		if len(active) == 1 {
+			return active[0], nil
+		}
+		if len(matches) > 1 {
+			return listedEntry{}, &ambiguousEntryError{query: query, candidates: matches}
+		}
+	}
+	return listedEntry{}, fmt.Errorf("nothing on your lists matches %q", query)
+}
+
+// searchOutput is a search result as written by --json.
+type searchOutput struct {
+	ID      int               `json:"id"`
+	IDMal   *int              `json:"idMal"`
+	Type    anilist.MediaType `json:"type"`
+	Format  string            `json:"format"`
+	Title   string            `json:"title"`
+	Total   *int              `json:"total"`
+	Status  string            `json:"status"`
+	SiteURL string            `json:"siteUrl"`
+}
+
+// runSearch searches AniList for anime and manga.  It works without logging in.
+func runSearch(cfg *config.UserConfig, args []string) int {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	listType := flags.String("type", "", "Only search for anime or manga")
+	limit := flags.Int("limit", 10, "The most results to show, up to 50")
+	jsonOutput := flags.Bool("json", false, "Print JSON")
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		return 2
+	}
+	query := strings.TrimSpace(strings.Join(positional, " "))
+	if query == "" {
+		fmt.Fprintln(os.Stderr, "Usage: hisame search [--type anime|manga] [--limit 10] [--json] <query>")
+		return 2
+	}
+	mediaType, err := parseMediaType(*listType)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+
+	client := anilist.NewClient("")
+	if session, _ := loadActiveSession(); session != nil {
+		client = newClient(cfg, session)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	results, err := client.SearchMedia(ctx, query, mediaType, min(max(*limit, 1), 50))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error searching AniList: %v\n", err)
+		return 1
+	}
+
+	titleLanguage := cfg.AnimeConfig.TitleLanguage
+	outputs := make([]searchOutput, len(results))
+	for i, media := range results {
+		outputs[i] = searchOutput{
+			ID:      media.ID,
+			IDMal:   media.IDMal,
+			Type:    media.Type,
+			Format:  media.Format,
+			Title:   media.Title.Preferred(titleLanguage),
+			Total:   entryTotal(&anilist.MediaListEntry{Media: media}),
+			Status:  media.Status,
+			SiteURL: media.SiteURL,
+		}
+	}
+	if *jsonOutput {
+		return printJSON(outputs)
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "MEDIA ID\tTYPE\tFORMAT\tLENGTH\tTITLE")
+	for _, output := range outputs {
+		length := "?"
+		if output.Total != nil {
+			length = strconv.Itoa(*output.Total)
+		}
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\n", output.ID, strings.ToLower(string(output.Type)), output.Format, length, output.Title)
+	}
+	writer.Flush()
+	return 0
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"time"
+
+	"github.com/StarTerrarium/hisame/internal/auth"
+	"github.com/StarTerrarium/hisame/internal/config"
+)
+
+// browserLoginTimeout is how long to wait for the user to log in with the browser.
+const browserLoginTimeout = 5 * time.Minute
+
+// accountOutput is an account as written by --json.
+type accountOutput struct {
+	Username  string     `json:"username"`
+	UserID    int        `json:"userId"`
+	Active    bool       `json:"active"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+func newAccountOutput(session *auth.Session, active bool) accountOutput {
+	output := accountOutput{Username: session.Username, UserID: session.UserID, Active: active}
+	if !session.ExpiresAt.IsZero() {
+		output.ExpiresAt = &session.ExpiresAt
+	}
+	return output
+}
+
+// runLogin logs in with the browser, as the app does, or with a token read from stdin.  The token is for
+// environments where the browser login can't reach the callback server, such as SSH sessions and containers.
+func runLogin(cfg *config.UserConfig, args []string) int {
+	flags := flag.NewFlagSet("login", flag.ContinueOnError)
+	tokenStdin := flags.Bool("token-stdin", false, "Read an access token, or the URL AniList redirected to, from standard input")
+	jsonOutput := flags.Bool("json", false, "Print JSON")
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: hisame login [--token-stdin] [--json]")
+		return 2
+	}
+
+	authInstance := auth.NewAuthFromConfig(cfg.AuthConfig)
+	var token string
+	if *tokenStdin {
+		token, err = readToken(authInstance)
+	} else {
+		token, err = browserLogin(authInstance)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error logging in: %v\n", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	session, err := auth.VerifyToken(ctx, token)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not verify the token with AniList: %v\n", err)
+		return 1
+	}
+
+	store, accounts, err := loadAccounts()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	// Add rather than replace, so logging in to an alt account keeps the main one logged in.
+	accounts.Add(session)
+	if err := store.Save(accounts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving session: %v\n", err)
+		return 1
+	}
+
+	if *jsonOutput {
+		return printJSON(newAccountOutput(session, true))
+	}
+	fmt.Printf("Logged in as %s\n", session.Username)
+	return 0
+}
+
+// readToken reads a token, or the URL AniList redirected to, from stdin.
+func readToken(authInstance *auth.Auth) (string, error) {
+	// Only prompt when a person is typing, so piping a token in stays quiet.
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprintf(os.Stderr, "Open %s in any browser, log in, then paste the token or the URL you were sent to: ", authInstance.LoginURL)
+	}
+	input, err := io.ReadAll(io.LimitReader(os.Stdin, 64*1024))
+	if err != nil {
+		return "", fmt.Errorf("couldn't read token: %w", err)
+	}
+	return auth.ParseTokenInput(string(input))
+}
+
+// browserLogin opens the AniList login page, and waits for the callback with the token.
+func browserLogin(authInstance *auth.Auth) (string, error) {
+	if err := authInstance.StartCallbackServer(); err != nil {
+		if errors.Is(err, auth.ErrNoCallbackPort) {
+			return "", fmt.Errorf("%w.  Use hisame login --token-stdin instead", err)
+		}
+		return "", err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, browserLoginTimeout)
+	defer cancel()
+
+	fmt.Fprintf(os.Stderr, "Continue in your browser.  If it didn't open, go to:\n  %s\n", authInstance.LoginURL)
+	openBrowser(authInstance.LoginURL.String())
+	return authInstance.WaitForToken(ctx)
+}
+
+// openBrowser opens a URL in the default browser, if there is one.  Failures are ignored, as the URL is also
+// printed.
+func openBrowser(url string) {
+	var command *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		command = exec.Command("open", url)
+	case "windows":
+		command = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		command = exec.Command("xdg-open", url)
+	}
+	if err := command.Start(); err == nil {
+		go command.Wait()
+	}
+}
@@ -1,27 +1,46 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
+	"github.com/StarTerrarium/hisame/internal/auth"
 	"github.com/StarTerrarium/hisame/internal/config"
+	"github.com/StarTerrarium/hisame/internal/instance"
+	"github.com/StarTerrarium/hisame/internal/links"
 	"github.com/StarTerrarium/hisame/internal/state"
 	"github.com/StarTerrarium/hisame/internal/ui"
 	"github.com/StarTerrarium/hisame/internal/utils"
 	"github.com/sirupsen/logrus"
+	"os"
 )
 
 func main() {
-	cleanupLogger := utils.InitLogger()
-	defer cleanupLogger()
+	args, flags := parseGlobalFlags(os.Args[1:])
+	// Deep links, such as those opened from a browser, are shown in the app rather than run as commands.  Commands
+	// take the single instance lock themselves.
+	if len(args) > 0 && !areLinks(args) {
+		// Headless commands keep stdout for their own output.
+		cleanupLogger := utils.InitLogger(os.Stderr)
+		code := runCommand(flags.apply(loadConfig()), args)
+		cleanupLogger()
+		os.Exit(code)
+	}
 
-	// Load user config from file
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		logrus.Warnf("Error loading config.  Will use default config. %v", err)
-		cfg = config.DefaultConfig()
+	// Check for a running instance before logging, so a second launch doesn't touch the log file.
+	running, code := acquireInstance(args)
+	if running == nil && code >= 0 {
+		os.Exit(code)
 	}
 
-	state.InitialiseAppState(cfg)
+	cleanupLogger := utils.InitLogger(os.Stdout)
+	defer cleanupLogger()
+
+	appState := state.InitialiseAppState(flags.apply(loadConfig()))
+	restoreSession(appState)
+	appState.StartBackups()
+	appState.StartControl()
 
 	logrus.Infof("App state initialised.  Log level: %s", logrus.GetLevel().String())
 
@@ -32,7 +51,132 @@ func main() {
 	w.Resize(fyne.NewSize(7680, 4320))
 
 	ui.InitialiseScreenManager(w)
+	if running != nil {
+		defer running.Release()
+		err := running.Serve(func(message instance.Message) error {
+			// Messages arrive on the socket's goroutine, so the pages are changed from the UI's.
+			return ui.RunOnUI(func() error {
+				ui.Activate()
+				return openLinks(message.Args)
+			})
+		})
+		if err != nil {
+			logrus.Warnf("Later launches won't be able to reach this one: %v", err)
+		}
+	} else {
+		logrus.Warn("Unable to take the single instance lock, so another instance may be running")
+	}
+	if err := openLinks(args); err != nil {
+		logrus.Errorf("Error opening link: %v", err)
+	}
+
+	// Pick up changes made on other devices when the user comes back to the app.
+	a.Lifecycle().SetOnEnteredForeground(func() {
+		if lib := appState.GetLibrary(); lib != nil {
+			lib.Syncer().SyncOnFocus()
+		}
+	})
 
 	logrus.Info("Starting GUI")
 	w.ShowAndRun()
 }
+
+// acquireInstance takes the single instance lock.  When Hisame is already running the arguments are forwarded to
+// it instead, and the exit code is returned.  A negative code means the app should start without the lock, as it
+// couldn't be taken for another reason.
+func acquireInstance(args []string) (*instance.Instance, int) {
+	dir, err := instance.DefaultDir()
+	if err != nil {
+		return nil, -1
+	}
+	running, err := instance.Acquire(dir)
+	if err == nil {
+		return running, 0
+	}
+	if !errors.Is(err, instance.ErrRunning) {
+		fmt.Fprintf(os.Stderr, "Unable to check for a running instance: %v\n", err)
+		return nil, -1
+	}
+
+	if err := instance.Forward(dir, instance.Message{Args: args}); err != nil {
+		fmt.Fprintf(os.Stderr, "Hisame is already running, but %v\n", err)
+		return nil, 1
+	}
+	fmt.Fprintln(os.Stderr, "Hisame is already running, so switched to it")
+	return nil, 0
+}
+
+// areLinks reports whether every argument is a hisame:// or AniList link.
+func areLinks(args []string) bool {
+	for _, arg := range args {
+		if !links.IsLink(arg) {
+			return false
+		}
+	}
+	return len(args) > 0
+}
+
+// openLinks shows the page for each link in turn, so the last is left showing.
+func openLinks(args []string) error {
+	for _, arg := range args {
+		if err := ui.OpenLink(arg); err != nil {
+			return fmt.Errorf("couldn't open %s: %w", arg, err)
+		}
+	}
+	return nil
+}
+
+// globalFlags are the flags given before any command, which apply to the app and every command.
+type globalFlags struct {
+	readOnly bool
+	dryRun   bool
+}
+
+// parseGlobalFlags takes the global flags from the start of args, returning the rest.
+func parseGlobalFlags(args []string) ([]string, globalFlags) {
+	var flags globalFlags
+	for ; len(args) > 0; args = args[1:] {
+		switch args[0] {
+		case "--read-only":
+			flags.readOnly = true
+		case "--dry-run":
+			flags.dryRun = true
+		default:
+			return args, flags
+		}
+	}
+	return args, flags
+}
+
+// apply overrides the config with the flags.
+func (f globalFlags) apply(cfg *config.UserConfig) *config.UserConfig {
+	cfg.ReadOnly = cfg.ReadOnly || f.readOnly
+	cfg.DryRun = cfg.DryRun || f.dryRun
+	return cfg
+}
+
+// loadConfig loads the user config from file, falling back to the default config.
+func loadConfig() *config.UserConfig {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logrus.Warnf("Error loading config.  Will use default config. %v", err)
+		cfg = config.DefaultConfig()
+	}
+	return cfg
+}
+
+// restoreSession loads the accounts saved by previous logins, so the user doesn't need to log in on every launch.
+func restoreSession(appState *state.AppState) {
+	store, err := auth.NewSessionStore()
+	if err != nil {
+		logrus.Warnf("Unable to open session store: %v", err)
+		return
+	}
+	if err := appState.LoadAccounts(store); err != nil {
+		logrus.Warnf("Error restoring saved accounts.  You will need to log in again. %v", err)
+		return
+	}
+	if session := appState.GetSession(); session != nil {
+		logrus.Infof("Restored session for %s", session.Username)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/backup"
+	"github.com/StarTerrarium/hisame/internal/config"
+	"github.com/StarTerrarium/hisame/internal/store"
+)
+
+// runRestore restores the active account's lists from a Hisame backup.  The differences are always printed
+// first, and nothing is written without confirmation.
+func runRestore(cfg *config.UserConfig, args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "Only show what differs from the backup")
+	missing := flags.Bool("missing", false, "Only add back entries that have been removed")
+	only := flags.String("only", "", "Only restore these entries, as a comma separated list of the keys shown, such as ANIME:1")
+	yes := flags.Bool("yes", false, "Don't ask for confirmation")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 || (*missing && *only != "") {
+		fmt.Fprintln(os.Stderr, "Usage: hisame restore [--dry-run] [--missing | --only KEY,...] [--yes] <backup.json>")
+		return 2
+	}
+	if cfg.ReadOnly && !*dryRun {
+		fmt.Fprintln(os.Stderr, "Read-only mode is on, so only showing what differs.")
+		*dryRun = true
+	}
+	path := flags.Arg(0)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+		return 1
+	}
+	b, err := backup.Decode(data, cfg.BackupPassphrase())
+	if errors.Is(err, backup.ErrPassphraseRequired) || errors.Is(err, backup.ErrWrongPassphrase) {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v.  Set HISAME_BACKUP_PASSPHRASE to the passphrase it was encrypted with.\n", path, err)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+		return 1
+	}
+	session, code := activeSession()
+	if session == nil {
+		return code
+	}
+	if b.UserID != 0 && b.UserID != session.UserID {
+		fmt.Fprintf(os.Stderr, "Warning: this backup is of %s's lists, and will be restored to %s's.\n", b.Username, session.Username)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	client := newClient(cfg, session)
+
+	viewer, err := client.Viewer(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error fetching account settings: %v\n", err)
+		return 1
+	}
+	current := map[anilist.MediaType]*anilist.MediaListCollection{}
+	for mediaType := range b.Lists {
+		if current[mediaType], err = client.MediaListCollection(ctx, session.UserID, mediaType); err != nil {
+			fmt.Fprintf(os.Stderr, "Error fetching your %s list: %v\n", mediaType, err)
+			return 1
+		}
+	}
+
+	mode, selected := backup.RestoreAll, map[string]bool{}
+	switch {
+	case *missing:
+		mode = backup.RestoreMissing
+	case *only != "":
+		mode = backup.RestoreSelected
+		for _, key := range strings.Split(*only, ",") {
+			selected[strings.ToUpper(strings.TrimSpace(key))] = true
+		}
+	}
+	changes := backup.Compare(b, current)
+	chosen := backup.Select(changes, mode, selected)
+	printChanges(changes, chosen, cfg.AnimeConfig.TitleLanguage)
+
+	if *dryRun || len(chosen) == 0 {
+		return 0
+	}
+	if !*yes && !confirm(fmt.Sprintf("Restore %d entries?", len(chosen))) {
+		fmt.Fprintln(os.Stderr, "Nothing restored.")
+		return 1
+	}
+
+	checkpointPath := ""
+	if baseDir, err := store.DefaultDir(); err == nil {
+		checkpointPath = backup.CheckpointPath(filepath.Join(baseDir, "accounts", session.CacheKey()), data)
+	}
+	result, err := backup.Restore(ctx, client, chosen, viewer.AdvancedScoring, checkpointPath, func(progress backup.RestoreProgress) {
+		fmt.Fprintf(os.Stderr, "\r[%d/%d] %s\033[K", progress.Done, progress.Total, progress.Current.Title(cfg.AnimeConfig.TitleLanguage))
+	})
+	fmt.Fprintln(os.Stderr)
+	if result != nil {
+		fmt.Printf("Restored %d entries", result.Applied)
+		if result.Resumed > 0 {
+			fmt.Printf(", %d already restored by an earlier run", result.Resumed)
+		}
+		fmt.Println()
+		for _, failure := range result.Failed {
+			fmt.Printf("  FAILED  %s: %v\n", failure.Change.Key(), failure.Err)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\nRun the same command again to resume.\n", err)
+		return 1
+	}
+	if len(result.Failed) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// printChanges lists how the current lists differ from a backup, marking the changes that will be restored.
+func printChanges(changes, chosen []*backup.Change, titleLanguage string) {
+	if len(changes) == 0 {
+		fmt.Println("Your lists match the backup.")
+		return
+	}
+	restoring := map[string]bool{}
+	for _, change := range chosen {
+		restoring[change.Key()] = true
+	}
+	fmt.Printf("%d entries differ from the backup; %d will be restored:\n", len(changes), len(chosen))
+	for _, change := range changes {
+		mark := " "
+		if restoring[change.Key()] {
+			mark = "*"
+		}
+		fmt.Printf("%s %-8s  %-13s  %s\n", mark, change.Kind, change.Key(), change.Title(titleLanguage))
+		for _, diff := range change.Diffs {
+			fmt.Printf("              %s: %s -> %s\n", diff.Field, diff.Entry, diff.Input)
+		}
+	}
+}
+
+// confirm asks a yes or no question on the terminal.  Without a terminal the answer is no.
+func confirm(question string) bool {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		fmt.Fprintln(os.Stderr, "Add --yes to confirm without a terminal.")
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
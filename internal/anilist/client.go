@@ -0,0 +1,205 @@
+package anilist
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const defaultEndpoint = "https://graphql.anilist.co"
+
+// ErrSessionExpired is matched by API errors caused by an expired or revoked token.
+var ErrSessionExpired = errors.New("AniList session expired")
+
+// Client is a minimal AniList GraphQL API client.
+type Client struct {
+	endpoint   string
+	token      string
+	httpClient *http.Client
+	limiter    *rateLimiter
+
+	onSessionExpired func(error)
+	onMutation       func(MutationRecord)
+	mode             atomic.Int32
+}
+
+// NewClient creates a client for the AniList API authenticated with the given access token.  An empty token
+// creates an anonymous client.
+func NewClient(token string) *Client {
+	return NewClientWithEndpoint(defaultEndpoint, token)
+}
+
+// NewClientWithEndpoint creates a client against a custom GraphQL endpoint.  Mostly useful for tests.
+func NewClientWithEndpoint(endpoint, token string) *Client {
+	return &Client{
+		endpoint:   endpoint,
+		token:      token,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		limiter:    newRateLimiter(),
+	}
+}
+
+// GraphQLError is a single error entry returned in a GraphQL response.
+type GraphQLError struct {
+	Message string `json:"message"`
+	Status  int    `json:"status"`
+}
+
+// APIError is returned when the API responds with a non 200 status, or with errors in the response body.
+type APIError struct {
+	StatusCode int
+	Errors     []GraphQLError
+}
+
+func (e *APIError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, gqlErr := range e.Errors {
+		messages = append(messages, gqlErr.Message)
+	}
+	return fmt.Sprintf("AniList API error (status %d): %s", e.StatusCode, strings.Join(messages, "; "))
+}
+
+// Is makes errors.Is(err, ErrSessionExpired) true for errors caused by the token no longer being accepted.
+func (e *APIError) Is(target error) bool {
+	return target == ErrSessionExpired && e.sessionExpired()
+}
+
+func (e *APIError) sessionExpired() bool {
+	if e.StatusCode == http.StatusUnauthorized {
+		return true
+	}
+	for _, gqlErr := range e.Errors {
+		if gqlErr.Status == http.StatusUnauthorized || strings.EqualFold(gqlErr.Message, "Invalid token") {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOffline reports whether err means AniList could not be reached at all, as opposed to AniList responding with
+// an error.
+func IsOffline(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		// Cloudflare sits in front of AniList, so it being down shows up as a gateway error.
+		return apiErr.StatusCode == http.StatusBadGateway || apiErr.StatusCode == http.StatusServiceUnavailable ||
+			apiErr.StatusCode == http.StatusGatewayTimeout
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// IsTemporary reports whether a request that failed with err may succeed if retried later: AniList couldn't be
+// reached or the connection dropped, it is overloaded or rate limiting, or the user needs to log in again.  Errors
+// AniList returns for a bad request, and responses that couldn't be understood, are not temporary.
+func IsTemporary(err error) bool {
+	if err == nil {
+		return false
+	}
+	if IsOffline(err) || errors.Is(err, ErrSessionExpired) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	return false
+}
+
+// SetSessionExpiredHandler registers a function called whenever a request fails because the token has expired or
+// been revoked.  The error is still returned to the caller as usual.
+func (c *Client) SetSessionExpiredHandler(handler func(error)) {
+	c.onSessionExpired = handler
+}
+
+// Query executes a GraphQL query or mutation, decoding the "data" field of the response into out.
+func (c *Client) Query(ctx context.Context, query string, variables map[string]interface{}, out interface{}) error {
+	err := c.query(ctx, query, variables, out)
+	if err != nil && c.onSessionExpired != nil && errors.Is(err, ErrSessionExpired) {
+		logrus.Warnf("AniList rejected the session token: %v", err)
+		c.onSessionExpired(err)
+	}
+	return err
+}
+
+func (c *Client) query(ctx context.Context, query string, variables map[string]interface{}, out interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode query: %w", err)
+	}
+
+	logrus.Tracef("Sending AniList query: %s", query)
+	resp, err := c.send(ctx, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var data struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []GraphQLError  `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return &APIError{StatusCode: resp.StatusCode}
+		}
+		return fmt.Errorf("failed to decode AniList response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || len(data.Errors) > 0 {
+		return &APIError{StatusCode: resp.StatusCode, Errors: data.Errors}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data.Data, out); err != nil {
+		return fmt.Errorf("failed to decode AniList response data: %w", err)
+	}
+	return nil
+}
+
+// send posts a request body to the API, waiting for the rate limit and retrying requests that hit it.
+func (c *Client) send(ctx context.Context, body []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("AniList request failed: %w", err)
+		}
+		retryAfter, limited := c.limiter.update(resp)
+		if !limited || attempt >= maxRateLimitRetries {
+			return resp, nil
+		}
+		resp.Body.Close()
+		logrus.Warnf("AniList rate limit reached, retrying in %s", retryAfter)
+	}
+}
@@ -0,0 +1,219 @@
+package anilist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// newFakeAPI starts a server that responds to every request using handler, after checking the request is a
+// well formed GraphQL POST.
+func newFakeAPI(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, query string)) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Expected POST request, got %s", r.Method)
+		}
+		var body struct {
+			Query string `json:"query"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		handler(w, r, body.Query)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestViewer(t *testing.T) {
+	ts := newFakeAPI(t, func(w http.ResponseWriter, r *http.Request, query string) {
+		if r.Header.Get("Authorization") != "Bearer test_token" {
+			t.Errorf("Expected bearer token header, got '%s'", r.Header.Get("Authorization"))
+		}
+		w.Write([]byte(`{"data":{"Viewer":{"id":42,"name":"Hisame","avatar":{"large":"https://example.com/l.png","medium":"https://example.com/m.png"}}}}`))
+	})
+
+	viewer, err := NewClientWithEndpoint(ts.URL, "test_token").Viewer(context.Background())
+	if err != nil {
+		t.Fatalf("Expected Viewer to succeed, got %v", err)
+	}
+	if viewer.ID != 42 || viewer.Name != "Hisame" {
+		t.Fatalf("Unexpected viewer %+v", viewer)
+	}
+	if viewer.Avatar.Medium != "https://example.com/m.png" {
+		t.Fatalf("Unexpected avatar %+v", viewer.Avatar)
+	}
+}
+
+func TestQuery_GraphQLErrors(t *testing.T) {
+	ts := newFakeAPI(t, func(w http.ResponseWriter, r *http.Request, query string) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"data":null,"errors":[{"message":"Bad query","status":400}]}`))
+	})
+
+	err := NewClientWithEndpoint(ts.URL, "").Query(context.Background(), "query { nope }", nil, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest || len(apiErr.Errors) != 1 || apiErr.Errors[0].Message != "Bad query" {
+		t.Fatalf("Unexpected APIError %+v", apiErr)
+	}
+}
+
+func TestQuery_NonJSONErrorResponse(t *testing.T) {
+	ts := newFakeAPI(t, func(w http.ResponseWriter, r *http.Request, query string) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("<html>oops</html>"))
+	})
+
+	err := NewClientWithEndpoint(ts.URL, "").Query(context.Background(), "query { Viewer { id } }", nil, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("Expected APIError with status 500, got %v", err)
+	}
+}
+
+func TestQuery_SessionExpired(t *testing.T) {
+	testCases := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"Unauthorized", http.StatusUnauthorized, `{"data":null,"errors":[{"message":"Unauthorized.","status":401}]}`},
+		{"InvalidToken", http.StatusBadRequest, `{"data":null,"errors":[{"message":"Invalid token","status":400}]}`},
+		{"UnauthorizedNoBody", http.StatusUnauthorized, ``},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newFakeAPI(t, func(w http.ResponseWriter, r *http.Request, query string) {
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			})
+
+			var handled error
+			client := NewClientWithEndpoint(ts.URL, "expired_token")
+			client.SetSessionExpiredHandler(func(err error) {
+				handled = err
+			})
+
+			_, err := client.Viewer(context.Background())
+			if !errors.Is(err, ErrSessionExpired) {
+				t.Fatalf("Expected ErrSessionExpired, got %v", err)
+			}
+			if handled == nil {
+				t.Fatal("Expected session expired handler to be called")
+			}
+		})
+	}
+}
+
+func TestQuery_OtherErrorsAreNotSessionExpiry(t *testing.T) {
+	ts := newFakeAPI(t, func(w http.ResponseWriter, r *http.Request, query string) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"data":null,"errors":[{"message":"Not Found.","status":404}]}`))
+	})
+
+	client := NewClientWithEndpoint(ts.URL, "token")
+	client.SetSessionExpiredHandler(func(err error) {
+		t.Fatalf("Did not expect session expired handler to be called for %v", err)
+	})
+	if err := client.Query(context.Background(), "query { Media(id: 1) { id } }", nil, nil); errors.Is(err, ErrSessionExpired) {
+		t.Fatalf("Did not expect ErrSessionExpired for a 404, got %v", err)
+	}
+}
+
+func TestIsOffline(t *testing.T) {
+	// Nothing is listening on a closed server's address
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+	err := NewClientWithEndpoint(ts.URL, "").Query(context.Background(), "query { Viewer { id } }", nil, nil)
+	if !IsOffline(err) {
+		t.Errorf("Expected connection refused to be offline, got %v", err)
+	}
+
+	if !IsOffline(&APIError{StatusCode: http.StatusServiceUnavailable}) {
+		t.Error("Expected 503 to be offline")
+	}
+	if IsOffline(&APIError{StatusCode: http.StatusBadRequest}) {
+		t.Error("Did not expect 400 to be offline")
+	}
+	if IsOffline(nil) {
+		t.Error("Did not expect nil to be offline")
+	}
+}
+
+func TestIsTemporary(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"nil", nil, false},
+		{"rate limited", &APIError{StatusCode: http.StatusTooManyRequests}, true},
+		{"server error", &APIError{StatusCode: http.StatusInternalServerError}, true},
+		{"session expired", &APIError{StatusCode: http.StatusUnauthorized}, true},
+		{"bad request", &APIError{StatusCode: http.StatusBadRequest}, false},
+		{"validation", &APIError{StatusCode: http.StatusNotFound}, false},
+		{"timeout", context.DeadlineExceeded, true},
+		{"network", &url.Error{Op: "Post", URL: defaultEndpoint, Err: errors.New("connection refused")}, true},
+		{"dropped connection", fmt.Errorf("failed to decode AniList response: %w", io.ErrUnexpectedEOF), true},
+		{"bad response", fmt.Errorf("failed to decode AniList response: %w", errors.New("invalid character")), false},
+		{"not deleted", errors.New("AniList did not delete entry 1"), false},
+	}
+
+	for _, tt := range tests {
+		if got := IsTemporary(tt.err); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestSearchMedia(t *testing.T) {
+	ts := newFakeAPI(t, func(w http.ResponseWriter, r *http.Request, query string) {
+		w.Write([]byte(`{"data":{"Page":{"media":[{"id":21,"type":"ANIME","title":{"romaji":"One Piece"}},{"id":30013,"type":"MANGA","title":{"romaji":"One Piece"}}]}}}`))
+	})
+
+	media, err := NewClientWithEndpoint(ts.URL, "token").SearchMedia(context.Background(), "one piece", "", 10)
+	if err != nil {
+		t.Fatalf("Expected search to succeed, got %v", err)
+	}
+	if len(media) != 2 || media[0].ID != 21 || media[1].Type != MediaTypeManga {
+		t.Fatalf("Unexpected results %+v", media)
+	}
+}
+
+func TestUser(t *testing.T) {
+	ts := newFakeAPI(t, func(w http.ResponseWriter, r *http.Request, query string) {
+		w.Write([]byte(`{"data":{"User":{"id":1,"name":"Josh","statistics":{"anime":{"count":12,"episodesWatched":300},"manga":{"count":3,"chaptersRead":90}}}}}`))
+	})
+
+	user, err := NewClientWithEndpoint(ts.URL, "").User(context.Background(), "Josh")
+	if err != nil {
+		t.Fatalf("Expected user lookup to succeed, got %v", err)
+	}
+	if user.ID != 1 || user.Statistics.Anime.EpisodesWatched != 300 || user.Statistics.Manga.ChaptersRead != 90 {
+		t.Fatalf("Unexpected user %+v", user)
+	}
+}
+
+func TestUser_NotFound(t *testing.T) {
+	ts := newFakeAPI(t, func(w http.ResponseWriter, r *http.Request, query string) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"data":{"User":null},"errors":[{"message":"Not Found.","status":404}]}`))
+	})
+
+	_, err := NewClientWithEndpoint(ts.URL, "").User(context.Background(), "nobody")
+	if !IsNotFound(err) {
+		t.Fatalf("Expected a not found error, got %v", err)
+	}
+}
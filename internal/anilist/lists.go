@@ -0,0 +1,214 @@
+package anilist
+
+import "context"
+
+// mediaFields are the fields fetched for every media, used by the list and media queries.
+const mediaFields = `
+    id
+    idMal
+    type
+    format
+    status
+    episodes
+    chapters
+    volumes
+    title {
+      romaji
+      english
+      native
+      userPreferred
+    }
+    coverImage {
+      extraLarge
+      large
+      medium
+    }
+    bannerImage
+    siteUrl
+    averageScore
+    genres
+    updatedAt`
+
+// entryFields are the fields fetched for every list entry.
+const entryFields = `
+    id
+    mediaId
+    status
+    score
+    progress
+    progressVolumes
+    repeat
+    priority
+    private
+    hiddenFromStatusLists
+    notes
+    customLists(asArray: false)
+    advancedScores
+    startedAt { year month day }
+    completedAt { year month day }
+    updatedAt
+    createdAt`
+
+const mediaListCollectionQuery = `query ($userId: Int, $type: MediaType) {
+  MediaListCollection(userId: $userId, type: $type) {
+    hasNextChunk
+    lists {
+      name
+      isCustomList
+      isSplitCompletedList
+      status
+      entries {` + entryFields + `
+        media {` + mediaFields + `
+        }
+      }
+    }
+  }
+}`
+
+const mediaQuery = `query ($id: Int) {
+  Media(id: $id) {` + mediaFields + `
+  }
+}`
+
+// MediaListCollection fetches all of a user's lists of the given media type.
+func (c *Client) MediaListCollection(ctx context.Context, userID int, mediaType MediaType) (*MediaListCollection, error) {
+	var data struct {
+		MediaListCollection *MediaListCollection `json:"MediaListCollection"`
+	}
+	variables := map[string]interface{}{"userId": userID, "type": mediaType}
+	if err := c.Query(ctx, mediaListCollectionQuery, variables, &data); err != nil {
+		return nil, err
+	}
+	return data.MediaListCollection, nil
+}
+
+// Media fetches a single anime or manga by its AniList ID.
+func (c *Client) Media(ctx context.Context, id int) (*Media, error) {
+	var data struct {
+		Media *Media `json:"Media"`
+	}
+	if err := c.Query(ctx, mediaQuery, map[string]interface{}{"id": id}, &data); err != nil {
+		return nil, err
+	}
+	return data.Media, nil
+}
+
+const updatedEntriesQuery = `query ($userId: Int, $type: MediaType, $page: Int, $perPage: Int) {
+  Page(page: $page, perPage: $perPage) {
+    pageInfo {
+      hasNextPage
+    }
+    mediaList(userId: $userId, type: $type, sort: UPDATED_TIME_DESC) {` + entryFields + `
+      media {` + mediaFields + `
+      }
+    }
+  }
+}`
+
+const mediaListIDsQuery = `query ($userId: Int, $type: MediaType) {
+  MediaListCollection(userId: $userId, type: $type) {
+    lists {
+      entries {
+        id
+        mediaId
+      }
+    }
+  }
+}`
+
+// UpdatedMediaListEntries fetches one page of a user's list entries, most recently updated first.
+func (c *Client) UpdatedMediaListEntries(ctx context.Context, userID int, mediaType MediaType, page, perPage int) ([]*MediaListEntry, bool, error) {
+	var data struct {
+		Page struct {
+			PageInfo struct {
+				HasNextPage bool `json:"hasNextPage"`
+			} `json:"pageInfo"`
+			MediaList []*MediaListEntry `json:"mediaList"`
+		} `json:"Page"`
+	}
+	variables := map[string]interface{}{"userId": userID, "type": mediaType, "page": page, "perPage": perPage}
+	if err := c.Query(ctx, updatedEntriesQuery, variables, &data); err != nil {
+		return nil, false, err
+	}
+	return data.Page.MediaList, data.Page.PageInfo.HasNextPage, nil
+}
+
+// MediaListIDs fetches the media IDs of every entry on a user's lists.  It is far cheaper than fetching the full
+// collection, and is used to notice entries deleted elsewhere.
+func (c *Client) MediaListIDs(ctx context.Context, userID int, mediaType MediaType) (map[int]bool, error) {
+	var data struct {
+		MediaListCollection *MediaListCollection `json:"MediaListCollection"`
+	}
+	variables := map[string]interface{}{"userId": userID, "type": mediaType}
+	if err := c.Query(ctx, mediaListIDsQuery, variables, &data); err != nil {
+		return nil, err
+	}
+	ids := map[int]bool{}
+	if data.MediaListCollection != nil {
+		for _, entry := range data.MediaListCollection.Entries() {
+			ids[entry.MediaID] = true
+		}
+	}
+	return ids, nil
+}
+
+const mediaByMalIDsQuery = `query ($ids: [Int], $type: MediaType, $perPage: Int) {
+  Page(perPage: $perPage) {
+    media(idMal_in: $ids, type: $type) {` + mediaFields + `
+    }
+  }
+}`
+
+// malIDBatchSize is the number of MyAnimeList IDs looked up per request.  It is the most AniList returns per page.
+const malIDBatchSize = 50
+
+// MediaByMalIDs looks up AniList media by their MyAnimeList IDs, keyed by MyAnimeList ID.  IDs AniList doesn't
+// know are missing from the result.
+func (c *Client) MediaByMalIDs(ctx context.Context, mediaType MediaType, malIDs []int) (map[int]*Media, error) {
+	found := map[int]*Media{}
+	for start := 0; start < len(malIDs); start += malIDBatchSize {
+		end := start + malIDBatchSize
+		if end > len(malIDs) {
+			end = len(malIDs)
+		}
+		var data struct {
+			Page struct {
+				Media []*Media `json:"media"`
+			} `json:"Page"`
+		}
+		variables := map[string]interface{}{"ids": malIDs[start:end], "type": mediaType, "perPage": malIDBatchSize}
+		if err := c.Query(ctx, mediaByMalIDsQuery, variables, &data); err != nil {
+			return nil, err
+		}
+		for _, media := range data.Page.Media {
+			if media.IDMal != nil {
+				found[*media.IDMal] = media
+			}
+		}
+	}
+	return found, nil
+}
+
+const searchMediaQuery = `query ($search: String, $type: MediaType, $perPage: Int) {
+  Page(perPage: $perPage) {
+    media(search: $search, type: $type, sort: SEARCH_MATCH) {` + mediaFields + `
+    }
+  }
+}`
+
+// SearchMedia searches AniList for anime or manga by title, best match first.  An empty media type searches both.
+func (c *Client) SearchMedia(ctx context.Context, search string, mediaType MediaType, perPage int) ([]*Media, error) {
+	var data struct {
+		Page struct {
+			Media []*Media `json:"media"`
+		} `json:"Page"`
+	}
+	variables := map[string]interface{}{"search": search, "perPage": perPage}
+	if mediaType != "" {
+		variables["type"] = mediaType
+	}
+	if err := c.Query(ctx, searchMediaQuery, variables, &data); err != nil {
+		return nil, err
+	}
+	return data.Page.Media, nil
+}
@@ -0,0 +1,180 @@
+package anilist
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MediaType is either anime or manga.
+type MediaType string
+
+const (
+	MediaTypeAnime MediaType = "ANIME"
+	MediaTypeManga MediaType = "MANGA"
+)
+
+// MediaListStatus is the status of an entry on a user's list.
+type MediaListStatus string
+
+const (
+	StatusCurrent   MediaListStatus = "CURRENT"
+	StatusPlanning  MediaListStatus = "PLANNING"
+	StatusCompleted MediaListStatus = "COMPLETED"
+	StatusDropped   MediaListStatus = "DROPPED"
+	StatusPaused    MediaListStatus = "PAUSED"
+	StatusRepeating MediaListStatus = "REPEATING"
+)
+
+// statusNames are the words accepted for each list status: AniList's own names, and the names the site shows.
+var statusNames = map[string]MediaListStatus{
+	"current":    StatusCurrent,
+	"watching":   StatusCurrent,
+	"reading":    StatusCurrent,
+	"planning":   StatusPlanning,
+	"completed":  StatusCompleted,
+	"repeating":  StatusRepeating,
+	"rewatching": StatusRepeating,
+	"rereading":  StatusRepeating,
+	"paused":     StatusPaused,
+	"dropped":    StatusDropped,
+}
+
+// ParseMediaListStatus reads a list status given by the user, such as "watching" or "COMPLETED", ignoring case.
+func ParseMediaListStatus(name string) (MediaListStatus, bool) {
+	status, ok := statusNames[strings.ToLower(strings.TrimSpace(name))]
+	return status, ok
+}
+
+// FuzzyDate is a date where any part may be unknown.
+type FuzzyDate struct {
+	Year  *int `json:"year"`
+	Month *int `json:"month"`
+	Day   *int `json:"day"`
+}
+
+// IsZero reports whether no part of the date is known.
+func (d FuzzyDate) IsZero() bool {
+	return d.Year == nil && d.Month == nil && d.Day == nil
+}
+
+// String formats the date as YYYY-MM-DD, using zeroes for unknown parts.  A completely unknown date is empty.
+func (d FuzzyDate) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	part := func(p *int) int {
+		if p == nil {
+			return 0
+		}
+		return *p
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", part(d.Year), part(d.Month), part(d.Day))
+}
+
+// MediaTitle holds the titles of a media in each language AniList provides.
+type MediaTitle struct {
+	Romaji        string `json:"romaji"`
+	English       string `json:"english"`
+	Native        string `json:"native"`
+	UserPreferred string `json:"userPreferred"`
+}
+
+// Preferred returns the title in the given language ("english", "romaji" or "native"), falling back to the other
+// languages when AniList doesn't have a title in that language.
+func (t MediaTitle) Preferred(language string) string {
+	var candidates []string
+	switch strings.ToLower(language) {
+	case "native":
+		candidates = []string{t.Native, t.Romaji, t.English}
+	case "romaji":
+		candidates = []string{t.Romaji, t.English, t.Native}
+	default:
+		candidates = []string{t.English, t.Romaji, t.Native}
+	}
+	for _, title := range append(candidates, t.UserPreferred) {
+		if title != "" {
+			return title
+		}
+	}
+	return ""
+}
+
+// MediaCoverImage holds the cover image URLs of a media.
+type MediaCoverImage struct {
+	ExtraLarge string `json:"extraLarge"`
+	Large      string `json:"large"`
+	Medium     string `json:"medium"`
+}
+
+// Media is an anime or manga.
+type Media struct {
+	ID           int             `json:"id"`
+	IDMal        *int            `json:"idMal"`
+	Type         MediaType       `json:"type"`
+	Format       string          `json:"format"`
+	Status       string          `json:"status"`
+	Episodes     *int            `json:"episodes"`
+	Chapters     *int            `json:"chapters"`
+	Volumes      *int            `json:"volumes"`
+	Title        MediaTitle      `json:"title"`
+	CoverImage   MediaCoverImage `json:"coverImage"`
+	BannerImage  string          `json:"bannerImage"`
+	SiteURL      string          `json:"siteUrl"`
+	AverageScore *int            `json:"averageScore"`
+	Genres       []string        `json:"genres"`
+	UpdatedAt    int64           `json:"updatedAt"`
+}
+
+// MediaListEntry is an entry on a user's anime or manga list.
+type MediaListEntry struct {
+	ID                    int                `json:"id"`
+	MediaID               int                `json:"mediaId"`
+	Status                MediaListStatus    `json:"status"`
+	Score                 float64            `json:"score"`
+	Progress              int                `json:"progress"`
+	ProgressVolumes       int                `json:"progressVolumes"`
+	Repeat                int                `json:"repeat"`
+	Priority              int                `json:"priority"`
+	Private               bool               `json:"private"`
+	HiddenFromStatusLists bool               `json:"hiddenFromStatusLists"`
+	Notes                 string             `json:"notes"`
+	CustomLists           map[string]bool    `json:"customLists"`
+	AdvancedScores        map[string]float64 `json:"advancedScores"`
+	StartedAt             FuzzyDate          `json:"startedAt"`
+	CompletedAt           FuzzyDate          `json:"completedAt"`
+	UpdatedAt             int64              `json:"updatedAt"`
+	CreatedAt             int64              `json:"createdAt"`
+	Media                 *Media             `json:"media"`
+}
+
+// MediaListGroup is one list within a collection, either a status list or a custom list.
+type MediaListGroup struct {
+	Name                 string            `json:"name"`
+	IsCustomList         bool              `json:"isCustomList"`
+	IsSplitCompletedList bool              `json:"isSplitCompletedList"`
+	Status               MediaListStatus   `json:"status"`
+	Entries              []*MediaListEntry `json:"entries"`
+}
+
+// MediaListCollection is all of a user's lists for one media type.
+type MediaListCollection struct {
+	Lists        []*MediaListGroup `json:"lists"`
+	HasNextChunk bool              `json:"hasNextChunk"`
+}
+
+// Entries returns every entry in the collection once.  Entries appear in several lists when they are also on
+// custom lists, so they are deduplicated by ID.
+func (c *MediaListCollection) Entries() []*MediaListEntry {
+	seen := map[int]bool{}
+	var entries []*MediaListEntry
+	for _, list := range c.Lists {
+		for _, entry := range list.Entries {
+			if seen[entry.ID] {
+				continue
+			}
+			seen[entry.ID] = true
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,126 @@
+package anilist
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestMediaTitlePreferred(t *testing.T) {
+	full := MediaTitle{Romaji: "Shingeki no Kyojin", English: "Attack on Titan", Native: "進撃の巨人"}
+	noEnglish := MediaTitle{Romaji: "Mushishi", Native: "蟲師"}
+
+	testCases := []struct {
+		name     string
+		title    MediaTitle
+		language string
+		expected string
+	}{
+		{"English", full, "english", "Attack on Titan"},
+		{"Romaji", full, "romaji", "Shingeki no Kyojin"},
+		{"Native", full, "native", "進撃の巨人"},
+		{"UnknownLanguage", full, "klingon", "Attack on Titan"},
+		{"EnglishFallback", noEnglish, "english", "Mushishi"},
+		{"UserPreferredFallback", MediaTitle{UserPreferred: "Only"}, "english", "Only"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.title.Preferred(tc.language); got != tc.expected {
+				t.Errorf("Expected '%s', got '%s'", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseMediaListStatus(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected MediaListStatus
+		ok       bool
+	}{
+		{"CURRENT", StatusCurrent, true},
+		{"watching", StatusCurrent, true},
+		{" Reading ", StatusCurrent, true},
+		{"rewatching", StatusRepeating, true},
+		{"completed", StatusCompleted, true},
+		{"finished", "", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, ok := ParseMediaListStatus(tc.name)
+			if status != tc.expected || ok != tc.ok {
+				t.Errorf("Expected %q, %v, got %q, %v", tc.expected, tc.ok, status, ok)
+			}
+		})
+	}
+}
+
+func TestFuzzyDateString(t *testing.T) {
+	if (FuzzyDate{}).String() != "" {
+		t.Error("Expected empty string for an unknown date")
+	}
+	if got := (FuzzyDate{Year: intPtr(2024), Month: intPtr(3)}).String(); got != "2024-03-00" {
+		t.Errorf("Expected '2024-03-00', got '%s'", got)
+	}
+}
+
+func TestMediaListCollection(t *testing.T) {
+	ts := newFakeAPI(t, func(w http.ResponseWriter, r *http.Request, query string) {
+		if !strings.Contains(query, "MediaListCollection") {
+			t.Errorf("Expected a MediaListCollection query, got %s", query)
+		}
+		w.Write([]byte(`{"data":{"MediaListCollection":{"hasNextChunk":false,"lists":[
+			{"name":"Watching","status":"CURRENT","entries":[
+				{"id":1,"mediaId":10,"status":"CURRENT","progress":3,"customLists":{"Favs":true},"media":{"id":10,"title":{"english":"Ten"}}}
+			]},
+			{"name":"Favs","isCustomList":true,"entries":[
+				{"id":1,"mediaId":10,"status":"CURRENT","progress":3,"customLists":{"Favs":true},"media":{"id":10,"title":{"english":"Ten"}}}
+			]}
+		]}}}`))
+	})
+
+	collection, err := NewClientWithEndpoint(ts.URL, "token").MediaListCollection(context.Background(), 1, MediaTypeAnime)
+	if err != nil {
+		t.Fatalf("Expected MediaListCollection to succeed, got %v", err)
+	}
+	if len(collection.Lists) != 2 {
+		t.Fatalf("Expected 2 lists, got %d", len(collection.Lists))
+	}
+	entries := collection.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("Expected entries on custom lists to be deduplicated, got %d entries", len(entries))
+	}
+	if entries[0].Media.Title.English != "Ten" || !entries[0].CustomLists["Favs"] {
+		t.Fatalf("Unexpected entry %+v", entries[0])
+	}
+}
+
+func TestScoreFormatConversion(t *testing.T) {
+	tests := []struct {
+		format  ScoreFormat
+		point10 float64
+		score   float64
+	}{
+		{ScorePoint100, 7, 70},
+		{ScorePoint10Decimal, 7, 7},
+		{ScorePoint10, 7, 7},
+		{ScorePoint5, 8, 4},
+		{ScorePoint3, 9, 3},
+		{ScorePoint3, 6, 2},
+		{ScorePoint100, 0, 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.format.FromPoint10(tt.point10); got != tt.score {
+			t.Errorf("Expected %g out of 10 to be %g in %s, got %g", tt.point10, tt.score, tt.format, got)
+		}
+		if got := tt.format.ToPoint10(tt.score); got != tt.point10 {
+			t.Errorf("Expected %g in %s to be %g out of 10, got %g", tt.score, tt.format, tt.point10, got)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package anilist
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrReadOnly is returned for mutations made while the client is read-only.
+var ErrReadOnly = errors.New("read-only mode is on, so nothing is changed on AniList")
+
+// MutationMode controls whether the client sends mutations to AniList.
+type MutationMode int32
+
+const (
+	// MutationsEnabled sends mutations as normal.
+	MutationsEnabled MutationMode = iota
+	// MutationsDryRun logs and records mutations without sending them, returning entries as AniList would have
+	// saved them.
+	MutationsDryRun
+	// MutationsReadOnly refuses every mutation with ErrReadOnly.
+	MutationsReadOnly
+)
+
+func (m MutationMode) String() string {
+	switch m {
+	case MutationsDryRun:
+		return "dry run"
+	case MutationsReadOnly:
+		return "read-only"
+	default:
+		return "normal"
+	}
+}
+
+// SetMutationMode changes whether mutations are sent.  It can be changed while requests are in flight.
+func (c *Client) SetMutationMode(mode MutationMode) {
+	c.mode.Store(int32(mode))
+}
+
+// MutationMode returns whether mutations are sent.
+func (c *Client) MutationMode() MutationMode {
+	return MutationMode(c.mode.Load())
+}
+
+// simulateSave returns the entry a save would leave, based on the entry before it when known.  UpdatedAt is left
+// alone, as AniList still has the old entry.
+func simulateSave(before *MediaListEntry, input SaveMediaListEntryInput) *MediaListEntry {
+	entry := &MediaListEntry{}
+	if before != nil {
+		copied := *before
+		entry = &copied
+	}
+	if input.ID != nil {
+		entry.ID = *input.ID
+	}
+	if input.MediaID != nil {
+		entry.MediaID = *input.MediaID
+	}
+	if entry.UpdatedAt == 0 {
+		entry.UpdatedAt = time.Now().Unix()
+	}
+	input.ApplyTo(entry)
+	return entry
+}
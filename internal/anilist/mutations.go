@@ -0,0 +1,544 @@
+package anilist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SaveMediaListEntryInput holds the arguments of a SaveMediaListEntry mutation.  Nil fields are left out of the
+// mutation, so AniList leaves them unchanged.
+type SaveMediaListEntryInput struct {
+	ID                    *int             `json:"id,omitempty"`
+	MediaID               *int             `json:"mediaId,omitempty"`
+	Status                *MediaListStatus `json:"status,omitempty"`
+	Score                 *float64         `json:"score,omitempty"`
+	Progress              *int             `json:"progress,omitempty"`
+	ProgressVolumes       *int             `json:"progressVolumes,omitempty"`
+	Repeat                *int             `json:"repeat,omitempty"`
+	Priority              *int             `json:"priority,omitempty"`
+	Private               *bool            `json:"private,omitempty"`
+	HiddenFromStatusLists *bool            `json:"hiddenFromStatusLists,omitempty"`
+	Notes                 *string          `json:"notes,omitempty"`
+	CustomLists           *[]string        `json:"customLists,omitempty"`
+	AdvancedScores        *[]float64       `json:"advancedScores,omitempty"`
+	StartedAt             *FuzzyDate       `json:"startedAt,omitempty"`
+	CompletedAt           *FuzzyDate       `json:"completedAt,omitempty"`
+}
+
+// FieldDiff is a field that differs between an input and an entry.
+type FieldDiff struct {
+	Field string
+	Input string
+	Entry string
+}
+
+// Merge returns a copy of the input with the fields in other overriding the receiver's.  ID and MediaID are
+// taken from other only if set.
+func (in SaveMediaListEntryInput) Merge(other SaveMediaListEntryInput) SaveMediaListEntryInput {
+	merged := in
+	inFields, otherFields := merged.fields(), other.fields()
+	for name, field := range otherFields {
+		if !field.isNil() {
+			inFields[name].set(field)
+		}
+	}
+	return merged
+}
+
+// Without returns a copy of the input with the named fields cleared, so they are left unchanged by the mutation.
+func (in SaveMediaListEntryInput) Without(names ...string) SaveMediaListEntryInput {
+	cleared := in
+	fields := cleared.fields()
+	for _, name := range names {
+		if field, ok := fields[name]; ok {
+			field.clear()
+		}
+	}
+	return cleared
+}
+
+// Only returns a copy of the input with every field but the named ones, and the IDs, cleared.
+func (in SaveMediaListEntryInput) Only(names ...string) SaveMediaListEntryInput {
+	keep := map[string]bool{"id": true, "mediaId": true}
+	for _, name := range names {
+		keep[name] = true
+	}
+	cleared := in
+	for name, field := range cleared.fields() {
+		if !keep[name] {
+			field.clear()
+		}
+	}
+	return cleared
+}
+
+// IsEmpty reports whether the input changes nothing.
+func (in SaveMediaListEntryInput) IsEmpty() bool {
+	for name, field := range in.fields() {
+		if name != "id" && name != "mediaId" && !field.isNil() {
+			return false
+		}
+	}
+	return true
+}
+
+// Diff lists the fields set in the input whose value differs from the entry's current value.
+func (in SaveMediaListEntryInput) Diff(entry *MediaListEntry) []FieldDiff {
+	var diffs []FieldDiff
+	entryInput := InputFromEntry(entry)
+	entryFields := entryInput.fields()
+	for _, name := range inputFieldOrder {
+		field := in.fields()[name]
+		if field.isNil() {
+			continue
+		}
+		mine, theirs := field.String(), entryFields[name].String()
+		if mine != theirs {
+			diffs = append(diffs, FieldDiff{Field: name, Input: mine, Entry: theirs})
+		}
+	}
+	return diffs
+}
+
+// Changes lists every field set in the input, with the entry's value before the mutation.  Before values are
+// empty when the entry is nil.
+func (in SaveMediaListEntryInput) Changes(before *MediaListEntry) []FieldDiff {
+	var beforeFields map[string]inputField
+	if before != nil {
+		beforeInput := InputFromEntry(before)
+		beforeFields = beforeInput.fields()
+	}
+	var changes []FieldDiff
+	for _, name := range inputFieldOrder {
+		field := in.fields()[name]
+		if field.isNil() {
+			continue
+		}
+		change := FieldDiff{Field: name, Input: field.String()}
+		if beforeFields != nil {
+			change.Entry = beforeFields[name].String()
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// ApplyTo updates an entry with the fields set in the input.  Used to show an edit before AniList confirms it.
+func (in SaveMediaListEntryInput) ApplyTo(entry *MediaListEntry) {
+	if in.Status != nil {
+		entry.Status = *in.Status
+	}
+	if in.Score != nil {
+		entry.Score = *in.Score
+	}
+	if in.Progress != nil {
+		entry.Progress = *in.Progress
+	}
+	if in.ProgressVolumes != nil {
+		entry.ProgressVolumes = *in.ProgressVolumes
+	}
+	if in.Repeat != nil {
+		entry.Repeat = *in.Repeat
+	}
+	if in.Priority != nil {
+		entry.Priority = *in.Priority
+	}
+	if in.Private != nil {
+		entry.Private = *in.Private
+	}
+	if in.HiddenFromStatusLists != nil {
+		entry.HiddenFromStatusLists = *in.HiddenFromStatusLists
+	}
+	if in.Notes != nil {
+		entry.Notes = *in.Notes
+	}
+	if in.CustomLists != nil {
+		entry.CustomLists = map[string]bool{}
+		for _, name := range *in.CustomLists {
+			entry.CustomLists[name] = true
+		}
+	}
+	if in.StartedAt != nil {
+		entry.StartedAt = *in.StartedAt
+	}
+	if in.CompletedAt != nil {
+		entry.CompletedAt = *in.CompletedAt
+	}
+}
+
+// InputFromEntry returns an input that would save every field of the entry as it is.  Advanced scores are left
+// out, as AniList expects them in the order of the user's scoring categories which the entry doesn't record.
+func InputFromEntry(entry *MediaListEntry) SaveMediaListEntryInput {
+	customLists := make([]string, 0, len(entry.CustomLists))
+	for name, enabled := range entry.CustomLists {
+		if enabled {
+			customLists = append(customLists, name)
+		}
+	}
+	sort.Strings(customLists)
+
+	status, score, progress, progressVolumes := entry.Status, entry.Score, entry.Progress, entry.ProgressVolumes
+	repeat, priority, private, hidden, notes := entry.Repeat, entry.Priority, entry.Private, entry.HiddenFromStatusLists, entry.Notes
+	startedAt, completedAt := entry.StartedAt, entry.CompletedAt
+	input := SaveMediaListEntryInput{
+		Status:                &status,
+		Score:                 &score,
+		Progress:              &progress,
+		ProgressVolumes:       &progressVolumes,
+		Repeat:                &repeat,
+		Priority:              &priority,
+		Private:               &private,
+		HiddenFromStatusLists: &hidden,
+		Notes:                 &notes,
+		CustomLists:           &customLists,
+		StartedAt:             &startedAt,
+		CompletedAt:           &completedAt,
+	}
+	if entry.ID != 0 {
+		id := entry.ID
+		input.ID = &id
+	}
+	if entry.MediaID != 0 {
+		mediaID := entry.MediaID
+		input.MediaID = &mediaID
+	}
+	return input
+}
+
+// inputFieldOrder is the order fields are listed in diffs.
+var inputFieldOrder = []string{"status", "score", "progress", "progressVolumes", "repeat", "priority", "private",
+	"hiddenFromStatusLists", "notes", "customLists", "advancedScores", "startedAt", "completedAt"}
+
+// inputField gives uniform access to one of the pointer fields of an input.
+type inputField struct {
+	ptr interface{}
+}
+
+func (f inputField) isNil() bool {
+	switch p := f.ptr.(type) {
+	case **int:
+		return *p == nil
+	case **float64:
+		return *p == nil
+	case **bool:
+		return *p == nil
+	case **string:
+		return *p == nil
+	case **MediaListStatus:
+		return *p == nil
+	case **[]string:
+		return *p == nil
+	case **[]float64:
+		return *p == nil
+	case **FuzzyDate:
+		return *p == nil
+	}
+	return true
+}
+
+func (f inputField) clear() {
+	switch p := f.ptr.(type) {
+	case **int:
+		*p = nil
+	case **float64:
+		*p = nil
+	case **bool:
+		*p = nil
+	case **string:
+		*p = nil
+	case **MediaListStatus:
+		*p = nil
+	case **[]string:
+		*p = nil
+	case **[]float64:
+		*p = nil
+	case **FuzzyDate:
+		*p = nil
+	}
+}
+
+// set copies the value of another field of the same type into this one.
+func (f inputField) set(other inputField) {
+	switch p := f.ptr.(type) {
+	case **int:
+		*p = *other.ptr.(**int)
+	case **float64:
+		*p = *other.ptr.(**float64)
+	case **bool:
+		*p = *other.ptr.(**bool)
+	case **string:
+		*p = *other.ptr.(**string)
+	case **MediaListStatus:
+		*p = *other.ptr.(**MediaListStatus)
+	case **[]string:
+		*p = *other.ptr.(**[]string)
+	case **[]float64:
+		*p = *other.ptr.(**[]float64)
+	case **FuzzyDate:
+		*p = *other.ptr.(**FuzzyDate)
+	}
+}
+
+// String formats the field's value for display.  Unset fields are empty.
+func (f inputField) String() string {
+	if f.isNil() {
+		return ""
+	}
+	switch p := f.ptr.(type) {
+	case **int:
+		return strconv.Itoa(**p)
+	case **float64:
+		return strconv.FormatFloat(**p, 'f', -1, 64)
+	case **bool:
+		return strconv.FormatBool(**p)
+	case **string:
+		return **p
+	case **MediaListStatus:
+		return string(**p)
+	case **[]string:
+		values := append([]string{}, (**p)...)
+		sort.Strings(values)
+		return strings.Join(values, ", ")
+	case **[]float64:
+		values := make([]string, 0, len(**p))
+		for _, v := range **p {
+			values = append(values, strconv.FormatFloat(v, 'f', -1, 64))
+		}
+		return strings.Join(values, ", ")
+	case **FuzzyDate:
+		return (**p).String()
+	}
+	return ""
+}
+
+// fields returns the input's fields keyed by their GraphQL argument name.
+func (in *SaveMediaListEntryInput) fields() map[string]inputField {
+	return map[string]inputField{
+		"id":                    {&in.ID},
+		"mediaId":               {&in.MediaID},
+		"status":                {&in.Status},
+		"score":                 {&in.Score},
+		"progress":              {&in.Progress},
+		"progressVolumes":       {&in.ProgressVolumes},
+		"repeat":                {&in.Repeat},
+		"priority":              {&in.Priority},
+		"private":               {&in.Private},
+		"hiddenFromStatusLists": {&in.HiddenFromStatusLists},
+		"notes":                 {&in.Notes},
+		"customLists":           {&in.CustomLists},
+		"advancedScores":        {&in.AdvancedScores},
+		"startedAt":             {&in.StartedAt},
+		"completedAt":           {&in.CompletedAt},
+	}
+}
+
+const saveMediaListEntryMutation = `mutation ($id: Int, $mediaId: Int, $status: MediaListStatus, $score: Float,
+    $progress: Int, $progressVolumes: Int, $repeat: Int, $priority: Int, $private: Boolean,
+    $hiddenFromStatusLists: Boolean, $notes: String, $customLists: [String], $advancedScores: [Float],
+    $startedAt: FuzzyDateInput, $completedAt: FuzzyDateInput) {
+  SaveMediaListEntry(id: $id, mediaId: $mediaId, status: $status, score: $score, progress: $progress,
+      progressVolumes: $progressVolumes, repeat: $repeat, priority: $priority, private: $private,
+      hiddenFromStatusLists: $hiddenFromStatusLists, notes: $notes, customLists: $customLists,
+      advancedScores: $advancedScores, startedAt: $startedAt, completedAt: $completedAt) {` + entryFields + `
+    media {` + mediaFields + `
+    }
+  }
+}`
+
+const deleteMediaListEntryMutation = `mutation ($id: Int) {
+  DeleteMediaListEntry(id: $id) {
+    deleted
+  }
+}`
+
+const mediaListEntryQuery = `query ($id: Int) {
+  MediaList(id: $id) {` + entryFields + `
+  }
+}`
+
+// MutationRecord describes a mutation the client sent to AniList, for the audit log.
+type MutationRecord struct {
+	Time time.Time
+	// Delete is set for deleted entries.  Otherwise Input holds the fields saved.
+	Delete  bool
+	Input   SaveMediaListEntryInput
+	EntryID int
+	MediaID int
+	// Before is the entry before the mutation, if the caller knew it.  See WithPreviousEntry.
+	Before *MediaListEntry
+	// After is the entry as saved by AniList.  It is nil for deletes and failed mutations.
+	After *MediaListEntry
+	Err   error
+	// DryRun is set when the mutation wasn't sent, because the client is in dry run mode.
+	DryRun bool
+}
+
+// Changes lists the fields the mutation set, with their values before it.
+func (r *MutationRecord) Changes() []FieldDiff {
+	if r.Delete {
+		return nil
+	}
+	return r.Input.Changes(r.Before)
+}
+
+type previousEntryKey struct{}
+
+// WithPreviousEntry returns a context telling the client the entry a mutation sent with it changes, so the entry's
+// values before the mutation are recorded.
+func WithPreviousEntry(ctx context.Context, entry *MediaListEntry) context.Context {
+	if entry == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, previousEntryKey{}, entry)
+}
+
+func previousEntry(ctx context.Context) *MediaListEntry {
+	entry, _ := ctx.Value(previousEntryKey{}).(*MediaListEntry)
+	return entry
+}
+
+type dryRunKey struct{}
+
+// WithDryRun returns a context telling the client to simulate a mutation sent with it, as in dry run mode, even
+// when mutations are enabled.  It is for changes made in dry run mode that are replayed after it was turned off.
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// mutationMode returns the mode a mutation sent with ctx is made in.
+func (c *Client) mutationMode(ctx context.Context) MutationMode {
+	mode := c.MutationMode()
+	if dryRun, _ := ctx.Value(dryRunKey{}).(bool); dryRun && mode == MutationsEnabled {
+		return MutationsDryRun
+	}
+	return mode
+}
+
+// SetMutationHandler registers a function called after every mutation the client sends, whether or not AniList
+// accepted it.
+func (c *Client) SetMutationHandler(handler func(MutationRecord)) {
+	c.onMutation = handler
+}
+
+// recordMutation passes a sent mutation to the mutation handler, if there is one.
+func (c *Client) recordMutation(ctx context.Context, record MutationRecord) {
+	if c.onMutation == nil {
+		return
+	}
+	record.Time = time.Now()
+	record.Before = previousEntry(ctx)
+	if record.Before != nil {
+		if record.EntryID == 0 {
+			record.EntryID = record.Before.ID
+		}
+		if record.MediaID == 0 {
+			record.MediaID = record.Before.MediaID
+		}
+	}
+	if record.After != nil {
+		record.EntryID, record.MediaID = record.After.ID, record.After.MediaID
+	}
+	c.onMutation(record)
+}
+
+// SaveMediaListEntry creates or updates a list entry, returning the entry as saved by AniList.
+func (c *Client) SaveMediaListEntry(ctx context.Context, input SaveMediaListEntryInput) (*MediaListEntry, error) {
+	switch c.mutationMode(ctx) {
+	case MutationsReadOnly:
+		return nil, ErrReadOnly
+	case MutationsDryRun:
+		entry := simulateSave(previousEntry(ctx), input)
+		logrus.Infof("Dry run: not saving entry %d for media %d: %+v", entry.ID, entry.MediaID, input.Changes(previousEntry(ctx)))
+		c.recordMutation(ctx, MutationRecord{Input: input, EntryID: entry.ID, MediaID: entry.MediaID, After: entry, DryRun: true})
+		return entry, nil
+	}
+
+	encoded, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode entry: %w", err)
+	}
+	var variables map[string]interface{}
+	if err := json.Unmarshal(encoded, &variables); err != nil {
+		return nil, fmt.Errorf("failed to encode entry: %w", err)
+	}
+
+	var data struct {
+		SaveMediaListEntry *MediaListEntry `json:"SaveMediaListEntry"`
+	}
+	err = c.Query(ctx, saveMediaListEntryMutation, variables, &data)
+	record := MutationRecord{Input: input, After: data.SaveMediaListEntry, Err: err}
+	if input.ID != nil {
+		record.EntryID = *input.ID
+	}
+	if input.MediaID != nil {
+		record.MediaID = *input.MediaID
+	}
+	c.recordMutation(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+	return data.SaveMediaListEntry, nil
+}
+
+// DeleteMediaListEntry removes an entry from the user's list.
+func (c *Client) DeleteMediaListEntry(ctx context.Context, id int) error {
+	switch c.mutationMode(ctx) {
+	case MutationsReadOnly:
+		return ErrReadOnly
+	case MutationsDryRun:
+		logrus.Infof("Dry run: not deleting entry %d", id)
+		c.recordMutation(ctx, MutationRecord{Delete: true, EntryID: id, DryRun: true})
+		return nil
+	}
+
+	var data struct {
+		DeleteMediaListEntry struct {
+			Deleted bool `json:"deleted"`
+		} `json:"DeleteMediaListEntry"`
+	}
+	err := c.Query(ctx, deleteMediaListEntryMutation, map[string]interface{}{"id": id}, &data)
+	if err == nil && !data.DeleteMediaListEntry.Deleted {
+		err = fmt.Errorf("AniList did not delete entry %d", id)
+	}
+	c.recordMutation(ctx, MutationRecord{Delete: true, EntryID: id, Err: err})
+	return err
+}
+
+// MediaListEntry fetches a single list entry by its ID.  Media details are not included.
+func (c *Client) MediaListEntry(ctx context.Context, id int) (*MediaListEntry, error) {
+	var data struct {
+		MediaList *MediaListEntry `json:"MediaList"`
+	}
+	if err := c.Query(ctx, mediaListEntryQuery, map[string]interface{}{"id": id}, &data); err != nil {
+		return nil, err
+	}
+	if data.MediaList == nil {
+		return nil, &APIError{StatusCode: http.StatusNotFound, Errors: []GraphQLError{{Message: "Not Found.", Status: http.StatusNotFound}}}
+	}
+	return data.MediaList, nil
+}
+
+// IsNotFound reports whether err is AniList saying the requested object doesn't exist.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.StatusCode == http.StatusNotFound {
+		return true
+	}
+	for _, gqlErr := range apiErr.Errors {
+		if gqlErr.Status == http.StatusNotFound {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package anilist
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func statusPtr(s MediaListStatus) *MediaListStatus {
+	return &s
+}
+
+func TestSaveMediaListEntry_OnlySendsSetFields(t *testing.T) {
+	var variables map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Variables map[string]interface{} `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+		variables = body.Variables
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"SaveMediaListEntry":{"id":1,"mediaId":10,"status":"CURRENT","progress":4,"updatedAt":100}}}`))
+	}))
+	defer ts.Close()
+
+	id, progress := 1, 4
+	entry, err := NewClientWithEndpoint(ts.URL, "token").SaveMediaListEntry(context.Background(), SaveMediaListEntryInput{ID: &id, Progress: &progress})
+	if err != nil {
+		t.Fatalf("Expected save to succeed, got %v", err)
+	}
+	if entry.Progress != 4 || entry.UpdatedAt != 100 {
+		t.Fatalf("Unexpected entry %+v", entry)
+	}
+	expected := map[string]interface{}{"id": float64(1), "progress": float64(4)}
+	if !reflect.DeepEqual(variables, expected) {
+		t.Fatalf("Expected only set fields to be sent, got %v", variables)
+	}
+}
+
+func TestMutationHandler_RecordsEveryMutation(t *testing.T) {
+	ts := newFakeAPI(t, func(w http.ResponseWriter, r *http.Request, query string) {
+		if strings.Contains(query, "DeleteMediaListEntry") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors":[{"message":"validation","status":400}]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"SaveMediaListEntry":{"id":1,"mediaId":10,"status":"COMPLETED","progress":12}}}`))
+	})
+
+	var records []MutationRecord
+	client := NewClientWithEndpoint(ts.URL, "token")
+	client.SetMutationHandler(func(record MutationRecord) { records = append(records, record) })
+
+	before := &MediaListEntry{ID: 1, MediaID: 10, Status: StatusCurrent, Progress: 11}
+	id, progress := 1, 12
+	input := SaveMediaListEntryInput{ID: &id, Status: statusPtr(StatusCompleted), Progress: &progress}
+	if _, err := client.SaveMediaListEntry(WithPreviousEntry(context.Background(), before), input); err != nil {
+		t.Fatalf("Expected save to succeed, got %v", err)
+	}
+	if err := client.DeleteMediaListEntry(context.Background(), 2); err == nil {
+		t.Fatalf("Expected delete to fail")
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	saved := records[0]
+	expected := []FieldDiff{{Field: "status", Input: "COMPLETED", Entry: "CURRENT"}, {Field: "progress", Input: "12", Entry: "11"}}
+	if saved.Delete || saved.MediaID != 10 || saved.Err != nil || !reflect.DeepEqual(saved.Changes(), expected) {
+		t.Errorf("Unexpected save record %+v with changes %+v", saved, saved.Changes())
+	}
+	deleted := records[1]
+	if !deleted.Delete || deleted.EntryID != 2 || deleted.Before != nil || deleted.Err == nil {
+		t.Errorf("Unexpected delete record %+v", deleted)
+	}
+}
+
+func TestMediaListEntry_NotFound(t *testing.T) {
+	ts := newFakeAPI(t, func(w http.ResponseWriter, r *http.Request, query string) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"data":{"MediaList":null},"errors":[{"message":"Not Found.","status":404}]}`))
+	})
+
+	_, err := NewClientWithEndpoint(ts.URL, "token").MediaListEntry(context.Background(), 1)
+	if !IsNotFound(err) {
+		t.Fatalf("Expected not found error, got %v", err)
+	}
+}
+
+func TestInputMergeAndWithout(t *testing.T) {
+	progress, score, notes := 5, 8.5, "rewatch"
+	mine := SaveMediaListEntryInput{Progress: &progress, Score: &score}
+	later := SaveMediaListEntryInput{Notes: &notes, Status: statusPtr(StatusCompleted)}
+
+	merged := mine.Merge(later)
+	if *merged.Progress != 5 || *merged.Score != 8.5 || *merged.Notes != "rewatch" || *merged.Status != StatusCompleted {
+		t.Fatalf("Unexpected merged input %+v", merged)
+	}
+	if mine.Notes != nil {
+		t.Fatal("Expected Merge not to modify the receiver")
+	}
+
+	without := merged.Without("score", "notes")
+	if without.Score != nil || without.Notes != nil || without.Progress == nil {
+		t.Fatalf("Expected score and notes to be cleared, got %+v", without)
+	}
+	if merged.Score == nil {
+		t.Fatal("Expected Without not to modify the receiver")
+	}
+
+	id := 3
+	merged.ID = &id
+	only := merged.Only("score")
+	if only.Score == nil || only.ID == nil || only.Progress != nil || only.Notes != nil || only.Status != nil {
+		t.Fatalf("Expected only score and the ID to be kept, got %+v", only)
+	}
+
+	if !(SaveMediaListEntryInput{}).IsEmpty() || merged.IsEmpty() {
+		t.Fatal("Unexpected IsEmpty result")
+	}
+}
+
+func TestInputDiffAndApply(t *testing.T) {
+	entry := &MediaListEntry{ID: 1, MediaID: 10, Status: StatusCurrent, Progress: 3, Score: 7, CustomLists: map[string]bool{"b": true, "a": true, "c": false}}
+	progress, score := 5, 7.0
+	customLists := []string{"a", "b"}
+	input := SaveMediaListEntryInput{Progress: &progress, Score: &score, CustomLists: &customLists}
+
+	diffs := input.Diff(entry)
+	if len(diffs) != 1 || diffs[0] != (FieldDiff{Field: "progress", Input: "5", Entry: "3"}) {
+		t.Fatalf("Expected only progress to differ, got %+v", diffs)
+	}
+
+	input.ApplyTo(entry)
+	if entry.Progress != 5 || !entry.CustomLists["a"] || entry.CustomLists["c"] {
+		t.Fatalf("Unexpected entry after applying input %+v", entry)
+	}
+}
@@ -0,0 +1,135 @@
+package anilist
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultRateLimit is AniList's documented requests per minute, used until a response reports the real limit.
+	defaultRateLimit = 90
+	// rateLimitReserve is how many requests are left in the window before requests are spaced out evenly.
+	rateLimitReserve = 10
+	// defaultRetryAfter is waited after a 429 response that doesn't say how long to wait.
+	defaultRetryAfter = time.Minute
+	// maxRateLimitRetries is how many times a rate limited request is retried before giving up.
+	maxRateLimitRetries = 2
+)
+
+// RateLimit is the client's view of AniList's rate limit.
+type RateLimit struct {
+	// Limit is the number of requests allowed per minute.
+	Limit int
+	// Remaining is the number of requests left in the current minute, as of the last response.
+	Remaining int
+	// BlockedUntil is set when AniList has asked the client to stop sending requests until then.
+	BlockedUntil time.Time
+}
+
+// rateLimiter keeps the client under AniList's rate limit, using the limit headers on each response.  Requests are
+// spaced out as the limit gets close, and wait out the block after a 429 response.
+type rateLimiter struct {
+	mutex       sync.Mutex
+	status      RateLimit
+	lastRequest time.Time
+	listeners   map[int]func(RateLimit)
+	nextID      int
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		status:    RateLimit{Limit: defaultRateLimit, Remaining: defaultRateLimit},
+		listeners: map[int]func(RateLimit){},
+	}
+}
+
+// wait blocks until a request may be sent.
+func (r *rateLimiter) wait(ctx context.Context) error {
+	r.mutex.Lock()
+	now := time.Now()
+	next := now
+	if r.status.BlockedUntil.After(next) {
+		next = r.status.BlockedUntil
+	}
+	if r.status.Remaining < rateLimitReserve && r.status.Limit > 0 {
+		spaced := r.lastRequest.Add(time.Minute / time.Duration(r.status.Limit))
+		if spaced.After(next) {
+			next = spaced
+		}
+	}
+	r.lastRequest = next
+	r.mutex.Unlock()
+
+	delay := next.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// update records the limit reported by a response, returning how long to wait before retrying if the request
+// was rate limited.
+func (r *rateLimiter) update(resp *http.Response) (time.Duration, bool) {
+	r.mutex.Lock()
+	if limit, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit")); err == nil {
+		r.status.Limit = limit
+	}
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		r.status.Remaining = remaining
+	}
+
+	limited := resp.StatusCode == http.StatusTooManyRequests
+	var retryAfter time.Duration
+	if limited {
+		retryAfter = defaultRetryAfter
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		r.status.Remaining = 0
+		r.status.BlockedUntil = time.Now().Add(retryAfter)
+	}
+	status := r.status
+	listeners := make([]func(RateLimit), 0, len(r.listeners))
+	for _, fn := range r.listeners {
+		listeners = append(listeners, fn)
+	}
+	r.mutex.Unlock()
+
+	for _, fn := range listeners {
+		fn(status)
+	}
+	return retryAfter, limited
+}
+
+// RateLimit returns the client's current view of the rate limit.
+func (c *Client) RateLimit() RateLimit {
+	c.limiter.mutex.Lock()
+	defer c.limiter.mutex.Unlock()
+	return c.limiter.status
+}
+
+// SubscribeRateLimit registers a function called after each response with the updated rate limit.  The returned
+// function unsubscribes.
+func (c *Client) SubscribeRateLimit(fn func(RateLimit)) func() {
+	r := c.limiter
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	id := r.nextID
+	r.nextID++
+	r.listeners[id] = fn
+	return func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		delete(r.listeners, id)
+	}
+}
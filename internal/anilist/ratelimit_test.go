@@ -0,0 +1,68 @@
+package anilist
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestQuery_RetriesWhenRateLimited(t *testing.T) {
+	requests := 0
+	ts := newFakeAPI(t, func(w http.ResponseWriter, r *http.Request, query string) {
+		requests++
+		w.Header().Set("X-RateLimit-Limit", "90")
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"data":null,"errors":[{"message":"Too Many Requests.","status":429}]}`))
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "59")
+		w.Write([]byte(`{"data":{"Viewer":{"id":1,"name":"Hisame"}}}`))
+	})
+
+	client := NewClientWithEndpoint(ts.URL, "token")
+	var updates []RateLimit
+	client.SubscribeRateLimit(func(limit RateLimit) { updates = append(updates, limit) })
+	if _, err := client.Viewer(context.Background()); err != nil {
+		t.Fatalf("Expected the retried request to succeed, got %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", requests)
+	}
+	if len(updates) != 2 || updates[0].Remaining != 0 {
+		t.Errorf("Expected 2 rate limit updates starting with none remaining, got %+v", updates)
+	}
+	if limit := client.RateLimit(); limit.Limit != 90 || limit.Remaining != 59 {
+		t.Errorf("Expected limit 90 with 59 remaining, got %+v", limit)
+	}
+}
+
+func TestRateLimiter_SpacesRequestsNearLimit(t *testing.T) {
+	r := newRateLimiter()
+	r.status = RateLimit{Limit: 600, Remaining: 1}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := r.wait(context.Background()); err != nil {
+			t.Fatalf("Expected wait to succeed, got %v", err)
+		}
+	}
+	// 600 a minute is one every 100ms.  The first request goes straight away.
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Expected requests to be spaced out, took %s", elapsed)
+	}
+}
+
+func TestRateLimiter_WaitHonoursContext(t *testing.T) {
+	r := newRateLimiter()
+	r.status.BlockedUntil = time.Now().Add(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := r.wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package anilist
+
+import (
+	"context"
+)
+
+const userQuery = `query ($name: String) {
+  User(name: $name) {
+    id
+    name
+    about(asHtml: false)
+    siteUrl
+    avatar {
+      large
+      medium
+    }
+    statistics {
+      anime {
+        count
+        meanScore
+        episodesWatched
+      }
+      manga {
+        count
+        meanScore
+        chaptersRead
+      }
+    }
+  }
+}`
+
+// User is an AniList user's public profile.
+type User struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	About   string `json:"about"`
+	SiteURL string `json:"siteUrl"`
+	Avatar  struct {
+		Large  string `json:"large"`
+		Medium string `json:"medium"`
+	} `json:"avatar"`
+	Statistics struct {
+		Anime UserStatistics `json:"anime"`
+		Manga UserStatistics `json:"manga"`
+	} `json:"statistics"`
+}
+
+// UserStatistics summarises one of a user's lists.
+type UserStatistics struct {
+	Count           int     `json:"count"`
+	MeanScore       float64 `json:"meanScore"`
+	EpisodesWatched int     `json:"episodesWatched"`
+	ChaptersRead    int     `json:"chaptersRead"`
+}
+
+// User fetches a user's public profile by name.  Use IsNotFound to check for a user that doesn't exist.
+func (c *Client) User(ctx context.Context, name string) (*User, error) {
+	var data struct {
+		User *User `json:"User"`
+	}
+	if err := c.Query(ctx, userQuery, map[string]interface{}{"name": name}, &data); err != nil {
+		return nil, err
+	}
+	return data.User, nil
+}
@@ -0,0 +1,127 @@
+package anilist
+
+import (
+	"context"
+	"math"
+)
+
+const viewerQuery = `query {
+  Viewer {
+    id
+    name
+    avatar {
+      large
+      medium
+    }
+    mediaListOptions {
+      scoreFormat
+      animeList {
+        advancedScoring
+        advancedScoringEnabled
+      }
+      mangaList {
+        advancedScoring
+        advancedScoringEnabled
+      }
+    }
+  }
+}`
+
+// Viewer is the currently authenticated AniList user.
+type Viewer struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Avatar struct {
+		Large  string `json:"large"`
+		Medium string `json:"medium"`
+	} `json:"avatar"`
+	MediaListOptions struct {
+		ScoreFormat ScoreFormat          `json:"scoreFormat"`
+		AnimeList   MediaListTypeOptions `json:"animeList"`
+		MangaList   MediaListTypeOptions `json:"mangaList"`
+	} `json:"mediaListOptions"`
+}
+
+// MediaListTypeOptions are a user's list settings for one media type.
+type MediaListTypeOptions struct {
+	AdvancedScoring        []string `json:"advancedScoring"`
+	AdvancedScoringEnabled bool     `json:"advancedScoringEnabled"`
+}
+
+// AdvancedScoring returns the user's advanced scoring categories for a media type, in the order AniList expects
+// advanced scores to be saved in.  It is empty when advanced scoring is off.
+func (v *Viewer) AdvancedScoring(mediaType MediaType) []string {
+	options := v.MediaListOptions.AnimeList
+	if mediaType == MediaTypeManga {
+		options = v.MediaListOptions.MangaList
+	}
+	if !options.AdvancedScoringEnabled {
+		return nil
+	}
+	return options.AdvancedScoring
+}
+
+// Viewer fetches the user the client's token belongs to.  This is the cheapest way to check a token is valid.
+func (c *Client) Viewer(ctx context.Context) (*Viewer, error) {
+	var data struct {
+		Viewer *Viewer `json:"Viewer"`
+	}
+	if err := c.Query(ctx, viewerQuery, nil, &data); err != nil {
+		return nil, err
+	}
+	return data.Viewer, nil
+}
+
+// ScoreFormat is the scale a user gives scores on.  Scores sent to and received from the API use it.
+type ScoreFormat string
+
+const (
+	ScorePoint100       ScoreFormat = "POINT_100"
+	ScorePoint10Decimal ScoreFormat = "POINT_10_DECIMAL"
+	ScorePoint10        ScoreFormat = "POINT_10"
+	ScorePoint5         ScoreFormat = "POINT_5"
+	ScorePoint3         ScoreFormat = "POINT_3"
+)
+
+// FromPoint10 converts a score out of 10, as used by MyAnimeList, to the format.  0 means unscored in every format.
+func (f ScoreFormat) FromPoint10(score float64) float64 {
+	if score <= 0 {
+		return 0
+	}
+	switch f {
+	case ScorePoint100:
+		return math.Round(score * 10)
+	case ScorePoint10:
+		return math.Round(score)
+	case ScorePoint5:
+		return math.Max(1, math.Round(score/2))
+	case ScorePoint3:
+		switch {
+		case score <= 4:
+			return 1
+		case score <= 7:
+			return 2
+		default:
+			return 3
+		}
+	default:
+		return score
+	}
+}
+
+// ToPoint10 converts a score in the format to a score out of 10.
+func (f ScoreFormat) ToPoint10(score float64) float64 {
+	if score <= 0 {
+		return 0
+	}
+	switch f {
+	case ScorePoint100:
+		return math.Round(score) / 10
+	case ScorePoint5:
+		return score * 2
+	case ScorePoint3:
+		return []float64{0, 3, 6, 9}[int(math.Min(score, 3))]
+	default:
+		return score
+	}
+}
@@ -0,0 +1,246 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLineBytes bounds a single record when reading the log, as notes can be long.
+const maxLineBytes = 1 << 20
+
+// Action is the kind of mutation a record describes.
+type Action string
+
+const (
+	ActionSave   Action = "save"
+	ActionDelete Action = "delete"
+)
+
+// FieldChange is one field a mutation set, with its value before and after.
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// Record is one mutation sent to AniList.
+type Record struct {
+	Time    time.Time `json:"time"`
+	Account string    `json:"account"`
+	UserID  int       `json:"userId"`
+	Action  Action    `json:"action"`
+	MediaID int       `json:"mediaId,omitempty"`
+	EntryID int       `json:"entryId,omitempty"`
+	Title   string    `json:"title,omitempty"`
+	// BeforeKnown is false when the entry's values before the mutation weren't known, so the changes' Before
+	// values are empty.
+	BeforeKnown bool          `json:"beforeKnown"`
+	Changes     []FieldChange `json:"changes,omitempty"`
+	// Error is set when AniList didn't accept the mutation.
+	Error string `json:"error,omitempty"`
+	// DryRun is set for mutations that weren't sent, because dry run mode was on.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// Succeeded reports whether AniList accepted the mutation.
+func (r *Record) Succeeded() bool {
+	return r.Error == ""
+}
+
+// Log is an append-only file of records, one JSON object per line.  It is shared by every account, and by the
+// app and the command line.
+type Log struct {
+	path string
+
+	mutex       sync.Mutex
+	subscribers map[int]func(Record)
+	nextID      int
+}
+
+// DefaultPath returns where the audit log is kept.  It lives with the config rather than the cache, so clearing
+// the cache doesn't lose it.
+func DefaultPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user config directory: %w", err)
+	}
+	return filepath.Join(configDir, "hisame", "audit.jsonl"), nil
+}
+
+// Open returns the log at path.  The file is created when the first record is appended.
+func Open(path string) *Log {
+	return &Log{path: path, subscribers: map[int]func(Record){}}
+}
+
+// Path returns the file the log is kept in.
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Append adds a record to the end of the log.
+func (l *Log) Append(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mutex.Lock()
+	err = l.write(line)
+	subscribers := make([]func(Record), 0, len(l.subscribers))
+	for _, fn := range l.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	l.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range subscribers {
+		fn(record)
+	}
+	return nil
+}
+
+// write appends a line to the file.  Must be called with the mutex held.
+func (l *Log) write(line []byte) error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	// O_APPEND keeps records whole when the app and the command line write at the same time.
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if _, err := file.Write(line); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return file.Close()
+}
+
+// Read returns every record in the log, oldest first.  Lines that can't be decoded, such as one cut short by a
+// crash, are skipped.
+func (l *Log) Read() ([]Record, error) {
+	file, err := os.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+	for line := 1; scanner.Scan(); line++ {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			logrus.Warnf("Skipping unreadable audit log line %d: %v", line, err)
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return records, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return records, nil
+}
+
+// Subscribe registers a function called with every record appended by this process.  The returned function
+// unsubscribes.
+func (l *Log) Subscribe(fn func(Record)) func() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	id := l.nextID
+	l.nextID++
+	l.subscribers[id] = fn
+	return func() {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		delete(l.subscribers, id)
+	}
+}
+
+// Filter chooses records to show.  Zero fields match everything.
+type Filter struct {
+	Account string
+	// Text matches the title, media ID or a changed field's name, ignoring case.
+	Text       string
+	Since      time.Time
+	FailedOnly bool
+}
+
+// Match reports whether the record passes the filter.
+func (f Filter) Match(record Record) bool {
+	if f.Account != "" && record.Account != f.Account {
+		return false
+	}
+	if !f.Since.IsZero() && record.Time.Before(f.Since) {
+		return false
+	}
+	if f.FailedOnly && record.Succeeded() {
+		return false
+	}
+	text := strings.ToLower(strings.TrimSpace(f.Text))
+	if text == "" {
+		return true
+	}
+	if strings.Contains(strings.ToLower(record.Title), text) || strconv.Itoa(record.MediaID) == text {
+		return true
+	}
+	for _, change := range record.Changes {
+		if strings.ToLower(change.Field) == text {
+			return true
+		}
+	}
+	return false
+}
+
+// Recorder returns a mutation handler for anilist.Client.SetMutationHandler, appending a record for every mutation
+// the account's client sends.  titleOf looks up a media's title for the record, and may be nil.
+func Recorder(log *Log, account string, userID int, titleOf func(mediaID int) string) func(anilist.MutationRecord) {
+	return func(mutation anilist.MutationRecord) {
+		record := Record{
+			Time:        mutation.Time,
+			Account:     account,
+			UserID:      userID,
+			Action:      ActionSave,
+			MediaID:     mutation.MediaID,
+			EntryID:     mutation.EntryID,
+			BeforeKnown: mutation.Before != nil,
+			DryRun:      mutation.DryRun,
+		}
+		if mutation.Delete {
+			record.Action = ActionDelete
+		}
+		switch {
+		case mutation.After != nil && mutation.After.Media != nil:
+			record.Title = mutation.After.Media.Title.Preferred("romaji")
+		case mutation.Before != nil && mutation.Before.Media != nil:
+			record.Title = mutation.Before.Media.Title.Preferred("romaji")
+		case titleOf != nil && record.MediaID != 0:
+			record.Title = titleOf(record.MediaID)
+		}
+		for _, diff := range mutation.Changes() {
+			record.Changes = append(record.Changes, FieldChange{Field: diff.Field, Before: diff.Entry, After: diff.Input})
+		}
+		if mutation.Err != nil {
+			record.Error = mutation.Err.Error()
+		}
+
+		if err := log.Append(record); err != nil {
+			logrus.Errorf("Error writing audit log: %v", err)
+		}
+	}
+}
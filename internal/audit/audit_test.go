@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/StarTerrarium/hisame/internal/anilist"
+)
+
+func TestLog_AppendAndRead(t *testing.T) {
+	log := Open(filepath.Join(t.TempDir(), "nested", "audit.jsonl"))
+
+	var notified []Record
+	unsubscribe := log.Subscribe(func(record Record) { notified = append(notified, record) })
+	first := Record{Time: time.Unix(100, 0).UTC(), Account: "alice", Action: ActionSave, MediaID: 1}
+	if err := log.Append(first); err != nil {
+		t.Fatalf("Expected append to succeed, got %v", err)
+	}
+	// A line cut short by a crash shouldn't hide the records after it.
+	file, err := os.OpenFile(log.Path(), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	file.WriteString("{\"time\":\n")
+	file.Close()
+	unsubscribe()
+	if err := log.Append(Record{Account: "bob", Action: ActionDelete, MediaID: 2}); err != nil {
+		t.Fatalf("Expected append to succeed, got %v", err)
+	}
+
+	records, err := log.Read()
+	if err != nil {
+		t.Fatalf("Expected read to succeed, got %v", err)
+	}
+	if len(records) != 2 || records[0].Account != "alice" || !records[0].Time.Equal(first.Time) || records[1].Action != ActionDelete {
+		t.Fatalf("Unexpected records %+v", records)
+	}
+	if len(notified) != 1 {
+		t.Errorf("Expected 1 notification before unsubscribing, got %d", len(notified))
+	}
+}
+
+func TestLog_ReadMissingFile(t *testing.T) {
+	records, err := Open(filepath.Join(t.TempDir(), "audit.jsonl")).Read()
+	if err != nil || records != nil {
+		t.Fatalf("Expected no records and no error, got %v, %v", records, err)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	record := Record{
+		Time:    time.Unix(1000, 0),
+		Account: "alice",
+		MediaID: 21,
+		Title:   "One Piece",
+		Changes: []FieldChange{{Field: "progress", Before: "1", After: "2"}},
+	}
+	failed := record
+	failed.Error = "rejected"
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		record   Record
+		expected bool
+	}{
+		{"Empty filter", Filter{}, record, true},
+		{"Other account", Filter{Account: "bob"}, record, false},
+		{"Title", Filter{Text: "piece"}, record, true},
+		{"Media ID", Filter{Text: "21"}, record, true},
+		{"Field", Filter{Text: "Progress"}, record, true},
+		{"No match", Filter{Text: "naruto"}, record, false},
+		{"Too old", Filter{Since: time.Unix(2000, 0)}, record, false},
+		{"Failed only skips successes", Filter{FailedOnly: true}, record, false},
+		{"Failed only", Filter{FailedOnly: true}, failed, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.filter.Match(test.record); got != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	log := Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	record := Recorder(log, "alice", 7, func(mediaID int) string { return "Cached title" })
+
+	progress := 5
+	record(anilist.MutationRecord{
+		Time:    time.Unix(100, 0),
+		Input:   anilist.SaveMediaListEntryInput{Progress: &progress},
+		MediaID: 10,
+		Before:  &anilist.MediaListEntry{MediaID: 10, Progress: 4},
+	})
+	record(anilist.MutationRecord{Delete: true, EntryID: 3, Err: errors.New("offline")})
+
+	records, err := log.Read()
+	if err != nil {
+		t.Fatalf("Expected read to succeed, got %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	saved := records[0]
+	if saved.Account != "alice" || saved.UserID != 7 || saved.Title != "Cached title" || !saved.BeforeKnown || !saved.Succeeded() {
+		t.Errorf("Unexpected save record %+v", saved)
+	}
+	if len(saved.Changes) != 1 || saved.Changes[0] != (FieldChange{Field: "progress", Before: "4", After: "5"}) {
+		t.Errorf("Unexpected changes %+v", saved.Changes)
+	}
+	deleted := records[1]
+	if deleted.Action != ActionDelete || deleted.BeforeKnown || deleted.Error != "offline" || deleted.Title != "" {
+		t.Errorf("Unexpected delete record %+v", deleted)
+	}
+}
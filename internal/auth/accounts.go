@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// ErrUnknownAccount is returned when switching to an account that has not been logged in to.
+var ErrUnknownAccount = errors.New("unknown account")
+
+// Accounts is the set of AniList accounts the user has logged in to, keyed by account name.
+type Accounts struct {
+	Active   string              `json:"active"`
+	Sessions map[string]*Session `json:"sessions"`
+}
+
+// NewAccounts returns an empty set of accounts.
+func NewAccounts() *Accounts {
+	return &Accounts{Sessions: map[string]*Session{}}
+}
+
+// Name returns the name an account is stored under.  This is the AniList username.
+func (s *Session) Name() string {
+	return s.Username
+}
+
+// CacheKey returns a filesystem safe key for the account's cached data.  The user ID is used rather than the name
+// so the cache survives the user renaming their account.
+func (s *Session) CacheKey() string {
+	return strconv.Itoa(s.UserID)
+}
+
+// Add stores a session and makes it the active account.  Logging in to an account again replaces its session.
+func (a *Accounts) Add(session *Session) {
+	a.Sessions[session.Name()] = session
+	a.Active = session.Name()
+}
+
+// Remove deletes an account.  If it was the active account another account, if any, becomes active.
+func (a *Accounts) Remove(name string) {
+	delete(a.Sessions, name)
+	if a.Active != name {
+		return
+	}
+	a.Active = ""
+	if names := a.Names(); len(names) > 0 {
+		a.Active = names[0]
+	}
+}
+
+// Expire deletes an account whose session AniList no longer accepts.  Unlike Remove, no other account becomes
+// active, as the user is asked to log in again.
+func (a *Accounts) Expire(name string) {
+	delete(a.Sessions, name)
+	if a.Active == name {
+		a.Active = ""
+	}
+}
+
+// Switch makes the named account active.
+func (a *Accounts) Switch(name string) error {
+	if _, ok := a.Sessions[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownAccount, name)
+	}
+	a.Active = name
+	return nil
+}
+
+// ActiveSession returns the session of the active account, or nil if there are no accounts.
+func (a *Accounts) ActiveSession() *Session {
+	return a.Sessions[a.Active]
+}
+
+// Names returns the names of all accounts in alphabetical order.
+func (a *Accounts) Names() []string {
+	names := make([]string, 0, len(a.Sessions))
+	for name := range a.Sessions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SessionStore persists the logged in accounts to disk so the user stays logged in between runs.
+type SessionStore struct {
+	path string
+}
+
+// NewSessionStore returns a store in the user's config directory.
+func NewSessionStore() (*SessionStore, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user config directory: %w", err)
+	}
+	return NewSessionStoreAt(filepath.Join(configDir, "hisame", "accounts.json")), nil
+}
+
+// NewSessionStoreAt returns a store saving to the given file.
+func NewSessionStoreAt(path string) *SessionStore {
+	return &SessionStore{path: path}
+}
+
+// legacyPath is where a single session was saved before multiple accounts were supported.
+func (s *SessionStore) legacyPath() string {
+	return filepath.Join(filepath.Dir(s.path), "session.json")
+}
+
+// Load returns the saved accounts.  If nothing has been saved an empty set is returned.
+func (s *SessionStore) Load() (*Accounts, error) {
+	accounts := NewAccounts()
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s.loadLegacy()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, accounts); err != nil {
+		return nil, fmt.Errorf("failed to decode accounts file %s: %w", s.path, err)
+	}
+	if accounts.Sessions == nil {
+		accounts.Sessions = map[string]*Session{}
+	}
+	for name, session := range accounts.Sessions {
+		if session == nil || session.Token == "" {
+			delete(accounts.Sessions, name)
+			continue
+		}
+		session.refreshExpiry()
+	}
+	if accounts.ActiveSession() == nil {
+		accounts.Remove(accounts.Active)
+	}
+	return accounts, nil
+}
+
+// loadLegacy imports a session saved by a version of Hisame that only supported a single account.
+func (s *SessionStore) loadLegacy() (*Accounts, error) {
+	accounts := NewAccounts()
+	data, err := os.ReadFile(s.legacyPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return accounts, nil
+		}
+		return nil, err
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil || session.Token == "" {
+		logrus.Warnf("Ignoring unreadable legacy session file %s: %v", s.legacyPath(), err)
+		return accounts, nil
+	}
+	session.refreshExpiry()
+	accounts.Add(&session)
+	logrus.Infof("Imported legacy session for %s", session.Username)
+	return accounts, nil
+}
+
+// Save writes the accounts to disk.  The file is only readable by the current user as it contains the tokens.
+func (s *SessionStore) Save(accounts *Accounts) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create accounts directory: %w", err)
+	}
+	data, err := json.Marshal(accounts)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path, data, 0o600); err != nil {
+		return err
+	}
+	// Now the accounts file exists the legacy session has been migrated and is no longer needed.
+	if err := os.Remove(s.legacyPath()); err != nil && !os.IsNotExist(err) {
+		logrus.Warnf("Error removing legacy session file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAccounts(t *testing.T) {
+	accounts := NewAccounts()
+	if accounts.ActiveSession() != nil {
+		t.Fatal("Expected no active session for empty accounts")
+	}
+
+	main := &Session{Token: "main_token", UserID: 1, Username: "Main"}
+	alt := &Session{Token: "alt_token", UserID: 2, Username: "Alt"}
+	accounts.Add(main)
+	accounts.Add(alt)
+
+	if accounts.ActiveSession() != alt {
+		t.Fatal("Expected the last added account to be active")
+	}
+	if !reflect.DeepEqual(accounts.Names(), []string{"Alt", "Main"}) {
+		t.Fatalf("Expected sorted account names, got %v", accounts.Names())
+	}
+
+	if err := accounts.Switch("Main"); err != nil {
+		t.Fatalf("Expected switch to succeed, got %v", err)
+	}
+	if accounts.ActiveSession() != main {
+		t.Fatal("Expected Main to be active after switching")
+	}
+	if err := accounts.Switch("Nobody"); !errors.Is(err, ErrUnknownAccount) {
+		t.Fatalf("Expected ErrUnknownAccount, got %v", err)
+	}
+
+	// Logging in again replaces the session rather than adding a duplicate
+	renewed := &Session{Token: "new_main_token", UserID: 1, Username: "Main"}
+	accounts.Add(renewed)
+	if len(accounts.Sessions) != 2 || accounts.ActiveSession() != renewed {
+		t.Fatalf("Expected Main's session to be replaced, got %v", accounts.Sessions)
+	}
+
+	accounts.Remove("Main")
+	if accounts.Active != "Alt" {
+		t.Fatalf("Expected Alt to become active after removing Main, got '%s'", accounts.Active)
+	}
+	accounts.Remove("Alt")
+	if accounts.Active != "" || accounts.ActiveSession() != nil {
+		t.Fatal("Expected no active account after removing all accounts")
+	}
+
+	accounts.Add(&Session{Token: "alt_token", UserID: 2, Username: "Alt"})
+	accounts.Add(&Session{Token: "main_token", UserID: 1, Username: "Main"})
+	accounts.Expire("Main")
+	if accounts.Active != "" || len(accounts.Sessions) != 1 {
+		t.Fatalf("Expected no account to become active after Main expired, got '%s'", accounts.Active)
+	}
+}
+
+func TestSessionStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hisame", "accounts.json")
+	store := NewSessionStoreAt(path)
+
+	accounts, err := store.Load()
+	if err != nil || len(accounts.Sessions) != 0 {
+		t.Fatalf("Expected no accounts before saving, got %+v, %v", accounts, err)
+	}
+
+	accounts.Add(&Session{Token: "main_token", UserID: 1, Username: "Main"})
+	accounts.Add(&Session{Token: "alt_token", UserID: 2, Username: "Alt"})
+	if err := store.Save(accounts); err != nil {
+		t.Fatalf("Failed to save accounts: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected accounts file to exist: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("Expected accounts file permissions 0600, got %o", info.Mode().Perm())
+	}
+
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Failed to load accounts: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, accounts) {
+		t.Fatalf("Expected %+v, got %+v", accounts, loaded)
+	}
+}
+
+func TestSessionStore_MigratesLegacySession(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "hisame")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	legacy := filepath.Join(dir, "session.json")
+	if err := os.WriteFile(legacy, []byte(`{"token":"legacy_token","userId":3,"username":"Legacy"}`), 0o600); err != nil {
+		t.Fatalf("Failed to write legacy session: %v", err)
+	}
+
+	store := NewSessionStoreAt(filepath.Join(dir, "accounts.json"))
+	accounts, err := store.Load()
+	if err != nil {
+		t.Fatalf("Failed to load accounts: %v", err)
+	}
+	session := accounts.ActiveSession()
+	if session == nil || session.Username != "Legacy" || session.Token != "legacy_token" {
+		t.Fatalf("Expected legacy session to be imported, got %+v", session)
+	}
+
+	if err := store.Save(accounts); err != nil {
+		t.Fatalf("Failed to save accounts: %v", err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Fatal("Expected legacy session file to be removed once migrated")
+	}
+}
@@ -5,48 +5,171 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/StarTerrarium/hisame/internal/config"
 	"github.com/sirupsen/logrus"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 )
 
 const (
-	callbackPort = "19331"
-	callbackPath = "/callback"
-	tokenPath    = "/token"
-	clientID     = "18776"
+	defaultCallbackPort = 19331
+	defaultClientID     = "18776"
+	callbackPath        = "/callback"
+	tokenPath           = "/token"
 )
 
+// ErrNoCallbackPort is returned when none of the registered redirect URI ports could be bound.
+var ErrNoCallbackPort = errors.New("no callback port available")
+
+// Flow is the OAuth grant used to obtain an access token from AniList.
+type Flow string
+
+const (
+	// FlowImplicit receives the token directly in the callback URL fragment.
+	FlowImplicit Flow = "implicit"
+	// FlowCode receives an authorization code in the callback which is exchanged for a token.
+	FlowCode Flow = "code"
+)
+
+// RedirectURI pairs a local callback port with the AniList client whose registered redirect URI points at it.
+// ClientSecret is only required for the authorization code flow.
+type RedirectURI struct {
+	Port         int
+	ClientID     string
+	ClientSecret string
+}
+
+// String returns the redirect URI as it must be registered with AniList.
+func (r RedirectURI) String() string {
+	return fmt.Sprintf("http://localhost:%d%s", r.Port, callbackPath)
+}
+
 type Auth struct {
 	LoginURL     *url.URL
+	flow         Flow
+	redirectURIs []RedirectURI
 	tokenChannel chan string
+	errChannel   chan error
 	httpServer   *http.Server
+
+	// Only used by the authorization code flow
+	activeRedirect RedirectURI
+	state          string
+	tokenURL       string
+	httpClient     *http.Client
 }
 
+// NewAuth creates an Auth using the default Hisame client and callback port.
 func NewAuth() *Auth {
-	return &Auth{
-		LoginURL:     generateAuthURL(),
+	return NewAuthWithRedirects(RedirectURI{Port: defaultCallbackPort, ClientID: defaultClientID})
+}
+
+// NewAuthFromConfig creates an Auth from the user's auth configuration.  The configured callback port is tried
+// first, followed by each port in the fallback range that has a client registered for it.
+func NewAuthFromConfig(cfg config.AuthConfig) *Auth {
+	clientID := cfg.ClientID
+	if clientID == "" {
+		clientID = defaultClientID
+	}
+	port := cfg.CallbackPort
+	if port == 0 {
+		port = defaultCallbackPort
+	}
+
+	redirects := []RedirectURI{{Port: port, ClientID: clientID, ClientSecret: cfg.ClientSecret}}
+	if id, ok := cfg.RedirectClients[port]; ok {
+		redirects[0].ClientID = id
+		redirects[0].ClientSecret = cfg.RedirectClientSecrets[port]
+	}
+	for p := port + 1; p <= port+cfg.CallbackPortRange; p++ {
+		id, ok := cfg.RedirectClients[p]
+		if !ok {
+			logrus.Debugf("Skipping fallback callback port %d as it has no registered client", p)
+			continue
+		}
+		redirects = append(redirects, RedirectURI{Port: p, ClientID: id, ClientSecret: cfg.RedirectClientSecrets[p]})
+	}
+
+	auth := NewAuthWithRedirects(redirects...)
+	switch Flow(cfg.Flow) {
+	case FlowCode:
+		auth.SetFlow(FlowCode)
+	case FlowImplicit, "":
+	default:
+		logrus.Warnf("Unknown auth flow '%s' in configuration; using the implicit flow", cfg.Flow)
+	}
+	return auth
+}
+
+// NewAuthWithRedirects creates an Auth that will try each redirect URI in order when starting the callback server.
+func NewAuthWithRedirects(redirects ...RedirectURI) *Auth {
+	auth := &Auth{
+		flow:         FlowImplicit,
 		tokenChannel: make(chan string, 1),
+		errChannel:   make(chan error, 1),
 		httpServer:   nil,
+		tokenURL:     defaultTokenURL,
+		httpClient:   &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, r := range redirects {
+		auth.RegisterRedirectURI(r)
+	}
+	return auth
+}
+
+// RegisterRedirectURI adds a redirect URI to the list of candidates for the callback server.  The first
+// registered redirect determines the initial LoginURL.
+func (auth *Auth) RegisterRedirectURI(redirect RedirectURI) {
+	auth.redirectURIs = append(auth.redirectURIs, redirect)
+	if auth.LoginURL == nil {
+		auth.LoginURL = auth.buildLoginURL(redirect)
+	}
+}
+
+// SetFlow changes the OAuth grant used for the next login attempt.
+func (auth *Auth) SetFlow(flow Flow) {
+	auth.flow = flow
+	if len(auth.redirectURIs) > 0 {
+		auth.LoginURL = auth.buildLoginURL(auth.redirectURIs[0])
+	}
+}
+
+// buildLoginURL returns the authorize URL for the current flow.
+func (auth *Auth) buildLoginURL(redirect RedirectURI) *url.URL {
+	if auth.flow == FlowCode {
+		return generateCodeAuthURL(redirect, auth.state)
 	}
+	return generateAuthURL(redirect.ClientID)
 }
 
-// StartCallbackServer starts the HTTP server listening for the callback from AniList.
+// StartCallbackServer starts the HTTP server listening for the callback from AniList.  Each registered redirect
+// URI is tried in order, and LoginURL is updated to use the client matching the port that was bound.
 func (auth *Auth) StartCallbackServer() error {
 	logrus.Info("Starting auth callback server.")
 
 	mux := http.NewServeMux()
-	mux.HandleFunc(callbackPath, handleCallback)
+	mux.HandleFunc(callbackPath, auth.callbackHandler())
 	mux.HandleFunc(tokenPath, auth.handleToken())
 
 	// Create auth listener early so we can report an error if we can't secure the port.
-	listener, err := net.Listen("tcp", ":"+callbackPort)
+	listener, redirect, err := auth.listen()
 	if err != nil {
-		logrus.Errorf("Could not listen on port %s: %v", callbackPort, err)
 		return err
 	}
+	auth.activeRedirect = redirect
+	if auth.flow == FlowCode {
+		// A fresh state for every attempt, so a callback from an older attempt can't be replayed.
+		auth.state, err = generateState()
+		if err != nil {
+			listener.Close()
+			return err
+		}
+	}
+	auth.LoginURL = auth.buildLoginURL(redirect)
+	logrus.Infof("Auth callback server listening on %s", redirect)
 
 	auth.httpServer = &http.Server{
 		Handler: mux,
@@ -61,6 +184,20 @@ func (auth *Auth) StartCallbackServer() error {
 	return nil
 }
 
+// listen binds the first available port out of the registered redirect URIs.
+func (auth *Auth) listen() (net.Listener, RedirectURI, error) {
+	for _, redirect := range auth.redirectURIs {
+		listener, err := net.Listen("tcp", ":"+strconv.Itoa(redirect.Port))
+		if err != nil {
+			logrus.Warnf("Could not listen on port %d: %v", redirect.Port, err)
+			continue
+		}
+		return listener, redirect, nil
+	}
+	logrus.Errorf("Could not listen on any of the %d registered callback ports", len(auth.redirectURIs))
+	return nil, RedirectURI{}, ErrNoCallbackPort
+}
+
 // WaitForToken sits and waits for a token to be received on the channel.  This is a way to block and wait
 // for a token.  Also accepts a context as an arg so we can stop waiting if the user cancels the login flow.
 func (auth *Auth) WaitForToken(ctx context.Context) (string, error) {
@@ -73,6 +210,9 @@ func (auth *Auth) WaitForToken(ctx context.Context) (string, error) {
 	case <-ctx.Done():
 		logrus.Debug("WaitForToken exiting because context is done")
 		return "", ctx.Err()
+	case err := <-auth.errChannel:
+		logrus.Warnf("Login failed: %v", err)
+		return "", err
 	case token, ok := <-auth.tokenChannel:
 		if !ok || token == "" {
 			logrus.Warn("Failed to receive token")
@@ -97,8 +237,8 @@ func (auth *Auth) StopCallbackServer() {
 	logrus.Debug("Callback server shutdown successfully")
 }
 
-func generateAuthURL() *url.URL {
-	loginURL, err := url.Parse(fmt.Sprintf("https://anilist.co/api/v2/oauth/authorize?client_id=%s&response_type=token", clientID))
+func generateAuthURL(clientID string) *url.URL {
+	loginURL, err := url.Parse(fmt.Sprintf("https://anilist.co/api/v2/oauth/authorize?client_id=%s&response_type=token", url.QueryEscape(clientID)))
 	if err != nil {
 		// For simplicity simply kill the application for now.
 		logrus.Panicf("Failed to generate auth url: %v", err)
@@ -123,7 +263,7 @@ func (auth *Auth) handleToken() http.HandlerFunc {
 		logrus.Debugf("Token decoded: %s", data.Token)
 
 		// Send the token to the channel
-		auth.tokenChannel <- data.Token
+		auth.sendToken(data.Token)
 
 		// Send auth success response back
 		w.Header().Set("Content-Type", "application/json")
@@ -131,6 +271,23 @@ func (auth *Auth) handleToken() http.HandlerFunc {
 	}
 }
 
+// callbackHandler dispatches the callback from AniList.  Errors reported by AniList are shown to the user and
+// end the login attempt, otherwise the request is handled according to the configured flow.
+func (auth *Auth) callbackHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("error") != "" {
+			auth.handleProviderError(w, query)
+			return
+		}
+		if auth.flow == FlowCode {
+			auth.handleCodeCallback(w, r)
+			return
+		}
+		handleCallback(w, r)
+	}
+}
+
 // handleCallback handles the callback from AniList after auth is successful.
 // As we are using the implicit grant, the token is passed along as a URL fragment.  This is why we are returning
 // some javascript in the page to have the browser extract that token, and forward it to our /token POST endpoint
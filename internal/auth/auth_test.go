@@ -8,9 +8,12 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/StarTerrarium/hisame/internal/config"
 )
 
 func TestNewAuth(t *testing.T) {
@@ -203,8 +206,105 @@ func TestStopCallbackServer(t *testing.T) {
 	a.StopCallbackServer()
 
 	// Verify that the server is no longer accepting connections
-	_, err = net.DialTimeout("tcp", ":"+callbackPort, 100*time.Millisecond)
+	_, err = net.DialTimeout("tcp", ":"+strconv.Itoa(defaultCallbackPort), 100*time.Millisecond)
 	if err == nil {
 		t.Fatal("Expected connection to fail after server is stopped")
 	}
 }
+
+// freePort returns a port that was free at the time of calling.
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestNewAuthFromConfig(t *testing.T) {
+	cfg := config.AuthConfig{
+		ClientID:          "111",
+		CallbackPort:      20000,
+		CallbackPortRange: 3,
+		RedirectClients:   map[int]string{20002: "222", 20003: "333", 20010: "999"},
+	}
+	a := NewAuthFromConfig(cfg)
+
+	expected := []RedirectURI{{Port: 20000, ClientID: "111"}, {Port: 20002, ClientID: "222"}, {Port: 20003, ClientID: "333"}}
+	if len(a.redirectURIs) != len(expected) {
+		t.Fatalf("Expected %d redirect URIs, got %v", len(expected), a.redirectURIs)
+	}
+	for i, r := range expected {
+		if a.redirectURIs[i] != r {
+			t.Errorf("Expected redirect %d to be %v, got %v", i, r, a.redirectURIs[i])
+		}
+	}
+
+	if !strings.Contains(a.LoginURL.String(), "client_id=111") {
+		t.Fatalf("Expected LoginURL to use the primary client, got %s", a.LoginURL.String())
+	}
+}
+
+func TestNewAuthFromConfig_Defaults(t *testing.T) {
+	a := NewAuthFromConfig(config.AuthConfig{})
+	if len(a.redirectURIs) != 1 || a.redirectURIs[0] != (RedirectURI{Port: defaultCallbackPort, ClientID: defaultClientID}) {
+		t.Fatalf("Expected only the default redirect URI, got %v", a.redirectURIs)
+	}
+}
+
+func TestStartCallbackServer_FallbackPort(t *testing.T) {
+	// Hold the primary port to simulate another application using it
+	blocker, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer blocker.Close()
+	takenPort := blocker.Addr().(*net.TCPAddr).Port
+	fallbackPort := freePort(t)
+
+	a := NewAuthWithRedirects(
+		RedirectURI{Port: takenPort, ClientID: "primary"},
+		RedirectURI{Port: fallbackPort, ClientID: "fallback"},
+	)
+	if err := a.StartCallbackServer(); err != nil {
+		t.Fatalf("Expected StartCallbackServer to fall back to port %d, got %v", fallbackPort, err)
+	}
+	defer a.StopCallbackServer()
+
+	if !strings.Contains(a.LoginURL.String(), "client_id=fallback") {
+		t.Fatalf("Expected LoginURL to use the fallback client, got %s", a.LoginURL.String())
+	}
+
+	conn, err := net.DialTimeout("tcp", ":"+strconv.Itoa(fallbackPort), 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Expected callback server to be listening on fallback port: %v", err)
+	}
+	conn.Close()
+}
+
+func TestStartCallbackServer_AllPortsTaken(t *testing.T) {
+	var redirects []RedirectURI
+	for i := 0; i < 2; i++ {
+		blocker, err := net.Listen("tcp", ":0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		defer blocker.Close()
+		redirects = append(redirects, RedirectURI{Port: blocker.Addr().(*net.TCPAddr).Port, ClientID: strconv.Itoa(i)})
+	}
+
+	a := NewAuthWithRedirects(redirects...)
+	err := a.StartCallbackServer()
+	if !errors.Is(err, ErrNoCallbackPort) {
+		t.Fatalf("Expected ErrNoCallbackPort, got %v", err)
+	}
+}
+
+func TestRedirectURIString(t *testing.T) {
+	r := RedirectURI{Port: 19332, ClientID: "1"}
+	if r.String() != "http://localhost:19332/callback" {
+		t.Fatalf("Unexpected redirect URI %s", r.String())
+	}
+}
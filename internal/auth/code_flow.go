@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const defaultTokenURL = "https://anilist.co/api/v2/oauth/token"
+
+var (
+	// ErrAccessDenied is returned when the user declines to authorise Hisame on AniList.
+	ErrAccessDenied = errors.New("access denied by user")
+	// ErrProvider is returned when AniList reports any other error on the callback.
+	ErrProvider = errors.New("AniList returned an error")
+	// ErrTokenExchange is returned when an authorization code could not be exchanged for a token.
+	ErrTokenExchange = errors.New("failed to exchange authorization code")
+)
+
+var resultPage = template.Must(template.New("result").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Hisame Auth</title>
+</head>
+<body>
+    <h1>{{.Heading}}</h1>
+    {{if .Detail}}<p>{{.Detail}}</p>{{end}}
+</body>
+</html>
+`))
+
+// generateCodeAuthURL builds the authorize URL for the authorization code grant.  Unlike the implicit grant the
+// redirect URI must be sent, and must exactly match the one registered for the client.
+func generateCodeAuthURL(redirect RedirectURI, state string) *url.URL {
+	query := url.Values{}
+	query.Set("client_id", redirect.ClientID)
+	query.Set("redirect_uri", redirect.String())
+	query.Set("response_type", "code")
+	if state != "" {
+		query.Set("state", state)
+	}
+	loginURL, err := url.Parse("https://anilist.co/api/v2/oauth/authorize?" + query.Encode())
+	if err != nil {
+		logrus.Panicf("Failed to generate auth url: %v", err)
+		panic("Failed to generate auth url.  Exiting application.")
+	}
+	return loginURL
+}
+
+// generateState returns a random value for the OAuth state parameter, used to reject callbacks that were not
+// initiated by this login attempt.
+func generateState() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate OAuth state: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// handleProviderError renders an error page for an error AniList reported on the callback, and ends the login.
+func (auth *Auth) handleProviderError(w http.ResponseWriter, query url.Values) {
+	providerErr := query.Get("error")
+	description := query.Get("error_description")
+	logrus.Warnf("AniList returned error on callback: %s (%s)", providerErr, description)
+
+	var err error
+	if providerErr == "access_denied" {
+		err = ErrAccessDenied
+		renderResultPage(w, http.StatusForbidden, "Login cancelled.  Hisame was not given access to your account.", "You can close this window and try again from Hisame.")
+	} else {
+		err = fmt.Errorf("%w: %s %s", ErrProvider, providerErr, description)
+		renderResultPage(w, http.StatusBadRequest, "AniList reported an error during login.", providerErr+": "+description)
+	}
+	auth.sendError(err)
+}
+
+// handleCodeCallback validates the state and exchanges the authorization code for an access token.
+func (auth *Auth) handleCodeCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	state := query.Get("state")
+	if auth.state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(auth.state)) != 1 {
+		// Don't end the login attempt here.  A forged request shouldn't be able to cancel a genuine login.
+		logrus.Warn("Rejected auth callback with invalid state")
+		renderResultPage(w, http.StatusBadRequest, "Invalid login request.", "The request did not originate from this login attempt.  Please start the login again from Hisame.")
+		return
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		renderResultPage(w, http.StatusBadRequest, "No authorization code found in the request.", "")
+		return
+	}
+
+	token, err := auth.exchangeCode(r.Context(), code)
+	if err != nil {
+		logrus.Errorf("Error exchanging authorization code: %v", err)
+		renderResultPage(w, http.StatusBadGateway, "Error retrieving token.", err.Error())
+		auth.sendError(err)
+		return
+	}
+
+	auth.sendToken(token)
+	renderResultPage(w, http.StatusOK, "Token fetched successfully.  You can close this window.", "")
+}
+
+// exchangeCode swaps an authorization code for an access token at the token endpoint.
+func (auth *Auth) exchangeCode(ctx context.Context, code string) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"grant_type":    "authorization_code",
+		"client_id":     auth.activeRedirect.ClientID,
+		"client_secret": auth.activeRedirect.ClientSecret,
+		"redirect_uri":  auth.activeRedirect.String(),
+		"code":          code,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, auth.tokenURL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := auth.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrTokenExchange, err)
+	}
+	defer resp.Body.Close()
+
+	var data struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+		Message     string `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", fmt.Errorf("%w: invalid response (status %d): %v", ErrTokenExchange, resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || data.AccessToken == "" {
+		reason := data.Error
+		if data.Message != "" {
+			reason = data.Message
+		}
+		return "", fmt.Errorf("%w: status %d: %s", ErrTokenExchange, resp.StatusCode, reason)
+	}
+	return data.AccessToken, nil
+}
+
+// sendToken hands a token to WaitForToken.  Like sendError it never blocks, so a repeated callback, such as a double
+// submit or a browser retry, can't leave its request hanging.
+func (auth *Auth) sendToken(token string) {
+	select {
+	case auth.tokenChannel <- token:
+	default:
+		logrus.Debug("Dropping token as one is already pending")
+	}
+}
+
+// sendError reports a failed login to WaitForToken.  It never blocks, so repeated callbacks after the first
+// failure are simply dropped.
+func (auth *Auth) sendError(err error) {
+	select {
+	case auth.errChannel <- err:
+	default:
+		logrus.Debugf("Dropping login error as one is already pending: %v", err)
+	}
+}
+
+func renderResultPage(w http.ResponseWriter, status int, heading, detail string) {
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(status)
+	err := resultPage.Execute(w, struct{ Heading, Detail string }{heading, detail})
+	if err != nil {
+		logrus.Errorf("Error rendering auth result page: %v", err)
+	}
+}
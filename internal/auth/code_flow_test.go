@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StarTerrarium/hisame/internal/config"
+)
+
+// newFakeTokenEndpoint starts a server that behaves like the AniList token endpoint, accepting only validCode.
+func newFakeTokenEndpoint(t *testing.T, validCode string) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if body["grant_type"] != "authorization_code" || body["code"] != validCode || body["client_secret"] != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_request", "message": "The authorization code is invalid"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token_type":   "Bearer",
+			"expires_in":   31536000,
+			"access_token": "exchanged_token",
+		})
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func newCodeFlowAuth(t *testing.T, tokenURL string) *Auth {
+	t.Helper()
+	a := NewAuthWithRedirects(RedirectURI{Port: freePort(t), ClientID: "123", ClientSecret: "secret"})
+	a.SetFlow(FlowCode)
+	a.tokenURL = tokenURL
+	if err := a.StartCallbackServer(); err != nil {
+		t.Fatalf("Failed to start callback server: %v", err)
+	}
+	t.Cleanup(a.StopCallbackServer)
+	return a
+}
+
+func callbackURL(a *Auth, query string) string {
+	return "http://localhost:" + strconv.Itoa(a.activeRedirect.Port) + callbackPath + "?" + query
+}
+
+func TestNewAuthFromConfig_CodeFlow(t *testing.T) {
+	a := NewAuthFromConfig(config.AuthConfig{Flow: "code", ClientID: "123", ClientSecret: "secret"})
+	if a.flow != FlowCode {
+		t.Fatalf("Expected code flow, got %s", a.flow)
+	}
+	if a.redirectURIs[0].ClientSecret != "secret" {
+		t.Fatal("Expected client secret to be set on the primary redirect URI")
+	}
+	if a.LoginURL.Query().Get("response_type") != "code" {
+		t.Fatalf("Expected response_type=code in LoginURL, got %s", a.LoginURL)
+	}
+}
+
+func TestStartCallbackServer_CodeFlowLoginURL(t *testing.T) {
+	a := newCodeFlowAuth(t, "")
+
+	query := a.LoginURL.Query()
+	if query.Get("state") == "" || query.Get("state") != a.state {
+		t.Fatalf("Expected LoginURL to carry the generated state, got %s", a.LoginURL)
+	}
+	if query.Get("redirect_uri") != a.activeRedirect.String() {
+		t.Fatalf("Expected redirect_uri %s, got %s", a.activeRedirect.String(), query.Get("redirect_uri"))
+	}
+	if query.Get("client_id") != "123" {
+		t.Fatalf("Expected client_id 123, got %s", query.Get("client_id"))
+	}
+}
+
+func TestCodeFlow_ExchangesCode(t *testing.T) {
+	tokenServer := newFakeTokenEndpoint(t, "good_code")
+	a := newCodeFlowAuth(t, tokenServer.URL)
+
+	resp, err := http.Get(callbackURL(a, "code=good_code&state="+a.state))
+	if err != nil {
+		t.Fatalf("Callback request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	token, err := a.WaitForToken(ctx)
+	if err != nil {
+		t.Fatalf("Expected token, got error %v", err)
+	}
+	if token != "exchanged_token" {
+		t.Fatalf("Expected 'exchanged_token', got '%s'", token)
+	}
+}
+
+func TestCodeFlow_RepeatedCallback(t *testing.T) {
+	tokenServer := newFakeTokenEndpoint(t, "good_code")
+	a := newCodeFlowAuth(t, tokenServer.URL)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(callbackURL(a, "code=good_code&state="+a.state))
+		if err != nil {
+			t.Fatalf("Expected callback %d to complete, got %v", i+1, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if token, err := a.WaitForToken(ctx); err != nil || token != "exchanged_token" {
+		t.Fatalf("Expected 'exchanged_token', got '%s' (%v)", token, err)
+	}
+}
+
+func TestCodeFlow_RejectsInvalidState(t *testing.T) {
+	tokenServer := newFakeTokenEndpoint(t, "good_code")
+	a := newCodeFlowAuth(t, tokenServer.URL)
+
+	resp, err := http.Get(callbackURL(a, "code=good_code&state=forged"))
+	if err != nil {
+		t.Fatalf("Callback request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", resp.StatusCode)
+	}
+
+	select {
+	case token := <-a.tokenChannel:
+		t.Fatalf("Expected no token for a forged state, got '%s'", token)
+	case err := <-a.errChannel:
+		t.Fatalf("Expected a forged state not to end the login, got %v", err)
+	default:
+	}
+}
+
+func TestCodeFlow_ExchangeFailure(t *testing.T) {
+	tokenServer := newFakeTokenEndpoint(t, "good_code")
+	a := newCodeFlowAuth(t, tokenServer.URL)
+
+	resp, err := http.Get(callbackURL(a, "code=bad_code&state="+a.state))
+	if err != nil {
+		t.Fatalf("Callback request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("Expected status 502, got %d", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = a.WaitForToken(ctx)
+	if !errors.Is(err, ErrTokenExchange) {
+		t.Fatalf("Expected ErrTokenExchange, got %v", err)
+	}
+}
+
+func TestCallback_AccessDenied(t *testing.T) {
+	for _, flow := range []Flow{FlowImplicit, FlowCode} {
+		t.Run(string(flow), func(t *testing.T) {
+			a := NewAuth()
+			a.SetFlow(flow)
+
+			req := httptest.NewRequest("GET", "/callback?error=access_denied&error_description=The+resource+owner+denied+the+request", nil)
+			w := httptest.NewRecorder()
+			a.callbackHandler()(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusForbidden {
+				t.Fatalf("Expected status 403, got %d", resp.StatusCode)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if !strings.Contains(string(body), "Login cancelled") {
+				t.Fatalf("Expected access denied page, got %s", body)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			_, err := a.WaitForToken(ctx)
+			if !errors.Is(err, ErrAccessDenied) {
+				t.Fatalf("Expected ErrAccessDenied, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCallback_ProviderErrorIsEscaped(t *testing.T) {
+	a := NewAuth()
+
+	req := httptest.NewRequest("GET", "/callback?error=server_error&error_description=%3Cscript%3E", nil)
+	w := httptest.NewRecorder()
+	a.callbackHandler()(w, req)
+
+	body, _ := io.ReadAll(w.Result().Body)
+	if strings.Contains(string(body), "<script>") {
+		t.Fatal("Expected provider error description to be HTML escaped")
+	}
+	if err := <-a.errChannel; !errors.Is(err, ErrProvider) {
+		t.Fatalf("Expected ErrProvider, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/sirupsen/logrus"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned when a token is rejected by AniList, or is obviously malformed.
+var ErrInvalidToken = errors.New("invalid token")
+
+// Session is an authenticated AniList user along with the token used to access their account.
+type Session struct {
+	Token     string    `json:"token"`
+	UserID    int       `json:"userId"`
+	Username  string    `json:"username"`
+	AvatarURL string    `json:"avatarUrl"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+}
+
+// VerifyToken checks a token against AniList with a Viewer query, and returns the session it belongs to.
+func VerifyToken(ctx context.Context, token string) (*Session, error) {
+	return VerifyTokenWithClient(ctx, anilist.NewClient(token), token)
+}
+
+// VerifyTokenWithClient is VerifyToken using the provided client, which must be authenticated with token.
+func VerifyTokenWithClient(ctx context.Context, client *anilist.Client, token string) (*Session, error) {
+	viewer, err := client.Viewer(ctx)
+	if err != nil {
+		var apiErr *anilist.APIError
+		if errors.As(err, &apiErr) && (apiErr.StatusCode == 400 || apiErr.StatusCode == 401) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+		}
+		return nil, err
+	}
+	if viewer == nil {
+		return nil, fmt.Errorf("%w: no viewer returned for token", ErrInvalidToken)
+	}
+	logrus.Infof("Token verified for AniList user %s", viewer.Name)
+	session := &Session{
+		Token:     token,
+		UserID:    viewer.ID,
+		Username:  viewer.Name,
+		AvatarURL: viewer.Avatar.Medium,
+	}
+	session.refreshExpiry()
+	return session, nil
+}
+
+// refreshExpiry sets ExpiresAt from the token's exp claim, if it has one.
+func (s *Session) refreshExpiry() {
+	expiry, err := TokenExpiry(s.Token)
+	if err != nil {
+		logrus.Warnf("Unable to determine token expiry: %v", err)
+		return
+	}
+	s.ExpiresAt = expiry
+	logrus.Infof("AniList token expires at %s", expiry.Format(time.RFC1123))
+}
+
+// ParseTokenInput extracts an access token from text pasted by the user.  This accepts the bare token, or the
+// full URL the browser was redirected to after login, where the token is in the fragment or the query.
+func ParseTokenInput(input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", fmt.Errorf("%w: no token provided", ErrInvalidToken)
+	}
+
+	if index := strings.Index(input, "access_token="); index >= 0 {
+		// The token is normally in the fragment, but look in the query too.  Input that is only the fragment
+		// has neither, so the text from access_token= onwards is used instead.
+		var candidates []string
+		if parsed, err := url.Parse(input); err == nil && (parsed.Fragment != "" || parsed.RawQuery != "") {
+			candidates = append(candidates, parsed.Fragment, parsed.RawQuery)
+		} else {
+			candidates = append(candidates, input[index:])
+		}
+		for _, candidate := range candidates {
+			if params, err := url.ParseQuery(candidate); err == nil && params.Get("access_token") != "" {
+				return params.Get("access_token"), nil
+			}
+		}
+		return "", fmt.Errorf("%w: could not find access_token in %q", ErrInvalidToken, input)
+	}
+
+	if strings.ContainsAny(input, " \t\n") {
+		return "", fmt.Errorf("%w: token contains whitespace", ErrInvalidToken)
+	}
+	return input, nil
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/StarTerrarium/hisame/internal/anilist"
+)
+
+func TestParseTokenInput(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"BareToken", "abc.def.ghi", "abc.def.ghi", false},
+		{"SurroundingWhitespace", "  abc.def.ghi\n", "abc.def.ghi", false},
+		{"RedirectURL", "http://localhost:19331/callback#access_token=abc.def.ghi&token_type=Bearer&expires_in=31536000", "abc.def.ghi", false},
+		{"QueryWithFragment", "https://anilist.co/?access_token=abc.def.ghi#frag", "abc.def.ghi", false},
+		{"FragmentOnly", "access_token=abc.def.ghi&token_type=Bearer", "abc.def.ghi", false},
+		{"Empty", "   ", "", true},
+		{"InnerWhitespace", "abc def", "", true},
+		{"MissingToken", "http://localhost:19331/callback#access_token=", "", true},
+		{"MissingTokenWithFragment", "https://anilist.co/?access_token=#frag", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := ParseTokenInput(tc.input)
+			if tc.wantErr {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("Expected ErrInvalidToken, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if token != tc.expected {
+				t.Fatalf("Expected token '%s', got '%s'", tc.expected, token)
+			}
+		})
+	}
+}
+
+func TestVerifyTokenWithClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Authorization") != "Bearer good_token" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"data":null,"errors":[{"message":"Invalid token","status":400}]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"Viewer":{"id":7,"name":"Tester","avatar":{"medium":"https://example.com/m.png"}}}}`))
+	}))
+	defer ts.Close()
+
+	session, err := VerifyTokenWithClient(context.Background(), anilist.NewClientWithEndpoint(ts.URL, "good_token"), "good_token")
+	if err != nil {
+		t.Fatalf("Expected token to verify, got %v", err)
+	}
+	if session.Username != "Tester" || session.UserID != 7 || session.Token != "good_token" {
+		t.Fatalf("Unexpected session %+v", session)
+	}
+
+	_, err = VerifyTokenWithClient(context.Background(), anilist.NewClientWithEndpoint(ts.URL, "bad_token"), "bad_token")
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Expected ErrInvalidToken, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ExpiryWarningPeriod is how long before a token expires that the user starts being warned about it.
+const ExpiryWarningPeriod = 14 * 24 * time.Hour
+
+// TokenExpiry decodes the exp claim of an AniList access token, which is a JWT.  The signature is not checked, as
+// AniList is the only party that can verify it.  The expiry is only used to warn the user ahead of time.
+func TokenExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("%w: not a JWT", ErrInvalidToken)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: could not decode JWT payload: %v", ErrInvalidToken, err)
+	}
+
+	var claims struct {
+		Exp json.Number `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("%w: could not parse JWT claims: %v", ErrInvalidToken, err)
+	}
+	if claims.Exp == "" {
+		return time.Time{}, fmt.Errorf("%w: JWT has no exp claim", ErrInvalidToken)
+	}
+	exp, err := claims.Exp.Float64()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: invalid exp claim %q", ErrInvalidToken, claims.Exp)
+	}
+	return time.Unix(int64(exp), 0), nil
+}
+
+// Expired reports whether the session's token has passed its expiry time.  Sessions with an unknown expiry are
+// never considered expired; the API will tell us if they are.
+func (s *Session) Expired(now time.Time) bool {
+	return !s.ExpiresAt.IsZero() && !now.Before(s.ExpiresAt)
+}
+
+// ExpiresSoon reports whether the session's token expires within ExpiryWarningPeriod.
+func (s *Session) ExpiresSoon(now time.Time) bool {
+	return !s.ExpiresAt.IsZero() && now.Add(ExpiryWarningPeriod).After(s.ExpiresAt)
+}
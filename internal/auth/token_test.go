@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+// makeJWT builds an unsigned JWT with the given claims payload.
+func makeJWT(claims string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"RS256"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(claims))
+	return header + "." + payload + ".signature"
+}
+
+func TestTokenExpiry(t *testing.T) {
+	expiry, err := TokenExpiry(makeJWT(`{"aud":"18776","jti":"abc","iat":1700000000,"nbf":1700000000,"exp":1731536000,"sub":"1","scopes":[]}`))
+	if err != nil {
+		t.Fatalf("Expected expiry to decode, got %v", err)
+	}
+	if !expiry.Equal(time.Unix(1731536000, 0)) {
+		t.Fatalf("Expected expiry %v, got %v", time.Unix(1731536000, 0), expiry)
+	}
+
+	// AniList encodes exp as a float
+	expiry, err = TokenExpiry(makeJWT(`{"exp":1731536000.5}`))
+	if err != nil || expiry.Unix() != 1731536000 {
+		t.Fatalf("Expected float exp to decode, got %v, %v", expiry, err)
+	}
+}
+
+func TestTokenExpiry_Invalid(t *testing.T) {
+	testCases := map[string]string{
+		"NotJWT":     "not-a-jwt",
+		"BadPayload": "a.!!!.c",
+		"NotJSON":    makeJWT("nope"),
+		"NoExp":      makeJWT(`{"sub":"1"}`),
+	}
+	for name, token := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := TokenExpiry(token); !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("Expected ErrInvalidToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	now := time.Now()
+
+	testCases := []struct {
+		name        string
+		expiresAt   time.Time
+		expired     bool
+		expiresSoon bool
+	}{
+		{"Unknown", time.Time{}, false, false},
+		{"FarFuture", now.Add(300 * 24 * time.Hour), false, false},
+		{"WithinWarning", now.Add(3 * 24 * time.Hour), false, true},
+		{"Past", now.Add(-time.Hour), true, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Session{ExpiresAt: tc.expiresAt}
+			if s.Expired(now) != tc.expired {
+				t.Errorf("Expected Expired to be %v", tc.expired)
+			}
+			if s.ExpiresSoon(now) != tc.expiresSoon {
+				t.Errorf("Expected ExpiresSoon to be %v", tc.expiresSoon)
+			}
+		})
+	}
+}
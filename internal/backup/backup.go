@@ -0,0 +1,169 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/mal"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// formatVersion is bumped whenever the backup format changes incompatibly.
+const formatVersion = 1
+
+var (
+	// ErrNotBackup is returned when reading a file that isn't a Hisame backup.
+	ErrNotBackup = errors.New("not a Hisame backup")
+	// ErrUnsupportedVersion is returned when reading a backup written by a newer version of Hisame.
+	ErrUnsupportedVersion = errors.New("unsupported backup version")
+	// ErrSingleListFormat is returned when exporting both lists to a format that only holds one.
+	ErrSingleListFormat = errors.New("format holds a single list; choose anime or manga")
+)
+
+// MediaTypes are the lists a backup holds, in the order they are exported.
+var MediaTypes = []anilist.MediaType{anilist.MediaTypeAnime, anilist.MediaTypeManga}
+
+// Format is a file format lists can be exported to.
+type Format string
+
+const (
+	// FormatJSON is Hisame's own lossless backup format, which can be restored from.
+	FormatJSON Format = "json"
+	// FormatCSV is a flat table of entries for spreadsheets.
+	FormatCSV Format = "csv"
+	// FormatMAL is MyAnimeList's XML export format, for importing into other sites.
+	FormatMAL Format = "xml"
+)
+
+// Formats are all export formats, in the order they are offered.
+var Formats = []Format{FormatJSON, FormatCSV, FormatMAL}
+
+// Extension returns the file extension for the format, including the dot.
+func (f Format) Extension() string {
+	return "." + string(f)
+}
+
+// Backup is a complete copy of a user's lists.  It keeps everything AniList returns for each entry, including
+// notes, custom lists, advanced scores and fuzzy dates, as well as the lists themselves.
+type Backup struct {
+	Version     int                 `json:"version"`
+	CreatedAt   time.Time           `json:"createdAt"`
+	UserID      int                 `json:"userId"`
+	Username    string              `json:"username"`
+	ScoreFormat anilist.ScoreFormat `json:"scoreFormat"`
+	// Lists holds a collection for every media type backed up.
+	Lists map[anilist.MediaType]*anilist.MediaListCollection `json:"lists"`
+}
+
+// ListSource fetches one of the user's lists.
+type ListSource func(ctx context.Context, mediaType anilist.MediaType) (*anilist.MediaListCollection, error)
+
+// Create backs up the viewer's anime and manga lists, fetched from source.
+func Create(ctx context.Context, viewer *anilist.Viewer, source ListSource) (*Backup, error) {
+	b := &Backup{
+		Version:     formatVersion,
+		CreatedAt:   time.Now().UTC(),
+		UserID:      viewer.ID,
+		Username:    viewer.Name,
+		ScoreFormat: viewer.MediaListOptions.ScoreFormat,
+		Lists:       map[anilist.MediaType]*anilist.MediaListCollection{},
+	}
+	for _, mediaType := range MediaTypes {
+		collection, err := source(ctx, mediaType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s list: %w", mediaType, err)
+		}
+		b.Lists[mediaType] = collection
+	}
+	return b, nil
+}
+
+// Entries returns every entry on the list of the given media type once.
+func (b *Backup) Entries(mediaType anilist.MediaType) []*anilist.MediaListEntry {
+	collection := b.Lists[mediaType]
+	if collection == nil {
+		return nil
+	}
+	return collection.Entries()
+}
+
+// Export writes the lists in the given format.  An empty mediaType exports both lists, which the MyAnimeList
+// format can't hold.
+func (b *Backup) Export(w io.Writer, format Format, mediaType anilist.MediaType) error {
+	switch format {
+	case FormatJSON:
+		if mediaType != "" {
+			b = b.only(mediaType)
+		}
+		return Write(w, b)
+	case FormatCSV:
+		types := MediaTypes
+		if mediaType != "" {
+			types = []anilist.MediaType{mediaType}
+		}
+		return b.WriteCSV(w, types)
+	case FormatMAL:
+		if mediaType == "" {
+			return ErrSingleListFormat
+		}
+		return mal.Write(w, mediaType, b.Entries(mediaType), b.ScoreFormat, b.Username)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// only returns a copy of the backup holding just one list.
+func (b *Backup) only(mediaType anilist.MediaType) *Backup {
+	copied := *b
+	copied.Lists = map[anilist.MediaType]*anilist.MediaListCollection{}
+	if collection := b.Lists[mediaType]; collection != nil {
+		copied.Lists[mediaType] = collection
+	}
+	return &copied
+}
+
+// Write writes a backup as indented JSON.
+func Write(w io.Writer, b *Backup) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(b)
+}
+
+// Read reads a backup written by Write.
+func Read(r io.Reader) (*Backup, error) {
+	var b Backup
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotBackup, err)
+	}
+	switch {
+	case b.Version == 0 || b.Lists == nil:
+		return nil, ErrNotBackup
+	case b.Version > formatVersion:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, b.Version)
+	}
+	return &b, nil
+}
+
+// ReadFile reads a backup from disk.
+func ReadFile(path string) (*Backup, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+// FileName returns the default name of an export, such as hisame-anime-2024-05-01.xml.
+func FileName(format Format, mediaType anilist.MediaType, at time.Time) string {
+	lists := "lists"
+	if mediaType != "" {
+		lists = strings.ToLower(string(mediaType))
+	}
+	return fmt.Sprintf("hisame-%s-%s%s", lists, at.Format("2006-01-02"), format.Extension())
+}
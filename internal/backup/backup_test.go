@@ -0,0 +1,107 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/StarTerrarium/hisame/internal/anilist"
+)
+
+func newBackup(t *testing.T) *Backup {
+	t.Helper()
+	malID, year := 5, 2020
+	viewer := &anilist.Viewer{ID: 1, Name: "tester"}
+	viewer.MediaListOptions.ScoreFormat = anilist.ScorePoint10Decimal
+	lists := map[anilist.MediaType]*anilist.MediaListCollection{
+		anilist.MediaTypeAnime: {Lists: []*anilist.MediaListGroup{
+			{Name: "Completed", Status: anilist.StatusCompleted, Entries: []*anilist.MediaListEntry{{
+				ID: 10, MediaID: 100, Status: anilist.StatusCompleted, Score: 8.5, Progress: 12, Notes: "notes, \"quoted\"",
+				CustomLists:    map[string]bool{"Favourites": true, "Rewatch": true, "Unused": false},
+				AdvancedScores: map[string]float64{"Story": 9},
+				StartedAt:      anilist.FuzzyDate{Year: &year},
+				Media:          &anilist.Media{IDMal: &malID, Title: anilist.MediaTitle{Romaji: "Show"}},
+			}}},
+		}},
+		anilist.MediaTypeManga: {},
+	}
+	lists[anilist.MediaTypeAnime].Lists = append(lists[anilist.MediaTypeAnime].Lists, &anilist.MediaListGroup{
+		Name: "Favourites", IsCustomList: true, Entries: lists[anilist.MediaTypeAnime].Lists[0].Entries,
+	})
+
+	b, err := Create(context.Background(), viewer, func(ctx context.Context, mediaType anilist.MediaType) (*anilist.MediaListCollection, error) {
+		return lists[mediaType], nil
+	})
+	if err != nil {
+		t.Fatalf("Expected backup to be created, got %v", err)
+	}
+	return b
+}
+
+func TestWriteRead_Lossless(t *testing.T) {
+	b := newBackup(t)
+	var buffer bytes.Buffer
+	if err := b.Export(&buffer, FormatJSON, ""); err != nil {
+		t.Fatalf("Expected backup to be written, got %v", err)
+	}
+	restored, err := Read(&buffer)
+	if err != nil {
+		t.Fatalf("Expected backup to be read, got %v", err)
+	}
+	if !reflect.DeepEqual(restored.Lists, b.Lists) || restored.ScoreFormat != b.ScoreFormat || restored.Username != "tester" {
+		t.Errorf("Expected the backup to round trip unchanged, got %+v", restored)
+	}
+}
+
+func TestRead_Errors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected error
+	}{
+		{"not json", ErrNotBackup},
+		{`{"some": "other file"}`, ErrNotBackup},
+		{`{"version": 99, "lists": {}}`, ErrUnsupportedVersion},
+	}
+	for _, test := range tests {
+		if _, err := Read(strings.NewReader(test.input)); !errors.Is(err, test.expected) {
+			t.Errorf("Expected %v reading %q, got %v", test.expected, test.input, err)
+		}
+	}
+}
+
+func TestExport_CSV(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := newBackup(t).Export(&buffer, FormatCSV, ""); err != nil {
+		t.Fatalf("Expected CSV to be written, got %v", err)
+	}
+	rows, err := csv.NewReader(&buffer).ReadAll()
+	if err != nil {
+		t.Fatalf("Expected valid CSV, got %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Expected a header and one row for the entry on two lists, got %d rows", len(rows))
+	}
+	expected := []string{"anime", "100", "5", "Show", "", "COMPLETED", "8.5", "12", "0", "0", "0", "false",
+		"2020-00-00", "", "Favourites;Rewatch", "notes, \"quoted\"", ""}
+	if !reflect.DeepEqual(rows[1], expected) {
+		t.Errorf("Expected row %q, got %q", expected, rows[1])
+	}
+}
+
+func TestExport_MALNeedsOneList(t *testing.T) {
+	b := newBackup(t)
+	if err := b.Export(&bytes.Buffer{}, FormatMAL, ""); !errors.Is(err, ErrSingleListFormat) {
+		t.Errorf("Expected ErrSingleListFormat, got %v", err)
+	}
+	var buffer bytes.Buffer
+	if err := b.Export(&buffer, FormatMAL, anilist.MediaTypeAnime); err != nil {
+		t.Fatalf("Expected MyAnimeList export to be written, got %v", err)
+	}
+	if !strings.Contains(buffer.String(), "<series_animedb_id>5</series_animedb_id>") {
+		t.Errorf("Expected the entry in the export, got %s", buffer.String())
+	}
+}
@@ -0,0 +1,76 @@
+package backup
+
+import (
+	"encoding/csv"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var csvHeader = []string{
+	"type", "media_id", "mal_id", "title", "format", "status", "score", "progress", "progress_volumes", "repeat",
+	"priority", "private", "started_at", "completed_at", "custom_lists", "notes", "updated_at",
+}
+
+// WriteCSV writes one row for every entry on the lists of the given media types.  Scores are in the user's score
+// format, dates are YYYY-MM-DD with zeroes for unknown parts, and custom lists are separated by semicolons.
+func (b *Backup) WriteCSV(w io.Writer, mediaTypes []anilist.MediaType) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, mediaType := range mediaTypes {
+		for _, entry := range b.Entries(mediaType) {
+			if err := writer.Write(csvRow(mediaType, entry)); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func csvRow(mediaType anilist.MediaType, entry *anilist.MediaListEntry) []string {
+	var malID, title, format string
+	if entry.Media != nil {
+		if entry.Media.IDMal != nil {
+			malID = strconv.Itoa(*entry.Media.IDMal)
+		}
+		title = entry.Media.Title.Preferred("romaji")
+		format = entry.Media.Format
+	}
+	var customLists []string
+	for name, on := range entry.CustomLists {
+		if on {
+			customLists = append(customLists, name)
+		}
+	}
+	sort.Strings(customLists)
+	var updatedAt string
+	if entry.UpdatedAt > 0 {
+		updatedAt = time.Unix(entry.UpdatedAt, 0).UTC().Format(time.RFC3339)
+	}
+
+	return []string{
+		strings.ToLower(string(mediaType)),
+		strconv.Itoa(entry.MediaID),
+		malID,
+		title,
+		format,
+		string(entry.Status),
+		strconv.FormatFloat(entry.Score, 'f', -1, 64),
+		strconv.Itoa(entry.Progress),
+		strconv.Itoa(entry.ProgressVolumes),
+		strconv.Itoa(entry.Repeat),
+		strconv.Itoa(entry.Priority),
+		strconv.FormatBool(entry.Private),
+		entry.StartedAt.String(),
+		entry.CompletedAt.String(),
+		strings.Join(customLists, ";"),
+		entry.Notes,
+		updatedAt,
+	}
+}
@@ -0,0 +1,155 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrPassphraseRequired is returned when reading an encrypted backup without a passphrase.
+	ErrPassphraseRequired = errors.New("backup is encrypted; a passphrase is required")
+	// ErrWrongPassphrase is returned when an encrypted backup can't be decrypted with the given passphrase, or has
+	// been tampered with.
+	ErrWrongPassphrase = errors.New("wrong passphrase, or the backup is damaged")
+)
+
+// encryptedMagic starts every encrypted backup.  It is followed by a format version byte, the key derivation
+// iteration count, the salt, the nonce and the AES-GCM sealed backup.
+var encryptedMagic = []byte("HISAME-ENCRYPTED")
+
+const (
+	encryptedVersion = 1
+	saltSize         = 16
+	keySize          = 32
+)
+
+// defaultKDFIterations is the PBKDF2-HMAC-SHA256 iteration count used for new backups.  It is stored with each
+// backup, so it can be raised without breaking older ones.
+const defaultKDFIterations = 600_000
+
+// maxKDFIterations is the highest iteration count Decrypt accepts.  The count is read before anything is
+// authenticated, so a damaged or hostile backup could otherwise tie up the key derivation for hours.
+const maxKDFIterations = 10 * defaultKDFIterations
+
+// kdfIterations is the iteration count used for new backups, lowered by tests.
+var kdfIterations = defaultKDFIterations
+
+// IsEncrypted reports whether data is an encrypted backup.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedMagic)
+}
+
+// Encrypt seals data with a key derived from the passphrase.
+func Encrypt(data []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	header := bytes.NewBuffer(append([]byte{}, encryptedMagic...))
+	header.WriteByte(encryptedVersion)
+	binary.Write(header, binary.BigEndian, uint32(kdfIterations))
+	header.Write(salt)
+
+	gcm, err := newGCM(passphrase, salt, kdfIterations)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	header.Write(nonce)
+	// The header is authenticated too, so the iteration count can't be tampered with.
+	return gcm.Seal(header.Bytes(), nonce, data, header.Bytes()), nil
+}
+
+// Decrypt opens data sealed by Encrypt.
+func Decrypt(data []byte, passphrase string) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, ErrNotBackup
+	}
+	if passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+	rest := data[len(encryptedMagic):]
+	if len(rest) < 1+4+saltSize || rest[0] != encryptedVersion {
+		return nil, fmt.Errorf("%w: unknown encryption format", ErrUnsupportedVersion)
+	}
+	iterations := int(binary.BigEndian.Uint32(rest[1:5]))
+	if iterations == 0 || iterations > maxKDFIterations {
+		return nil, fmt.Errorf("%w: key derivation iteration count %d is out of range", ErrUnsupportedVersion, iterations)
+	}
+	salt := rest[5 : 5+saltSize]
+
+	gcm, err := newGCM(passphrase, salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+	headerSize := len(encryptedMagic) + 1 + 4 + saltSize + gcm.NonceSize()
+	if len(data) < headerSize+gcm.Overhead() {
+		return nil, ErrWrongPassphrase
+	}
+	header := data[:headerSize]
+	nonce := header[headerSize-gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, data[headerSize:], header)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plain, nil
+}
+
+func newGCM(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2SHA256([]byte(passphrase), salt, iterations, keySize))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2SHA256 derives a key from a password with PBKDF2 (RFC 8018) using HMAC-SHA256.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLength int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLength := prf.Size()
+	blocks := (keyLength + hashLength - 1) / hashLength
+
+	key := make([]byte, 0, blocks*hashLength)
+	u := make([]byte, hashLength)
+	var counter [4]byte
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Write(counter[:])
+		key = prf.Sum(key)
+		t := key[len(key)-hashLength:]
+		copy(u, t)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range u {
+				t[j] ^= u[j]
+			}
+		}
+	}
+	return key[:keyLength]
+}
+
+// Decode reads a backup written by Write, decrypting it first if it is encrypted.
+func Decode(data []byte, passphrase string) (*Backup, error) {
+	if IsEncrypted(data) {
+		plain, err := Decrypt(data, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		data = plain
+	}
+	return Read(bytes.NewReader(data))
+}
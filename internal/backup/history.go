@@ -0,0 +1,68 @@
+package backup
+
+import (
+	"github.com/StarTerrarium/hisame/internal/anilist"
+)
+
+// History lists how the lists changed between two backups, by media type and then title.  It reads Compare the
+// other way round: a ChangeMissing entry was removed after older was made, a ChangeAdded entry was added, and a
+// ChangeModified entry's diffs hold the older value as Input and the newer value as Entry.  Backup holds each
+// entry as it was in older, and Current as it was in newer.
+func History(older, newer *Backup) []*Change {
+	return Compare(older, newer.Lists)
+}
+
+// ProgressDelta returns how many episodes or chapters were watched or read between the two sides of a modified
+// change.
+func (c *Change) ProgressDelta() int {
+	if c.Backup == nil || c.Current == nil {
+		return 0
+	}
+	return c.Current.Progress - c.Backup.Progress
+}
+
+// Revert returns the change undoing a history change on the current lists: removing an entry that was added,
+// adding back one that was removed, or putting back the fields that changed.  Fields changed again since are left
+// alone.  It returns nil when there is nothing left to undo.
+func Revert(change *Change, current map[anilist.MediaType]*anilist.MediaListCollection) *Change {
+	var now *anilist.MediaListEntry
+	if collection := current[change.MediaType]; collection != nil {
+		for _, entry := range collection.Entries() {
+			if entry.MediaID == change.entry().MediaID {
+				now = entry
+				break
+			}
+		}
+	}
+
+	switch change.Kind {
+	case ChangeAdded:
+		if now == nil {
+			return nil
+		}
+		return &Change{MediaType: change.MediaType, Kind: ChangeAdded, Current: now}
+	case ChangeMissing:
+		if now != nil {
+			return nil
+		}
+		return &Change{MediaType: change.MediaType, Kind: ChangeMissing, Backup: change.Backup}
+	default:
+		if now == nil {
+			return &Change{MediaType: change.MediaType, Kind: ChangeMissing, Backup: change.Backup}
+		}
+		changed := map[string]string{}
+		for _, diff := range change.Diffs {
+			changed[diff.Field] = diff.Entry
+		}
+		var diffs []anilist.FieldDiff
+		for _, diff := range entryDiffs(change.Backup, now) {
+			if after, ok := changed[diff.Field]; ok && after == diff.Entry {
+				diffs = append(diffs, diff)
+			}
+		}
+		if len(diffs) == 0 {
+			return nil
+		}
+		return &Change{MediaType: change.MediaType, Kind: ChangeModified, Backup: change.Backup, Current: now, Diffs: diffs}
+	}
+}
@@ -0,0 +1,73 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/StarTerrarium/hisame/internal/anilist"
+)
+
+func TestHistory_ProgressDelta(t *testing.T) {
+	older, newer := newRestoreBackup()
+	changes := History(older, &Backup{Lists: newer})
+
+	var modified *Change
+	for _, change := range changes {
+		if change.Kind == ChangeModified {
+			modified = change
+		}
+	}
+	if modified == nil {
+		t.Fatalf("Expected a modified change")
+	}
+	if delta := modified.ProgressDelta(); delta != -8 {
+		t.Errorf("Expected a progress delta of -8, got %d", delta)
+	}
+}
+
+func TestRevert(t *testing.T) {
+	older, newer := newRestoreBackup()
+	changes := map[string]*Change{}
+	for _, change := range History(older, &Backup{Lists: newer}) {
+		changes[change.Key()] = change
+	}
+
+	rewatched := entry(2, 2, anilist.StatusCurrent, 6)
+	tests := []struct {
+		name     string
+		key      string
+		current  *anilist.MediaListCollection
+		kind     ChangeKind
+		fields   []string
+		expected bool
+	}{
+		{"Removed entry is added back", "ANIME:1", collection(), ChangeMissing, nil, true},
+		{"Removed entry already back", "ANIME:1", collection(entry(9, 1, anilist.StatusCurrent, 3)), "", nil, false},
+		{"Added entry is removed", "ANIME:4", collection(entry(4, 4, anilist.StatusDropped, 1)), ChangeAdded, nil, true},
+		{"Added entry already gone", "ANIME:4", collection(), "", nil, false},
+		{"Changed fields are put back", "ANIME:2", newer[anilist.MediaTypeAnime], ChangeModified, []string{"status", "progress", "advancedScores"}, true},
+		{"Fields changed again are left alone", "ANIME:2", collection(rewatched), ChangeModified, []string{"status", "advancedScores"}, true},
+		{"Modified entry since removed is added back", "ANIME:2", collection(), ChangeMissing, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			revert := Revert(changes[test.key], map[anilist.MediaType]*anilist.MediaListCollection{anilist.MediaTypeAnime: test.current})
+			if !test.expected {
+				if revert != nil {
+					t.Fatalf("Expected nothing to revert, got %s", revert.Kind)
+				}
+				return
+			}
+			if revert == nil || revert.Kind != test.kind {
+				t.Fatalf("Expected a %s change, got %+v", test.kind, revert)
+			}
+			if len(revert.Diffs) != len(test.fields) {
+				t.Fatalf("Expected %d diffs, got %+v", len(test.fields), revert.Diffs)
+			}
+			for i, field := range test.fields {
+				if revert.Diffs[i].Field != field {
+					t.Errorf("Expected diff %d to be %s, got %s", i, field, revert.Diffs[i].Field)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/store"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChangeKind is how an entry on the user's current list differs from the backup.
+type ChangeKind string
+
+const (
+	// ChangeMissing is an entry in the backup that is no longer on the list.  Restoring adds it back.
+	ChangeMissing ChangeKind = "missing"
+	// ChangeModified is an entry whose fields differ from the backup.  Restoring puts the backed up values back.
+	ChangeModified ChangeKind = "modified"
+	// ChangeAdded is an entry on the list that isn't in the backup.  Restoring removes it.
+	ChangeAdded ChangeKind = "added"
+)
+
+// Change is one difference between a backup and the user's current list.
+type Change struct {
+	MediaType anilist.MediaType
+	Kind      ChangeKind
+	// Backup is the entry as backed up.  It is nil for added entries.
+	Backup *anilist.MediaListEntry
+	// Current is the entry on the list now.  It is nil for missing entries.
+	Current *anilist.MediaListEntry
+	// Diffs lists the fields restoring changes, for modified entries.
+	Diffs []anilist.FieldDiff
+}
+
+// Key identifies the change's entry across runs, for selecting changes and checkpointing.
+func (c *Change) Key() string {
+	return fmt.Sprintf("%s:%d", c.MediaType, c.entry().MediaID)
+}
+
+// Title returns the entry's media title in the given language.
+func (c *Change) Title(language string) string {
+	entry := c.entry()
+	if entry.Media == nil {
+		return fmt.Sprintf("Media %d", entry.MediaID)
+	}
+	return entry.Media.Title.Preferred(language)
+}
+
+func (c *Change) entry() *anilist.MediaListEntry {
+	if c.Backup != nil {
+		return c.Backup
+	}
+	return c.Current
+}
+
+// Compare lists how the user's current lists differ from the backup, by media type and then title.  current holds
+// a collection for each media type in the backup; entries are matched by media ID.
+func Compare(b *Backup, current map[anilist.MediaType]*anilist.MediaListCollection) []*Change {
+	var changes []*Change
+	for _, mediaType := range MediaTypes {
+		if b.Lists[mediaType] == nil {
+			continue
+		}
+		existing := map[int]*anilist.MediaListEntry{}
+		if collection := current[mediaType]; collection != nil {
+			for _, entry := range collection.Entries() {
+				existing[entry.MediaID] = entry
+			}
+		}
+
+		var typeChanges []*Change
+		backedUp := map[int]bool{}
+		for _, entry := range b.Entries(mediaType) {
+			backedUp[entry.MediaID] = true
+			now := existing[entry.MediaID]
+			if now == nil {
+				typeChanges = append(typeChanges, &Change{MediaType: mediaType, Kind: ChangeMissing, Backup: entry})
+				continue
+			}
+			if diffs := entryDiffs(entry, now); len(diffs) > 0 {
+				typeChanges = append(typeChanges, &Change{MediaType: mediaType, Kind: ChangeModified, Backup: entry, Current: now, Diffs: diffs})
+			}
+		}
+		for mediaID, entry := range existing {
+			if !backedUp[mediaID] {
+				typeChanges = append(typeChanges, &Change{MediaType: mediaType, Kind: ChangeAdded, Current: entry})
+			}
+		}
+
+		sort.Slice(typeChanges, func(i, j int) bool {
+			return strings.ToLower(typeChanges[i].Title("romaji")) < strings.ToLower(typeChanges[j].Title("romaji"))
+		})
+		changes = append(changes, typeChanges...)
+	}
+	return changes
+}
+
+// entryDiffs lists the fields of the current entry that differ from the backed up one.
+func entryDiffs(backedUp, current *anilist.MediaListEntry) []anilist.FieldDiff {
+	diffs := anilist.InputFromEntry(backedUp).Diff(current)
+	// Advanced scores aren't part of an input built from an entry, so are compared by category.
+	if mine, theirs := formatAdvancedScores(backedUp.AdvancedScores), formatAdvancedScores(current.AdvancedScores); mine != theirs {
+		diffs = append(diffs, anilist.FieldDiff{Field: "advancedScores", Input: mine, Entry: theirs})
+	}
+	return diffs
+}
+
+// formatAdvancedScores formats advanced scores by category name.  Categories without a score are left out.
+func formatAdvancedScores(scores map[string]float64) string {
+	var parts []string
+	for category, score := range scores {
+		if score != 0 {
+			parts = append(parts, category+": "+strconv.FormatFloat(score, 'f', -1, 64))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// RestoreMode chooses which changes a restore applies.
+type RestoreMode int
+
+const (
+	// RestoreAll makes the lists match the backup, including removing entries added since.
+	RestoreAll RestoreMode = iota
+	// RestoreMissing only adds back entries that have been removed.
+	RestoreMissing
+	// RestoreSelected applies only the changes the user picked.
+	RestoreSelected
+)
+
+// Select returns the changes a restore in the given mode applies.  selected holds the keys of the changes picked
+// for RestoreSelected.
+func Select(changes []*Change, mode RestoreMode, selected map[string]bool) []*Change {
+	var chosen []*Change
+	for _, change := range changes {
+		switch {
+		case mode == RestoreAll,
+			mode == RestoreMissing && change.Kind == ChangeMissing,
+			mode == RestoreSelected && selected[change.Key()]:
+			chosen = append(chosen, change)
+		}
+	}
+	return chosen
+}
+
+// RestoreProgress reports how far a restore has got.
+type RestoreProgress struct {
+	Done    int
+	Total   int
+	Current *Change
+}
+
+// RestoreFailure is a change AniList refused to apply.
+type RestoreFailure struct {
+	Change *Change
+	Err    error
+}
+
+// RestoreResult summarises a restore.
+type RestoreResult struct {
+	Applied int
+	// Resumed counts changes skipped because an interrupted restore already applied them.
+	Resumed int
+	Failed  []RestoreFailure
+}
+
+// Restore applies changes to AniList one at a time, through the client's rate limiting.  advancedScoring returns
+// the user's current advanced scoring categories for a media type, which backed up advanced scores are saved in
+// the order of.  Progress is checkpointed after every change.  When AniList can't be reached, or the session
+// expires, Restore stops and returns the error; calling it again with the same checkpoint resumes.  Changes
+// AniList rejects are reported in the result without stopping the restore.  An empty checkpointPath disables
+// resuming.
+func Restore(ctx context.Context, client *anilist.Client, changes []*Change, advancedScoring func(anilist.MediaType) []string, checkpointPath string, onProgress func(RestoreProgress)) (*RestoreResult, error) {
+	progress := loadCheckpoint(checkpointPath)
+	result := &RestoreResult{}
+
+	for i, change := range changes {
+		if progress.Done[change.Key()] {
+			result.Resumed++
+		} else {
+			err := applyChange(ctx, client, change, advancedScoring(change.MediaType))
+			switch {
+			case err != nil && anilist.IsTemporary(err):
+				return result, fmt.Errorf("restore interrupted after %d of %d changes: %w", i, len(changes), err)
+			case err != nil:
+				logrus.Warnf("AniList rejected restoring %s: %v", change.Key(), err)
+				result.Failed = append(result.Failed, RestoreFailure{Change: change, Err: err})
+			default:
+				result.Applied++
+				progress.Done[change.Key()] = true
+				if err := saveCheckpoint(checkpointPath, progress); err != nil {
+					logrus.Errorf("Error saving restore progress: %v", err)
+				}
+			}
+		}
+		if onProgress != nil {
+			onProgress(RestoreProgress{Done: i + 1, Total: len(changes), Current: change})
+		}
+	}
+
+	if len(result.Failed) == 0 && checkpointPath != "" {
+		if err := os.Remove(checkpointPath); err != nil && !os.IsNotExist(err) {
+			logrus.Warnf("Error removing restore checkpoint: %v", err)
+		}
+	}
+	return result, nil
+}
+
+// applyChange makes one entry on the list match the backup.
+func applyChange(ctx context.Context, client *anilist.Client, change *Change, categories []string) error {
+	ctx = anilist.WithPreviousEntry(ctx, change.Current)
+	if change.Kind == ChangeAdded {
+		return client.DeleteMediaListEntry(ctx, change.Current.ID)
+	}
+
+	input := anilist.InputFromEntry(change.Backup)
+	input.ID = nil
+	if scores := orderAdvancedScores(change.Backup.AdvancedScores, categories); scores != nil {
+		input.AdvancedScores = &scores
+	}
+	if change.Kind == ChangeModified {
+		changed := make([]string, len(change.Diffs))
+		for i, diff := range change.Diffs {
+			changed[i] = diff.Field
+		}
+		input = input.Only(changed...)
+		input.ID = &change.Current.ID
+	}
+	if input.IsEmpty() && input.ID != nil {
+		return nil
+	}
+	_, err := client.SaveMediaListEntry(ctx, input)
+	return err
+}
+
+// orderAdvancedScores lists advanced scores in the order of the given categories, as AniList expects.  It returns
+// nil if there are no scores, or any category of the backup no longer exists.
+func orderAdvancedScores(scores map[string]float64, categories []string) []float64 {
+	if formatAdvancedScores(scores) == "" || len(categories) == 0 {
+		return nil
+	}
+	known := map[string]bool{}
+	for _, category := range categories {
+		known[category] = true
+	}
+	for category, score := range scores {
+		if score != 0 && !known[category] {
+			logrus.Warnf("Not restoring advanced scores, as the category %q no longer exists", category)
+			return nil
+		}
+	}
+	ordered := make([]float64, len(categories))
+	for i, category := range categories {
+		ordered[i] = scores[category]
+	}
+	return ordered
+}
+
+// checkpoint records which changes of a restore have been applied, so an interrupted restore picks up where it
+// left off.
+type checkpoint struct {
+	Done map[string]bool `json:"done"`
+}
+
+// CheckpointPath returns where progress restoring the backup with the given contents is recorded, under dir.
+func CheckpointPath(dir string, backupData []byte) string {
+	sum := sha256.Sum256(backupData)
+	return filepath.Join(dir, "restores", hex.EncodeToString(sum[:])[:16]+".json")
+}
+
+func loadCheckpoint(path string) *checkpoint {
+	progress := &checkpoint{Done: map[string]bool{}}
+	if path == "" {
+		return progress
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.Warnf("Error reading restore checkpoint; starting from the beginning: %v", err)
+		}
+		return progress
+	}
+	if err := json.Unmarshal(data, progress); err != nil || progress.Done == nil {
+		logrus.Warnf("Ignoring corrupt restore checkpoint %s", path)
+		return &checkpoint{Done: map[string]bool{}}
+	}
+	logrus.Infof("Resuming restore, %d changes already applied", len(progress.Done))
+	return progress
+}
+
+func saveCheckpoint(path string, progress *checkpoint) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	return store.WriteFileAtomic(path, data)
+}
@@ -0,0 +1,144 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/StarTerrarium/hisame/internal/anilist"
+)
+
+func entry(id, mediaID int, status anilist.MediaListStatus, progress int) *anilist.MediaListEntry {
+	return &anilist.MediaListEntry{ID: id, MediaID: mediaID, Status: status, Progress: progress,
+		Media: &anilist.Media{ID: mediaID, Title: anilist.MediaTitle{Romaji: string(rune('A' + mediaID))}}}
+}
+
+func collection(entries ...*anilist.MediaListEntry) *anilist.MediaListCollection {
+	return &anilist.MediaListCollection{Lists: []*anilist.MediaListGroup{{Entries: entries}}}
+}
+
+func newRestoreBackup() (*Backup, map[anilist.MediaType]*anilist.MediaListCollection) {
+	modified := entry(2, 2, anilist.StatusCompleted, 12)
+	modified.AdvancedScores = map[string]float64{"Story": 9}
+	b := &Backup{Version: formatVersion, Lists: map[anilist.MediaType]*anilist.MediaListCollection{
+		anilist.MediaTypeAnime: collection(entry(1, 1, anilist.StatusCurrent, 3), modified, entry(3, 3, anilist.StatusPlanning, 0)),
+	}}
+	current := map[anilist.MediaType]*anilist.MediaListCollection{
+		anilist.MediaTypeAnime: collection(entry(2, 2, anilist.StatusCurrent, 4), entry(3, 3, anilist.StatusPlanning, 0), entry(4, 4, anilist.StatusDropped, 1)),
+	}
+	return b, current
+}
+
+func TestCompare(t *testing.T) {
+	b, current := newRestoreBackup()
+	changes := Compare(b, current)
+
+	expected := []struct {
+		kind   ChangeKind
+		key    string
+		fields string
+	}{
+		{ChangeMissing, "ANIME:1", ""},
+		{ChangeModified, "ANIME:2", "status,progress,advancedScores"},
+		{ChangeAdded, "ANIME:4", ""},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %d", len(expected), len(changes))
+	}
+	for i, want := range expected {
+		var fields []string
+		for _, diff := range changes[i].Diffs {
+			fields = append(fields, diff.Field)
+		}
+		if changes[i].Kind != want.kind || changes[i].Key() != want.key || strings.Join(fields, ",") != want.fields {
+			t.Errorf("Expected change %d to be %s %s (%s), got %s %s (%s)", i, want.kind, want.key, want.fields,
+				changes[i].Kind, changes[i].Key(), strings.Join(fields, ","))
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	b, current := newRestoreBackup()
+	changes := Compare(b, current)
+
+	tests := []struct {
+		mode     RestoreMode
+		selected map[string]bool
+		expected int
+	}{
+		{RestoreAll, nil, 3},
+		{RestoreMissing, nil, 1},
+		{RestoreSelected, map[string]bool{"ANIME:2": true, "ANIME:4": true}, 2},
+		{RestoreSelected, nil, 0},
+	}
+	for _, test := range tests {
+		if got := Select(changes, test.mode, test.selected); len(got) != test.expected {
+			t.Errorf("Expected mode %d to select %d changes, got %d", test.mode, test.expected, len(got))
+		}
+	}
+}
+
+func TestRestore_ResumesAfterInterruption(t *testing.T) {
+	var calls, failing atomic.Int32
+	var requests []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if failing.Load() > 0 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		calls.Add(1)
+		requests = append(requests, body.Variables)
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(body.Query, "DeleteMediaListEntry(") {
+			w.Write([]byte(`{"data":{"DeleteMediaListEntry":{"deleted":true}}}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"SaveMediaListEntry":{"id":1}}}`))
+	}))
+	defer ts.Close()
+	client := anilist.NewClientWithEndpoint(ts.URL, "token")
+
+	b, current := newRestoreBackup()
+	changes := Select(Compare(b, current), RestoreAll, nil)
+	checkpointPath := filepath.Join(t.TempDir(), "restore.json")
+	categories := func(anilist.MediaType) []string { return []string{"Art", "Story"} }
+
+	_, err := Restore(context.Background(), client, changes, categories, checkpointPath, func(progress RestoreProgress) {
+		if progress.Done == 2 {
+			failing.Store(1)
+		}
+	})
+	if !anilist.IsTemporary(err) {
+		t.Fatalf("Expected the restore to stop when AniList is unavailable, got %v", err)
+	}
+
+	failing.Store(0)
+	result, err := Restore(context.Background(), client, changes, categories, checkpointPath, nil)
+	if err != nil {
+		t.Fatalf("Expected the resumed restore to succeed, got %v", err)
+	}
+	if result.Resumed != 2 || result.Applied != 1 || calls.Load() != 3 {
+		t.Fatalf("Expected 2 resumed and 1 applied change with 3 requests, got %d, %d and %d", result.Resumed, result.Applied, calls.Load())
+	}
+
+	if requests[0]["mediaId"] != float64(1) || requests[0]["id"] != nil {
+		t.Errorf("Expected the missing entry to be created, got %v", requests[0])
+	}
+	scores, _ := requests[1]["advancedScores"].([]interface{})
+	if requests[1]["id"] != float64(2) || requests[1]["notes"] != nil || len(scores) != 2 || scores[1] != float64(9) {
+		t.Errorf("Expected only the changed fields to be restored, with advanced scores in category order, got %v", requests[1])
+	}
+	if requests[2]["id"] != float64(4) {
+		t.Errorf("Expected the added entry to be deleted, got %v", requests[2])
+	}
+}
@@ -0,0 +1,190 @@
+package backup
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// maxCheckInterval bounds how long the scheduler sleeps between checking whether a backup is due, so backups
+// catch up soon after the computer wakes from sleep.
+const maxCheckInterval = 10 * time.Minute
+
+// Schedule configures automatic backups.
+type Schedule struct {
+	// Dir holds a subdirectory of snapshots for each account.
+	Dir string
+	// Interval is how often each account is backed up.
+	Interval time.Duration
+	// KeepCount and MaxAge limit how many snapshots are kept.  Zero disables a limit.
+	KeepCount int
+	MaxAge    time.Duration
+	// Passphrase encrypts snapshots when set.
+	Passphrase string
+}
+
+// Account is an account the scheduler backs up.
+type Account struct {
+	// Key names the account's snapshot directory.  It must stay the same across runs.
+	Key  string
+	Name string
+	// Create fetches a backup of the account's lists.
+	Create func(ctx context.Context) (*Backup, error)
+}
+
+// Status is the outcome of an account's most recent scheduled backup.
+type Status struct {
+	Running    bool
+	LastBackup time.Time
+	Err        error
+}
+
+// Scheduler periodically backs up every logged in account, and prunes old snapshots.
+type Scheduler struct {
+	schedule Schedule
+	accounts func() []Account
+
+	mutex       sync.Mutex
+	status      map[string]Status
+	subscribers map[int]func()
+	nextID      int
+	force       chan struct{}
+}
+
+// NewScheduler creates a scheduler backing up the accounts returned by accounts, which is called before each
+// round so logins and logouts are picked up.
+func NewScheduler(schedule Schedule, accounts func() []Account) *Scheduler {
+	return &Scheduler{
+		schedule:    schedule,
+		accounts:    accounts,
+		status:      map[string]Status{},
+		subscribers: map[int]func(){},
+		force:       make(chan struct{}, 1),
+	}
+}
+
+// Snapshots returns the snapshots of the account with the given key.
+func (s *Scheduler) Snapshots(key string) *Snapshots {
+	return OpenSnapshots(filepath.Join(s.schedule.Dir, key), s.schedule.Passphrase)
+}
+
+// Status returns the state of an account's backups.  LastBackup falls back to the newest snapshot on disk when
+// no backup has been made this run.
+func (s *Scheduler) Status(key string) Status {
+	s.mutex.Lock()
+	status := s.status[key]
+	s.mutex.Unlock()
+	if status.LastBackup.IsZero() {
+		if latest, ok := s.Snapshots(key).Latest(); ok {
+			status.LastBackup = latest.CreatedAt
+		}
+	}
+	return status
+}
+
+// Subscribe registers a function called whenever a backup starts or finishes.  The returned function
+// unsubscribes.
+func (s *Scheduler) Subscribe(fn func()) func() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	id := s.nextID
+	s.nextID++
+	s.subscribers[id] = fn
+	return func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		delete(s.subscribers, id)
+	}
+}
+
+// BackupNow backs up every account straight away, whether or not a backup is due.
+func (s *Scheduler) BackupNow() {
+	select {
+	case s.force <- struct{}{}:
+	default:
+	}
+}
+
+// Run backs up accounts whenever their newest snapshot is older than the interval, until ctx is cancelled.  A
+// failed backup is retried at the next check.
+func (s *Scheduler) Run(ctx context.Context) {
+	if s.schedule.Interval <= 0 {
+		return
+	}
+	checkInterval := min(s.schedule.Interval, maxCheckInterval)
+	force := false
+	for {
+		for _, account := range s.accounts() {
+			if ctx.Err() != nil {
+				return
+			}
+			if force || s.due(account.Key, time.Now()) {
+				s.backUp(ctx, account)
+			}
+		}
+
+		timer := time.NewTimer(checkInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			force = false
+		case <-s.force:
+			timer.Stop()
+			force = true
+		}
+	}
+}
+
+// due reports whether the account's newest snapshot is older than the interval.
+func (s *Scheduler) due(key string, now time.Time) bool {
+	latest, ok := s.Snapshots(key).Latest()
+	return !ok || now.Sub(latest.CreatedAt) >= s.schedule.Interval
+}
+
+// backUp makes a snapshot of one account and prunes old ones.
+func (s *Scheduler) backUp(ctx context.Context, account Account) {
+	s.update(account.Key, func(status *Status) { status.Running = true })
+
+	b, err := account.Create(ctx)
+	var snapshot Snapshot
+	if err == nil {
+		snapshot, err = s.Snapshots(account.Key).Save(b)
+	}
+	if err != nil {
+		logrus.Errorf("Automatic backup of %s failed: %v", account.Name, err)
+	} else {
+		logrus.Infof("Backed up %s's lists to %s", account.Name, snapshot.Path)
+		if removed, err := s.Snapshots(account.Key).Prune(s.schedule.KeepCount, s.schedule.MaxAge, time.Now()); err != nil {
+			logrus.Warnf("Error pruning old backups of %s: %v", account.Name, err)
+		} else if removed > 0 {
+			logrus.Infof("Removed %d old backups of %s", removed, account.Name)
+		}
+	}
+
+	s.update(account.Key, func(status *Status) {
+		status.Running = false
+		status.Err = err
+		if err == nil {
+			status.LastBackup = snapshot.CreatedAt
+		}
+	})
+}
+
+func (s *Scheduler) update(key string, change func(status *Status)) {
+	s.mutex.Lock()
+	status := s.status[key]
+	change(&status)
+	s.status[key] = status
+	subscribers := make([]func(), 0, len(s.subscribers))
+	for _, fn := range s.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	s.mutex.Unlock()
+	for _, fn := range subscribers {
+		fn()
+	}
+}
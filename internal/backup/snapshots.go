@@ -0,0 +1,138 @@
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/StarTerrarium/hisame/internal/store"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	snapshotPrefix     = "backup-"
+	snapshotTimeFormat = "20060102T150405Z"
+	encryptedExtension = ".enc"
+)
+
+// Snapshot is one automatic backup on disk.
+type Snapshot struct {
+	Path      string
+	CreatedAt time.Time
+	Encrypted bool
+}
+
+// Snapshots is a directory of timestamped backups of one account.
+type Snapshots struct {
+	dir        string
+	passphrase string
+}
+
+// OpenSnapshots returns the snapshots in dir.  When passphrase is set new snapshots are encrypted with it, and
+// it is used to read encrypted ones.
+func OpenSnapshots(dir, passphrase string) *Snapshots {
+	return &Snapshots{dir: dir, passphrase: passphrase}
+}
+
+// Dir returns the directory the snapshots are kept in.
+func (s *Snapshots) Dir() string {
+	return s.dir
+}
+
+// Save writes a backup as a new snapshot named after the time it was made.
+func (s *Snapshots) Save(b *Backup) (Snapshot, error) {
+	var buffer bytes.Buffer
+	if err := Write(&buffer, b); err != nil {
+		return Snapshot{}, err
+	}
+	data := buffer.Bytes()
+
+	snapshot := Snapshot{CreatedAt: b.CreatedAt.UTC().Truncate(time.Second), Encrypted: s.passphrase != ""}
+	name := snapshotPrefix + snapshot.CreatedAt.Format(snapshotTimeFormat) + FormatJSON.Extension()
+	if snapshot.Encrypted {
+		encrypted, err := Encrypt(data, s.passphrase)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		data = encrypted
+		name += encryptedExtension
+	}
+	snapshot.Path = filepath.Join(s.dir, name)
+	if err := store.WriteFileAtomic(snapshot.Path, data); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// List returns the snapshots, newest first.  A missing directory has no snapshots.
+func (s *Snapshots) List() ([]Snapshot, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var snapshots []Snapshot
+	for _, file := range files {
+		name := file.Name()
+		encrypted := strings.HasSuffix(name, encryptedExtension)
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, encryptedExtension), FormatJSON.Extension())
+		if file.IsDir() || !strings.HasPrefix(stamp, snapshotPrefix) {
+			continue
+		}
+		createdAt, err := time.Parse(snapshotTimeFormat, strings.TrimPrefix(stamp, snapshotPrefix))
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, Snapshot{Path: filepath.Join(s.dir, name), CreatedAt: createdAt, Encrypted: encrypted})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+	return snapshots, nil
+}
+
+// Latest returns the newest snapshot, if there is one.
+func (s *Snapshots) Latest() (Snapshot, bool) {
+	snapshots, err := s.List()
+	if err != nil || len(snapshots) == 0 {
+		return Snapshot{}, false
+	}
+	return snapshots[0], true
+}
+
+// Load reads a snapshot, decrypting it with the passphrase if needed.
+func (s *Snapshots) Load(snapshot Snapshot) (*Backup, error) {
+	data, err := os.ReadFile(snapshot.Path)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(data, s.passphrase)
+}
+
+// Prune deletes snapshots beyond the newest keepCount, and those older than maxAge.  A zero keepCount or maxAge
+// disables that limit.  The newest snapshot is always kept, so pruning never leaves an account without a backup.
+func (s *Snapshots) Prune(keepCount int, maxAge time.Duration, now time.Time) (int, error) {
+	snapshots, err := s.List()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for i, snapshot := range snapshots {
+		tooMany := keepCount > 0 && i >= keepCount
+		tooOld := maxAge > 0 && now.Sub(snapshot.CreatedAt) > maxAge
+		if i == 0 || !(tooMany || tooOld) {
+			continue
+		}
+		if err := os.Remove(snapshot.Path); err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("failed to remove old snapshot: %w", err)
+		}
+		logrus.Debugf("Pruned backup snapshot %s", snapshot.Path)
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,151 @@
+package backup
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/StarTerrarium/hisame/internal/anilist"
+)
+
+func init() {
+	// Keep tests fast.  The count is stored with each backup, so decrypting still uses the right one.
+	kdfIterations = 1000
+}
+
+func TestPBKDF2_RFC7914Vector(t *testing.T) {
+	key := pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1, 64)
+	expected := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if got := hex.EncodeToString(key); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
+
+func TestEncrypt_RoundTrip(t *testing.T) {
+	sealed, err := Encrypt([]byte(`{"version":1,"lists":{}}`), "secret")
+	if err != nil {
+		t.Fatalf("Expected data to encrypt, got %v", err)
+	}
+	if !IsEncrypted(sealed) {
+		t.Fatal("Expected the sealed data to be recognised as encrypted")
+	}
+	if _, err := Decode(sealed, "secret"); err != nil {
+		t.Errorf("Expected the backup to decrypt, got %v", err)
+	}
+
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 1
+	tests := []struct {
+		data       []byte
+		passphrase string
+		expected   error
+	}{
+		{sealed, "", ErrPassphraseRequired},
+		{sealed, "wrong", ErrWrongPassphrase},
+		{tampered, "secret", ErrWrongPassphrase},
+	}
+	for _, test := range tests {
+		if _, err := Decode(test.data, test.passphrase); !errors.Is(err, test.expected) {
+			t.Errorf("Expected %v with passphrase %q, got %v", test.expected, test.passphrase, err)
+		}
+	}
+}
+
+func TestDecrypt_IterationsOutOfRange(t *testing.T) {
+	sealed, err := Encrypt([]byte(`{"version":1,"lists":{}}`), "secret")
+	if err != nil {
+		t.Fatalf("Expected data to encrypt, got %v", err)
+	}
+	offset := len(encryptedMagic) + 1
+	for _, iterations := range []uint32{0, maxKDFIterations + 1, 0xFFFFFFFF} {
+		damaged := append([]byte{}, sealed...)
+		binary.BigEndian.PutUint32(damaged[offset:], iterations)
+		if _, err := Decrypt(damaged, "secret"); !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("Expected ErrUnsupportedVersion for %d iterations, got %v", iterations, err)
+		}
+	}
+}
+
+func TestSnapshots_SaveListPrune(t *testing.T) {
+	snapshots := OpenSnapshots(t.TempDir(), "secret")
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	for days := 0; days < 5; days++ {
+		b := &Backup{Version: formatVersion, CreatedAt: now.AddDate(0, 0, -days), Lists: map[anilist.MediaType]*anilist.MediaListCollection{}}
+		if _, err := snapshots.Save(b); err != nil {
+			t.Fatalf("Expected snapshot to be saved, got %v", err)
+		}
+	}
+	os.WriteFile(filepath.Join(snapshots.Dir(), "notes.txt"), []byte("not a snapshot"), 0o644)
+
+	list, err := snapshots.List()
+	if err != nil || len(list) != 5 || !list[0].CreatedAt.Equal(now) || !list[0].Encrypted {
+		t.Fatalf("Expected 5 encrypted snapshots, newest first, got %+v, %v", list, err)
+	}
+	if b, err := snapshots.Load(list[0]); err != nil || !b.CreatedAt.Equal(now) {
+		t.Fatalf("Expected the newest snapshot to load, got %+v, %v", b, err)
+	}
+
+	tests := []struct {
+		keepCount int
+		maxAge    time.Duration
+		remaining int
+	}{
+		{0, 0, 5},
+		{4, 0, 4},
+		{0, 60 * time.Hour, 3},
+		{0, time.Minute, 1},
+	}
+	for _, test := range tests {
+		if _, err := snapshots.Prune(test.keepCount, test.maxAge, now); err != nil {
+			t.Fatalf("Expected pruning to succeed, got %v", err)
+		}
+		if list, _ := snapshots.List(); len(list) != test.remaining {
+			t.Errorf("Expected %d snapshots after pruning to %d and %s, got %d", test.remaining, test.keepCount, test.maxAge, len(list))
+		}
+	}
+}
+
+func TestScheduler_BacksUpDueAccounts(t *testing.T) {
+	dir := t.TempDir()
+	created := make(chan string, 10)
+	account := func(key string) Account {
+		return Account{Key: key, Name: key, Create: func(ctx context.Context) (*Backup, error) {
+			created <- key
+			return &Backup{Version: formatVersion, CreatedAt: time.Now(), Lists: map[anilist.MediaType]*anilist.MediaListCollection{}}, nil
+		}}
+	}
+	scheduler := NewScheduler(Schedule{Dir: dir, Interval: time.Hour, KeepCount: 2}, func() []Account {
+		return []Account{account("1"), account("2")}
+	})
+	// Account 2 was backed up recently, so isn't due.
+	OpenSnapshots(filepath.Join(dir, "2"), "").Save(&Backup{Version: formatVersion, CreatedAt: time.Now().Add(-time.Minute)})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go scheduler.Run(ctx)
+
+	select {
+	case key := <-created:
+		if key != "1" {
+			t.Fatalf("Expected only account 1 to be due, got %s", key)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for a backup")
+	}
+	scheduler.BackupNow()
+	for _, expected := range []string{"1", "2"} {
+		select {
+		case key := <-created:
+			if key != expected {
+				t.Errorf("Expected a forced backup of %s, got %s", expected, key)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for a forced backup")
+		}
+	}
+}
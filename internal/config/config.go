@@ -5,13 +5,35 @@ import (
 	"github.com/sirupsen/logrus"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
 // UserConfig represents the application's configuration settings.
 type UserConfig struct {
-	LogLevel    string      `yaml:"logLevel"`
+	LogLevel string `yaml:"logLevel"`
+	// ReadOnly stops Hisame changing anything on AniList.  Lists can still be browsed, synced and exported.
+	ReadOnly bool `yaml:"readOnly"`
+	// DryRun logs the changes Hisame would make to AniList, and records them in the audit log, without sending
+	// them.  ReadOnly takes precedence.
+	DryRun        bool          `yaml:"dryRun"`
+	AnimeConfig   AnimeConfig   `yaml:"anime"`
+	AuthConfig    AuthConfig    `yaml:"auth"`
+	SyncConfig    SyncConfig    `yaml:"sync"`
+	CacheConfig   CacheConfig   `yaml:"cache"`
+	BackupConfig  BackupConfig  `yaml:"backup"`
+	ControlConfig ControlConfig `yaml:"control"`
+	// Keymap rebinds keyboard shortcuts, mapping action names such as "next" or "edit" to keys such as "j" or
+	// "ctrl+1".  An empty key unbinds the action.  Actions left out keep their default keys.
+	Keymap map[string]string `yaml:"keymap"`
+	// Accounts holds preferences for individual AniList accounts, keyed by username.  Any value set here
+	// overrides the top level setting while that account is active.
+	Accounts map[string]AccountConfig `yaml:"accounts"`
+}
+
+// AccountConfig contains the preferences that can be set per account
+type AccountConfig struct {
 	AnimeConfig AnimeConfig `yaml:"anime"`
 }
 
@@ -21,6 +43,144 @@ type AnimeConfig struct {
 	DisplayLayout string `yaml:"displayLayout"`
 }
 
+// AuthConfig contains settings for the AniList login flow
+type AuthConfig struct {
+	// ClientID is the AniList API client used for the primary callback port.  Override it to use a self-hosted
+	// app registration.
+	ClientID string `yaml:"clientID"`
+	// ClientSecret belongs to ClientID and is only needed for the authorization code flow.
+	ClientSecret string `yaml:"clientSecret"`
+	// Flow selects the OAuth grant.  Either "implicit" or "code".
+	Flow string `yaml:"flow"`
+	// CallbackPort is the first local port tried for the login callback server.
+	CallbackPort int `yaml:"callbackPort"`
+	// CallbackPortRange is the number of additional consecutive ports to try when CallbackPort is taken.
+	CallbackPortRange int `yaml:"callbackPortRange"`
+	// RedirectClients maps a callback port to the client ID whose registered redirect URI is
+	// http://localhost:<port>/callback.  AniList only allows one redirect URI per client, so every fallback
+	// port needs its own registration.
+	RedirectClients map[int]string `yaml:"redirectClients"`
+	// RedirectClientSecrets maps a callback port to the secret of its client in RedirectClients.
+	RedirectClientSecrets map[int]string `yaml:"redirectClientSecrets"`
+}
+
+// SyncConfig contains settings for keeping the local lists in sync with AniList
+type SyncConfig struct {
+	// Interval is how often the lists are synced in the background, as a Go duration such as "15m".  "0"
+	// disables periodic syncing; lists are still synced when opened and when the window regains focus.
+	Interval string `yaml:"interval"`
+}
+
+// CacheConfig contains limits for the local caches
+type CacheConfig struct {
+	// ImageSizeMB caps the disk space used by cached cover and banner images.  0 means no limit.
+	ImageSizeMB int `yaml:"imageSizeMB"`
+	// ImageMemoryEntries is how many decoded images are kept in memory for quick redrawing.
+	ImageMemoryEntries int `yaml:"imageMemoryEntries"`
+}
+
+// BackupConfig contains settings for automatic backups of every logged in account's lists
+type BackupConfig struct {
+	// Interval is how often each account is backed up, as a Go duration such as "24h".  "0" disables automatic
+	// backups.
+	Interval string `yaml:"interval"`
+	// Directory is where backups are written, in a subdirectory for each account.  Defaults to "backups" in
+	// Hisame's config directory.
+	Directory string `yaml:"directory"`
+	// KeepCount is how many backups of each account are kept.  0 keeps any number.
+	KeepCount int `yaml:"keepCount"`
+	// MaxAge removes backups older than this, as a Go duration such as "720h".  Empty keeps backups of any age.
+	// The newest backup is always kept.
+	MaxAge string `yaml:"maxAge"`
+	// Passphrase encrypts backups when set.  The HISAME_BACKUP_PASSPHRASE environment variable overrides it, so
+	// it needn't be stored in this file.
+	Passphrase string `yaml:"passphrase"`
+}
+
+// ControlConfig contains settings for the local control API, which lets other programs on the machine drive Hisame
+type ControlConfig struct {
+	// Enabled starts the control API with the app.  It is off by default.
+	Enabled bool `yaml:"enabled"`
+	// Address is a loopback address such as "127.0.0.1:19332", or "unix:" followed by the path of a socket.
+	Address string `yaml:"address"`
+	// Token must be sent with every request.  When empty, a random token is generated and saved next to this
+	// file.  The HISAME_CONTROL_TOKEN environment variable overrides it.
+	Token string `yaml:"token"`
+}
+
+// defaultSyncInterval is used when the configured sync interval is missing or invalid.
+const defaultSyncInterval = 15 * time.Minute
+
+// SyncInterval returns the configured background sync interval.
+func (c *UserConfig) SyncInterval() time.Duration {
+	if c.SyncConfig.Interval == "" {
+		return defaultSyncInterval
+	}
+	interval, err := time.ParseDuration(c.SyncConfig.Interval)
+	if err != nil || interval < 0 {
+		logrus.Warnf("Invalid sync interval '%s' in configuration; using %s", c.SyncConfig.Interval, defaultSyncInterval)
+		return defaultSyncInterval
+	}
+	return interval
+}
+
+// defaultBackupInterval is used when the configured backup interval is missing or invalid.
+const defaultBackupInterval = 24 * time.Hour
+
+// BackupInterval returns how often automatic backups are made.  0 means automatic backups are off.
+func (c *UserConfig) BackupInterval() time.Duration {
+	if c.BackupConfig.Interval == "" {
+		return defaultBackupInterval
+	}
+	interval, err := time.ParseDuration(c.BackupConfig.Interval)
+	if err != nil || interval < 0 {
+		logrus.Warnf("Invalid backup interval '%s' in configuration; using %s", c.BackupConfig.Interval, defaultBackupInterval)
+		return defaultBackupInterval
+	}
+	return interval
+}
+
+// BackupMaxAge returns the age past which backups are removed.  0 keeps backups of any age.
+func (c *UserConfig) BackupMaxAge() time.Duration {
+	if c.BackupConfig.MaxAge == "" {
+		return 0
+	}
+	maxAge, err := time.ParseDuration(c.BackupConfig.MaxAge)
+	if err != nil || maxAge < 0 {
+		logrus.Warnf("Invalid backup max age '%s' in configuration; keeping backups of any age", c.BackupConfig.MaxAge)
+		return 0
+	}
+	return maxAge
+}
+
+// BackupDirectory returns the directory automatic backups are written to.
+func (c *UserConfig) BackupDirectory() (string, error) {
+	if c.BackupConfig.Directory != "" {
+		return expandPath(c.BackupConfig.Directory)
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user config directory: %w", err)
+	}
+	return filepath.Join(configDir, "hisame", "backups"), nil
+}
+
+// BackupPassphrase returns the passphrase backups are encrypted with, or an empty string if they aren't.
+func (c *UserConfig) BackupPassphrase() string {
+	if passphrase := os.Getenv("HISAME_BACKUP_PASSPHRASE"); passphrase != "" {
+		return passphrase
+	}
+	return c.BackupConfig.Passphrase
+}
+
+// ControlToken returns the token the control API requires, or an empty string if one should be generated.
+func (c *UserConfig) ControlToken() string {
+	if token := os.Getenv("HISAME_CONTROL_TOKEN"); token != "" {
+		return token
+	}
+	return c.ControlConfig.Token
+}
+
 // DefaultConfig returns a UserConfig populated with default values.
 func DefaultConfig() *UserConfig {
 	return &UserConfig{
@@ -29,7 +189,44 @@ func DefaultConfig() *UserConfig {
 			TitleLanguage: "english",
 			DisplayLayout: "list",
 		},
+		AuthConfig: AuthConfig{
+			ClientID:     "18776",
+			Flow:         "implicit",
+			CallbackPort: 19331,
+		},
+		SyncConfig: SyncConfig{
+			Interval: "15m",
+		},
+		CacheConfig: CacheConfig{
+			ImageSizeMB:        200,
+			ImageMemoryEntries: 300,
+		},
+		BackupConfig: BackupConfig{
+			Interval:  "24h",
+			KeepCount: 14,
+		},
+		ControlConfig: ControlConfig{
+			Address: "127.0.0.1:19332",
+		},
+	}
+}
+
+// ForAccount returns the config with the named account's preferences applied.  The receiver is returned as is
+// when the account has no preferences of its own.
+func (c *UserConfig) ForAccount(name string) *UserConfig {
+	account, ok := c.Accounts[name]
+	if !ok {
+		return c
+	}
+
+	merged := *c
+	if account.AnimeConfig.TitleLanguage != "" {
+		merged.AnimeConfig.TitleLanguage = account.AnimeConfig.TitleLanguage
+	}
+	if account.AnimeConfig.DisplayLayout != "" {
+		merged.AnimeConfig.DisplayLayout = account.AnimeConfig.DisplayLayout
 	}
+	return &merged
 }
 
 // getConfigFilePath returns the path to the configuration file.
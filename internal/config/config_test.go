@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig_DefaultsWhenFileMissing(t *testing.T) {
@@ -35,6 +36,9 @@ func TestLoadConfig_DefaultsWhenFileMissing(t *testing.T) {
 	if cfg.AnimeConfig.DisplayLayout != "list" {
 		t.Errorf("Expected default Anime DisplayLayout 'list', got '%s'", cfg.AnimeConfig.DisplayLayout)
 	}
+	if cfg.CacheConfig.ImageSizeMB != 200 {
+		t.Errorf("Expected default ImageSizeMB 200, got %d", cfg.CacheConfig.ImageSizeMB)
+	}
 }
 
 func TestLoadConfig_PartialConfigFile(t *testing.T) {
@@ -149,3 +153,137 @@ func TestLoadConfig_WithInvalidEnvVarLocation(t *testing.T) {
 		t.Errorf("Expected default Anime DisplayLayout 'list', got '%s'", cfg.AnimeConfig.DisplayLayout)
 	}
 }
+
+func TestLoadConfig_AuthConfig(t *testing.T) {
+	tempDir := t.TempDir()
+	customConfigPath := filepath.Join(tempDir, "auth_config.yaml")
+	os.Setenv("HISAME_CONFIG_FILE", customConfigPath)
+	defer os.Unsetenv("HISAME_CONFIG_FILE")
+
+	authConfig := `
+auth:
+  callbackPortRange: 2
+  redirectClients:
+    19332: "54321"
+`
+
+	err := os.WriteFile(customConfigPath, []byte(authConfig), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write custom config file: %v", err)
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Check that unspecified auth fields keep their defaults
+	if cfg.AuthConfig.ClientID != "18776" {
+		t.Errorf("Expected default ClientID '18776', got '%s'", cfg.AuthConfig.ClientID)
+	}
+	if cfg.AuthConfig.CallbackPort != 19331 {
+		t.Errorf("Expected default CallbackPort 19331, got %d", cfg.AuthConfig.CallbackPort)
+	}
+
+	if cfg.AuthConfig.CallbackPortRange != 2 {
+		t.Errorf("Expected CallbackPortRange 2, got %d", cfg.AuthConfig.CallbackPortRange)
+	}
+	if cfg.AuthConfig.RedirectClients[19332] != "54321" {
+		t.Errorf("Expected redirect client '54321' for port 19332, got '%s'", cfg.AuthConfig.RedirectClients[19332])
+	}
+}
+
+func TestForAccount(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Accounts = map[string]AccountConfig{
+		"Alt": {AnimeConfig: AnimeConfig{TitleLanguage: "romaji"}},
+	}
+
+	if cfg.ForAccount("Main") != cfg {
+		t.Error("Expected an account without preferences to use the config as is")
+	}
+
+	alt := cfg.ForAccount("Alt")
+	if alt.AnimeConfig.TitleLanguage != "romaji" {
+		t.Errorf("Expected Alt's TitleLanguage 'romaji', got '%s'", alt.AnimeConfig.TitleLanguage)
+	}
+	if alt.AnimeConfig.DisplayLayout != "list" {
+		t.Errorf("Expected Alt to inherit DisplayLayout 'list', got '%s'", alt.AnimeConfig.DisplayLayout)
+	}
+	if cfg.AnimeConfig.TitleLanguage != "english" {
+		t.Error("Expected the base config to be unchanged")
+	}
+}
+
+func TestSyncInterval(t *testing.T) {
+	tests := []struct {
+		interval string
+		expected time.Duration
+	}{
+		{"", 15 * time.Minute},
+		{"5m", 5 * time.Minute},
+		{"0", 0},
+		{"soon", 15 * time.Minute},
+		{"-1h", 15 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		cfg := DefaultConfig()
+		cfg.SyncConfig.Interval = tt.interval
+		if got := cfg.SyncInterval(); got != tt.expected {
+			t.Errorf("Expected interval %s for %q, got %s", tt.expected, tt.interval, got)
+		}
+	}
+}
+
+func TestBackupSettings(t *testing.T) {
+	tests := []struct {
+		interval, maxAge string
+		expectedInterval time.Duration
+		expectedMaxAge   time.Duration
+	}{
+		{"", "", 24 * time.Hour, 0},
+		{"12h", "720h", 12 * time.Hour, 720 * time.Hour},
+		{"0", "forever", 0, 0},
+		{"daily", "-1h", 24 * time.Hour, 0},
+	}
+
+	for _, tt := range tests {
+		cfg := DefaultConfig()
+		cfg.BackupConfig.Interval = tt.interval
+		cfg.BackupConfig.MaxAge = tt.maxAge
+		if got := cfg.BackupInterval(); got != tt.expectedInterval {
+			t.Errorf("Expected interval %s for %q, got %s", tt.expectedInterval, tt.interval, got)
+		}
+		if got := cfg.BackupMaxAge(); got != tt.expectedMaxAge {
+			t.Errorf("Expected max age %s for %q, got %s", tt.expectedMaxAge, tt.maxAge, got)
+		}
+	}
+}
+
+func TestBackupPassphrase(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.BackupConfig.Passphrase = "from config"
+	if got := cfg.BackupPassphrase(); got != "from config" {
+		t.Errorf("Expected the configured passphrase, got %q", got)
+	}
+	t.Setenv("HISAME_BACKUP_PASSPHRASE", "from env")
+	if got := cfg.BackupPassphrase(); got != "from env" {
+		t.Errorf("Expected the environment to override the passphrase, got %q", got)
+	}
+}
+
+func TestControlToken(t *testing.T) {
+	cfg := DefaultConfig()
+	if cfg.ControlConfig.Enabled || cfg.ControlToken() != "" {
+		t.Errorf("Expected the control API to be off with no token by default")
+	}
+	cfg.ControlConfig.Token = "from config"
+	if got := cfg.ControlToken(); got != "from config" {
+		t.Errorf("Expected the configured token, got %q", got)
+	}
+	t.Setenv("HISAME_CONTROL_TOKEN", "from env")
+	if got := cfg.ControlToken(); got != "from env" {
+		t.Errorf("Expected the environment to override the token, got %q", got)
+	}
+}
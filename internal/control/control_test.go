@@ -0,0 +1,218 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/StarTerrarium/hisame/internal/anilist"
+)
+
+// fakeBackend holds lists in memory, recording the edits queued.
+type fakeBackend struct {
+	lists    map[anilist.MediaType]*anilist.MediaListCollection
+	saved    []anilist.SaveMediaListEntryInput
+	readOnly bool
+}
+
+func (b *fakeBackend) Status() Status {
+	return Status{LoggedIn: true, Account: "alice", UserID: 1, Mode: "normal", PendingEdits: len(b.saved)}
+}
+
+func (b *fakeBackend) Lists(ctx context.Context, mediaType anilist.MediaType) (*anilist.MediaListCollection, error) {
+	if b.lists == nil {
+		return nil, ErrNotLoggedIn
+	}
+	if collection, ok := b.lists[mediaType]; ok {
+		return collection, nil
+	}
+	return &anilist.MediaListCollection{}, nil
+}
+
+func (b *fakeBackend) SaveEntry(mediaType anilist.MediaType, entry *anilist.MediaListEntry, input anilist.SaveMediaListEntryInput) error {
+	if b.readOnly {
+		return anilist.ErrReadOnly
+	}
+	b.saved = append(b.saved, input)
+	input.ApplyTo(entry)
+	return nil
+}
+
+func newTestBackend() *fakeBackend {
+	episodes := 12
+	return &fakeBackend{lists: map[anilist.MediaType]*anilist.MediaListCollection{
+		anilist.MediaTypeAnime: {Lists: []*anilist.MediaListGroup{{Entries: []*anilist.MediaListEntry{
+			{ID: 1, MediaID: 10, Status: anilist.StatusCurrent, Progress: 3, Media: &anilist.Media{Episodes: &episodes}},
+			{ID: 2, MediaID: 20, Status: anilist.StatusPlanning},
+		}}}},
+		anilist.MediaTypeManga: {Lists: []*anilist.MediaListGroup{{Entries: []*anilist.MediaListEntry{
+			{ID: 3, MediaID: 30, Status: anilist.StatusCurrent, Progress: 50},
+		}}}},
+	}}
+}
+
+// rpc posts a JSON-RPC request to the server and decodes the response.
+func rpc(t *testing.T, ts *httptest.Server, token, method string, params interface{}, result interface{}) *Error {
+	t.Helper()
+	body, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/rpc", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	var decoded struct {
+		Result json.RawMessage `json:"result"`
+		Error  *Error          `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if decoded.Error == nil && result != nil {
+		if err := json.Unmarshal(decoded.Result, result); err != nil {
+			t.Fatalf("Failed to decode result: %v", err)
+		}
+	}
+	return decoded.Error
+}
+
+func TestServer_RequiresToken(t *testing.T) {
+	ts := httptest.NewServer(NewServer(newTestBackend(), "secret").Handler())
+	defer ts.Close()
+
+	for _, header := range []string{"", "Bearer wrong", "secret"} {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/rpc", bytes.NewReader([]byte(`{"jsonrpc":"2.0","id":1,"method":"status"}`)))
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for Authorization %q, got %d", header, resp.StatusCode)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/rpc", nil)
+	req.Host = "attacker.example:80"
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 for another host, got %d", resp.StatusCode)
+	}
+}
+
+func TestServer_Methods(t *testing.T) {
+	backend := newTestBackend()
+	ts := httptest.NewServer(NewServer(backend, "secret").Handler())
+	defer ts.Close()
+
+	var entries []Entry
+	if err := rpc(t, ts, "secret", "list", ListParams{Type: "anime", Status: "watching"}, &entries); err != nil {
+		t.Fatalf("Expected list to succeed, got %v", err)
+	}
+	if len(entries) != 1 || entries[0].MediaID != 10 || entries[0].Total == nil || *entries[0].Total != 12 {
+		t.Fatalf("Unexpected entries %+v", entries)
+	}
+
+	var entry Entry
+	if err := rpc(t, ts, "secret", "entry", EntryParams{MediaID: 30}, &entry); err != nil || entry.Type != anilist.MediaTypeManga {
+		t.Fatalf("Expected the manga entry, got %+v, %v", entry, err)
+	}
+
+	delta := 20
+	if err := rpc(t, ts, "secret", "setProgress", ProgressParams{MediaID: 10, Delta: &delta}, &entry); err != nil {
+		t.Fatalf("Expected setProgress to succeed, got %v", err)
+	}
+	if entry.Progress != 12 || len(backend.saved) != 1 || *backend.saved[0].Progress != 12 {
+		t.Errorf("Expected progress capped at 12 episodes, got %+v", entry)
+	}
+
+	var status Status
+	if err := rpc(t, ts, "secret", "status", nil, &status); err != nil || status.PendingEdits != 1 {
+		t.Errorf("Unexpected status %+v, %v", status, err)
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	backend := newTestBackend()
+	ts := httptest.NewServer(NewServer(backend, "secret").Handler())
+	defer ts.Close()
+	progress := 1
+
+	tests := []struct {
+		name   string
+		method string
+		params interface{}
+		code   int
+	}{
+		{"Unknown method", "deleteEverything", nil, codeMethodNotFound},
+		{"Bad type", "list", ListParams{Type: "novel"}, codeInvalidParams},
+		{"Bad status", "list", ListParams{Type: "ANIME", Status: "finished"}, codeInvalidParams},
+		{"Not on list", "entry", EntryParams{MediaID: 99}, codeNotFound},
+		{"Neither progress nor delta", "setProgress", ProgressParams{MediaID: 10}, codeInvalidParams},
+		{"Bad params", "entry", []int{1}, codeInvalidParams},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := rpc(t, ts, "secret", test.method, test.params, nil)
+			if err == nil || err.Code != test.code {
+				t.Errorf("Expected error code %d, got %v", test.code, err)
+			}
+		})
+	}
+
+	backend.readOnly = true
+	if err := rpc(t, ts, "secret", "setProgress", ProgressParams{MediaID: 10, Progress: &progress}, nil); err == nil || err.Code != codeReadOnly {
+		t.Errorf("Expected a read-only error, got %v", err)
+	}
+	backend.lists = nil
+	if err := rpc(t, ts, "secret", "list", ListParams{Type: "ANIME"}, nil); err == nil || err.Code != codeNotLoggedIn {
+		t.Errorf("Expected a not logged in error, got %v", err)
+	}
+}
+
+func TestListen_RefusesNetworkAddresses(t *testing.T) {
+	server := NewServer(newTestBackend(), "secret")
+	if err := server.Start("0.0.0.0:0"); err == nil {
+		server.Close()
+		t.Fatalf("Expected listening on every interface to be refused")
+	}
+	if err := server.Start("127.0.0.1:0"); err != nil {
+		t.Fatalf("Expected loopback to be allowed, got %v", err)
+	}
+	if server.Address() == "" {
+		t.Errorf("Expected the bound address")
+	}
+	server.Close()
+}
+
+func TestLoadOrCreateToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hisame", "control-token")
+	token, err := LoadOrCreateToken(path)
+	if err != nil || len(token) != 64 {
+		t.Fatalf("Expected a generated token, got %q, %v", token, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the token file to be private, got %v, %v", info, err)
+	}
+	again, err := LoadOrCreateToken(path)
+	if err != nil || again != token {
+		t.Errorf("Expected the saved token %q, got %q, %v", token, again, err)
+	}
+}
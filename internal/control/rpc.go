@@ -0,0 +1,287 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// requestTimeout bounds the work done for one request, such as fetching lists that aren't cached.
+const requestTimeout = time.Minute
+
+// JSON-RPC 2.0 error codes.  The codes from -32000 are Hisame's own.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+	codeNotLoggedIn    = -32001
+	codeNotFound       = -32002
+	codeReadOnly       = -32003
+)
+
+// Error is a JSON-RPC error response.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// Entry is a list entry as returned by the API.
+type Entry struct {
+	ID       int                     `json:"id"`
+	MediaID  int                     `json:"mediaId"`
+	Type     anilist.MediaType       `json:"type"`
+	Title    anilist.MediaTitle      `json:"title"`
+	Status   anilist.MediaListStatus `json:"status"`
+	Progress int                     `json:"progress"`
+	// Total is the number of episodes or chapters, when known.
+	Total     *int    `json:"total"`
+	Score     float64 `json:"score"`
+	SiteURL   string  `json:"siteUrl,omitempty"`
+	UpdatedAt int64   `json:"updatedAt"`
+}
+
+func newEntry(mediaType anilist.MediaType, entry *anilist.MediaListEntry) Entry {
+	e := Entry{
+		ID:        entry.ID,
+		MediaID:   entry.MediaID,
+		Type:      mediaType,
+		Status:    entry.Status,
+		Progress:  entry.Progress,
+		Score:     entry.Score,
+		UpdatedAt: entry.UpdatedAt,
+	}
+	if media := entry.Media; media != nil {
+		e.Title = media.Title
+		e.SiteURL = media.SiteURL
+		e.Total = media.Episodes
+		if mediaType == anilist.MediaTypeManga {
+			e.Total = media.Chapters
+		}
+	}
+	return e
+}
+
+// ListParams are the params of the list method.
+type ListParams struct {
+	// Type is ANIME or MANGA.
+	Type string `json:"type"`
+	// Status only returns entries with this status, such as "watching" or "COMPLETED".
+	Status string `json:"status"`
+}
+
+// EntryParams are the params of the entry method.
+type EntryParams struct {
+	MediaID int `json:"mediaId"`
+}
+
+// ProgressParams are the params of the setProgress method.  Exactly one of Progress and Delta is given.
+type ProgressParams struct {
+	MediaID  int  `json:"mediaId"`
+	Progress *int `json:"progress"`
+	Delta    *int `json:"delta"`
+}
+
+// serveRPC handles a JSON-RPC 2.0 request.  Batches aren't supported.
+func (s *Server) serveRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "JSON-RPC requests must be posted", http.StatusMethodNotAllowed)
+		return
+	}
+	var req request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes)).Decode(&req); err != nil {
+		writeResponse(w, response{Error: &Error{Code: codeParseError, Message: err.Error()}})
+		return
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		writeResponse(w, response{ID: req.ID, Error: &Error{Code: codeInvalidRequest, Message: "expected a JSON-RPC 2.0 request"}})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+	result, err := s.call(ctx, req.Method, req.Params)
+	if req.ID == nil {
+		// A notification, which gets no response.
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	resp := response{ID: req.ID, Result: result}
+	if err != nil {
+		resp.Result = nil
+		resp.Error = toError(err)
+		logrus.Debugf("Control API %s failed: %v", req.Method, err)
+	}
+	writeResponse(w, resp)
+}
+
+func writeResponse(w http.ResponseWriter, resp response) {
+	resp.JSONRPC = "2.0"
+	if resp.ID == nil {
+		resp.ID = json.RawMessage("null")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logrus.Warnf("Error writing control API response: %v", err)
+	}
+}
+
+// toError converts an error from a method to a JSON-RPC error.
+func toError(err error) *Error {
+	var rpcErr *Error
+	switch {
+	case errors.As(err, &rpcErr):
+		return rpcErr
+	case errors.Is(err, ErrNotLoggedIn):
+		return &Error{Code: codeNotLoggedIn, Message: err.Error()}
+	case errors.Is(err, anilist.ErrReadOnly):
+		return &Error{Code: codeReadOnly, Message: err.Error()}
+	default:
+		return &Error{Code: codeInternalError, Message: err.Error()}
+	}
+}
+
+// call runs a method.
+func (s *Server) call(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "status":
+		return s.backend.Status(), nil
+	case "list":
+		var p ListParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return s.list(ctx, p)
+	case "entry":
+		var p EntryParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		mediaType, entry, err := s.findEntry(ctx, p.MediaID)
+		if err != nil {
+			return nil, err
+		}
+		return newEntry(mediaType, entry), nil
+	case "setProgress":
+		var p ProgressParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return s.setProgress(ctx, p)
+	default:
+		return nil, &Error{Code: codeMethodNotFound, Message: fmt.Sprintf("unknown method %q", method)}
+	}
+}
+
+func decodeParams(params json.RawMessage, out interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(params, out); err != nil {
+		return &Error{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// list returns the entries on one list, optionally only those with one status.
+func (s *Server) list(ctx context.Context, p ListParams) ([]Entry, error) {
+	mediaType := anilist.MediaType(strings.ToUpper(p.Type))
+	if mediaType != anilist.MediaTypeAnime && mediaType != anilist.MediaTypeManga {
+		return nil, &Error{Code: codeInvalidParams, Message: "type must be ANIME or MANGA"}
+	}
+	var status anilist.MediaListStatus
+	if p.Status != "" {
+		var ok bool
+		if status, ok = anilist.ParseMediaListStatus(p.Status); !ok {
+			return nil, &Error{Code: codeInvalidParams, Message: fmt.Sprintf("unknown status %q", p.Status)}
+		}
+	}
+
+	collection, err := s.backend.Lists(ctx, mediaType)
+	if err != nil {
+		return nil, err
+	}
+	entries := []Entry{}
+	for _, entry := range collection.Entries() {
+		if status == "" || entry.Status == status {
+			entries = append(entries, newEntry(mediaType, entry))
+		}
+	}
+	return entries, nil
+}
+
+// findEntry looks for a media on the anime list, then the manga list.
+func (s *Server) findEntry(ctx context.Context, mediaID int) (anilist.MediaType, *anilist.MediaListEntry, error) {
+	if mediaID <= 0 {
+		return "", nil, &Error{Code: codeInvalidParams, Message: "mediaId is required"}
+	}
+	for _, mediaType := range []anilist.MediaType{anilist.MediaTypeAnime, anilist.MediaTypeManga} {
+		collection, err := s.backend.Lists(ctx, mediaType)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, entry := range collection.Entries() {
+			if entry.MediaID == mediaID {
+				return mediaType, entry, nil
+			}
+		}
+	}
+	return "", nil, &Error{Code: codeNotFound, Message: fmt.Sprintf("media %d isn't on your lists", mediaID)}
+}
+
+// setProgress sets an entry's progress, or changes it by a delta.  The edit is queued like one made in the app, so
+// it reaches AniList even if it is offline, and the returned entry shows it straight away.
+func (s *Server) setProgress(ctx context.Context, p ProgressParams) (Entry, error) {
+	if (p.Progress == nil) == (p.Delta == nil) {
+		return Entry{}, &Error{Code: codeInvalidParams, Message: "give either progress or delta"}
+	}
+	mediaType, entry, err := s.findEntry(ctx, p.MediaID)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	progress := entry.Progress
+	if p.Progress != nil {
+		progress = *p.Progress
+	} else {
+		progress += *p.Delta
+	}
+	progress = max(progress, 0)
+	if total := newEntry(mediaType, entry).Total; total != nil && *total > 0 {
+		progress = min(progress, *total)
+	}
+
+	input := anilist.SaveMediaListEntryInput{Progress: &progress}
+	if err := s.backend.SaveEntry(mediaType, entry, input); err != nil {
+		return Entry{}, err
+	}
+	updated := *entry
+	input.ApplyTo(&updated)
+	return newEntry(mediaType, &updated), nil
+}
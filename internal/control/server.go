@@ -0,0 +1,201 @@
+package control
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// unixPrefix marks an address as the path of a unix socket rather than a host and port.
+const unixPrefix = "unix:"
+
+// maxRequestBytes bounds the size of a request body.
+const maxRequestBytes = 1 << 20
+
+var (
+	// ErrNotLoggedIn is returned by a Backend when no account is logged in.
+	ErrNotLoggedIn = errors.New("not logged in")
+	// ErrNotLoopback is returned when asked to listen on an address other programs could reach over the network.
+	ErrNotLoopback = errors.New("the control API only listens on loopback addresses and unix sockets")
+)
+
+// Status describes the app for the status method.
+type Status struct {
+	LoggedIn     bool   `json:"loggedIn"`
+	Account      string `json:"account,omitempty"`
+	UserID       int    `json:"userId,omitempty"`
+	Mode         string `json:"mode"`
+	PendingEdits int    `json:"pendingEdits"`
+}
+
+// Backend is the app state the control API reads and changes.  It is implemented by the app, so requests see the
+// same lists and join the same queue of edits as the GUI.
+type Backend interface {
+	// Status describes the active account.
+	Status() Status
+	// Lists returns the active account's lists of one media type, or ErrNotLoggedIn.
+	Lists(ctx context.Context, mediaType anilist.MediaType) (*anilist.MediaListCollection, error)
+	// SaveEntry queues a change to an entry, as if it were made in the app, or returns ErrNotLoggedIn.
+	SaveEntry(mediaType anilist.MediaType, entry *anilist.MediaListEntry, input anilist.SaveMediaListEntryInput) error
+}
+
+// Server serves the control API.  Every request must carry the token as a bearer token.
+type Server struct {
+	backend Backend
+	token   string
+
+	mutex    sync.Mutex
+	server   *http.Server
+	address  string
+	unixPath string
+}
+
+// NewServer creates a server for the backend, accepting requests with the given token.
+func NewServer(backend Backend, token string) *Server {
+	return &Server{backend: backend, token: token}
+}
+
+// Token returns the token requests must carry.
+func (s *Server) Token() string {
+	return s.token
+}
+
+// Address returns the address the server is listening on, or an empty string if it isn't.
+func (s *Server) Address() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.address
+}
+
+// Handler returns the HTTP handler serving the API.  JSON-RPC requests are posted to /rpc.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/rpc", s.authenticate(http.HandlerFunc(s.serveRPC)))
+	return mux
+}
+
+// Start listens on the address, either a loopback host and port or "unix:" and a socket path, and serves
+// requests in the background until Close is called.
+func (s *Server) Start(address string) error {
+	listener, err := listen(address)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+
+	s.mutex.Lock()
+	s.server = server
+	s.address = address
+	if strings.HasPrefix(address, unixPrefix) {
+		s.unixPath = strings.TrimPrefix(address, unixPrefix)
+	} else {
+		s.address = listener.Addr().String()
+	}
+	s.mutex.Unlock()
+
+	logrus.Infof("Control API listening on %s", s.Address())
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.Errorf("Control API server error: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	s.mutex.Lock()
+	server, unixPath := s.server, s.unixPath
+	s.server, s.address, s.unixPath = nil, "", ""
+	s.mutex.Unlock()
+	if server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logrus.Errorf("Control API shutdown failed: %v", err)
+	}
+	if unixPath != "" {
+		os.Remove(unixPath)
+	}
+}
+
+// listen opens a listener on a unix socket only the user can connect to, or on a loopback address.
+func listen(address string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(address, unixPrefix); ok {
+		// A socket left behind by a crash would stop the listener being created.
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		listener, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+		}
+		if err := os.Chmod(path, 0600); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("failed to restrict access to %s: %w", path, err)
+		}
+		return listener, nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid control API address %q: %w", address, err)
+	}
+	if !isLoopback(host) {
+		return nil, fmt.Errorf("%w: %s", ErrNotLoopback, address)
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+	return listener, nil
+}
+
+// isLoopback reports whether a host name or IP address only refers to this machine.
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// servesUnix reports whether the server is listening on a unix socket, which web pages can't reach.
+func (s *Server) servesUnix() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.unixPath != ""
+}
+
+// authenticate rejects requests without the token.  Requests naming another host are rejected too, so a web page
+// can't reach the API by pointing its own domain at this machine.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !s.servesUnix() && !isLoopback(host) {
+			http.Error(w, "forbidden host", http.StatusForbidden)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing or invalid token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
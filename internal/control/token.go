@@ -0,0 +1,43 @@
+package control
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/StarTerrarium/hisame/internal/store"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultTokenPath returns where the generated token is kept, next to the config file.
+func DefaultTokenPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user config directory: %w", err)
+	}
+	return filepath.Join(configDir, "hisame", "control-token"), nil
+}
+
+// LoadOrCreateToken reads the token saved at path, generating and saving a random one if there isn't one yet.
+// The file is only readable by the user, and programs using the API can read their token from it.
+func LoadOrCreateToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read control API token: %w", err)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate control API token: %w", err)
+	}
+	token := hex.EncodeToString(secret)
+	if err := store.WriteFileAtomic(path, []byte(token+"\n")); err != nil {
+		return "", fmt.Errorf("failed to save control API token: %w", err)
+	}
+	return token, nil
+}
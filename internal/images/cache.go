@@ -0,0 +1,276 @@
+package images
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/StarTerrarium/hisame/internal/store"
+	"github.com/sirupsen/logrus"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxConcurrentFetches bounds the downloads running at once, so scrolling a long list doesn't open hundreds
+	// of connections to the CDN.
+	maxConcurrentFetches = 6
+	// maxImageBytes guards against downloading something that isn't a cover.
+	maxImageBytes = 20 << 20
+	// DefaultMemoryEntries is how many decoded images are kept in memory by default.
+	DefaultMemoryEntries = 300
+)
+
+// Cache fetches images from AniList's CDN, keeping them on disk up to a size limit and decoded in memory, evicting
+// the least recently used first.  Concurrent requests for the same image share a single download.
+type Cache struct {
+	dir        string
+	maxBytes   int64
+	httpClient *http.Client
+	fetchSlots chan struct{}
+
+	mutex     sync.Mutex
+	disk      map[string]*diskEntry
+	diskBytes int64
+	inFlight  map[string]*call
+
+	memory        *list.List
+	memoryIndex   map[string]*list.Element
+	memoryEntries int
+}
+
+type diskEntry struct {
+	size     int64
+	lastUsed time.Time
+}
+
+type memoryEntry struct {
+	url   string
+	image image.Image
+}
+
+// call is a download that other requests for the same image wait on.
+type call struct {
+	done  chan struct{}
+	image image.Image
+	err   error
+}
+
+// DefaultDir returns the directory images are cached in, shared by all accounts.
+func DefaultDir() (string, error) {
+	base, err := store.DefaultDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "images"), nil
+}
+
+// New opens the image cache in dir, which holds at most maxBytes of images on disk.
+func New(dir string, maxBytes int64, memoryEntries int) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create image cache directory: %w", err)
+	}
+	c := &Cache{
+		dir:           dir,
+		maxBytes:      maxBytes,
+		httpClient:    &http.Client{Timeout: 30 * time.Second},
+		fetchSlots:    make(chan struct{}, maxConcurrentFetches),
+		disk:          map[string]*diskEntry{},
+		inFlight:      map[string]*call{},
+		memory:        list.New(),
+		memoryIndex:   map[string]*list.Element{},
+		memoryEntries: memoryEntries,
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image cache directory: %w", err)
+	}
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil || file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		// The modification time is bumped on every read, so it doubles as the last used time.
+		c.disk[file.Name()] = &diskEntry{size: info.Size(), lastUsed: info.ModTime()}
+		c.diskBytes += info.Size()
+	}
+	c.mutex.Lock()
+	c.evict()
+	c.mutex.Unlock()
+	logrus.Debugf("Image cache holds %d images, %d bytes", len(c.disk), c.diskBytes)
+	return c, nil
+}
+
+// Cached returns the decoded image if it is already in memory, without touching the disk or network.
+func (c *Cache) Cached(url string) (image.Image, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.memoryIndex[url]; ok {
+		c.memory.MoveToFront(element)
+		return element.Value.(*memoryEntry).image, true
+	}
+	return nil, false
+}
+
+// Load returns the decoded image at url, from memory, disk or the network in that order.
+func (c *Cache) Load(ctx context.Context, url string) (image.Image, error) {
+	if img, ok := c.Cached(url); ok {
+		return img, nil
+	}
+
+	c.mutex.Lock()
+	if pending, ok := c.inFlight[url]; ok {
+		c.mutex.Unlock()
+		select {
+		case <-pending.done:
+			return pending.image, pending.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	pending := &call{done: make(chan struct{})}
+	c.inFlight[url] = pending
+	c.mutex.Unlock()
+
+	// The download isn't tied to the first caller's context, as other callers may be waiting on it.
+	pending.image, pending.err = c.load(url)
+
+	c.mutex.Lock()
+	delete(c.inFlight, url)
+	if pending.err == nil {
+		c.remember(url, pending.image)
+	}
+	c.mutex.Unlock()
+	close(pending.done)
+	return pending.image, pending.err
+}
+
+// load reads an image from disk, downloading it first if it isn't cached.
+func (c *Cache) load(url string) (image.Image, error) {
+	name := fileName(url)
+	path := filepath.Join(c.dir, name)
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		c.mutex.Lock()
+		if entry, ok := c.disk[name]; ok {
+			entry.lastUsed = now
+		}
+		c.mutex.Unlock()
+	} else {
+		data, err = c.fetch(url)
+		if err != nil {
+			return nil, err
+		}
+		if err := store.WriteFileAtomic(path, data); err != nil {
+			logrus.Warnf("Error caching image %s: %v", url, err)
+		} else {
+			c.mutex.Lock()
+			if old, ok := c.disk[name]; ok {
+				c.diskBytes -= old.size
+			}
+			c.disk[name] = &diskEntry{size: int64(len(data)), lastUsed: time.Now()}
+			c.diskBytes += int64(len(data))
+			c.evict()
+			c.mutex.Unlock()
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image %s: %w", url, err)
+	}
+	return img, nil
+}
+
+// fetch downloads an image, waiting for a free download slot.
+func (c *Cache) fetch(url string) ([]byte, error) {
+	c.fetchSlots <- struct{}{}
+	defer func() { <-c.fetchSlots }()
+
+	logrus.Debugf("Downloading image %s", url)
+	resp, err := c.httpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download image %s: status %d", url, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image %s: %w", url, err)
+	}
+	return data, nil
+}
+
+// remember adds a decoded image to the in memory cache.  Must be called with the mutex held.
+func (c *Cache) remember(url string, img image.Image) {
+	if c.memoryEntries <= 0 {
+		return
+	}
+	if element, ok := c.memoryIndex[url]; ok {
+		c.memory.MoveToFront(element)
+		return
+	}
+	c.memoryIndex[url] = c.memory.PushFront(&memoryEntry{url: url, image: img})
+	for c.memory.Len() > c.memoryEntries {
+		oldest := c.memory.Back()
+		c.memory.Remove(oldest)
+		delete(c.memoryIndex, oldest.Value.(*memoryEntry).url)
+	}
+}
+
+// evict removes the least recently used images from disk until the cache fits its size limit.  Must be called
+// with the mutex held.
+func (c *Cache) evict() {
+	if c.maxBytes <= 0 || c.diskBytes <= c.maxBytes {
+		return
+	}
+	names := make([]string, 0, len(c.disk))
+	for name := range c.disk {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return c.disk[names[i]].lastUsed.Before(c.disk[names[j]].lastUsed)
+	})
+	for _, name := range names {
+		if c.diskBytes <= c.maxBytes {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.dir, name)); err != nil && !os.IsNotExist(err) {
+			logrus.Warnf("Error evicting cached image %s: %v", name, err)
+			continue
+		}
+		c.diskBytes -= c.disk[name].size
+		delete(c.disk, name)
+	}
+}
+
+// DiskUsage returns the number of bytes of images cached on disk.
+func (c *Cache) DiskUsage() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.diskBytes
+}
+
+// fileName returns the name an image is cached under.
+func fileName(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,135 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newImageServer serves a small PNG at every path, counting requests.  release is closed to let held requests
+// finish, so tests can pile up concurrent requests.
+func newImageServer(t *testing.T, hold bool) (*httptest.Server, *int32, chan struct{}) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+
+	var requests int32
+	release := make(chan struct{})
+	if !hold {
+		close(release)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		w.Write(buf.Bytes())
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &requests, release
+}
+
+func TestLoad_DeduplicatesInFlight(t *testing.T) {
+	ts, requests, release := newImageServer(t, true)
+	c, err := New(t.TempDir(), 0, DefaultMemoryEntries)
+	if err != nil {
+		t.Fatalf("Failed to open cache: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Load(context.Background(), ts.URL+"/cover.png")
+			errs <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Expected load to succeed, got %v", err)
+		}
+	}
+	if *requests != 1 {
+		t.Errorf("Expected 1 download, got %d", *requests)
+	}
+}
+
+func TestLoad_UsesDiskCache(t *testing.T) {
+	ts, requests, _ := newImageServer(t, false)
+	dir := t.TempDir()
+	c, _ := New(dir, 0, DefaultMemoryEntries)
+	if _, err := c.Load(context.Background(), ts.URL+"/cover.png"); err != nil {
+		t.Fatalf("Expected load to succeed, got %v", err)
+	}
+
+	// A new cache has nothing in memory, but finds the image on disk.
+	reopened, _ := New(dir, 0, DefaultMemoryEntries)
+	if _, ok := reopened.Cached(ts.URL + "/cover.png"); ok {
+		t.Fatal("Expected a reopened cache to start with nothing in memory")
+	}
+	img, err := reopened.Load(context.Background(), ts.URL+"/cover.png")
+	if err != nil || img.Bounds().Dx() != 4 {
+		t.Fatalf("Expected the cached image, got %v, %v", img, err)
+	}
+	if *requests != 1 {
+		t.Errorf("Expected 1 download, got %d", *requests)
+	}
+}
+
+func TestEvict_LeastRecentlyUsed(t *testing.T) {
+	ts, _, _ := newImageServer(t, false)
+	c, _ := New(t.TempDir(), 0, 0)
+	ctx := context.Background()
+	c.Load(ctx, ts.URL+"/a.png")
+	size := c.DiskUsage()
+
+	// Room for two images.  Using a after b is cached makes b the one evicted by c.
+	c.maxBytes = 2 * size
+	time.Sleep(10 * time.Millisecond)
+	c.Load(ctx, ts.URL+"/b.png")
+	time.Sleep(10 * time.Millisecond)
+	c.Load(ctx, ts.URL+"/a.png")
+	time.Sleep(10 * time.Millisecond)
+	c.Load(ctx, ts.URL+"/c.png")
+
+	if got := c.DiskUsage(); got != 2*size {
+		t.Errorf("Expected %d bytes cached, got %d", 2*size, got)
+	}
+	if _, ok := c.disk[fileName(ts.URL+"/b.png")]; ok {
+		t.Error("Expected the least recently used image to be evicted")
+	}
+	if _, ok := c.disk[fileName(ts.URL+"/a.png")]; !ok {
+		t.Error("Expected the recently used image to be kept")
+	}
+}
+
+func TestMemoryCache_Bounded(t *testing.T) {
+	ts, _, _ := newImageServer(t, false)
+	c, _ := New(t.TempDir(), 0, 2)
+	ctx := context.Background()
+	for _, name := range []string{"/a.png", "/b.png", "/c.png"} {
+		c.Load(ctx, ts.URL+name)
+	}
+
+	if _, ok := c.Cached(ts.URL + "/a.png"); ok {
+		t.Error("Expected the oldest image to be dropped from memory")
+	}
+	if _, ok := c.Cached(ts.URL + "/c.png"); !ok {
+		t.Error("Expected the newest image to be in memory")
+	}
+}
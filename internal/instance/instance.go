@@ -0,0 +1,197 @@
+package instance
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	lockFileName   = "hisame.lock"
+	socketFileName = "hisame.sock"
+
+	// connectTimeout is how long a second launch keeps trying to reach the running instance, which may still be
+	// starting up.
+	connectTimeout = 3 * time.Second
+	// exchangeTimeout bounds sending a message and reading the reply.
+	exchangeTimeout = 5 * time.Second
+	// maxMessageBytes bounds the size of a forwarded message.
+	maxMessageBytes = 64 * 1024
+)
+
+// ErrRunning is returned by Acquire when another instance holds the lock.
+var ErrRunning = errors.New("hisame is already running")
+
+// Message is what a second launch sends to the running instance.
+type Message struct {
+	// Args are the command line arguments of the second launch, after the global flags.  Only links are forwarded.
+	// Commands take the lock themselves, so they don't run while the app is open.
+	Args []string `json:"args"`
+}
+
+type reply struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// DefaultDir returns where the lock and socket live: the runtime directory where there is one, as it is cleared on
+// logout, otherwise the cache directory.
+func DefaultDir() (string, error) {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "hisame"), nil
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user cache directory: %w", err)
+	}
+	return filepath.Join(cacheDir, "hisame"), nil
+}
+
+// Instance is the lock held by the running instance, and the socket it receives messages from later launches on.
+type Instance struct {
+	dir  string
+	lock *os.File
+
+	mutex    sync.Mutex
+	listener net.Listener
+}
+
+// Acquire takes the single-instance lock in dir, returning ErrRunning if another instance holds it.  The lock is
+// released by the operating system if the process dies, so a crash never leaves it stuck.
+func Acquire(dir string) (*Instance, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create instance directory: %w", err)
+	}
+	file, err := os.OpenFile(filepath.Join(dir, lockFileName), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open instance lock: %w", err)
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	file.Truncate(0)
+	fmt.Fprintf(file, "%d\n", os.Getpid())
+	return &Instance{dir: dir, lock: file}, nil
+}
+
+// Serve listens for messages from later launches in the background, calling handler with each.  An error returned
+// by the handler is reported to the launch that sent the message.
+func (i *Instance) Serve(handler func(Message) error) error {
+	path := filepath.Join(i.dir, socketFileName)
+	// Holding the lock means any socket left here belongs to an instance that has gone.
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to restrict access to %s: %w", path, err)
+	}
+	i.mutex.Lock()
+	i.listener = listener
+	i.mutex.Unlock()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					logrus.Errorf("Error accepting instance connection: %v", err)
+				}
+				return
+			}
+			go handleConn(conn, handler)
+		}
+	}()
+	return nil
+}
+
+func handleConn(conn net.Conn, handler func(Message) error) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(exchangeTimeout))
+	var message Message
+	if err := json.NewDecoder(bufio.NewReader(&limitedConn{conn, maxMessageBytes})).Decode(&message); err != nil {
+		logrus.Warnf("Ignoring unreadable message from another launch: %v", err)
+		return
+	}
+	logrus.Infof("Another launch forwarded arguments %q", message.Args)
+	var r reply
+	if err := handler(message); err != nil {
+		r.Error = err.Error()
+	} else {
+		r.OK = true
+	}
+	json.NewEncoder(conn).Encode(r)
+}
+
+// limitedConn stops reading after a number of bytes, so a misbehaving client can't use unbounded memory.
+type limitedConn struct {
+	conn      net.Conn
+	remaining int
+}
+
+func (c *limitedConn) Read(p []byte) (int, error) {
+	if c.remaining <= 0 {
+		return 0, errors.New("message too large")
+	}
+	if len(p) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.conn.Read(p)
+	c.remaining -= n
+	return n, err
+}
+
+// Release stops listening and gives up the lock.
+func (i *Instance) Release() {
+	i.mutex.Lock()
+	if i.listener != nil {
+		i.listener.Close()
+		i.listener = nil
+	}
+	i.mutex.Unlock()
+	os.Remove(filepath.Join(i.dir, socketFileName))
+	unlockFile(i.lock)
+	i.lock.Close()
+}
+
+// Forward sends a message to the instance running with the lock in dir, waiting for it to be handled.
+func Forward(dir string, message Message) error {
+	path := filepath.Join(dir, socketFileName)
+	var conn net.Conn
+	deadline := time.Now().Add(connectTimeout)
+	for {
+		var err error
+		conn, err = net.DialTimeout("unix", path, connectTimeout)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("couldn't reach the running instance: %w", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(exchangeTimeout))
+	if err := json.NewEncoder(conn).Encode(message); err != nil {
+		return fmt.Errorf("couldn't send to the running instance: %w", err)
+	}
+	var r reply
+	if err := json.NewDecoder(conn).Decode(&r); err != nil {
+		return fmt.Errorf("no reply from the running instance: %w", err)
+	}
+	if !r.OK {
+		return errors.New(r.Error)
+	}
+	return nil
+}
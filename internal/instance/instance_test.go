@@ -0,0 +1,68 @@
+package instance
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// shortTempDir returns a temporary directory with a path short enough for a unix socket.
+func shortTempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "hisame")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestAcquire_SecondLaunchSeesRunningInstance(t *testing.T) {
+	dir := filepath.Join(shortTempDir(t), "nested")
+	first, err := Acquire(dir)
+	if err != nil {
+		t.Fatalf("Expected the first launch to get the lock, got %v", err)
+	}
+	if _, err := Acquire(dir); !errors.Is(err, ErrRunning) {
+		t.Fatalf("Expected ErrRunning for the second launch, got %v", err)
+	}
+	first.Release()
+
+	again, err := Acquire(dir)
+	if err != nil {
+		t.Fatalf("Expected the lock to be free after release, got %v", err)
+	}
+	again.Release()
+}
+
+func TestForward(t *testing.T) {
+	dir := shortTempDir(t)
+	running, err := Acquire(dir)
+	if err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+	defer running.Release()
+
+	received := make(chan Message, 2)
+	err = running.Serve(func(message Message) error {
+		received <- message
+		if len(message.Args) > 0 && message.Args[0] == "bad" {
+			return errors.New("unknown link")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to serve: %v", err)
+	}
+
+	if err := Forward(dir, Message{Args: []string{"hisame://anime/1"}}); err != nil {
+		t.Fatalf("Expected forward to succeed, got %v", err)
+	}
+	if message := <-received; len(message.Args) != 1 || message.Args[0] != "hisame://anime/1" {
+		t.Errorf("Unexpected message %+v", message)
+	}
+	if err := Forward(dir, Message{Args: []string{"bad"}}); err == nil || err.Error() != "unknown link" {
+		t.Errorf("Expected the handler's error, got %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+package keymap
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidBinding is returned by Parse for text that doesn't describe a key.
+var ErrInvalidBinding = errors.New("invalid key binding")
+
+// Action is something a key binding does.  Its value is the name used for it in the config file.
+type Action string
+
+const (
+	ActionAnime       Action = "anime"
+	ActionSearch      Action = "search"
+	ActionFocusSearch Action = "focusSearch"
+	ActionNext        Action = "next"
+	ActionPrevious    Action = "previous"
+	ActionIncrement   Action = "increment"
+	ActionDecrement   Action = "decrement"
+	ActionEdit        Action = "edit"
+	ActionOpen        Action = "open"
+	ActionPalette     Action = "palette"
+	ActionHelp        Action = "help"
+)
+
+// Actions lists every action with a description for the help overlay, in the order they are listed.
+var Actions = []struct {
+	Action      Action
+	Description string
+}{
+	{ActionAnime, "Show your anime list"},
+	{ActionSearch, "Show the search page"},
+	{ActionFocusSearch, "Search AniList"},
+	{ActionNext, "Move to the next row"},
+	{ActionPrevious, "Move to the previous row"},
+	{ActionIncrement, "Add one to the row's progress"},
+	{ActionDecrement, "Take one from the row's progress"},
+	{ActionEdit, "Edit the row's entry"},
+	{ActionOpen, "Open the row's details"},
+	{ActionPalette, "Open the command palette"},
+	{ActionHelp, "Show these keyboard shortcuts"},
+}
+
+// defaults are the bindings used for actions the config doesn't set.
+var defaults = map[Action]string{
+	ActionAnime:       "ctrl+1",
+	ActionSearch:      "ctrl+3",
+	ActionFocusSearch: "/",
+	ActionNext:        "j",
+	ActionPrevious:    "k",
+	ActionIncrement:   "+",
+	ActionDecrement:   "-",
+	ActionEdit:        "e",
+	ActionOpen:        "enter",
+	ActionPalette:     "ctrl+k",
+	ActionHelp:        "?",
+}
+
+// Modifier is a set of modifier keys held with a key.
+type Modifier int
+
+const (
+	ModifierShift Modifier = 1 << iota
+	ModifierCtrl
+	ModifierAlt
+	ModifierSuper
+)
+
+// modifierNames maps the names a modifier can be written as to the modifier, with the name shown first in the
+// order modifiers are shown.
+var modifierNames = []struct {
+	names    []string
+	modifier Modifier
+}{
+	{[]string{"ctrl", "control"}, ModifierCtrl},
+	{[]string{"alt", "option"}, ModifierAlt},
+	{[]string{"shift"}, ModifierShift},
+	{[]string{"super", "cmd", "command", "meta"}, ModifierSuper},
+}
+
+// namedKeys maps the names of keys that aren't a single character to the names the UI toolkit gives them.
+var namedKeys = map[string]string{
+	"enter":     "Return",
+	"return":    "Return",
+	"escape":    "Escape",
+	"esc":       "Escape",
+	"space":     "Space",
+	"tab":       "Tab",
+	"up":        "Up",
+	"down":      "Down",
+	"left":      "Left",
+	"right":     "Right",
+	"home":      "Home",
+	"end":       "End",
+	"pageup":    "Prior",
+	"pagedown":  "Next",
+	"delete":    "Delete",
+	"backspace": "BackSpace",
+	"insert":    "Insert",
+}
+
+// displayNames are the names shown for keys whose toolkit names aren't what is printed on the key.
+var displayNames = map[string]string{
+	"Return":    "Enter",
+	"Prior":     "Page Up",
+	"Next":      "Page Down",
+	"BackSpace": "Backspace",
+}
+
+// Binding is a key, and the modifiers held with it.
+type Binding struct {
+	// Key is a single character, or the name the UI toolkit gives a key such as "Return" or "F1".  Letters are
+	// upper case when the binding has modifiers, since they then name the key rather than the character typed.
+	Key       string
+	Modifiers Modifier
+}
+
+// Parse reads a binding written like "ctrl+1", "j", "+" or "enter".
+func Parse(raw string) (Binding, error) {
+	text := strings.TrimSpace(raw)
+	var key string
+	var modifiers []string
+	switch {
+	case text == "":
+		return Binding{}, fmt.Errorf("%w: empty", ErrInvalidBinding)
+	case text == "+":
+		key = text
+	case strings.HasSuffix(text, "++"):
+		key = "+"
+		modifiers = strings.Split(text[:len(text)-2], "+")
+	default:
+		parts := strings.Split(text, "+")
+		key = parts[len(parts)-1]
+		modifiers = parts[:len(parts)-1]
+	}
+
+	var binding Binding
+	for _, name := range modifiers {
+		modifier, ok := parseModifier(name)
+		if !ok {
+			return Binding{}, fmt.Errorf("%w %q: unknown modifier %q", ErrInvalidBinding, raw, name)
+		}
+		binding.Modifiers |= modifier
+	}
+	if binding.Modifiers == ModifierShift {
+		// Shift on its own changes the character typed rather than making a shortcut.
+		return Binding{}, fmt.Errorf("%w %q: bind the character shift types instead", ErrInvalidBinding, raw)
+	}
+
+	key = strings.TrimSpace(key)
+	lower := strings.ToLower(key)
+	switch {
+	case len([]rune(key)) == 1 && binding.Modifiers != 0:
+		binding.Key = strings.ToUpper(key)
+	case len([]rune(key)) == 1:
+		binding.Key = key
+	case namedKeys[lower] != "":
+		binding.Key = namedKeys[lower]
+	case isFunctionKey(lower):
+		binding.Key = strings.ToUpper(lower)
+	default:
+		return Binding{}, fmt.Errorf("%w %q: unknown key %q", ErrInvalidBinding, raw, key)
+	}
+	return binding, nil
+}
+
+func parseModifier(name string) (Modifier, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, m := range modifierNames {
+		for _, n := range m.names {
+			if n == name {
+				return m.modifier, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// isFunctionKey reports whether name is one of f1 to f12.
+func isFunctionKey(name string) bool {
+	var n int
+	if _, err := fmt.Sscanf(name, "f%d", &n); err != nil {
+		return false
+	}
+	return n >= 1 && n <= 12 && name == fmt.Sprintf("f%d", n)
+}
+
+// Typed reports whether the binding is a character typed without modifiers, rather than a key or shortcut.
+func (b Binding) Typed() bool {
+	return b.Modifiers == 0 && len([]rune(b.Key)) == 1
+}
+
+// String returns the binding as it is shown to the user, such as "Ctrl+1" or "Enter".
+func (b Binding) String() string {
+	var parts []string
+	for _, m := range modifierNames {
+		if b.Modifiers&m.modifier != 0 {
+			name := m.names[0]
+			parts = append(parts, strings.ToUpper(name[:1])+name[1:])
+		}
+	}
+	key := b.Key
+	if name, ok := displayNames[key]; ok {
+		key = name
+	}
+	return strings.Join(append(parts, key), "+")
+}
+
+// Keymap maps each action to the key that does it.  Actions without a binding can't be done from the keyboard.
+type Keymap map[Action]Binding
+
+// New returns the default keymap with the bindings in config applied.  Config maps action names to bindings, and an
+// empty binding unbinds the action.  Unknown actions and invalid bindings are logged and ignored.
+func New(config map[string]string) Keymap {
+	keymap := Keymap{}
+	for action, raw := range defaults {
+		binding, err := Parse(raw)
+		if err != nil {
+			panic(fmt.Sprintf("default binding for %s: %v", action, err))
+		}
+		keymap[action] = binding
+	}
+
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		action := Action(name)
+		if _, ok := defaults[action]; !ok {
+			logrus.Warnf("Unknown action '%s' in keymap configuration", name)
+			continue
+		}
+		if strings.TrimSpace(config[name]) == "" {
+			delete(keymap, action)
+			continue
+		}
+		binding, err := Parse(config[name])
+		if err != nil {
+			logrus.Warnf("Invalid binding for '%s' in keymap configuration; using %s: %v", name, keymap[action], err)
+			continue
+		}
+		keymap[action] = binding
+	}
+
+	for _, a := range Actions {
+		binding, ok := keymap[a.Action]
+		if !ok {
+			continue
+		}
+		if other, ok := keymap.Action(binding); ok && other != a.Action {
+			logrus.Warnf("%s is bound to both '%s' and '%s' in keymap configuration; only '%s' will be used", binding, other, a.Action, other)
+		}
+	}
+	return keymap
+}
+
+// Action returns the action a binding does.  When several actions share a binding, the first in Actions is returned.
+func (k Keymap) Action(binding Binding) (Action, bool) {
+	for _, a := range Actions {
+		if b, ok := k[a.Action]; ok && b == binding {
+			return a.Action, true
+		}
+	}
+	return "", false
+}
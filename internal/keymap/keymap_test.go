@@ -0,0 +1,144 @@
+package keymap
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected Binding
+	}{
+		{"j", Binding{Key: "j"}},
+		{"J", Binding{Key: "J"}},
+		{"/", Binding{Key: "/"}},
+		{"+", Binding{Key: "+"}},
+		{"-", Binding{Key: "-"}},
+		{" e ", Binding{Key: "e"}},
+		{"ctrl+1", Binding{Key: "1", Modifiers: ModifierCtrl}},
+		{"Ctrl+K", Binding{Key: "K", Modifiers: ModifierCtrl}},
+		{"ctrl+k", Binding{Key: "K", Modifiers: ModifierCtrl}},
+		{"ctrl+shift+k", Binding{Key: "K", Modifiers: ModifierCtrl | ModifierShift}},
+		{"alt++", Binding{Key: "+", Modifiers: ModifierAlt}},
+		{"cmd+f", Binding{Key: "F", Modifiers: ModifierSuper}},
+		{"enter", Binding{Key: "Return"}},
+		{"Escape", Binding{Key: "Escape"}},
+		{"pagedown", Binding{Key: "Next"}},
+		{"f1", Binding{Key: "F1"}},
+		{"ctrl+F12", Binding{Key: "F12", Modifiers: ModifierCtrl}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.raw)
+		if err != nil {
+			t.Errorf("Expected %q to parse, got %v", tt.raw, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("Expected %q to parse as %+v, got %+v", tt.raw, tt.expected, got)
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, raw := range []string{"", "  ", "hyper+k", "ctrl+", "f13", "f1x", "jk", "ctrl+nothing", "shift+k"} {
+		if _, err := Parse(raw); !errors.Is(err, ErrInvalidBinding) {
+			t.Errorf("Expected ErrInvalidBinding for %q, got %v", raw, err)
+		}
+	}
+}
+
+func TestBinding_String(t *testing.T) {
+	tests := []struct {
+		binding  Binding
+		expected string
+	}{
+		{Binding{Key: "j"}, "j"},
+		{Binding{Key: "1", Modifiers: ModifierCtrl}, "Ctrl+1"},
+		{Binding{Key: "K", Modifiers: ModifierShift | ModifierCtrl}, "Ctrl+Shift+K"},
+		{Binding{Key: "Return"}, "Enter"},
+		{Binding{Key: "Prior", Modifiers: ModifierAlt}, "Alt+Page Up"},
+	}
+	for _, tt := range tests {
+		if got := tt.binding.String(); got != tt.expected {
+			t.Errorf("Expected %+v to show as %q, got %q", tt.binding, tt.expected, got)
+		}
+	}
+}
+
+func TestBinding_Typed(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected bool
+	}{
+		{"j", true},
+		{"+", true},
+		{"ctrl+1", false},
+		{"enter", false},
+		{"f1", false},
+	}
+	for _, tt := range tests {
+		binding, err := Parse(tt.raw)
+		if err != nil {
+			t.Fatalf("Expected %q to parse, got %v", tt.raw, err)
+		}
+		if got := binding.Typed(); got != tt.expected {
+			t.Errorf("Expected Typed() of %q to be %v, got %v", tt.raw, tt.expected, got)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	keymap := New(map[string]string{
+		"next":     "down",
+		"previous": "",
+		"edit":     "not a key",
+		"unknown":  "x",
+	})
+
+	if got := keymap[ActionNext]; got != (Binding{Key: "Down"}) {
+		t.Errorf("Expected next to be rebound to Down, got %+v", got)
+	}
+	if _, ok := keymap[ActionPrevious]; ok {
+		t.Errorf("Expected previous to be unbound")
+	}
+	if got := keymap[ActionEdit]; got != (Binding{Key: "e"}) {
+		t.Errorf("Expected an invalid binding to keep the default, got %+v", got)
+	}
+	if got := keymap[ActionAnime]; got != (Binding{Key: "1", Modifiers: ModifierCtrl}) {
+		t.Errorf("Expected anime to keep its default, got %+v", got)
+	}
+	if _, ok := keymap[Action("unknown")]; ok {
+		t.Errorf("Expected unknown actions to be ignored")
+	}
+	if len(keymap) != len(Actions)-1 {
+		t.Errorf("Expected %d bindings, got %d", len(Actions)-1, len(keymap))
+	}
+}
+
+func TestKeymap_Action(t *testing.T) {
+	keymap := New(map[string]string{"open": "e"})
+
+	action, ok := keymap.Action(Binding{Key: "e"})
+	if !ok || action != ActionEdit {
+		t.Errorf("Expected a shared binding to do the first action listed, got %q", action)
+	}
+	action, ok = keymap.Action(Binding{Key: "1", Modifiers: ModifierCtrl})
+	if !ok || action != ActionAnime {
+		t.Errorf("Expected Ctrl+1 to show the anime list, got %q", action)
+	}
+	if action, ok := keymap.Action(Binding{Key: "z"}); ok {
+		t.Errorf("Expected no action for an unbound key, got %q", action)
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	for _, a := range Actions {
+		if _, ok := defaults[a.Action]; !ok {
+			t.Errorf("Expected a default binding for %s", a.Action)
+		}
+	}
+	if len(defaults) != len(Actions) {
+		t.Errorf("Expected %d default bindings, got %d", len(Actions), len(defaults))
+	}
+}
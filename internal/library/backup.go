@@ -0,0 +1,35 @@
+package library
+
+import (
+	"context"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/backup"
+	"github.com/sirupsen/logrus"
+)
+
+// Backup backs up the account's anime and manga lists.  The lists are synced first when AniList can be reached;
+// otherwise the cached lists are used, which include edits that haven't been synced yet.
+func (l *Library) Backup(ctx context.Context) (*backup.Backup, error) {
+	viewer, err := l.client.Viewer(ctx)
+	if err != nil {
+		if !anilist.IsTemporary(err) || l.store == nil {
+			return nil, err
+		}
+		cached, _, cacheErr := l.store.LoadViewer()
+		if cacheErr != nil {
+			return nil, err
+		}
+		logrus.Warnf("Backing up cached lists, as AniList can't be reached: %v", err)
+		viewer = cached
+	}
+
+	return backup.Create(ctx, viewer, func(ctx context.Context, mediaType anilist.MediaType) (*anilist.MediaListCollection, error) {
+		collection, err := l.syncer.Sync(ctx, mediaType)
+		if err != nil && anilist.IsTemporary(err) {
+			if cached, _ := l.storedListCollection(mediaType); cached != nil {
+				return cached, nil
+			}
+		}
+		return collection, err
+	})
+}
@@ -0,0 +1,261 @@
+package library
+
+import (
+	"context"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+// SaveEntry queues a change to a list entry and shows it in the cached lists straight away.  entry is the entry as
+// the user last saw it, or nil when adding new media to the list.
+func (l *Library) SaveEntry(mediaType anilist.MediaType, entry *anilist.MediaListEntry, mediaID int, input anilist.SaveMediaListEntryInput) error {
+	m := &Mutation{Kind: MutationSave, MediaType: mediaType, MediaID: mediaID, Input: input}
+	if entry != nil {
+		m.EntryID = entry.ID
+		m.BaseUpdatedAt = entry.UpdatedAt
+	}
+	return l.enqueue(m)
+}
+
+// DeleteEntry queues removing an entry from the user's list and removes it from the cached lists straight away.
+func (l *Library) DeleteEntry(mediaType anilist.MediaType, entry *anilist.MediaListEntry) error {
+	return l.enqueue(&Mutation{
+		Kind:          MutationDelete,
+		MediaType:     mediaType,
+		EntryID:       entry.ID,
+		MediaID:       entry.MediaID,
+		BaseUpdatedAt: entry.UpdatedAt,
+	})
+}
+
+func (l *Library) enqueue(m *Mutation) error {
+	switch l.client.MutationMode() {
+	case anilist.MutationsReadOnly:
+		return anilist.ErrReadOnly
+	case anilist.MutationsDryRun:
+		m.DryRun = true
+	}
+	err := l.queue.Enqueue(m)
+	if err != nil {
+		// The mutation is still queued in memory, it just won't survive a restart.
+		logrus.Errorf("Error saving mutation queue: %v", err)
+	}
+
+	l.updateCachedCollection(m.MediaType, m.DryRun, func(collection *anilist.MediaListCollection) {
+		l.applyMutation(collection, m)
+	})
+	return err
+}
+
+// handleReplayResult brings the cached lists in line with AniList once a mutation has been replayed.
+func (l *Library) handleReplayResult(result ReplayResult) {
+	m := result.Mutation
+	switch {
+	case result.Outcome == OutcomeFailed:
+		// Our optimistic change was never made, so fetch the real state of the list.
+		go func() {
+			if _, err := l.RefreshListCollection(context.Background(), m.MediaType); err == nil {
+				l.notifyLists(m.MediaType)
+			}
+		}()
+		return
+	case result.Entry == nil && (m.Kind == MutationDelete || result.Outcome == OutcomeDiscarded):
+		l.updateCachedCollection(m.MediaType, m.DryRun, func(collection *anilist.MediaListCollection) {
+			removeEntry(collection, m.MediaID)
+		})
+	case result.Entry != nil:
+		l.updateCachedCollection(m.MediaType, m.DryRun, func(collection *anilist.MediaListCollection) {
+			l.setEntry(collection, result.Entry)
+		})
+	}
+}
+
+// updateCachedCollection modifies the cached lists of a media type, and lets subscribers know.  A change made in
+// dry run mode is kept in memory instead, so the stored lists never hold changes AniList doesn't have, and is
+// dropped if dry run has been turned off since.
+func (l *Library) updateCachedCollection(mediaType anilist.MediaType, dryRun bool, update func(collection *anilist.MediaListCollection)) {
+	if l.store == nil {
+		return
+	}
+
+	l.listMutex.Lock()
+	collection, _ := l.storedListCollection(mediaType)
+	if collection == nil {
+		// Nothing to update until the lists have been fetched, which will include the change.
+		l.listMutex.Unlock()
+		return
+	}
+	if dryRun {
+		if l.client.MutationMode() != anilist.MutationsDryRun {
+			l.listMutex.Unlock()
+			return
+		}
+		l.dryRunMutex.Lock()
+		l.dryRunEdits[mediaType] = append(l.dryRunEdits[mediaType], update)
+		l.dryRunMutex.Unlock()
+	} else {
+		update(collection)
+		if err := l.store.SaveListCollection(mediaType, collection); err != nil {
+			logrus.Errorf("Error caching %s lists: %v", mediaType, err)
+		}
+	}
+	l.listMutex.Unlock()
+
+	l.notifyLists(mediaType)
+}
+
+// applyDryRunEdits makes the changes made in dry run mode to a collection read from the store.
+func (l *Library) applyDryRunEdits(mediaType anilist.MediaType, collection *anilist.MediaListCollection) {
+	l.dryRunMutex.Lock()
+	edits := append([]func(*anilist.MediaListCollection){}, l.dryRunEdits[mediaType]...)
+	l.dryRunMutex.Unlock()
+	for _, edit := range edits {
+		edit(collection)
+	}
+}
+
+// DiscardDryRunEdits drops the changes made in dry run mode, and those still queued, so the cached lists show what
+// AniList has again.
+func (l *Library) DiscardDryRunEdits() {
+	l.queue.DiscardDryRun()
+	l.dryRunMutex.Lock()
+	edited := make([]anilist.MediaType, 0, len(l.dryRunEdits))
+	for mediaType := range l.dryRunEdits {
+		edited = append(edited, mediaType)
+	}
+	l.dryRunEdits = map[anilist.MediaType][]func(*anilist.MediaListCollection){}
+	l.dryRunMutex.Unlock()
+
+	for _, mediaType := range edited {
+		l.notifyLists(mediaType)
+	}
+}
+
+// applyMutation makes a pending mutation's change to a collection.
+func (l *Library) applyMutation(collection *anilist.MediaListCollection, m *Mutation) {
+	if m.Kind == MutationDelete {
+		removeEntry(collection, m.MediaID)
+		return
+	}
+
+	entry := findEntry(collection, m.MediaID)
+	if entry == nil {
+		entry = &anilist.MediaListEntry{MediaID: m.MediaID, Status: anilist.StatusPlanning}
+		if l.store != nil {
+			if media, _, err := l.store.LoadMedia(m.MediaID); err == nil {
+				entry.Media = media
+			}
+		}
+	} else {
+		copied := *entry
+		entry = &copied
+	}
+	m.Input.ApplyTo(entry)
+	placeEntry(collection, entry)
+}
+
+// setEntry replaces the cached entry for a media with one returned by AniList.
+func (l *Library) setEntry(collection *anilist.MediaListCollection, entry *anilist.MediaListEntry) {
+	updated := *entry
+	if existing := findEntry(collection, entry.MediaID); existing != nil && updated.Media == nil {
+		updated.Media = existing.Media
+	}
+	if updated.Media == nil && l.store != nil {
+		if media, _, err := l.store.LoadMedia(entry.MediaID); err == nil {
+			updated.Media = media
+		}
+	}
+	placeEntry(collection, &updated)
+}
+
+// findEntry returns the collection's entry for a media, or nil.
+func findEntry(collection *anilist.MediaListCollection, mediaID int) *anilist.MediaListEntry {
+	for _, list := range collection.Lists {
+		for _, entry := range list.Entries {
+			if entry.MediaID == mediaID {
+				return entry
+			}
+		}
+	}
+	return nil
+}
+
+// removeEntry removes a media from every list in the collection.
+func removeEntry(collection *anilist.MediaListCollection, mediaID int) {
+	for _, list := range collection.Lists {
+		kept := list.Entries[:0]
+		for _, entry := range list.Entries {
+			if entry.MediaID != mediaID {
+				kept = append(kept, entry)
+			}
+		}
+		list.Entries = kept
+	}
+}
+
+// placeEntry puts an entry in the lists it belongs on, based on its status and custom lists, replacing any
+// existing entry for the same media.
+func placeEntry(collection *anilist.MediaListCollection, entry *anilist.MediaListEntry) {
+	// Completed lists can be split by format, so an entry staying completed stays on the list it is already on.
+	var statusList *anilist.MediaListGroup
+	for _, list := range collection.Lists {
+		if !list.IsCustomList && list.Status == entry.Status && indexOfEntry(list, entry.MediaID) >= 0 {
+			statusList = list
+			break
+		}
+	}
+	if statusList == nil {
+		for _, list := range collection.Lists {
+			if !list.IsCustomList && list.Status == entry.Status {
+				statusList = list
+				break
+			}
+		}
+	}
+	if statusList == nil && !entry.HiddenFromStatusLists {
+		statusList = &anilist.MediaListGroup{Name: statusListName(entry.Status), Status: entry.Status}
+		collection.Lists = append(collection.Lists, statusList)
+	}
+
+	for _, list := range collection.Lists {
+		var wanted bool
+		if list.IsCustomList {
+			wanted = entry.CustomLists[list.Name]
+		} else {
+			wanted = list == statusList && !entry.HiddenFromStatusLists
+		}
+
+		index := indexOfEntry(list, entry.MediaID)
+		switch {
+		case wanted && index >= 0:
+			list.Entries[index] = entry
+		case wanted:
+			list.Entries = append(list.Entries, entry)
+		case index >= 0:
+			list.Entries = append(list.Entries[:index], list.Entries[index+1:]...)
+		}
+	}
+}
+
+func indexOfEntry(list *anilist.MediaListGroup, mediaID int) int {
+	for i, entry := range list.Entries {
+		if entry.MediaID == mediaID {
+			return i
+		}
+	}
+	return -1
+}
+
+// statusListName returns the name AniList gives the list for a status.
+func statusListName(status anilist.MediaListStatus) string {
+	switch status {
+	case anilist.StatusCurrent:
+		return "Watching"
+	case anilist.StatusRepeating:
+		return "Rewatching"
+	default:
+		name := strings.ToLower(string(status))
+		return strings.ToUpper(name[:1]) + name[1:]
+	}
+}
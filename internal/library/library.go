@@ -0,0 +1,306 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/store"
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fetchTimeout bounds each background revalidation request.
+const fetchTimeout = time.Minute
+
+// Library gives cache first access to an account's AniList data.  Cached data is handed back straight away so
+// pages render instantly, then revalidated against AniList in the background.
+type Library struct {
+	store  *store.Store
+	client *anilist.Client
+	userID int
+	queue  *Queue
+	syncer *Syncer
+
+	// Guards reading and writing the cached collections, so local edits and revalidation don't interleave.
+	listMutex     sync.Mutex
+	listeners     map[int]func(mediaType anilist.MediaType)
+	nextListener  int
+	listenerMutex sync.Mutex
+
+	// Changes made to the cached lists in dry run mode.  They never reach AniList, so rather than being stored they
+	// are kept in memory and made again each time the lists are read.
+	dryRunEdits map[anilist.MediaType][]func(collection *anilist.MediaListCollection)
+	dryRunMutex sync.Mutex
+
+	cancel context.CancelFunc
+}
+
+// New creates a Library for the user, caching in the given store.  A nil store disables caching, and keeps
+// pending mutations in memory only.
+func New(s *store.Store, client *anilist.Client, userID int) *Library {
+	l := &Library{
+		store:       s,
+		client:      client,
+		userID:      userID,
+		listeners:   map[int]func(anilist.MediaType){},
+		dryRunEdits: map[anilist.MediaType][]func(*anilist.MediaListCollection){},
+	}
+
+	queuePath := ""
+	if s != nil {
+		queuePath = QueuePath(s)
+	}
+	queue, err := OpenQueue(queuePath, client)
+	if err != nil {
+		logrus.Errorf("Error loading pending mutations; starting with an empty queue: %v", err)
+		queue, _ = OpenQueue("", client)
+	}
+	l.queue = queue
+	l.queue.OnResult(l.handleReplayResult)
+	l.syncer = newSyncer(l)
+	return l
+}
+
+// QueuePath returns where an account's pending mutations are saved.
+func QueuePath(s *store.Store) string {
+	return filepath.Join(s.Dir(), "queue.json")
+}
+
+// Start begins replaying pending mutations and syncing the lists in the background.
+func (l *Library) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	go l.queue.Run(ctx)
+	go l.syncer.Run(ctx)
+	l.queue.Kick()
+}
+
+// Close stops background work started by Start.
+func (l *Library) Close() {
+	if l.cancel != nil {
+		l.cancel()
+	}
+}
+
+// Queue returns the queue of mutations waiting to be sent to AniList.
+func (l *Library) Queue() *Queue {
+	return l.queue
+}
+
+// Syncer returns the syncer keeping the cached lists up to date.
+func (l *Library) Syncer() *Syncer {
+	return l.syncer
+}
+
+// SubscribeLists registers a function called whenever the cached lists of a media type change.  The returned
+// function unsubscribes.
+func (l *Library) SubscribeLists(fn func(mediaType anilist.MediaType)) func() {
+	l.listenerMutex.Lock()
+	defer l.listenerMutex.Unlock()
+	id := l.nextListener
+	l.nextListener++
+	l.listeners[id] = fn
+	return func() {
+		l.listenerMutex.Lock()
+		defer l.listenerMutex.Unlock()
+		delete(l.listeners, id)
+	}
+}
+
+func (l *Library) notifyLists(mediaType anilist.MediaType) {
+	l.listenerMutex.Lock()
+	listeners := make([]func(anilist.MediaType), 0, len(l.listeners))
+	for _, fn := range l.listeners {
+		listeners = append(listeners, fn)
+	}
+	l.listenerMutex.Unlock()
+	for _, fn := range listeners {
+		fn(mediaType)
+	}
+}
+
+// Store returns the account's on-disk store, which may be nil.
+func (l *Library) Store() *store.Store {
+	return l.store
+}
+
+// Client returns the API client used for revalidation.
+func (l *Library) Client() *anilist.Client {
+	return l.client
+}
+
+// ListUpdate is delivered each time a list collection is loaded from the cache or from AniList.
+type ListUpdate struct {
+	Collection *anilist.MediaListCollection
+	// FetchedAt is when the collection was fetched from AniList.
+	FetchedAt time.Time
+	// Fresh is true once the collection has been revalidated against AniList.
+	Fresh bool
+	// Err is set when revalidation failed.  Collection still holds the cached data, if there was any.
+	Err error
+}
+
+// ListCollection loads the user's lists of one media type.  onUpdate is called synchronously with the cached
+// lists, if there are any, and again from a background goroutine once they have been synced with AniList.
+func (l *Library) ListCollection(ctx context.Context, mediaType anilist.MediaType, onUpdate func(ListUpdate)) {
+	cached, fetchedAt := l.cachedListCollection(mediaType)
+	if cached != nil {
+		onUpdate(ListUpdate{Collection: cached, FetchedAt: fetchedAt})
+	}
+
+	go func() {
+		fresh, err := l.syncer.Sync(ctx, mediaType)
+		if err != nil {
+			onUpdate(ListUpdate{Collection: cached, FetchedAt: fetchedAt, Err: err})
+			return
+		}
+		l.applyDryRunEdits(mediaType, fresh)
+		onUpdate(ListUpdate{Collection: fresh, FetchedAt: time.Now(), Fresh: true})
+	}()
+}
+
+// CachedListCollection returns the cached lists of one media type without contacting AniList, or nil.
+func (l *Library) CachedListCollection(mediaType anilist.MediaType) *anilist.MediaListCollection {
+	collection, _ := l.cachedListCollection(mediaType)
+	return collection
+}
+
+// cachedListCollection returns the stored lists of one media type with any dry run changes made to them.
+func (l *Library) cachedListCollection(mediaType anilist.MediaType) (*anilist.MediaListCollection, time.Time) {
+	collection, fetchedAt := l.storedListCollection(mediaType)
+	if collection != nil {
+		l.applyDryRunEdits(mediaType, collection)
+	}
+	return collection, fetchedAt
+}
+
+// storedListCollection returns the lists of one media type as they were last stored, which is how AniList has them
+// apart from pending edits.
+func (l *Library) storedListCollection(mediaType anilist.MediaType) (*anilist.MediaListCollection, time.Time) {
+	if l.store == nil {
+		return nil, time.Time{}
+	}
+	collection, fetchedAt, err := l.store.LoadListCollection(mediaType)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotCached) {
+			logrus.Warnf("Error reading cached %s lists: %v", mediaType, err)
+		}
+		return nil, time.Time{}
+	}
+	return collection, fetchedAt
+}
+
+// RefreshListCollection fetches the user's lists of one media type from AniList and caches them, along with the
+// metadata of every media on them.
+func (l *Library) RefreshListCollection(ctx context.Context, mediaType anilist.MediaType) (*anilist.MediaListCollection, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	collection, err := l.client.MediaListCollection(ctx, l.userID, mediaType)
+	if err != nil {
+		logrus.Warnf("Error fetching %s lists: %v", mediaType, err)
+		return nil, err
+	}
+
+	cursor := latestUpdate(collection)
+
+	l.listMutex.Lock()
+	// Edits that haven't reached AniList yet would otherwise disappear from the page until they do.  Dry run changes
+	// are shown from memory instead.
+	for _, m := range l.queue.Pending() {
+		if m.MediaType == mediaType && !m.DryRun {
+			l.applyMutation(collection, m)
+		}
+	}
+	l.cacheListCollection(mediaType, collection)
+	l.saveSyncCursor(mediaType, cursor)
+	l.listMutex.Unlock()
+	return collection, nil
+}
+
+// cacheListCollection saves a collection, and the media on it, to the store.
+func (l *Library) cacheListCollection(mediaType anilist.MediaType, collection *anilist.MediaListCollection) {
+	if l.store == nil {
+		return
+	}
+	if err := l.store.SaveListCollection(mediaType, collection); err != nil {
+		logrus.Errorf("Error caching %s lists: %v", mediaType, err)
+	}
+	l.cacheMedia(collection.Entries())
+}
+
+// cacheMedia saves the media of the given entries to the store.
+func (l *Library) cacheMedia(entries []*anilist.MediaListEntry) {
+	if l.store == nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.Media == nil {
+			continue
+		}
+		if err := l.store.SaveMedia(entry.Media); err != nil {
+			logrus.Errorf("Error caching media %d: %v", entry.Media.ID, err)
+			return
+		}
+	}
+}
+
+// Media loads the metadata of a single media, calling onUpdate with the cached copy if there is one and again once
+// AniList has responded.  err is only set when revalidation failed.
+func (l *Library) Media(ctx context.Context, id int, onUpdate func(media *anilist.Media, fresh bool, err error)) {
+	var cached *anilist.Media
+	if l.store != nil {
+		if media, _, err := l.store.LoadMedia(id); err == nil {
+			cached = media
+			onUpdate(cached, false, nil)
+		}
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+		defer cancel()
+		media, err := l.client.Media(ctx, id)
+		if err != nil {
+			logrus.Warnf("Error fetching media %d: %v", id, err)
+			onUpdate(cached, false, err)
+			return
+		}
+		if l.store != nil {
+			if err := l.store.SaveMedia(media); err != nil {
+				logrus.Errorf("Error caching media %d: %v", id, err)
+			}
+		}
+		onUpdate(media, true, nil)
+	}()
+}
+
+// Viewer loads the user's profile, calling onUpdate with the cached copy if there is one and again once AniList
+// has responded.  err is only set when revalidation failed.
+func (l *Library) Viewer(ctx context.Context, onUpdate func(viewer *anilist.Viewer, fresh bool, err error)) {
+	var cached *anilist.Viewer
+	if l.store != nil {
+		if viewer, _, err := l.store.LoadViewer(); err == nil {
+			cached = viewer
+			onUpdate(cached, false, nil)
+		}
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+		defer cancel()
+		viewer, err := l.client.Viewer(ctx)
+		if err != nil {
+			logrus.Warnf("Error fetching viewer: %v", err)
+			onUpdate(cached, false, err)
+			return
+		}
+		if l.store != nil {
+			if err := l.store.SaveViewer(viewer); err != nil {
+				logrus.Errorf("Error caching viewer: %v", err)
+			}
+		}
+		onUpdate(viewer, true, nil)
+	}()
+}
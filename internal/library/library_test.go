@@ -0,0 +1,175 @@
+package library
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/store"
+)
+
+const collectionResponse = `{"data":{"MediaListCollection":{"lists":[
+	{"name":"Watching","status":"CURRENT","entries":[
+		{"id":1,"mediaId":10,"status":"CURRENT","progress":5,"media":{"id":10,"title":{"english":"Ten"}}}
+	]}
+]}}}`
+
+// newFakeAPI returns a client for a fake API server that serves the given response to every request.  Closing
+// the server simulates being offline.
+func newFakeAPI(t *testing.T, response string) (*anilist.Client, *httptest.Server) {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(ts.Close)
+	return anilist.NewClientWithEndpoint(ts.URL, "token"), ts
+}
+
+func newStore(t *testing.T) *store.Store {
+	t.Helper()
+	s, err := store.Open(t.TempDir(), "1")
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	return s
+}
+
+// collectUpdates returns an update handler, and a function waiting for the given number of updates.
+func collectUpdates(t *testing.T) (func(ListUpdate), func(n int) []ListUpdate) {
+	updates := make(chan ListUpdate, 10)
+	wait := func(n int) []ListUpdate {
+		var received []ListUpdate
+		for len(received) < n {
+			select {
+			case update := <-updates:
+				received = append(received, update)
+			case <-time.After(2 * time.Second):
+				t.Fatalf("Timed out waiting for update %d of %d", len(received)+1, n)
+			}
+		}
+		return received
+	}
+	return func(update ListUpdate) { updates <- update }, wait
+}
+
+func TestListCollection_RevalidatesAndCaches(t *testing.T) {
+	client, _ := newFakeAPI(t, collectionResponse)
+	s := newStore(t)
+	lib := New(s, client, 1)
+
+	onUpdate, wait := collectUpdates(t)
+	lib.ListCollection(context.Background(), anilist.MediaTypeAnime, onUpdate)
+
+	// Nothing is cached yet, so the only update is the fresh one
+	updates := wait(1)
+	if !updates[0].Fresh || updates[0].Err != nil || updates[0].Collection.Entries()[0].Progress != 5 {
+		t.Fatalf("Expected a fresh collection, got %+v", updates[0])
+	}
+
+	if cached := lib.CachedListCollection(anilist.MediaTypeAnime); cached == nil {
+		t.Fatal("Expected the collection to be cached after revalidating")
+	}
+	if media, _, err := s.LoadMedia(10); err != nil || media.Title.English != "Ten" {
+		t.Fatalf("Expected media on the list to be cached, got %+v, %v", media, err)
+	}
+}
+
+func TestListCollection_ServesCacheFirst(t *testing.T) {
+	client, _ := newFakeAPI(t, strings.Replace(collectionResponse, `"progress":5`, `"progress":6`, 1))
+	s := newStore(t)
+	cached := &anilist.MediaListCollection{Lists: []*anilist.MediaListGroup{{
+		Entries: []*anilist.MediaListEntry{{ID: 1, MediaID: 10, Progress: 5}},
+	}}}
+	if err := s.SaveListCollection(anilist.MediaTypeAnime, cached); err != nil {
+		t.Fatalf("Failed to seed cache: %v", err)
+	}
+
+	onUpdate, wait := collectUpdates(t)
+	New(s, client, 1).ListCollection(context.Background(), anilist.MediaTypeAnime, onUpdate)
+
+	updates := wait(2)
+	if updates[0].Fresh || updates[0].Collection.Entries()[0].Progress != 5 {
+		t.Fatalf("Expected the cached collection first, got %+v", updates[0])
+	}
+	if !updates[1].Fresh || updates[1].Collection.Entries()[0].Progress != 6 {
+		t.Fatalf("Expected the revalidated collection second, got %+v", updates[1])
+	}
+}
+
+func TestListCollection_Offline(t *testing.T) {
+	client, ts := newFakeAPI(t, collectionResponse)
+	ts.Close()
+	s := newStore(t)
+	cached := &anilist.MediaListCollection{Lists: []*anilist.MediaListGroup{{
+		Entries: []*anilist.MediaListEntry{{ID: 1, MediaID: 10, Progress: 5}},
+	}}}
+	if err := s.SaveListCollection(anilist.MediaTypeAnime, cached); err != nil {
+		t.Fatalf("Failed to seed cache: %v", err)
+	}
+
+	onUpdate, wait := collectUpdates(t)
+	New(s, client, 1).ListCollection(context.Background(), anilist.MediaTypeAnime, onUpdate)
+
+	updates := wait(2)
+	if updates[1].Err == nil || !anilist.IsOffline(updates[1].Err) {
+		t.Fatalf("Expected an offline error, got %v", updates[1].Err)
+	}
+	if updates[1].Collection == nil || updates[1].Collection.Entries()[0].Progress != 5 {
+		t.Fatal("Expected the cached collection to still be delivered while offline")
+	}
+}
+
+func TestViewer_Offline(t *testing.T) {
+	client, ts := newFakeAPI(t, "")
+	ts.Close()
+	s := newStore(t)
+	if err := s.SaveViewer(&anilist.Viewer{ID: 1, Name: "Tester"}); err != nil {
+		t.Fatalf("Failed to seed cache: %v", err)
+	}
+
+	done := make(chan struct{})
+	var calls int
+	New(s, client, 1).Viewer(context.Background(), func(viewer *anilist.Viewer, fresh bool, err error) {
+		calls++
+		if viewer == nil || viewer.Name != "Tester" {
+			t.Errorf("Expected cached viewer on call %d, got %+v", calls, viewer)
+		}
+		if calls == 2 {
+			close(done)
+		}
+	})
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for viewer updates")
+	}
+}
+
+func TestBackup_FallsBackToCacheOffline(t *testing.T) {
+	client, ts := newFakeAPI(t, collectionResponse)
+	s := newStore(t)
+	lib := New(s, client, 1)
+	for _, mediaType := range []anilist.MediaType{anilist.MediaTypeAnime, anilist.MediaTypeManga} {
+		if _, err := lib.RefreshListCollection(context.Background(), mediaType); err != nil {
+			t.Fatalf("Failed to cache %s lists: %v", mediaType, err)
+		}
+	}
+	if err := s.SaveViewer(&anilist.Viewer{ID: 1, Name: "tester"}); err != nil {
+		t.Fatalf("Failed to cache viewer: %v", err)
+	}
+	ts.Close()
+
+	b, err := lib.Backup(context.Background())
+	if err != nil {
+		t.Fatalf("Expected a backup of the cached lists, got %v", err)
+	}
+	if b.Username != "tester" || len(b.Entries(anilist.MediaTypeAnime)) != 1 {
+		t.Errorf("Expected the cached lists to be backed up, got %+v", b)
+	}
+}
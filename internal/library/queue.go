@@ -0,0 +1,566 @@
+package library
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/store"
+	"github.com/sirupsen/logrus"
+	"os"
+	"sync"
+	"time"
+)
+
+// retryInterval is how often replay is retried while mutations are pending and AniList can't be reached.
+const retryInterval = 30 * time.Second
+
+// ErrResolveLater is why a mutation was set aside: its conflict was left for the user to resolve later.
+var ErrResolveLater = errors.New("conflict resolution deferred")
+
+// MutationKind is the type of change a Mutation makes.
+type MutationKind string
+
+const (
+	MutationSave   MutationKind = "save"
+	MutationDelete MutationKind = "delete"
+)
+
+// Mutation is a change to the user's list waiting to be sent to AniList.
+type Mutation struct {
+	ID        string                          `json:"id"`
+	Kind      MutationKind                    `json:"kind"`
+	MediaType anilist.MediaType               `json:"mediaType"`
+	EntryID   int                             `json:"entryId"`
+	MediaID   int                             `json:"mediaId"`
+	Input     anilist.SaveMediaListEntryInput `json:"input"`
+	// BaseUpdatedAt is the entry's updatedAt when the user made the change.  If AniList has a different value
+	// when the mutation is replayed, the entry was changed elsewhere in the meantime.
+	BaseUpdatedAt int64     `json:"baseUpdatedAt"`
+	QueuedAt      time.Time `json:"queuedAt"`
+	// Deferred is set when the user chose to resolve the mutation's conflict later.  It isn't sent, and neither are
+	// later mutations to the same media, until the entry is edited again or Resume is called.
+	Deferred bool `json:"deferred,omitempty"`
+	// DryRun is set when the change was made in dry run mode.  It is only ever simulated, and is kept in memory
+	// rather than saved with the queue.
+	DryRun bool `json:"-"`
+}
+
+// Conflict is a pending mutation to an entry that was changed on AniList after the user made their change.
+type Conflict struct {
+	Mutation *Mutation
+	// Server is the entry as it is now on AniList, or nil if it was deleted.
+	Server *anilist.MediaListEntry
+}
+
+// Diffs lists the fields the mutation would change from the server's current values.
+func (c *Conflict) Diffs() []anilist.FieldDiff {
+	if c.Mutation.Kind != MutationSave {
+		return nil
+	}
+	if c.Server == nil {
+		return c.Mutation.Input.Diff(&anilist.MediaListEntry{})
+	}
+	return c.Mutation.Input.Diff(c.Server)
+}
+
+// Resolution is the user's choice for a conflict.
+type Resolution int
+
+const (
+	// ResolveLater sets the mutation aside, leaving it queued while the rest of the queue is replayed.
+	ResolveLater Resolution = iota
+	// KeepMine applies the mutation as is, overwriting the changes made elsewhere.
+	KeepMine
+	// KeepTheirs discards the mutation.
+	KeepTheirs
+	// MergeFields applies only the fields listed in ConflictResolution.MineFields.
+	MergeFields
+)
+
+// ConflictResolution is returned by a ConflictResolver.
+type ConflictResolution struct {
+	Resolution Resolution
+	// MineFields are the fields to keep from the mutation when merging.  Others keep the server's value.
+	MineFields []string
+}
+
+// ConflictResolver decides what to do about a conflict.  It may block while the user chooses.
+type ConflictResolver func(conflict *Conflict) ConflictResolution
+
+// Outcome is what happened to a mutation when it was replayed.
+type Outcome int
+
+const (
+	// OutcomeApplied means AniList accepted the mutation.
+	OutcomeApplied Outcome = iota
+	// OutcomeDiscarded means the user kept the server's version over the mutation.
+	OutcomeDiscarded
+	// OutcomeFailed means AniList rejected the mutation, and it was dropped so it doesn't block the queue.
+	OutcomeFailed
+)
+
+// ReplayResult describes a mutation leaving the queue.
+type ReplayResult struct {
+	Mutation *Mutation
+	Outcome  Outcome
+	// Entry is the entry as it now is on AniList, or nil if it no longer exists or is unknown.
+	Entry *anilist.MediaListEntry
+	Err   error
+}
+
+// Queue persists list mutations and replays them against AniList in order.  Edits are never lost while AniList
+// is unreachable, and are checked for conflicts with changes made elsewhere before being applied.
+type Queue struct {
+	mutex     sync.Mutex
+	path      string
+	mutations []*Mutation
+	inFlight  string
+	// Set when the media of the mutation in flight is edited again, so a conflict found for it isn't set aside.
+	inFlightEdited bool
+
+	client   *anilist.Client
+	resolver ConflictResolver
+
+	listeners map[int]func(pending int)
+	nextID    int
+	onResult  func(ReplayResult)
+
+	replayMutex sync.Mutex
+	kick        chan struct{}
+}
+
+// OpenQueue loads the queue saved at path.  An empty path keeps the queue in memory only.
+func OpenQueue(path string, client *anilist.Client) (*Queue, error) {
+	q := &Queue{
+		path:      path,
+		client:    client,
+		listeners: map[int]func(int){},
+		kick:      make(chan struct{}, 1),
+	}
+	if path == "" {
+		return q, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return q, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &q.mutations); err != nil {
+		return nil, fmt.Errorf("failed to decode mutation queue %s: %w", path, err)
+	}
+	logrus.Infof("Loaded %d pending mutations", len(q.mutations))
+	return q, nil
+}
+
+// SetConflictResolver sets the function asked to resolve conflicts.  Without one, conflicts are left for later.
+func (q *Queue) SetConflictResolver(resolver ConflictResolver) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.resolver = resolver
+}
+
+// OnResult sets the function called as each mutation leaves the queue.
+func (q *Queue) OnResult(fn func(ReplayResult)) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.onResult = fn
+}
+
+// Subscribe registers a function called with the number of pending mutations whenever it changes.  The returned
+// function unsubscribes.
+func (q *Queue) Subscribe(fn func(pending int)) func() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	id := q.nextID
+	q.nextID++
+	q.listeners[id] = fn
+	return func() {
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+		delete(q.listeners, id)
+	}
+}
+
+// Pending returns a copy of the queued mutations, oldest first.
+func (q *Queue) Pending() []*Mutation {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	pending := make([]*Mutation, len(q.mutations))
+	for i, m := range q.mutations {
+		copied := *m
+		pending[i] = &copied
+	}
+	return pending
+}
+
+// Enqueue adds a mutation to the end of the queue and saves it.  A change to an entry that already has a pending
+// save, which isn't currently being sent, is folded into that save instead.
+func (q *Queue) Enqueue(m *Mutation) error {
+	if m.ID == "" {
+		m.ID = newMutationID()
+	}
+	if m.QueuedAt.IsZero() {
+		m.QueuedAt = time.Now()
+	}
+
+	q.mutex.Lock()
+	q.coalesce(m)
+	for _, pending := range q.mutations {
+		if pending.MediaID == m.MediaID {
+			// The user changed the entry again, so a conflict set aside for it is worth asking about again.
+			pending.Deferred = false
+			if pending.ID == q.inFlight {
+				q.inFlightEdited = true
+			}
+		}
+	}
+	err := q.save()
+	q.mutex.Unlock()
+
+	q.notify()
+	q.Kick()
+	return err
+}
+
+// coalesce adds m to the queue, merging it with a pending save for the same media.  Must be called with the
+// mutex held.
+func (q *Queue) coalesce(m *Mutation) {
+	for i := len(q.mutations) - 1; i >= 0; i-- {
+		pending := q.mutations[i]
+		if pending.MediaID != m.MediaID || pending.Kind != MutationSave || pending.ID == q.inFlight || pending.DryRun != m.DryRun {
+			continue
+		}
+		switch m.Kind {
+		case MutationSave:
+			pending.Input = pending.Input.Merge(m.Input)
+			return
+		case MutationDelete:
+			if pending.EntryID == 0 {
+				// The entry was never created on AniList, so there is nothing to delete.
+				q.mutations = append(q.mutations[:i], q.mutations[i+1:]...)
+				return
+			}
+			m.BaseUpdatedAt = pending.BaseUpdatedAt
+			q.mutations[i] = m
+			return
+		}
+	}
+	q.mutations = append(q.mutations, m)
+}
+
+// Resume asks about a mutation's conflict again on the next replay, after it was set aside to resolve later.
+func (q *Queue) Resume(id string) {
+	q.mutex.Lock()
+	for _, m := range q.mutations {
+		if m.ID == id {
+			m.Deferred = false
+		}
+	}
+	if err := q.save(); err != nil {
+		logrus.Errorf("Error saving mutation queue: %v", err)
+	}
+	q.mutex.Unlock()
+	q.Kick()
+}
+
+// DiscardDryRun drops the mutations made in dry run mode that haven't been simulated yet.  Call it when dry run is
+// turned off.
+func (q *Queue) DiscardDryRun() {
+	q.mutex.Lock()
+	kept := q.mutations[:0]
+	for _, m := range q.mutations {
+		if !m.DryRun || m.ID == q.inFlight {
+			kept = append(kept, m)
+		}
+	}
+	q.mutations = kept
+	q.mutex.Unlock()
+	q.notify()
+}
+
+// Kick asks a running queue to replay now, rather than at the next retry.
+func (q *Queue) Kick() {
+	select {
+	case q.kick <- struct{}{}:
+	default:
+	}
+}
+
+// Run replays the queue whenever a mutation is added, and periodically while mutations are pending, until ctx
+// is done.
+func (q *Queue) Run(ctx context.Context) {
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.kick:
+		case <-ticker.C:
+		}
+		if len(q.Pending()) == 0 {
+			continue
+		}
+		if err := q.Replay(ctx); err != nil {
+			logrus.Infof("Pending mutations not sent yet: %v", err)
+		}
+	}
+}
+
+// Replay sends pending mutations to AniList in order.  It stops at the first mutation that can't be sent yet,
+// such as when offline, and returns why.  Mutations whose conflict was left to resolve later are set aside rather
+// than holding up the rest.  Nothing is sent in read-only mode, so mutations queued before it was turned on wait
+// until it is turned off.  Mutations are replayed in the mode they were made in: those made in dry run mode are
+// only simulated, and others wait while dry run is on.
+func (q *Queue) Replay(ctx context.Context) error {
+	q.replayMutex.Lock()
+	defer q.replayMutex.Unlock()
+
+	if q.client.MutationMode() == anilist.MutationsReadOnly {
+		return anilist.ErrReadOnly
+	}
+
+	for {
+		q.mutex.Lock()
+		m := q.next(q.client.MutationMode() == anilist.MutationsEnabled)
+		if m == nil {
+			q.mutex.Unlock()
+			return nil
+		}
+		q.inFlight = m.ID
+		q.inFlightEdited = false
+		q.mutex.Unlock()
+
+		result, err := q.apply(ctx, m)
+
+		q.mutex.Lock()
+		q.inFlight = ""
+		q.mutex.Unlock()
+
+		if err != nil {
+			if errors.Is(err, ErrResolveLater) {
+				q.setAside(m)
+				continue
+			}
+			if isRetryable(ctx, err) {
+				return err
+			}
+			logrus.Errorf("AniList rejected mutation to media %d, dropping it: %v", m.MediaID, err)
+			result = ReplayResult{Mutation: m, Outcome: OutcomeFailed, Err: err}
+		}
+		q.complete(result)
+	}
+}
+
+// next returns the first mutation that can be sent, skipping those set aside and the later mutations to the same
+// media, which have to wait for them.  Unless send is set, only mutations made in dry run mode are returned.  Must
+// be called with the mutex held.
+func (q *Queue) next(send bool) *Mutation {
+	waiting := map[int]bool{}
+	for _, m := range q.mutations {
+		if !send && !m.DryRun {
+			continue
+		}
+		if m.Deferred || waiting[m.MediaID] {
+			waiting[m.MediaID] = true
+			continue
+		}
+		return m
+	}
+	return nil
+}
+
+// setAside marks a mutation as waiting for the user to resolve its conflict, unless its entry was edited while
+// the conflict was being resolved, in which case it is asked about again straight away.
+func (q *Queue) setAside(m *Mutation) {
+	q.mutex.Lock()
+	if q.inFlightEdited {
+		q.mutex.Unlock()
+		return
+	}
+	logrus.Infof("Setting aside the change to media %d until its conflict is resolved", m.MediaID)
+	m.Deferred = true
+	if err := q.save(); err != nil {
+		logrus.Errorf("Error saving mutation queue: %v", err)
+	}
+	q.mutex.Unlock()
+}
+
+// apply checks a mutation for conflicts and sends it.
+func (q *Queue) apply(ctx context.Context, m *Mutation) (ReplayResult, error) {
+	if m.DryRun {
+		ctx = anilist.WithDryRun(ctx)
+	}
+	if m.EntryID != 0 {
+		server, err := q.client.MediaListEntry(ctx, m.EntryID)
+		if err != nil && !anilist.IsNotFound(err) {
+			return ReplayResult{}, err
+		}
+		ctx = anilist.WithPreviousEntry(ctx, server)
+		if server == nil && m.Kind == MutationDelete {
+			logrus.Debugf("Entry %d was already deleted", m.EntryID)
+			return ReplayResult{Mutation: m, Outcome: OutcomeApplied}, nil
+		}
+
+		if server == nil || server.UpdatedAt != m.BaseUpdatedAt {
+			resolved, discard, err := q.resolveConflict(&Conflict{Mutation: m, Server: server})
+			if err != nil {
+				return ReplayResult{}, err
+			}
+			if discard {
+				return ReplayResult{Mutation: m, Outcome: OutcomeDiscarded, Entry: server}, nil
+			}
+			m = resolved
+		}
+	}
+
+	switch m.Kind {
+	case MutationDelete:
+		if err := q.client.DeleteMediaListEntry(ctx, m.EntryID); err != nil {
+			return ReplayResult{}, err
+		}
+		return ReplayResult{Mutation: m, Outcome: OutcomeApplied}, nil
+	default:
+		input := m.Input
+		if m.EntryID != 0 {
+			input.ID = &m.EntryID
+		} else {
+			input.ID = nil
+			input.MediaID = &m.MediaID
+		}
+		entry, err := q.client.SaveMediaListEntry(ctx, input)
+		if err != nil {
+			return ReplayResult{}, err
+		}
+		return ReplayResult{Mutation: m, Outcome: OutcomeApplied, Entry: entry}, nil
+	}
+}
+
+// resolveConflict asks the resolver what to do about a conflict.  It returns the mutation to send, or discard if
+// the server's version should be kept.
+func (q *Queue) resolveConflict(conflict *Conflict) (*Mutation, bool, error) {
+	q.mutex.Lock()
+	resolver := q.resolver
+	q.mutex.Unlock()
+
+	m := conflict.Mutation
+	logrus.Infof("Entry %d for media %d was changed elsewhere since it was edited", m.EntryID, m.MediaID)
+	if resolver == nil {
+		return nil, false, ErrResolveLater
+	}
+
+	resolution := resolver(conflict)
+	resolved := *m
+	if conflict.Server == nil {
+		// The entry was deleted elsewhere, so keeping our change means creating it again.
+		resolved.EntryID = 0
+	}
+
+	switch resolution.Resolution {
+	case KeepMine:
+		return &resolved, false, nil
+	case KeepTheirs:
+		return nil, true, nil
+	case MergeFields:
+		if m.Kind == MutationDelete {
+			// A delete has no fields to merge, so merging keeps the entry.
+			return nil, true, nil
+		}
+		keep := map[string]bool{}
+		for _, field := range resolution.MineFields {
+			keep[field] = true
+		}
+		var drop []string
+		for _, diff := range conflict.Diffs() {
+			if !keep[diff.Field] {
+				drop = append(drop, diff.Field)
+			}
+		}
+		resolved.Input = m.Input.Without(drop...)
+		return &resolved, false, nil
+	default:
+		return nil, false, ErrResolveLater
+	}
+}
+
+// complete removes a replayed mutation from the queue, and rebases later mutations to the same media on the
+// entry AniList returned, so they don't conflict with our own change.
+func (q *Queue) complete(result ReplayResult) {
+	q.mutex.Lock()
+	for i, m := range q.mutations {
+		if m.ID == result.Mutation.ID {
+			q.mutations = append(q.mutations[:i], q.mutations[i+1:]...)
+			break
+		}
+	}
+	if result.Entry != nil {
+		for _, m := range q.mutations {
+			if m.MediaID == result.Mutation.MediaID && m.DryRun == result.Mutation.DryRun {
+				m.EntryID = result.Entry.ID
+				m.BaseUpdatedAt = result.Entry.UpdatedAt
+			}
+		}
+	}
+	if err := q.save(); err != nil {
+		logrus.Errorf("Error saving mutation queue: %v", err)
+	}
+	onResult := q.onResult
+	q.mutex.Unlock()
+
+	if onResult != nil {
+		onResult(result)
+	}
+	q.notify()
+}
+
+// save writes the queue to disk.  Must be called with the mutex held.
+func (q *Queue) save() error {
+	if q.path == "" {
+		return nil
+	}
+	saved := make([]*Mutation, 0, len(q.mutations))
+	for _, m := range q.mutations {
+		if !m.DryRun {
+			saved = append(saved, m)
+		}
+	}
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	return store.WriteFileAtomic(q.path, data)
+}
+
+func (q *Queue) notify() {
+	q.mutex.Lock()
+	pending := len(q.mutations)
+	listeners := make([]func(int), 0, len(q.listeners))
+	for _, fn := range q.listeners {
+		listeners = append(listeners, fn)
+	}
+	q.mutex.Unlock()
+
+	for _, fn := range listeners {
+		fn(pending)
+	}
+}
+
+// isRetryable reports whether a mutation that failed with err should stay queued to be retried later.
+func isRetryable(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || anilist.IsTemporary(err)
+}
+
+func newMutationID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
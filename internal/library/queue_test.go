@@ -0,0 +1,482 @@
+package library
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/StarTerrarium/hisame/internal/anilist"
+)
+
+// fakeLists is a fake AniList API holding list entries, keyed by entry ID.
+type fakeLists struct {
+	mutex   sync.Mutex
+	entries map[int]*anilist.MediaListEntry
+	nextID  int
+	clock   int64
+	saves   []map[string]interface{}
+	// unavailable makes every request fail as if AniList was down.
+	unavailable bool
+}
+
+func newFakeLists(t *testing.T) (*fakeLists, *anilist.Client, *httptest.Server) {
+	t.Helper()
+	f := &fakeLists{entries: map[int]*anilist.MediaListEntry{}, nextID: 100, clock: 1000}
+	ts := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(ts.Close)
+	return f, anilist.NewClientWithEndpoint(ts.URL, "token"), ts
+}
+
+func (f *fakeLists) serve(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.unavailable {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	var data interface{}
+	switch {
+	case strings.Contains(body.Query, "SaveMediaListEntry("):
+		f.saves = append(f.saves, body.Variables)
+		var entry *anilist.MediaListEntry
+		if id, ok := body.Variables["id"].(float64); ok {
+			entry = f.entries[int(id)]
+		} else {
+			entry = &anilist.MediaListEntry{ID: f.nextID, MediaID: int(body.Variables["mediaId"].(float64)), Status: anilist.StatusPlanning}
+			f.nextID++
+			f.entries[entry.ID] = entry
+		}
+		encoded, _ := json.Marshal(body.Variables)
+		var input anilist.SaveMediaListEntryInput
+		json.Unmarshal(encoded, &input)
+		input.ApplyTo(entry)
+		f.clock++
+		entry.UpdatedAt = f.clock
+		data = map[string]interface{}{"SaveMediaListEntry": entry}
+	case strings.Contains(body.Query, "DeleteMediaListEntry("):
+		id := int(body.Variables["id"].(float64))
+		_, exists := f.entries[id]
+		delete(f.entries, id)
+		data = map[string]interface{}{"DeleteMediaListEntry": map[string]bool{"deleted": exists}}
+	case strings.Contains(body.Query, "MediaList("):
+		data = map[string]interface{}{"MediaList": f.entries[int(body.Variables["id"].(float64))]}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+// add puts an entry on the fake list as if it was edited elsewhere.
+func (f *fakeLists) add(entry anilist.MediaListEntry) *anilist.MediaListEntry {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.clock++
+	entry.UpdatedAt = f.clock
+	f.entries[entry.ID] = &entry
+	copied := entry
+	return &copied
+}
+
+func (f *fakeLists) get(id int) *anilist.MediaListEntry {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.entries[id]
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func float64Ptr(f float64) *float64 {
+	return &f
+}
+
+func TestQueue_ReplaysInOrder(t *testing.T) {
+	f, client, _ := newFakeLists(t)
+	entry := f.add(anilist.MediaListEntry{ID: 1, MediaID: 10, Status: anilist.StatusCurrent, Progress: 1})
+
+	q, _ := OpenQueue("", client)
+	q.Enqueue(&Mutation{Kind: MutationSave, EntryID: 1, MediaID: 10, BaseUpdatedAt: entry.UpdatedAt,
+		Input: anilist.SaveMediaListEntryInput{Progress: intPtr(2)}})
+	q.Enqueue(&Mutation{Kind: MutationSave, MediaID: 20,
+		Input: anilist.SaveMediaListEntryInput{Progress: intPtr(7)}})
+
+	if err := q.Replay(context.Background()); err != nil {
+		t.Fatalf("Expected replay to succeed, got %v", err)
+	}
+	if len(q.Pending()) != 0 {
+		t.Errorf("Expected empty queue, got %d pending", len(q.Pending()))
+	}
+	if len(f.saves) != 2 || f.saves[0]["id"] != float64(1) || f.saves[1]["mediaId"] != float64(20) {
+		t.Errorf("Expected saves for entry 1 then media 20, got %v", f.saves)
+	}
+	if got := f.get(1).Progress; got != 2 {
+		t.Errorf("Expected progress 2, got %d", got)
+	}
+}
+
+func TestQueue_PersistsAcrossReopen(t *testing.T) {
+	_, client, ts := newFakeLists(t)
+	ts.Close()
+	path := filepath.Join(t.TempDir(), "queue.json")
+
+	q, err := OpenQueue(path, client)
+	if err != nil {
+		t.Fatalf("Failed to open queue: %v", err)
+	}
+	q.Enqueue(&Mutation{Kind: MutationSave, MediaID: 20, Input: anilist.SaveMediaListEntryInput{Progress: intPtr(3)}})
+	if err := q.Replay(context.Background()); !anilist.IsOffline(err) {
+		t.Fatalf("Expected offline error, got %v", err)
+	}
+
+	reopened, err := OpenQueue(path, client)
+	if err != nil {
+		t.Fatalf("Failed to reopen queue: %v", err)
+	}
+	pending := reopened.Pending()
+	if len(pending) != 1 || pending[0].MediaID != 20 || *pending[0].Input.Progress != 3 {
+		t.Errorf("Expected the queued mutation to survive a reopen, got %+v", pending)
+	}
+}
+
+func TestQueue_Coalesces(t *testing.T) {
+	_, client, _ := newFakeLists(t)
+	q, _ := OpenQueue("", client)
+
+	q.Enqueue(&Mutation{Kind: MutationSave, EntryID: 1, MediaID: 10, Input: anilist.SaveMediaListEntryInput{Progress: intPtr(2)}})
+	q.Enqueue(&Mutation{Kind: MutationSave, EntryID: 1, MediaID: 10, Input: anilist.SaveMediaListEntryInput{Progress: intPtr(3), Notes: stringPtr("good")}})
+	pending := q.Pending()
+	if len(pending) != 1 || *pending[0].Input.Progress != 3 || *pending[0].Input.Notes != "good" {
+		t.Fatalf("Expected saves to be merged, got %+v", pending)
+	}
+
+	// Deleting an entry that was only ever created locally cancels out.
+	q.Enqueue(&Mutation{Kind: MutationSave, MediaID: 20, Input: anilist.SaveMediaListEntryInput{Progress: intPtr(1)}})
+	q.Enqueue(&Mutation{Kind: MutationDelete, MediaID: 20})
+	if got := len(q.Pending()); got != 1 {
+		t.Errorf("Expected 1 pending mutation, got %d", got)
+	}
+}
+
+func TestQueue_Conflicts(t *testing.T) {
+	tests := []struct {
+		name         string
+		resolution   ConflictResolution
+		wantProgress int
+		wantNotes    string
+		wantOutcome  Outcome
+	}{
+		{"keep mine", ConflictResolution{Resolution: KeepMine}, 5, "mine", OutcomeApplied},
+		{"keep theirs", ConflictResolution{Resolution: KeepTheirs}, 4, "theirs", OutcomeDiscarded},
+		{"merge", ConflictResolution{Resolution: MergeFields, MineFields: []string{"progress"}}, 5, "theirs", OutcomeApplied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, client, _ := newFakeLists(t)
+			base := f.add(anilist.MediaListEntry{ID: 1, MediaID: 10, Status: anilist.StatusCurrent, Progress: 1})
+			f.add(anilist.MediaListEntry{ID: 1, MediaID: 10, Status: anilist.StatusCurrent, Progress: 4, Notes: "theirs"})
+
+			q, _ := OpenQueue("", client)
+			var conflicts []*Conflict
+			q.SetConflictResolver(func(conflict *Conflict) ConflictResolution {
+				conflicts = append(conflicts, conflict)
+				return tt.resolution
+			})
+			var results []ReplayResult
+			q.OnResult(func(result ReplayResult) { results = append(results, result) })
+
+			q.Enqueue(&Mutation{Kind: MutationSave, EntryID: 1, MediaID: 10, BaseUpdatedAt: base.UpdatedAt,
+				Input: anilist.SaveMediaListEntryInput{Progress: intPtr(5), Notes: stringPtr("mine")}})
+			if err := q.Replay(context.Background()); err != nil {
+				t.Fatalf("Expected replay to succeed, got %v", err)
+			}
+
+			if len(conflicts) != 1 || len(conflicts[0].Diffs()) != 2 {
+				t.Fatalf("Expected one conflict with two differing fields, got %+v", conflicts)
+			}
+			if len(results) != 1 || results[0].Outcome != tt.wantOutcome {
+				t.Errorf("Expected outcome %d, got %+v", tt.wantOutcome, results)
+			}
+			server := f.get(1)
+			if server.Progress != tt.wantProgress || server.Notes != tt.wantNotes {
+				t.Errorf("Expected progress %d and notes %q, got %d and %q", tt.wantProgress, tt.wantNotes, server.Progress, server.Notes)
+			}
+		})
+	}
+}
+
+func TestQueue_ConflictWithoutResolverIsSetAside(t *testing.T) {
+	f, client, _ := newFakeLists(t)
+	f.add(anilist.MediaListEntry{ID: 1, MediaID: 10, Progress: 4})
+
+	q, _ := OpenQueue("", client)
+	q.Enqueue(&Mutation{Kind: MutationSave, EntryID: 1, MediaID: 10, BaseUpdatedAt: 1, Input: anilist.SaveMediaListEntryInput{Progress: intPtr(5)}})
+	if err := q.Replay(context.Background()); err != nil {
+		t.Fatalf("Expected replay to succeed, got %v", err)
+	}
+	if pending := q.Pending(); len(pending) != 1 || !pending[0].Deferred {
+		t.Errorf("Expected mutation to stay queued and be set aside, got %+v", pending)
+	}
+}
+
+func TestQueue_DeferredConflictDoesNotBlock(t *testing.T) {
+	f, client, _ := newFakeLists(t)
+	f.add(anilist.MediaListEntry{ID: 1, MediaID: 10, Progress: 4})
+
+	q, _ := OpenQueue("", client)
+	var asked int
+	q.SetConflictResolver(func(*Conflict) ConflictResolution {
+		asked++
+		return ConflictResolution{Resolution: ResolveLater}
+	})
+	q.Enqueue(&Mutation{Kind: MutationSave, EntryID: 1, MediaID: 10, BaseUpdatedAt: 1, Input: anilist.SaveMediaListEntryInput{Progress: intPtr(5)}})
+	q.Enqueue(&Mutation{Kind: MutationSave, MediaID: 20, Input: anilist.SaveMediaListEntryInput{Progress: intPtr(1)}})
+
+	for i := 0; i < 2; i++ {
+		if err := q.Replay(context.Background()); err != nil {
+			t.Fatalf("Expected replay to succeed, got %v", err)
+		}
+	}
+	if asked != 1 {
+		t.Errorf("Expected to be asked about the conflict once, got %d", asked)
+	}
+	if len(f.saves) != 1 || f.saves[0]["mediaId"] != float64(20) {
+		t.Errorf("Expected the later mutation to be sent, got saves %v", f.saves)
+	}
+	pending := q.Pending()
+	if len(pending) != 1 || pending[0].MediaID != 10 || !pending[0].Deferred {
+		t.Fatalf("Expected only the deferred mutation to stay queued, got %+v", pending)
+	}
+
+	q.Resume(pending[0].ID)
+	q.Replay(context.Background())
+	if asked != 2 {
+		t.Errorf("Expected to be asked again once resumed, got %d", asked)
+	}
+
+	q.Enqueue(&Mutation{Kind: MutationSave, EntryID: 1, MediaID: 10, BaseUpdatedAt: 1, Input: anilist.SaveMediaListEntryInput{Score: float64Ptr(8)}})
+	q.Replay(context.Background())
+	if asked != 3 {
+		t.Errorf("Expected to be asked again once the entry was edited, got %d", asked)
+	}
+}
+
+func TestQueue_DropsMutationsThatCantSucceed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`not json`))
+	}))
+	t.Cleanup(ts.Close)
+
+	q, _ := OpenQueue("", anilist.NewClientWithEndpoint(ts.URL, "token"))
+	var results []ReplayResult
+	q.OnResult(func(result ReplayResult) { results = append(results, result) })
+	q.Enqueue(&Mutation{Kind: MutationSave, MediaID: 20, Input: anilist.SaveMediaListEntryInput{Progress: intPtr(1)}})
+	if err := q.Replay(context.Background()); err != nil {
+		t.Fatalf("Expected replay to finish, got %v", err)
+	}
+	if len(results) != 1 || results[0].Outcome != OutcomeFailed {
+		t.Errorf("Expected the mutation to be recorded as failed, got %+v", results)
+	}
+	if got := len(q.Pending()); got != 0 {
+		t.Errorf("Expected nothing left queued, got %d pending", got)
+	}
+}
+
+func TestQueue_NotifiesPendingCount(t *testing.T) {
+	_, client, _ := newFakeLists(t)
+	q, _ := OpenQueue("", client)
+
+	var counts []int
+	unsubscribe := q.Subscribe(func(pending int) { counts = append(counts, pending) })
+	q.Enqueue(&Mutation{Kind: MutationSave, MediaID: 20, Input: anilist.SaveMediaListEntryInput{Progress: intPtr(1)}})
+	q.Replay(context.Background())
+	unsubscribe()
+	q.Enqueue(&Mutation{Kind: MutationSave, MediaID: 30, Input: anilist.SaveMediaListEntryInput{Progress: intPtr(1)}})
+
+	if len(counts) != 2 || counts[0] != 1 || counts[1] != 0 {
+		t.Errorf("Expected counts [1 0], got %v", counts)
+	}
+}
+
+func TestLibrary_SaveEntryUpdatesCacheAndReplays(t *testing.T) {
+	f, client, _ := newFakeLists(t)
+	entry := f.add(anilist.MediaListEntry{ID: 1, MediaID: 10, Status: anilist.StatusCurrent, Progress: 5})
+	s := newStore(t)
+	s.SaveListCollection(anilist.MediaTypeAnime, &anilist.MediaListCollection{Lists: []*anilist.MediaListGroup{
+		{Name: "Watching", Status: anilist.StatusCurrent, Entries: []*anilist.MediaListEntry{entry}},
+	}})
+
+	lib := New(s, client, 1)
+	completed := anilist.StatusCompleted
+	if err := lib.SaveEntry(anilist.MediaTypeAnime, entry, 10, anilist.SaveMediaListEntryInput{Status: &completed}); err != nil {
+		t.Fatalf("Expected save to succeed, got %v", err)
+	}
+
+	collection := lib.CachedListCollection(anilist.MediaTypeAnime)
+	if len(collection.Lists) != 2 || len(collection.Lists[0].Entries) != 0 || collection.Lists[1].Name != "Completed" {
+		t.Fatalf("Expected entry to move to a new Completed list, got %+v", collection.Lists)
+	}
+
+	if err := lib.Queue().Replay(context.Background()); err != nil {
+		t.Fatalf("Expected replay to succeed, got %v", err)
+	}
+	collection = lib.CachedListCollection(anilist.MediaTypeAnime)
+	cached := collection.Lists[1].Entries[0]
+	if cached.Status != anilist.StatusCompleted || cached.UpdatedAt != f.get(1).UpdatedAt {
+		t.Errorf("Expected cache to hold the entry saved on AniList, got %+v", cached)
+	}
+}
+
+func TestQueue_MutationModes(t *testing.T) {
+	f, client, _ := newFakeLists(t)
+	entry := f.add(anilist.MediaListEntry{ID: 1, MediaID: 10, Status: anilist.StatusCurrent, Progress: 1})
+	q, _ := OpenQueue("", client)
+	q.Enqueue(&Mutation{Kind: MutationSave, EntryID: 1, MediaID: 10, BaseUpdatedAt: entry.UpdatedAt,
+		Input: anilist.SaveMediaListEntryInput{Progress: intPtr(2)}})
+
+	client.SetMutationMode(anilist.MutationsReadOnly)
+	if err := q.Replay(context.Background()); !errors.Is(err, anilist.ErrReadOnly) {
+		t.Fatalf("Expected read-only error, got %v", err)
+	}
+	if len(q.Pending()) != 1 {
+		t.Fatalf("Expected the mutation to stay queued while read-only, got %d pending", len(q.Pending()))
+	}
+
+	client.SetMutationMode(anilist.MutationsDryRun)
+	q.Enqueue(&Mutation{Kind: MutationSave, EntryID: 1, MediaID: 10, BaseUpdatedAt: entry.UpdatedAt, DryRun: true,
+		Input: anilist.SaveMediaListEntryInput{Progress: intPtr(3)}})
+	var results []ReplayResult
+	q.OnResult(func(result ReplayResult) { results = append(results, result) })
+	if err := q.Replay(context.Background()); err != nil {
+		t.Fatalf("Expected dry run replay to succeed, got %v", err)
+	}
+	if len(f.saves) != 0 || f.get(1).Progress != 1 {
+		t.Errorf("Expected nothing to be sent in dry run, got saves %v", f.saves)
+	}
+	if len(results) != 1 || results[0].Entry == nil || results[0].Entry.Progress != 3 || results[0].Entry.UpdatedAt != entry.UpdatedAt {
+		t.Errorf("Expected the simulated entry as the result, got %+v", results)
+	}
+	if pending := q.Pending(); len(pending) != 1 || pending[0].DryRun {
+		t.Fatalf("Expected the edit made before dry run to wait, got %+v", pending)
+	}
+
+	client.SetMutationMode(anilist.MutationsEnabled)
+	if err := q.Replay(context.Background()); err != nil {
+		t.Fatalf("Expected replay to succeed, got %v", err)
+	}
+	if len(f.saves) != 1 || f.get(1).Progress != 2 {
+		t.Errorf("Expected the edit made before dry run to be sent, got saves %v", f.saves)
+	}
+}
+
+func TestQueue_DryRunEditsAreNeverSent(t *testing.T) {
+	f, client, _ := newFakeLists(t)
+	entry := f.add(anilist.MediaListEntry{ID: 1, MediaID: 10, Status: anilist.StatusCurrent, Progress: 1})
+	path := filepath.Join(t.TempDir(), "queue.json")
+	q, _ := OpenQueue(path, client)
+
+	f.mutex.Lock()
+	f.unavailable = true
+	f.mutex.Unlock()
+	client.SetMutationMode(anilist.MutationsDryRun)
+	q.Enqueue(&Mutation{Kind: MutationSave, EntryID: 1, MediaID: 10, BaseUpdatedAt: entry.UpdatedAt, DryRun: true,
+		Input: anilist.SaveMediaListEntryInput{Progress: intPtr(2)}})
+	if err := q.Replay(context.Background()); !anilist.IsOffline(err) {
+		t.Fatalf("Expected offline error, got %v", err)
+	}
+
+	reopened, err := OpenQueue(path, client)
+	if err != nil {
+		t.Fatalf("Failed to reopen queue: %v", err)
+	}
+	if pending := reopened.Pending(); len(pending) != 0 {
+		t.Errorf("Expected dry run edits not to be saved, got %+v", pending)
+	}
+
+	f.mutex.Lock()
+	f.unavailable = false
+	f.mutex.Unlock()
+	client.SetMutationMode(anilist.MutationsEnabled)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+	q.Kick()
+	for deadline := time.Now().Add(5 * time.Second); len(q.Pending()) != 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if len(f.saves) != 0 || f.entries[1].Progress != 1 {
+		t.Errorf("Expected the dry run edit not to be sent, got saves %v", f.saves)
+	}
+	if len(q.Pending()) != 0 {
+		t.Errorf("Expected the dry run edit to be simulated, got %d pending", len(q.Pending()))
+	}
+}
+
+func TestLibrary_DryRunLeavesStoreUnchanged(t *testing.T) {
+	f, client, _ := newFakeLists(t)
+	entry := f.add(anilist.MediaListEntry{ID: 1, MediaID: 10, Status: anilist.StatusCurrent, Progress: 5})
+	s := newStore(t)
+	s.SaveListCollection(anilist.MediaTypeAnime, &anilist.MediaListCollection{Lists: []*anilist.MediaListGroup{
+		{Name: "Watching", Status: anilist.StatusCurrent, Entries: []*anilist.MediaListEntry{entry}},
+	}})
+	client.SetMutationMode(anilist.MutationsDryRun)
+	lib := New(s, client, 1)
+
+	if err := lib.SaveEntry(anilist.MediaTypeAnime, entry, 10, anilist.SaveMediaListEntryInput{Progress: intPtr(6)}); err != nil {
+		t.Fatalf("Expected save to succeed, got %v", err)
+	}
+	if err := lib.Queue().Replay(context.Background()); err != nil {
+		t.Fatalf("Expected dry run replay to succeed, got %v", err)
+	}
+
+	if cached := findEntry(lib.CachedListCollection(anilist.MediaTypeAnime), 10); cached == nil || cached.Progress != 6 {
+		t.Errorf("Expected the cached lists to show the dry run change, got %+v", cached)
+	}
+	stored, _, err := s.LoadListCollection(anilist.MediaTypeAnime)
+	if err != nil {
+		t.Fatalf("Expected the lists to stay stored, got %v", err)
+	}
+	if stored := findEntry(stored, 10); stored == nil || stored.Progress != 5 {
+		t.Errorf("Expected the stored lists to be unchanged, got %+v", stored)
+	}
+
+	lib.DiscardDryRunEdits()
+	if cached := findEntry(lib.CachedListCollection(anilist.MediaTypeAnime), 10); cached == nil || cached.Progress != 5 {
+		t.Errorf("Expected the dry run change to be discarded, got %+v", cached)
+	}
+}
+
+func TestLibrary_SaveEntryRefusedWhenReadOnly(t *testing.T) {
+	_, client, _ := newFakeLists(t)
+	client.SetMutationMode(anilist.MutationsReadOnly)
+	lib := New(newStore(t), client, 1)
+
+	err := lib.SaveEntry(anilist.MediaTypeAnime, nil, 10, anilist.SaveMediaListEntryInput{Progress: intPtr(1)})
+	if !errors.Is(err, anilist.ErrReadOnly) {
+		t.Fatalf("Expected read-only error, got %v", err)
+	}
+	if len(lib.Queue().Pending()) != 0 {
+		t.Errorf("Expected nothing to be queued, got %d pending", len(lib.Queue().Pending()))
+	}
+}
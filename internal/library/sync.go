@@ -0,0 +1,296 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+const (
+	// syncPageSize is the number of recently updated entries fetched per request.
+	syncPageSize = 50
+	// maxIncrementalPages bounds an incremental sync.  When more than this many entries changed, refetching the
+	// whole collection takes fewer requests.
+	maxIncrementalPages = 10
+	// focusSyncGap stops refocusing the window from syncing again straight after a sync.
+	focusSyncGap = time.Minute
+)
+
+// syncedMediaTypes are the media types kept in sync in the background, once their lists have been loaded.
+var syncedMediaTypes = []anilist.MediaType{anilist.MediaTypeAnime, anilist.MediaTypeManga}
+
+// SyncStatus describes the background sync, for display in the status bar.
+type SyncStatus struct {
+	// Syncing is true while a sync is running.
+	Syncing bool
+	// Fetched is the number of changed entries fetched so far by the running sync.
+	Fetched int
+	// LastSynced is when the lists were last brought up to date with AniList.
+	LastSynced time.Time
+	// Err is why the last sync failed, or nil if it succeeded.
+	Err error
+}
+
+// Syncer keeps the cached lists up to date with AniList.  Rather than refetching the whole collection, it fetches
+// the entries updated since the last sync and merges them into the cache.
+type Syncer struct {
+	lib      *Library
+	interval time.Duration
+
+	// Serialises syncs, so a page load and a periodic sync don't fetch the same changes twice.
+	syncMutex sync.Mutex
+
+	mutex     sync.Mutex
+	status    SyncStatus
+	listeners map[int]func(SyncStatus)
+	nextID    int
+	trigger   chan struct{}
+}
+
+func newSyncer(lib *Library) *Syncer {
+	s := &Syncer{lib: lib, listeners: map[int]func(SyncStatus){}, trigger: make(chan struct{}, 1)}
+	if lib.store != nil {
+		for _, mediaType := range syncedMediaTypes {
+			if _, syncedAt, err := lib.store.LoadSyncCursor(mediaType); err == nil && syncedAt.After(s.status.LastSynced) {
+				s.status.LastSynced = syncedAt
+			}
+		}
+	}
+	return s
+}
+
+// SetInterval sets how often the lists are synced in the background.  Zero disables periodic syncing, leaving
+// syncs on page load and window focus.  Must be called before the library is started.
+func (s *Syncer) SetInterval(interval time.Duration) {
+	s.interval = interval
+}
+
+// Status returns the current sync status.
+func (s *Syncer) Status() SyncStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.status
+}
+
+// Subscribe registers a function called whenever the sync status changes.  The returned function unsubscribes.
+func (s *Syncer) Subscribe(fn func(SyncStatus)) func() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	id := s.nextID
+	s.nextID++
+	s.listeners[id] = fn
+	return func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		delete(s.listeners, id)
+	}
+}
+
+// SyncNow asks a running syncer to sync straight away.
+func (s *Syncer) SyncNow() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// SyncOnFocus syncs when the window regains focus, unless a sync finished very recently.
+func (s *Syncer) SyncOnFocus() {
+	if time.Since(s.Status().LastSynced) < focusSyncGap {
+		return
+	}
+	s.SyncNow()
+}
+
+// Run syncs periodically, and whenever SyncNow is called, until ctx is done.
+func (s *Syncer) Run(ctx context.Context) {
+	var tick <-chan time.Time
+	if s.interval > 0 {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.trigger:
+		case <-tick:
+		}
+		s.syncAll(ctx)
+	}
+}
+
+// syncAll syncs every media type whose lists have been loaded before.  Lists that were never opened aren't
+// fetched in the background.
+func (s *Syncer) syncAll(ctx context.Context) {
+	for _, mediaType := range syncedMediaTypes {
+		if s.lib.CachedListCollection(mediaType) == nil {
+			continue
+		}
+		if _, err := s.Sync(ctx, mediaType); err != nil {
+			return
+		}
+		s.lib.notifyLists(mediaType)
+	}
+}
+
+// Sync brings the cached lists of one media type up to date, returning the merged collection.  The first sync
+// fetches the whole collection; later ones only fetch what changed.
+func (s *Syncer) Sync(ctx context.Context, mediaType anilist.MediaType) (*anilist.MediaListCollection, error) {
+	s.syncMutex.Lock()
+	defer s.syncMutex.Unlock()
+
+	s.update(func(status *SyncStatus) {
+		status.Syncing = true
+		status.Fetched = 0
+	})
+	collection, err := s.lib.sync(ctx, mediaType, func(fetched int) {
+		s.update(func(status *SyncStatus) { status.Fetched = fetched })
+	})
+	s.update(func(status *SyncStatus) {
+		status.Syncing = false
+		// A sync cancelled because its page was left didn't fail, so the last result stands.
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+		status.Err = err
+		if err == nil {
+			status.LastSynced = time.Now()
+		}
+	})
+	return collection, err
+}
+
+func (s *Syncer) update(change func(status *SyncStatus)) {
+	s.mutex.Lock()
+	change(&s.status)
+	status := s.status
+	listeners := make([]func(SyncStatus), 0, len(s.listeners))
+	for _, fn := range s.listeners {
+		listeners = append(listeners, fn)
+	}
+	s.mutex.Unlock()
+
+	for _, fn := range listeners {
+		fn(status)
+	}
+}
+
+// sync merges the entries updated since the last sync into the cached lists, and drops entries deleted elsewhere.
+// It falls back to fetching the whole collection when there is nothing cached, or too much has changed.
+func (l *Library) sync(ctx context.Context, mediaType anilist.MediaType, onProgress func(fetched int)) (*anilist.MediaListCollection, error) {
+	if l.store == nil || l.CachedListCollection(mediaType) == nil {
+		return l.RefreshListCollection(ctx, mediaType)
+	}
+	cursor, _, err := l.store.LoadSyncCursor(mediaType)
+	if err != nil || cursor == 0 {
+		return l.RefreshListCollection(ctx, mediaType)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	var changed []*anilist.MediaListEntry
+	newCursor := cursor
+	for page := 1; ; page++ {
+		if page > maxIncrementalPages {
+			logrus.Infof("Over %d %s entries changed since the last sync, fetching the whole collection", len(changed), mediaType)
+			return l.RefreshListCollection(ctx, mediaType)
+		}
+		entries, hasNextPage, err := l.client.UpdatedMediaListEntries(ctx, l.userID, mediaType, page, syncPageSize)
+		if err != nil {
+			logrus.Warnf("Error fetching updated %s entries: %v", mediaType, err)
+			return nil, err
+		}
+		reachedCursor := false
+		for _, entry := range entries {
+			// Entries updated in the same second as the cursor may not have been seen, so they are fetched again.
+			if entry.UpdatedAt < cursor {
+				reachedCursor = true
+				break
+			}
+			changed = append(changed, entry)
+			if entry.UpdatedAt > newCursor {
+				newCursor = entry.UpdatedAt
+			}
+		}
+		if onProgress != nil {
+			onProgress(len(changed))
+		}
+		if reachedCursor || !hasNextPage {
+			break
+		}
+	}
+
+	onList, err := l.client.MediaListIDs(ctx, l.userID, mediaType)
+	if err != nil {
+		logrus.Warnf("Error fetching %s list IDs: %v", mediaType, err)
+		return nil, err
+	}
+
+	l.listMutex.Lock()
+	defer l.listMutex.Unlock()
+	collection, _ := l.storedListCollection(mediaType)
+	if collection == nil {
+		collection = &anilist.MediaListCollection{}
+	}
+
+	for _, entry := range changed {
+		l.setEntry(collection, entry)
+	}
+
+	pending := l.queue.Pending()
+	created := map[int]bool{}
+	for _, m := range pending {
+		if m.MediaType == mediaType && m.Kind == MutationSave && m.EntryID == 0 && !m.DryRun {
+			created[m.MediaID] = true
+		}
+	}
+	deleted := 0
+	for _, entry := range collection.Entries() {
+		// Entries added while offline aren't on AniList yet, so their absence doesn't mean they were deleted.
+		if !onList[entry.MediaID] && !created[entry.MediaID] {
+			removeEntry(collection, entry.MediaID)
+			deleted++
+		}
+	}
+	// Dry run changes are shown from memory, so only real edits go into the stored lists.
+	for _, m := range pending {
+		if m.MediaType == mediaType && !m.DryRun {
+			l.applyMutation(collection, m)
+		}
+	}
+
+	logrus.Infof("Synced %s lists: %d entries updated, %d deleted elsewhere", mediaType, len(changed), deleted)
+	if err := l.store.SaveListCollection(mediaType, collection); err != nil {
+		logrus.Errorf("Error caching %s lists: %v", mediaType, err)
+	}
+	l.cacheMedia(changed)
+	l.saveSyncCursor(mediaType, newCursor)
+	return collection, nil
+}
+
+// saveSyncCursor records the sync cursor, logging rather than failing as the next sync will just fetch more.
+func (l *Library) saveSyncCursor(mediaType anilist.MediaType, cursor int64) {
+	if l.store == nil {
+		return
+	}
+	if err := l.store.SaveSyncCursor(mediaType, cursor); err != nil {
+		logrus.Errorf("Error saving %s sync cursor: %v", mediaType, err)
+	}
+}
+
+// latestUpdate returns the newest updatedAt of any entry in the collection.
+func latestUpdate(collection *anilist.MediaListCollection) int64 {
+	var latest int64
+	for _, entry := range collection.Entries() {
+		if entry.UpdatedAt > latest {
+			latest = entry.UpdatedAt
+		}
+	}
+	return latest
+}
@@ -0,0 +1,143 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/StarTerrarium/hisame/internal/anilist"
+)
+
+const updatedEntriesResponse = `{"data":{"Page":{"pageInfo":{"hasNextPage":true},"mediaList":[
+	{"id":3,"mediaId":30,"status":"PLANNING","updatedAt":300,"media":{"id":30,"title":{"english":"Thirty"}}},
+	{"id":1,"mediaId":10,"status":"COMPLETED","progress":12,"updatedAt":200},
+	{"id":4,"mediaId":40,"status":"CURRENT","updatedAt":50}
+]}}}`
+
+const listIDsResponse = `{"data":{"MediaListCollection":{"lists":[
+	{"entries":[{"id":1,"mediaId":10},{"id":3,"mediaId":30}]}
+]}}}`
+
+// newSyncAPI returns a client for a fake API serving incremental sync queries, and a count of full collection
+// fetches.
+func newSyncAPI(t *testing.T) (*anilist.Client, *int32) {
+	t.Helper()
+	var fullFetches int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body := string(data)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.Contains(body, "UPDATED_TIME_DESC"):
+			w.Write([]byte(updatedEntriesResponse))
+		case strings.Contains(body, "isCustomList"):
+			atomic.AddInt32(&fullFetches, 1)
+			w.Write([]byte(collectionResponse))
+		default:
+			w.Write([]byte(listIDsResponse))
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return anilist.NewClientWithEndpoint(ts.URL, "token"), &fullFetches
+}
+
+func TestSync_FirstSyncFetchesEverything(t *testing.T) {
+	client, fullFetches := newSyncAPI(t)
+	lib := New(newStore(t), client, 1)
+
+	if _, err := lib.Syncer().Sync(context.Background(), anilist.MediaTypeAnime); err != nil {
+		t.Fatalf("Expected sync to succeed, got %v", err)
+	}
+	if *fullFetches != 1 {
+		t.Errorf("Expected 1 full fetch, got %d", *fullFetches)
+	}
+	if status := lib.Syncer().Status(); status.Syncing || status.LastSynced.IsZero() || status.Err != nil {
+		t.Errorf("Expected a completed sync status, got %+v", status)
+	}
+}
+
+func TestSync_CancelledIsNotAFailure(t *testing.T) {
+	client, _ := newSyncAPI(t)
+	lib := New(newStore(t), client, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := lib.Syncer().Sync(ctx, anilist.MediaTypeAnime); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the sync to be cancelled, got %v", err)
+	}
+	if status := lib.Syncer().Status(); status.Syncing || status.Err != nil {
+		t.Errorf("Expected a cancelled sync not to be reported as failed, got %+v", status)
+	}
+}
+
+func TestSync_MergesChangesSinceCursor(t *testing.T) {
+	client, fullFetches := newSyncAPI(t)
+	s := newStore(t)
+	s.SaveListCollection(anilist.MediaTypeAnime, &anilist.MediaListCollection{Lists: []*anilist.MediaListGroup{
+		{Name: "Watching", Status: anilist.StatusCurrent, Entries: []*anilist.MediaListEntry{
+			{ID: 1, MediaID: 10, Status: anilist.StatusCurrent, Progress: 5, UpdatedAt: 90, Media: &anilist.Media{ID: 10}},
+			{ID: 2, MediaID: 20, Status: anilist.StatusCurrent, UpdatedAt: 80},
+		}},
+	}})
+	s.SaveSyncCursor(anilist.MediaTypeAnime, 100)
+	lib := New(s, client, 1)
+
+	var progress []int
+	lib.Syncer().Subscribe(func(status SyncStatus) {
+		if status.Syncing && status.Fetched > 0 {
+			progress = append(progress, status.Fetched)
+		}
+	})
+	collection, err := lib.Syncer().Sync(context.Background(), anilist.MediaTypeAnime)
+	if err != nil {
+		t.Fatalf("Expected sync to succeed, got %v", err)
+	}
+	if *fullFetches != 0 {
+		t.Errorf("Expected no full fetch, got %d", *fullFetches)
+	}
+	if len(progress) != 1 || progress[0] != 2 {
+		t.Errorf("Expected progress [2], got %v", progress)
+	}
+
+	entries := map[int]*anilist.MediaListEntry{}
+	for _, entry := range collection.Entries() {
+		entries[entry.MediaID] = entry
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected media 10 and 30, got %+v", entries)
+	}
+	if entry := entries[10]; entry.Status != anilist.StatusCompleted || entry.Progress != 12 || entry.Media == nil {
+		t.Errorf("Expected media 10 to be completed with its cached media kept, got %+v", entry)
+	}
+	if entries[30] == nil || entries[30].Media.Title.English != "Thirty" {
+		t.Errorf("Expected media 30 to be added with its media, got %+v", entries[30])
+	}
+
+	cursor, _, _ := s.LoadSyncCursor(anilist.MediaTypeAnime)
+	if cursor != 300 {
+		t.Errorf("Expected cursor 300, got %d", cursor)
+	}
+}
+
+func TestSync_KeepsEntriesAddedOffline(t *testing.T) {
+	client, _ := newSyncAPI(t)
+	s := newStore(t)
+	s.SaveListCollection(anilist.MediaTypeAnime, &anilist.MediaListCollection{})
+	s.SaveSyncCursor(anilist.MediaTypeAnime, 100)
+	lib := New(s, client, 1)
+
+	lib.queue.mutations = append(lib.queue.mutations, &Mutation{ID: "a", Kind: MutationSave, MediaType: anilist.MediaTypeAnime, MediaID: 50,
+		Input: anilist.SaveMediaListEntryInput{Progress: intPtr(1)}})
+	collection, err := lib.Syncer().Sync(context.Background(), anilist.MediaTypeAnime)
+	if err != nil {
+		t.Fatalf("Expected sync to succeed, got %v", err)
+	}
+	if findEntry(collection, 50) == nil {
+		t.Errorf("Expected entry added offline to survive the sync")
+	}
+}
@@ -0,0 +1,177 @@
+package links
+
+import (
+	"errors"
+	"fmt"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Scheme is the URL scheme Hisame registers with the operating system.
+const Scheme = "hisame"
+
+// ErrUnsupported is returned by Parse for text that isn't a Hisame link or an AniList page Hisame can show.
+var ErrUnsupported = errors.New("not a Hisame or AniList link")
+
+// Kind is the kind of page a link leads to.
+type Kind string
+
+const (
+	KindMedia  Kind = "media"
+	KindSearch Kind = "search"
+	KindUser   Kind = "user"
+)
+
+// Link is a parsed hisame:// or AniList URL.
+type Link struct {
+	Kind Kind
+	// MediaID is the AniList ID of the media of a media link.
+	MediaID int
+	// MediaType is the type named by an AniList URL, which hisame:// links leave empty.
+	MediaType anilist.MediaType
+	// Query is the search of a search link.
+	Query string
+	// UserName is the user of a user link.
+	UserName string
+}
+
+// String returns the link as a hisame:// URL.
+func (l Link) String() string {
+	switch l.Kind {
+	case KindMedia:
+		return fmt.Sprintf("%s://media/%d", Scheme, l.MediaID)
+	case KindSearch:
+		return fmt.Sprintf("%s://search?q=%s", Scheme, url.QueryEscape(l.Query))
+	case KindUser:
+		return fmt.Sprintf("%s://user/%s", Scheme, url.PathEscape(l.UserName))
+	default:
+		return ""
+	}
+}
+
+// Parse reads a hisame:// URL, or an AniList URL such as https://anilist.co/anime/21, which may be missing its
+// scheme as pasted URLs often are.  Surrounding whitespace is ignored.
+func Parse(raw string) (Link, error) {
+	raw = strings.TrimSpace(raw)
+	lower := strings.ToLower(raw)
+	if strings.HasPrefix(lower, "anilist.co/") || strings.HasPrefix(lower, "www.anilist.co/") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Link{}, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case Scheme:
+		return parseHisame(u)
+	case "http", "https":
+		host := strings.ToLower(u.Hostname())
+		if host != "anilist.co" && host != "www.anilist.co" {
+			return Link{}, ErrUnsupported
+		}
+		return parseAniList(u)
+	default:
+		return Link{}, ErrUnsupported
+	}
+}
+
+// IsLink reports whether text is a link Parse understands.
+func IsLink(text string) bool {
+	_, err := Parse(text)
+	return err == nil
+}
+
+// parseHisame reads hisame://media/<id>, hisame://search?q=<query> and hisame://user/<name>.  The host is the
+// first part of the route, and hisame:media/<id> without the slashes is accepted too.
+func parseHisame(u *url.URL) (Link, error) {
+	route := u.Opaque
+	if route == "" {
+		route = u.Host + u.EscapedPath()
+	}
+	parts := splitPath(route)
+	if len(parts) == 0 {
+		return Link{}, fmt.Errorf("%w: missing route", ErrUnsupported)
+	}
+
+	switch strings.ToLower(parts[0]) {
+	case string(KindMedia):
+		if len(parts) != 2 {
+			return Link{}, fmt.Errorf("%w: expected %s://media/<id>", ErrUnsupported, Scheme)
+		}
+		return mediaLink(parts[1], "")
+	case string(KindSearch):
+		return searchLink(u.Query().Get("q"))
+	case string(KindUser):
+		if len(parts) != 2 {
+			return Link{}, fmt.Errorf("%w: expected %s://user/<name>", ErrUnsupported, Scheme)
+		}
+		return Link{Kind: KindUser, UserName: parts[1]}, nil
+	default:
+		return Link{}, fmt.Errorf("%w: unknown route %q", ErrUnsupported, parts[0])
+	}
+}
+
+// parseAniList reads AniList's media, user and search pages.  Anything after the ID or name, such as the title
+// slug or a user's list tab, is ignored.
+func parseAniList(u *url.URL) (Link, error) {
+	parts := splitPath(u.EscapedPath())
+	if len(parts) < 2 {
+		return Link{}, ErrUnsupported
+	}
+
+	switch strings.ToLower(parts[0]) {
+	case "anime":
+		return mediaLink(parts[1], anilist.MediaTypeAnime)
+	case "manga":
+		return mediaLink(parts[1], anilist.MediaTypeManga)
+	case "user":
+		return Link{Kind: KindUser, UserName: parts[1]}, nil
+	case "search":
+		link, err := searchLink(u.Query().Get("search"))
+		if err != nil {
+			return Link{}, err
+		}
+		switch strings.ToLower(parts[1]) {
+		case "anime":
+			link.MediaType = anilist.MediaTypeAnime
+		case "manga":
+			link.MediaType = anilist.MediaTypeManga
+		}
+		return link, nil
+	default:
+		return Link{}, ErrUnsupported
+	}
+}
+
+func mediaLink(id string, mediaType anilist.MediaType) (Link, error) {
+	mediaID, err := strconv.Atoi(id)
+	if err != nil || mediaID <= 0 {
+		return Link{}, fmt.Errorf("%w: invalid media ID %q", ErrUnsupported, id)
+	}
+	return Link{Kind: KindMedia, MediaID: mediaID, MediaType: mediaType}, nil
+}
+
+func searchLink(query string) (Link, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return Link{}, fmt.Errorf("%w: missing search", ErrUnsupported)
+	}
+	return Link{Kind: KindSearch, Query: query}, nil
+}
+
+// splitPath splits an escaped path into its unescaped, non-empty parts.
+func splitPath(path string) []string {
+	var parts []string
+	for _, part := range strings.Split(path, "/") {
+		if unescaped, err := url.PathUnescape(part); err == nil {
+			part = unescaped
+		}
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
@@ -0,0 +1,86 @@
+package links
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/StarTerrarium/hisame/internal/anilist"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		expected Link
+	}{
+		{"hisame media", "hisame://media/21", Link{Kind: KindMedia, MediaID: 21}},
+		{"hisame media without slashes", "hisame:media/21", Link{Kind: KindMedia, MediaID: 21}},
+		{"hisame media trailing slash", "hisame://media/21/", Link{Kind: KindMedia, MediaID: 21}},
+		{"hisame search", "hisame://search?q=one%20piece", Link{Kind: KindSearch, Query: "one piece"}},
+		{"hisame user", "hisame://user/Josh", Link{Kind: KindUser, UserName: "Josh"}},
+		{"hisame upper case", "HISAME://Media/21", Link{Kind: KindMedia, MediaID: 21}},
+		{"surrounding whitespace", "  hisame://media/21\n", Link{Kind: KindMedia, MediaID: 21}},
+		{"anilist anime", "https://anilist.co/anime/21", Link{Kind: KindMedia, MediaID: 21, MediaType: anilist.MediaTypeAnime}},
+		{"anilist anime with slug", "https://anilist.co/anime/21/One-Piece/", Link{Kind: KindMedia, MediaID: 21, MediaType: anilist.MediaTypeAnime}},
+		{"anilist manga", "https://www.anilist.co/manga/30013", Link{Kind: KindMedia, MediaID: 30013, MediaType: anilist.MediaTypeManga}},
+		{"anilist without scheme", "anilist.co/anime/21", Link{Kind: KindMedia, MediaID: 21, MediaType: anilist.MediaTypeAnime}},
+		{"anilist user list", "https://anilist.co/user/Josh/animelist", Link{Kind: KindUser, UserName: "Josh"}},
+		{"anilist search", "https://anilist.co/search/manga?search=berserk", Link{Kind: KindSearch, Query: "berserk", MediaType: anilist.MediaTypeManga}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.raw)
+		if err != nil {
+			t.Errorf("%s: expected %q to parse, got %v", tt.name, tt.raw, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestParse_Unsupported(t *testing.T) {
+	tests := []string{
+		"",
+		"one piece",
+		"hisame://",
+		"hisame://media/abc",
+		"hisame://media/-1",
+		"hisame://media/21/extra",
+		"hisame://search",
+		"hisame://search?q=%20",
+		"hisame://user",
+		"hisame://settings",
+		"https://example.com/anime/21",
+		"https://anilist.co/",
+		"https://anilist.co/character/40",
+		"ftp://anilist.co/anime/21",
+	}
+	for _, raw := range tests {
+		if _, err := Parse(raw); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Expected %q to be unsupported, got %v", raw, err)
+		}
+	}
+}
+
+func TestLink_String(t *testing.T) {
+	tests := []struct {
+		link     Link
+		expected string
+	}{
+		{Link{Kind: KindMedia, MediaID: 21, MediaType: anilist.MediaTypeAnime}, "hisame://media/21"},
+		{Link{Kind: KindSearch, Query: "one piece"}, "hisame://search?q=one+piece"},
+		{Link{Kind: KindUser, UserName: "Josh"}, "hisame://user/Josh"},
+	}
+	for _, tt := range tests {
+		got := tt.link.String()
+		if got != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, got)
+		}
+		// A link's string form must lead back to the same page.
+		parsed, err := Parse(got)
+		if err != nil || parsed.Kind != tt.link.Kind || parsed.MediaID != tt.link.MediaID || parsed.Query != tt.link.Query || parsed.UserName != tt.link.UserName {
+			t.Errorf("Expected %q to parse back to %+v, got %+v (%v)", got, tt.link, parsed, err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package mal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/store"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Progress reports how far applying a plan has got.
+type Progress struct {
+	Done  int
+	Total int
+	// Current is the entry just saved, or skipped because an earlier run saved it.
+	Current *PlannedEntry
+}
+
+// Failure is an entry AniList refused to save.
+type Failure struct {
+	Source Entry
+	Err    error
+}
+
+// Result summarises applying a plan.
+type Result struct {
+	Saved []*anilist.MediaListEntry
+	// Resumed counts entries skipped because an interrupted run already saved them.
+	Resumed int
+	Failed  []Failure
+}
+
+// checkpoint records which entries of an export have been saved, so an interrupted import picks up where it left
+// off.  Entries are keyed by MyAnimeList ID.
+type checkpoint struct {
+	Done map[int]bool `json:"done"`
+}
+
+// CheckpointPath returns where progress importing the export at exportPath is recorded, under dir.  The path
+// depends on the export's contents, so importing a newer export starts afresh.
+func CheckpointPath(dir, exportPath string) (string, error) {
+	file, err := os.Open(exportPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "imports", hex.EncodeToString(hash.Sum(nil))[:16]+".json"), nil
+}
+
+// Apply saves the plan's creates and updates to AniList one at a time, through the client's rate limiting.
+// Progress is checkpointed after every entry.  When AniList can't be reached, or the session expires, Apply stops
+// and returns the error; calling it again with the same checkpoint resumes.  Entries AniList rejects are reported
+// in the result without stopping the import.  An empty checkpointPath disables resuming.
+func Apply(ctx context.Context, client *anilist.Client, plan *Plan, checkpointPath string, onProgress func(Progress)) (*Result, error) {
+	progress := loadCheckpoint(checkpointPath)
+	writes := plan.Writes()
+	result := &Result{}
+
+	for i, item := range writes {
+		if progress.Done[item.Source.MalID] {
+			result.Resumed++
+		} else {
+			entry, err := client.SaveMediaListEntry(anilist.WithPreviousEntry(ctx, item.Existing), item.Input)
+			if err != nil {
+				if anilist.IsTemporary(err) {
+					return result, fmt.Errorf("import interrupted after %d of %d entries: %w", i, len(writes), err)
+				}
+				logrus.Warnf("AniList rejected imported entry %q: %v", item.Source.Title, err)
+				result.Failed = append(result.Failed, Failure{Source: item.Source, Err: err})
+			} else {
+				result.Saved = append(result.Saved, entry)
+				progress.Done[item.Source.MalID] = true
+				if err := saveCheckpoint(checkpointPath, progress); err != nil {
+					logrus.Errorf("Error saving import progress: %v", err)
+				}
+			}
+		}
+		if onProgress != nil {
+			onProgress(Progress{Done: i + 1, Total: len(writes), Current: item})
+		}
+	}
+
+	if len(result.Failed) == 0 && checkpointPath != "" {
+		// Finished, so a later import of the same file should plan afresh.
+		if err := os.Remove(checkpointPath); err != nil && !os.IsNotExist(err) {
+			logrus.Warnf("Error removing import checkpoint: %v", err)
+		}
+	}
+	return result, nil
+}
+
+func loadCheckpoint(path string) *checkpoint {
+	progress := &checkpoint{Done: map[int]bool{}}
+	if path == "" {
+		return progress
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.Warnf("Error reading import checkpoint; starting from the beginning: %v", err)
+		}
+		return progress
+	}
+	if err := json.Unmarshal(data, progress); err != nil || progress.Done == nil {
+		logrus.Warnf("Ignoring corrupt import checkpoint %s", path)
+		return &checkpoint{Done: map[int]bool{}}
+	}
+	logrus.Infof("Resuming import, %d entries already saved", len(progress.Done))
+	return progress
+}
+
+func saveCheckpoint(path string, progress *checkpoint) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	return store.WriteFileAtomic(path, data)
+}
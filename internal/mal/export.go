@@ -0,0 +1,140 @@
+package mal
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/sirupsen/logrus"
+	"io"
+	"math"
+)
+
+// cdata is text written as a CDATA section, as MyAnimeList does for titles and comments.
+type cdata struct {
+	Text string `xml:",cdata"`
+}
+
+type exportDocument struct {
+	XMLName xml.Name      `xml:"myanimelist"`
+	Info    exportInfo    `xml:"myinfo"`
+	Anime   []exportAnime `xml:"anime"`
+	Manga   []exportManga `xml:"manga"`
+}
+
+type exportInfo struct {
+	UserName   string `xml:"user_name"`
+	ExportType int    `xml:"user_export_type"`
+	Total      int    `xml:"user_total"`
+}
+
+// exportEntry holds the fields anime and manga entries share.
+type exportEntry struct {
+	StartDate      string `xml:"my_start_date"`
+	FinishDate     string `xml:"my_finish_date"`
+	Score          int    `xml:"my_score"`
+	Status         string `xml:"my_status"`
+	Comments       cdata  `xml:"my_comments"`
+	UpdateOnImport int    `xml:"update_on_import"`
+}
+
+type exportAnime struct {
+	ID         int   `xml:"series_animedb_id"`
+	Title      cdata `xml:"series_title"`
+	Watched    int   `xml:"my_watched_episodes"`
+	Times      int   `xml:"my_times_watched"`
+	Rewatching int   `xml:"my_rewatching"`
+	exportEntry
+}
+
+type exportManga struct {
+	ID        int   `xml:"manga_mangadb_id"`
+	Title     cdata `xml:"manga_title"`
+	Chapters  int   `xml:"my_read_chapters"`
+	Volumes   int   `xml:"my_read_volumes"`
+	Times     int   `xml:"my_times_read"`
+	Rereading int   `xml:"my_rereading"`
+	exportEntry
+}
+
+// Write writes list entries as a MyAnimeList export, which MyAnimeList and most other list sites can import.
+// Scores are converted from scoreFormat to MyAnimeList's 10 point scale.  MyAnimeList identifies entries by its own
+// IDs, so entries for media AniList has no MyAnimeList ID for are left out.
+func Write(w io.Writer, mediaType anilist.MediaType, entries []*anilist.MediaListEntry, scoreFormat anilist.ScoreFormat, username string) error {
+	exportType := 1
+	if mediaType == anilist.MediaTypeManga {
+		exportType = 2
+	}
+
+	document := exportDocument{Info: exportInfo{UserName: username, ExportType: exportType}}
+	skipped := 0
+	for _, entry := range entries {
+		if entry.Media == nil || entry.Media.IDMal == nil {
+			skipped++
+			continue
+		}
+		common := exportEntry{
+			StartDate:      formatDate(entry.StartedAt),
+			FinishDate:     formatDate(entry.CompletedAt),
+			Score:          int(math.Round(scoreFormat.ToPoint10(entry.Score))),
+			Status:         formatStatus(mediaType, entry.Status),
+			Comments:       cdata{entry.Notes},
+			UpdateOnImport: 1,
+		}
+		title := cdata{entry.Media.Title.Preferred("romaji")}
+		repeating := 0
+		if entry.Status == anilist.StatusRepeating {
+			repeating = 1
+		}
+		if mediaType == anilist.MediaTypeManga {
+			document.Manga = append(document.Manga, exportManga{ID: *entry.Media.IDMal, Title: title, Chapters: entry.Progress,
+				Volumes: entry.ProgressVolumes, Times: entry.Repeat, Rereading: repeating, exportEntry: common})
+		} else {
+			document.Anime = append(document.Anime, exportAnime{ID: *entry.Media.IDMal, Title: title, Watched: entry.Progress,
+				Times: entry.Repeat, Rewatching: repeating, exportEntry: common})
+		}
+	}
+	if skipped > 0 {
+		logrus.Warnf("Left %d entries without a MyAnimeList ID out of the MyAnimeList export", skipped)
+	}
+	document.Info.Total = len(document.Anime) + len(document.Manga)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "\t")
+	if err := encoder.Encode(document); err != nil {
+		return fmt.Errorf("failed to write MyAnimeList export: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// formatStatus maps an AniList status to MyAnimeList's.  MyAnimeList has no repeating status; repeating entries
+// are marked as being rewatched or reread instead.
+func formatStatus(mediaType anilist.MediaType, status anilist.MediaListStatus) string {
+	current, planning := "Watching", "Plan to Watch"
+	if mediaType == anilist.MediaTypeManga {
+		current, planning = "Reading", "Plan to Read"
+	}
+	switch status {
+	case anilist.StatusCurrent, anilist.StatusRepeating:
+		return current
+	case anilist.StatusCompleted:
+		return "Completed"
+	case anilist.StatusPaused:
+		return "On-Hold"
+	case anilist.StatusDropped:
+		return "Dropped"
+	default:
+		return planning
+	}
+}
+
+// formatDate formats a date the way MyAnimeList does, with zeroes for unknown parts.
+func formatDate(date anilist.FuzzyDate) string {
+	if date.IsZero() {
+		return "0000-00-00"
+	}
+	return date.String()
+}
@@ -0,0 +1,224 @@
+package mal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/StarTerrarium/hisame/internal/anilist"
+)
+
+const animeExport = `<?xml version="1.0" encoding="UTF-8" ?>
+<myanimelist>
+	<myinfo>
+		<user_name>tester</user_name>
+		<user_export_type>1</user_export_type>
+	</myinfo>
+	<anime>
+		<series_animedb_id>1</series_animedb_id>
+		<series_title><![CDATA[Cowboy Bebop]]></series_title>
+		<my_watched_episodes>26</my_watched_episodes>
+		<my_start_date>2020-01-05</my_start_date>
+		<my_finish_date>2020-02-00</my_finish_date>
+		<my_score>9</my_score>
+		<my_status>Completed</my_status>
+		<my_times_watched>1</my_times_watched>
+		<my_comments><![CDATA[Great]]></my_comments>
+		<my_rewatching>0</my_rewatching>
+	</anime>
+	<anime>
+		<series_animedb_id>5</series_animedb_id>
+		<series_title><![CDATA[Movie]]></series_title>
+		<my_watched_episodes>0</my_watched_episodes>
+		<my_start_date>0000-00-00</my_start_date>
+		<my_finish_date>0000-00-00</my_finish_date>
+		<my_score>0</my_score>
+		<my_status>Plan to Watch</my_status>
+		<my_rewatching>0</my_rewatching>
+	</anime>
+	<anime>
+		<series_animedb_id>999</series_animedb_id>
+		<series_title><![CDATA[Unknown]]></series_title>
+		<my_status>Watching</my_status>
+	</anime>
+</myanimelist>`
+
+const mangaExport = `<myanimelist>
+	<myinfo><user_export_type>2</user_export_type></myinfo>
+	<manga>
+		<manga_mangadb_id>2</manga_mangadb_id>
+		<manga_title>Berserk</manga_title>
+		<my_read_chapters>100</my_read_chapters>
+		<my_read_volumes>10</my_read_volumes>
+		<my_status>Reading</my_status>
+		<my_rereading>1</my_rereading>
+	</manga>
+</myanimelist>`
+
+func TestParse(t *testing.T) {
+	export, err := Parse(strings.NewReader(animeExport))
+	if err != nil {
+		t.Fatalf("Expected export to parse, got %v", err)
+	}
+	if export.Type != anilist.MediaTypeAnime || len(export.Entries) != 3 {
+		t.Fatalf("Expected 3 anime entries, got %s with %d", export.Type, len(export.Entries))
+	}
+
+	bebop := export.Entries[0]
+	if bebop.MalID != 1 || bebop.Title != "Cowboy Bebop" || bebop.Status != anilist.StatusCompleted ||
+		bebop.Score != 9 || bebop.Progress != 26 || bebop.Repeat != 1 || bebop.Notes != "Great" {
+		t.Errorf("Unexpected entry %+v", bebop)
+	}
+	if bebop.StartedAt.String() != "2020-01-05" || bebop.CompletedAt.String() != "2020-02-00" {
+		t.Errorf("Expected dates 2020-01-05 and 2020-02-00, got %s and %s", bebop.StartedAt, bebop.CompletedAt)
+	}
+	if movie := export.Entries[1]; movie.Status != anilist.StatusPlanning || !movie.StartedAt.IsZero() {
+		t.Errorf("Expected a planned entry without dates, got %+v", movie)
+	}
+}
+
+func TestParse_GzipManga(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(mangaExport))
+	gz.Close()
+
+	export, err := Parse(&compressed)
+	if err != nil {
+		t.Fatalf("Expected gzipped export to parse, got %v", err)
+	}
+	entry := export.Entries[0]
+	if export.Type != anilist.MediaTypeManga || entry.Status != anilist.StatusRepeating || entry.ProgressVolumes != 10 {
+		t.Errorf("Unexpected manga export %s %+v", export.Type, entry)
+	}
+}
+
+func TestParse_NotAnExport(t *testing.T) {
+	for _, input := range []string{"not xml", "<myanimelist></myanimelist>"} {
+		if _, err := Parse(strings.NewReader(input)); !errors.Is(err, ErrNotMALExport) {
+			t.Errorf("Expected ErrNotMALExport for %q, got %v", input, err)
+		}
+	}
+}
+
+// newFakeAPI serves MyAnimeList ID lookups for MAL IDs 1 and 5, and saves.  Saves fail with a 503 while failSaves
+// is set.
+func newFakeAPI(t *testing.T, failSaves *atomic.Bool) (*anilist.Client, *int32) {
+	t.Helper()
+	var saves int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.Contains(body.Query, "idMal_in"):
+			w.Write([]byte(`{"data":{"Page":{"media":[{"id":101,"idMal":1},{"id":105,"idMal":5}]}}}`))
+		case strings.Contains(body.Query, "SaveMediaListEntry("):
+			if failSaves != nil && failSaves.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			atomic.AddInt32(&saves, 1)
+			w.Write([]byte(`{"data":{"SaveMediaListEntry":{"id":1,"mediaId":101}}}`))
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return anilist.NewClientWithEndpoint(ts.URL, "token"), &saves
+}
+
+func TestBuildPlan(t *testing.T) {
+	client, _ := newFakeAPI(t, nil)
+	export, _ := Parse(strings.NewReader(animeExport))
+	current := &anilist.MediaListCollection{Lists: []*anilist.MediaListGroup{{Entries: []*anilist.MediaListEntry{
+		{ID: 7, MediaID: 101, Status: anilist.StatusCurrent, Progress: 20, Score: 90},
+		{ID: 8, MediaID: 105, Status: anilist.StatusPlanning},
+	}}}}
+
+	plan, err := BuildPlan(context.Background(), client, export, current, anilist.ScorePoint100)
+	if err != nil {
+		t.Fatalf("Expected plan to build, got %v", err)
+	}
+	if len(plan.Creates) != 0 || len(plan.Updates) != 1 || len(plan.Skips) != 1 || len(plan.Unmapped) != 1 {
+		t.Fatalf("Expected 1 update, 1 skip and 1 unmapped, got %d creates, %d updates, %d skips, %d unmapped",
+			len(plan.Creates), len(plan.Updates), len(plan.Skips), len(plan.Unmapped))
+	}
+
+	update := plan.Updates[0].Input
+	if *update.ID != 7 || *update.Status != anilist.StatusCompleted || *update.Progress != 26 || update.Score != nil {
+		t.Errorf("Expected only the changed fields to be updated, got %+v", update)
+	}
+	if plan.Unmapped[0].Source.MalID != 999 {
+		t.Errorf("Expected MAL ID 999 to be unmapped, got %+v", plan.Unmapped[0])
+	}
+}
+
+func TestApply_ResumesAfterInterruption(t *testing.T) {
+	var failSaves atomic.Bool
+	client, saves := newFakeAPI(t, &failSaves)
+	export, _ := Parse(strings.NewReader(animeExport))
+	plan, _ := BuildPlan(context.Background(), client, export, nil, anilist.ScorePoint10)
+	checkpointPath := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	interrupted := false
+	_, err := Apply(context.Background(), client, plan, checkpointPath, func(progress Progress) {
+		if progress.Done == 1 && !interrupted {
+			interrupted = true
+			failSaves.Store(true)
+		}
+	})
+	if !anilist.IsOffline(err) {
+		t.Fatalf("Expected the import to stop when AniList is unavailable, got %v", err)
+	}
+
+	failSaves.Store(false)
+	result, err := Apply(context.Background(), client, plan, checkpointPath, nil)
+	if err != nil {
+		t.Fatalf("Expected the resumed import to succeed, got %v", err)
+	}
+	if result.Resumed != 1 || len(result.Saved) != 1 || *saves != 2 {
+		t.Errorf("Expected 1 resumed and 1 saved entry with 2 saves in total, got %d, %d and %d", result.Resumed, len(result.Saved), *saves)
+	}
+}
+
+func TestWrite_RoundTrips(t *testing.T) {
+	malID, otherMalID := 1, 2
+	year, month := 2021, 3
+	entries := []*anilist.MediaListEntry{
+		{MediaID: 101, Status: anilist.StatusRepeating, Score: 85, Progress: 12, Repeat: 1, Notes: "a <b> & c",
+			StartedAt: anilist.FuzzyDate{Year: &year, Month: &month},
+			Media:     &anilist.Media{IDMal: &malID, Title: anilist.MediaTitle{Romaji: "Title"}}},
+		{MediaID: 102, Status: anilist.StatusPlanning, Media: &anilist.Media{IDMal: &otherMalID}},
+		{MediaID: 103, Status: anilist.StatusCompleted, Media: &anilist.Media{}},
+	}
+
+	var buffer bytes.Buffer
+	if err := Write(&buffer, anilist.MediaTypeAnime, entries, anilist.ScorePoint100, "tester"); err != nil {
+		t.Fatalf("Expected export to be written, got %v", err)
+	}
+	export, err := Parse(&buffer)
+	if err != nil {
+		t.Fatalf("Expected the written export to parse, got %v", err)
+	}
+	if len(export.Entries) != 2 {
+		t.Fatalf("Expected the entry without a MyAnimeList ID to be left out, got %d entries", len(export.Entries))
+	}
+	got := export.Entries[0]
+	if got.MalID != 1 || got.Status != anilist.StatusRepeating || got.Score != 9 || got.Progress != 12 ||
+		got.Notes != "a <b> & c" || got.StartedAt.String() != "2021-03-00" || !got.CompletedAt.IsZero() {
+		t.Errorf("Unexpected round tripped entry %+v", got)
+	}
+	if export.Entries[1].Status != anilist.StatusPlanning {
+		t.Errorf("Expected planning status, got %s", export.Entries[1].Status)
+	}
+}
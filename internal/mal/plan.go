@@ -0,0 +1,150 @@
+package mal
+
+import (
+	"context"
+	"fmt"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+)
+
+// Action is what an import will do with an entry.
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionSkip   Action = "skip"
+)
+
+// PlannedEntry is an export entry mapped to AniList, and the change importing it makes.
+type PlannedEntry struct {
+	Source Entry
+	Media  *anilist.Media
+	// Existing is the entry already on the user's AniList list, if any.
+	Existing *anilist.MediaListEntry
+	Action   Action
+	// Input holds only the fields that change.
+	Input anilist.SaveMediaListEntryInput
+	Diffs []anilist.FieldDiff
+}
+
+// Unmapped is an export entry that couldn't be matched to AniList media, for the user to resolve by hand.
+type Unmapped struct {
+	Source Entry
+	Reason string
+}
+
+// Plan is the preview of an import.  Nothing is written until it is applied.
+type Plan struct {
+	Type     anilist.MediaType
+	Creates  []*PlannedEntry
+	Updates  []*PlannedEntry
+	Skips    []*PlannedEntry
+	Unmapped []Unmapped
+}
+
+// Writes returns the entries applying the plan will save, in order.
+func (p *Plan) Writes() []*PlannedEntry {
+	return append(append([]*PlannedEntry{}, p.Creates...), p.Updates...)
+}
+
+// BuildPlan maps an export's entries to AniList media through their MyAnimeList IDs, and compares them with the
+// user's current lists.  Entries already on the list only update the fields that differ; entries that match
+// exactly are skipped.
+func BuildPlan(ctx context.Context, client *anilist.Client, export *Export, current *anilist.MediaListCollection, scoreFormat anilist.ScoreFormat) (*Plan, error) {
+	plan := &Plan{Type: export.Type}
+
+	var malIDs []int
+	seen := map[int]bool{}
+	for _, entry := range export.Entries {
+		if entry.MalID > 0 && !seen[entry.MalID] {
+			seen[entry.MalID] = true
+			malIDs = append(malIDs, entry.MalID)
+		}
+	}
+	media, err := client.MediaByMalIDs(ctx, export.Type, malIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up MyAnimeList IDs on AniList: %w", err)
+	}
+
+	existing := map[int]*anilist.MediaListEntry{}
+	if current != nil {
+		for _, entry := range current.Entries() {
+			existing[entry.MediaID] = entry
+		}
+	}
+
+	planned := map[int]bool{}
+	for _, entry := range export.Entries {
+		switch {
+		case entry.MalID <= 0:
+			plan.Unmapped = append(plan.Unmapped, Unmapped{Source: entry, Reason: "entry has no MyAnimeList ID"})
+			continue
+		case media[entry.MalID] == nil:
+			plan.Unmapped = append(plan.Unmapped, Unmapped{Source: entry, Reason: "no AniList media has this MyAnimeList ID"})
+			continue
+		case planned[media[entry.MalID].ID]:
+			plan.Unmapped = append(plan.Unmapped, Unmapped{Source: entry, Reason: "duplicate of another entry in the export"})
+			continue
+		}
+		m := media[entry.MalID]
+		planned[m.ID] = true
+
+		item := &PlannedEntry{Source: entry, Media: m, Existing: existing[m.ID]}
+		input := entryInput(entry, scoreFormat)
+		if item.Existing == nil {
+			item.Action = ActionCreate
+			item.Input = input
+			item.Input.MediaID = &m.ID
+			plan.Creates = append(plan.Creates, item)
+			continue
+		}
+
+		item.Diffs = input.Diff(item.Existing)
+		if len(item.Diffs) == 0 {
+			item.Action = ActionSkip
+			plan.Skips = append(plan.Skips, item)
+			continue
+		}
+		changed := make([]string, len(item.Diffs))
+		for i, diff := range item.Diffs {
+			changed[i] = diff.Field
+		}
+		item.Action = ActionUpdate
+		item.Input = input.Only(changed...)
+		item.Input.ID = &item.Existing.ID
+		plan.Updates = append(plan.Updates, item)
+	}
+	return plan, nil
+}
+
+// entryInput converts an export entry to the fields of a save mutation.  Fields MyAnimeList leaves empty are left
+// out, so they don't clear values set on AniList.
+func entryInput(entry Entry, scoreFormat anilist.ScoreFormat) anilist.SaveMediaListEntryInput {
+	status := entry.Status
+	progress := entry.Progress
+	input := anilist.SaveMediaListEntryInput{Status: &status, Progress: &progress}
+	if score := scoreFormat.FromPoint10(entry.Score); score > 0 {
+		input.Score = &score
+	}
+	if entry.ProgressVolumes > 0 {
+		volumes := entry.ProgressVolumes
+		input.ProgressVolumes = &volumes
+	}
+	if entry.Repeat > 0 {
+		repeat := entry.Repeat
+		input.Repeat = &repeat
+	}
+	if entry.Notes != "" {
+		notes := entry.Notes
+		input.Notes = &notes
+	}
+	if !entry.StartedAt.IsZero() {
+		started := entry.StartedAt
+		input.StartedAt = &started
+	}
+	if !entry.CompletedAt.IsZero() {
+		completed := entry.CompletedAt
+		input.CompletedAt = &completed
+	}
+	return input
+}
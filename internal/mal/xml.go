@@ -0,0 +1,184 @@
+package mal
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrNotMALExport is returned when a file doesn't look like a MyAnimeList list export.
+var ErrNotMALExport = errors.New("not a MyAnimeList export")
+
+// Export is a MyAnimeList anime or manga list export.
+type Export struct {
+	Type    anilist.MediaType
+	Entries []Entry
+}
+
+// Entry is one entry of a MyAnimeList export.
+type Entry struct {
+	MalID  int
+	Title  string
+	Status anilist.MediaListStatus
+	// Score is out of 10, with 0 meaning unscored.
+	Score           float64
+	Progress        int
+	ProgressVolumes int
+	Repeat          int
+	Notes           string
+	StartedAt       anilist.FuzzyDate
+	CompletedAt     anilist.FuzzyDate
+}
+
+// xmlExport mirrors the layout of MyAnimeList's animelist.xml and mangalist.xml.
+type xmlExport struct {
+	XMLName xml.Name `xml:"myanimelist"`
+	Info    struct {
+		ExportType string `xml:"user_export_type"`
+	} `xml:"myinfo"`
+	Anime []xmlAnime `xml:"anime"`
+	Manga []xmlManga `xml:"manga"`
+}
+
+type xmlAnime struct {
+	ID         int    `xml:"series_animedb_id"`
+	Title      string `xml:"series_title"`
+	Watched    int    `xml:"my_watched_episodes"`
+	StartDate  string `xml:"my_start_date"`
+	FinishDate string `xml:"my_finish_date"`
+	Score      int    `xml:"my_score"`
+	Status     string `xml:"my_status"`
+	Times      int    `xml:"my_times_watched"`
+	Comments   string `xml:"my_comments"`
+	Rewatching string `xml:"my_rewatching"`
+}
+
+type xmlManga struct {
+	ID         int    `xml:"manga_mangadb_id"`
+	Title      string `xml:"manga_title"`
+	Chapters   int    `xml:"my_read_chapters"`
+	Volumes    int    `xml:"my_read_volumes"`
+	StartDate  string `xml:"my_start_date"`
+	FinishDate string `xml:"my_finish_date"`
+	Score      int    `xml:"my_score"`
+	Status     string `xml:"my_status"`
+	Times      int    `xml:"my_times_read"`
+	Comments   string `xml:"my_comments"`
+	Rereading  string `xml:"my_rereading"`
+}
+
+// ParseFile reads a MyAnimeList export from disk.  Exports are downloaded gzipped, and may be given either
+// compressed or not.
+func ParseFile(path string) (*Export, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Parse(file)
+}
+
+// Parse reads a MyAnimeList export, decompressing it first if it is gzipped.
+func Parse(r io.Reader) (*Export, error) {
+	buffered := bufio.NewReader(r)
+	if magic, err := buffered.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress export: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = buffered
+	}
+
+	var raw xmlExport
+	if err := xml.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotMALExport, err)
+	}
+
+	export := &Export{}
+	switch {
+	case len(raw.Anime) > 0 || raw.Info.ExportType == "1":
+		export.Type = anilist.MediaTypeAnime
+		for _, a := range raw.Anime {
+			entry := Entry{
+				MalID:       a.ID,
+				Title:       strings.TrimSpace(a.Title),
+				Status:      parseStatus(a.Status, a.Rewatching),
+				Score:       float64(a.Score),
+				Progress:    a.Watched,
+				Repeat:      a.Times,
+				Notes:       strings.TrimSpace(a.Comments),
+				StartedAt:   parseDate(a.StartDate),
+				CompletedAt: parseDate(a.FinishDate),
+			}
+			export.Entries = append(export.Entries, entry)
+		}
+	case len(raw.Manga) > 0 || raw.Info.ExportType == "2":
+		export.Type = anilist.MediaTypeManga
+		for _, m := range raw.Manga {
+			entry := Entry{
+				MalID:           m.ID,
+				Title:           strings.TrimSpace(m.Title),
+				Status:          parseStatus(m.Status, m.Rereading),
+				Score:           float64(m.Score),
+				Progress:        m.Chapters,
+				ProgressVolumes: m.Volumes,
+				Repeat:          m.Times,
+				Notes:           strings.TrimSpace(m.Comments),
+				StartedAt:       parseDate(m.StartDate),
+				CompletedAt:     parseDate(m.FinishDate),
+			}
+			export.Entries = append(export.Entries, entry)
+		}
+	default:
+		return nil, fmt.Errorf("%w: no anime or manga entries found", ErrNotMALExport)
+	}
+	return export, nil
+}
+
+// parseStatus maps a MyAnimeList status to AniList's.  Older exports use numeric statuses.
+func parseStatus(status, repeating string) anilist.MediaListStatus {
+	if repeating == "1" {
+		return anilist.StatusRepeating
+	}
+	switch strings.ToLower(strings.TrimSpace(status)) {
+	case "watching", "reading", "1":
+		return anilist.StatusCurrent
+	case "completed", "2":
+		return anilist.StatusCompleted
+	case "on-hold", "3":
+		return anilist.StatusPaused
+	case "dropped", "4":
+		return anilist.StatusDropped
+	default:
+		return anilist.StatusPlanning
+	}
+}
+
+// parseDate parses MyAnimeList's YYYY-MM-DD dates, where unknown parts are zero.
+func parseDate(date string) anilist.FuzzyDate {
+	var fuzzy anilist.FuzzyDate
+	parts := strings.Split(strings.TrimSpace(date), "-")
+	if len(parts) != 3 {
+		return fuzzy
+	}
+	targets := []**int{&fuzzy.Year, &fuzzy.Month, &fuzzy.Day}
+	for i, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil || value == 0 {
+			continue
+		}
+		*targets[i] = &value
+	}
+	return fuzzy
+}
@@ -0,0 +1,190 @@
+package palette
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Command is something the command palette can do, such as going to a page or acting on a list entry.
+type Command struct {
+	// Title is what the command is listed as, and what searches match.
+	Title string
+	// Detail is shown beside the title, such as where a command leads or an entry's progress.
+	Detail string
+	// Run does the command.  It is ignored when the command has options.
+	Run func()
+	// Options returns the commands offered once this one is picked, such as the quick actions for a list entry.
+	Options func() []Command
+}
+
+// Source returns commands that change as the app is used, such as one for each entry in the user's lists.  It is
+// called each time the palette is searched.
+type Source func() []Command
+
+// Registry holds the commands the palette searches.  Features add their own commands with Register or
+// RegisterSource.
+type Registry struct {
+	mutex   sync.RWMutex
+	sources []Source
+}
+
+// NewRegistry creates a registry with no commands.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds commands that don't change.
+func (r *Registry) Register(commands ...Command) {
+	commands = append([]Command(nil), commands...)
+	r.RegisterSource(func() []Command { return commands })
+}
+
+// RegisterSource adds commands that are looked up each time the palette is searched.
+func (r *Registry) RegisterSource(source Source) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.sources = append(r.sources, source)
+}
+
+// Commands returns every command, in the order their sources were registered.
+func (r *Registry) Commands() []Command {
+	r.mutex.RLock()
+	sources := append([]Source(nil), r.sources...)
+	r.mutex.RUnlock()
+
+	var commands []Command
+	for _, source := range sources {
+		commands = append(commands, source()...)
+	}
+	return commands
+}
+
+// Search returns up to limit of the registry's commands matching query, best match first.
+func (r *Registry) Search(query string, limit int) []Command {
+	return Search(r.Commands(), query, limit)
+}
+
+// Search returns up to limit of commands whose titles match query, best match first.  Commands that match equally
+// well are listed shortest title first, then in their order.  An empty query matches every command, in order.  A
+// limit of 0 or less returns every match.
+func Search(commands []Command, query string, limit int) []Command {
+	type match struct {
+		command Command
+		score   int
+		length  int
+	}
+	var matches []match
+	for _, command := range commands {
+		if score, ok := Match(query, command.Title); ok {
+			matches = append(matches, match{command, score, len([]rune(command.Title))})
+		}
+	}
+	if strings.TrimSpace(query) != "" {
+		sort.SliceStable(matches, func(i, j int) bool {
+			if matches[i].score != matches[j].score {
+				return matches[i].score > matches[j].score
+			}
+			return matches[i].length < matches[j].length
+		})
+	}
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	results := make([]Command, len(matches))
+	for i, m := range matches {
+		results[i] = m.command
+	}
+	return results
+}
+
+// Scores for the ways a character of a query can match.
+const (
+	matchScore       = 1
+	consecutiveBonus = 8
+	wordStartBonus   = 6
+)
+
+// Match reports whether the characters of query appear in order in text, ignoring case and spaces in the query, and
+// scores the best way they line up.  Characters matching the start of a word, or following the previous match,
+// score higher, so "snk" matches "Shingeki no Kyojin" better than "Sunken".
+func Match(query, text string) (int, bool) {
+	needle := lower([]rune(strings.Join(strings.Fields(query), "")))
+	if len(needle) == 0 {
+		return 0, true
+	}
+	original := []rune(text)
+	haystack := lower(original)
+
+	// best[i] is the best score for the query so far with its last character matched at i, or noMatch.
+	const noMatch = -1
+	best := make([]int, len(haystack))
+	next := make([]int, len(haystack))
+	for i := range haystack {
+		best[i] = noMatch
+		if haystack[i] == needle[0] {
+			best[i] = charScore(original, i)
+		}
+	}
+	for _, c := range needle[1:] {
+		// Best score ending at least two characters back, so not consecutive.
+		earlier := noMatch
+		for i := range haystack {
+			if i >= 2 {
+				earlier = max(earlier, best[i-2])
+			}
+			next[i] = noMatch
+			if haystack[i] != c {
+				continue
+			}
+			previous := earlier
+			if i >= 1 && best[i-1] != noMatch {
+				previous = max(previous, best[i-1]+consecutiveBonus)
+			}
+			if previous != noMatch {
+				next[i] = previous + charScore(original, i)
+			}
+		}
+		best, next = next, best
+	}
+
+	score := noMatch
+	for _, s := range best {
+		score = max(score, s)
+	}
+	if score == noMatch {
+		return 0, false
+	}
+	return score, true
+}
+
+// lower returns the runes in lower case, rune by rune, so positions still line up with the original.
+func lower(runes []rune) []rune {
+	lowered := make([]rune, len(runes))
+	for i, r := range runes {
+		lowered[i] = unicode.ToLower(r)
+	}
+	return lowered
+}
+
+// charScore scores a character of the query matching text at i, before any bonus for following the previous match.
+func charScore(text []rune, i int) int {
+	if isWordStart(text, i) {
+		return matchScore + wordStartBonus
+	}
+	return matchScore
+}
+
+// isWordStart reports whether the character at i starts a word, after a space or punctuation, or as an upper case
+// letter after a lower case one.
+func isWordStart(text []rune, i int) bool {
+	if i == 0 {
+		return true
+	}
+	previous, current := text[i-1], text[i]
+	if !unicode.IsLetter(previous) && !unicode.IsDigit(previous) {
+		return true
+	}
+	return unicode.IsLower(previous) && unicode.IsUpper(current)
+}
@@ -0,0 +1,98 @@
+package palette
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		query   string
+		text    string
+		matches bool
+	}{
+		{"", "Anything", true},
+		{"set", "Go to Settings", true},
+		{"gts", "Go to Settings", true},
+		{"SETTINGS", "Go to Settings", true},
+		{"go set", "Go to Settings", true},
+		{"snk", "Shingeki no Kyojin", true},
+		{"xyz", "Shingeki no Kyojin", false},
+		{"sett", "Set", false},
+		{"tes", "Set", false},
+		{"café", "Café Terrace", true},
+	}
+	for _, tt := range tests {
+		if _, ok := Match(tt.query, tt.text); ok != tt.matches {
+			t.Errorf("Expected Match(%q, %q) to be %v, got %v", tt.query, tt.text, tt.matches, ok)
+		}
+	}
+}
+
+func TestMatch_Ranking(t *testing.T) {
+	tests := []struct {
+		query  string
+		better string
+		worse  string
+	}{
+		{"snk", "Shingeki no Kyojin", "Sunken"},
+		{"set", "Settings", "Sunset"},
+		{"op", "One Piece", "Hoppers"},
+		{"tokyo", "Tokyo Ghoul", "Toradora! Kyoto"},
+	}
+	for _, tt := range tests {
+		better, ok := Match(tt.query, tt.better)
+		if !ok {
+			t.Fatalf("Expected %q to match %q", tt.query, tt.better)
+		}
+		worse, ok := Match(tt.query, tt.worse)
+		if !ok {
+			t.Fatalf("Expected %q to match %q", tt.query, tt.worse)
+		}
+		if better <= worse {
+			t.Errorf("Expected %q to match %q (%d) better than %q (%d)", tt.query, tt.better, better, tt.worse, worse)
+		}
+	}
+}
+
+func titles(commands []Command) []string {
+	var result []string
+	for _, command := range commands {
+		result = append(result, command.Title)
+	}
+	return result
+}
+
+func TestSearch(t *testing.T) {
+	commands := []Command{{Title: "Sunset"}, {Title: "Go to Settings"}, {Title: "Sync now"}, {Title: "Settings"}}
+
+	if got, expected := titles(Search(commands, "set", 0)), []string{"Settings", "Go to Settings", "Sunset"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	if got, expected := titles(Search(commands, "", 2)), []string{"Sunset", "Go to Settings"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected an empty query to keep the order, got %v", got)
+	}
+	if got := Search(commands, "zzz", 0); len(got) != 0 {
+		t.Errorf("Expected no matches, got %v", titles(got))
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(Command{Title: "Go to Settings"}, Command{Title: "Sync now"})
+	entries := []Command{{Title: "One Piece"}}
+	registry.RegisterSource(func() []Command { return entries })
+
+	if got, expected := titles(registry.Commands()), []string{"Go to Settings", "Sync now", "One Piece"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	// Sources are looked up on every search, so they see changes.
+	entries = append(entries, Command{Title: "One Punch Man"})
+	if got, expected := titles(registry.Search("one p", 0)), []string{"One Piece", "One Punch Man"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	if got := registry.Search("one", 1); len(got) != 1 {
+		t.Errorf("Expected the limit to apply, got %v", titles(got))
+	}
+}
@@ -0,0 +1,147 @@
+package state
+
+import (
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/audit"
+	"github.com/StarTerrarium/hisame/internal/auth"
+	"github.com/StarTerrarium/hisame/internal/library"
+	"github.com/StarTerrarium/hisame/internal/store"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// LoadAccounts restores the accounts saved in the store, and saves any later account changes to it.  Accounts
+// whose token has already expired are dropped.
+func (s *AppState) LoadAccounts(store *auth.SessionStore) error {
+	accounts, err := store.Load()
+	if err != nil {
+		return err
+	}
+	for _, name := range accounts.Names() {
+		if session := accounts.Sessions[name]; session.Expired(time.Now()) {
+			logrus.Warnf("Saved session for %s expired at %s.  You will need to log in again.", name, session.ExpiresAt)
+			accounts.Remove(name)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.store = store
+	s.accounts = accounts
+	s.activateSession()
+	return nil
+}
+
+// GetSession returns the session of the active account, or nil if the user is not logged in.
+func (s *AppState) GetSession() *auth.Session {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.accounts.ActiveSession()
+}
+
+// GetAccountNames returns the names of all logged in accounts, and the name of the active one.
+func (s *AppState) GetAccountNames() ([]string, string) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.accounts.Names(), s.accounts.Active
+}
+
+// AddAccount adds a newly logged in account and makes it active.  Other accounts stay logged in.
+func (s *AppState) AddAccount(session *auth.Session) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.accounts.Add(session)
+	s.activateSession()
+	return s.saveAccounts()
+}
+
+// SwitchAccount makes the named account active.
+func (s *AppState) SwitchAccount(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.accounts.Switch(name); err != nil {
+		return err
+	}
+	s.activateSession()
+	return s.saveAccounts()
+}
+
+// RemoveAccount logs out of the named account.  If it was active another account becomes active, if there is one.
+func (s *AppState) RemoveAccount(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.accounts.Remove(name)
+	s.activateSession()
+	return s.saveAccounts()
+}
+
+// GetLibrary returns cache first access to the active account's data, or nil if not logged in.
+func (s *AppState) GetLibrary() *library.Library {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.library
+}
+
+// activateSession creates the API client and opens the cache for the active account.  Must be called with the
+// mutex held.
+func (s *AppState) activateSession() {
+	if s.library != nil {
+		s.library.Close()
+	}
+	s.client = nil
+	s.library = nil
+	session := s.accounts.ActiveSession()
+	if session == nil {
+		return
+	}
+	logrus.Infof("Active account is now %s", session.Name())
+	s.client = anilist.NewClient(session.Token)
+	s.client.SetSessionExpiredHandler(func(error) { s.handleSessionExpired(session) })
+	s.client.SetMutationMode(s.mutationMode)
+	accountStore := openStore(session)
+	if s.auditLog != nil {
+		s.client.SetMutationHandler(audit.Recorder(s.auditLog, session.Name(), session.UserID, cachedTitle(accountStore)))
+	}
+	s.library = library.New(accountStore, s.client, session.UserID)
+	s.library.Queue().SetConflictResolver(s.resolveConflict)
+	s.library.Syncer().SetInterval(s.config.SyncInterval())
+	s.library.Start()
+}
+
+// openStore opens the account's on-disk cache.  The app still works without a cache, it just needs the network,
+// so errors are logged rather than returned.
+func openStore(session *auth.Session) *store.Store {
+	baseDir, err := store.DefaultDir()
+	if err != nil {
+		logrus.Errorf("Unable to locate cache directory; offline access disabled: %v", err)
+		return nil
+	}
+	accountStore, err := store.Open(baseDir, session.CacheKey())
+	if err != nil {
+		logrus.Errorf("Unable to open cache for %s; offline access disabled: %v", session.Name(), err)
+		return nil
+	}
+	return accountStore
+}
+
+// cachedTitle returns a function looking up a media's title in the account's cache, for the audit log.
+func cachedTitle(accountStore *store.Store) func(mediaID int) string {
+	return func(mediaID int) string {
+		if accountStore == nil {
+			return ""
+		}
+		media, _, err := accountStore.LoadMedia(mediaID)
+		if err != nil {
+			return ""
+		}
+		return media.Title.Preferred("romaji")
+	}
+}
+
+// saveAccounts persists the accounts, if a store has been loaded.  Must be called with the mutex held.
+func (s *AppState) saveAccounts() error {
+	if s.store == nil {
+		return nil
+	}
+	return s.store.Save(s.accounts)
+}
@@ -0,0 +1,104 @@
+package state
+
+import (
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/StarTerrarium/hisame/internal/auth"
+	"github.com/StarTerrarium/hisame/internal/config"
+)
+
+func TestAccounts(t *testing.T) {
+	instance = nil
+	once = sync.Once{}
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	cfg := config.DefaultConfig()
+	cfg.Accounts = map[string]config.AccountConfig{
+		"Alt": {AnimeConfig: config.AnimeConfig{TitleLanguage: "native"}},
+	}
+	appState := InitialiseAppState(cfg)
+	store := auth.NewSessionStoreAt(filepath.Join(t.TempDir(), "accounts.json"))
+	if err := appState.LoadAccounts(store); err != nil {
+		t.Fatalf("Failed to load accounts: %v", err)
+	}
+	if appState.GetSession() != nil || appState.GetClient() != nil {
+		t.Fatal("Expected no session or client before logging in")
+	}
+
+	main := &auth.Session{Token: "main_token", UserID: 1, Username: "Main"}
+	alt := &auth.Session{Token: "alt_token", UserID: 2, Username: "Alt"}
+	if err := appState.AddAccount(main); err != nil {
+		t.Fatalf("Failed to add account: %v", err)
+	}
+	mainClient := appState.GetClient()
+	if err := appState.AddAccount(alt); err != nil {
+		t.Fatalf("Failed to add account: %v", err)
+	}
+
+	names, active := appState.GetAccountNames()
+	if !reflect.DeepEqual(names, []string{"Alt", "Main"}) || active != "Alt" {
+		t.Fatalf("Expected both accounts with Alt active, got %v, %s", names, active)
+	}
+	if appState.GetClient() == mainClient {
+		t.Fatal("Expected a new client for the new active account")
+	}
+	if lib := appState.GetLibrary(); lib == nil || lib.Store() == nil {
+		t.Fatal("Expected a library with a cache for the active account")
+	} else if filepath.Base(lib.Store().Dir()) != "2" {
+		t.Fatalf("Expected Alt's cache to be keyed by user ID, got %s", lib.Store().Dir())
+	}
+	if appState.GetConfig().AnimeConfig.TitleLanguage != "native" {
+		t.Fatal("Expected Alt's preferences to apply while it is active")
+	}
+
+	if err := appState.SwitchAccount("Main"); err != nil {
+		t.Fatalf("Failed to switch account: %v", err)
+	}
+	if appState.GetSession() != main {
+		t.Fatal("Expected Main to be active after switching")
+	}
+	if appState.GetConfig().AnimeConfig.TitleLanguage != "english" {
+		t.Fatal("Expected the base preferences to apply for Main")
+	}
+
+	// The accounts should have been saved as they changed
+	saved, err := store.Load()
+	if err != nil {
+		t.Fatalf("Failed to load saved accounts: %v", err)
+	}
+	if saved.Active != "Main" || len(saved.Sessions) != 2 {
+		t.Fatalf("Expected saved accounts to match, got %+v", saved)
+	}
+
+	if err := appState.RemoveAccount("Main"); err != nil {
+		t.Fatalf("Failed to remove account: %v", err)
+	}
+	if session := appState.GetSession(); session == nil || session.Username != "Alt" {
+		t.Fatalf("Expected Alt to become active after removing Main, got %+v", session)
+	}
+}
+
+func TestLoadAccounts_DropsExpiredSessions(t *testing.T) {
+	instance = nil
+	once = sync.Once{}
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	store := auth.NewSessionStoreAt(filepath.Join(t.TempDir(), "accounts.json"))
+	accounts := auth.NewAccounts()
+	accounts.Add(&auth.Session{Token: "expired_token", Username: "Expired", ExpiresAt: time.Now().Add(-time.Hour)})
+	if err := store.Save(accounts); err != nil {
+		t.Fatalf("Failed to save accounts: %v", err)
+	}
+
+	appState := InitialiseAppState(&config.UserConfig{})
+	if err := appState.LoadAccounts(store); err != nil {
+		t.Fatalf("Failed to load accounts: %v", err)
+	}
+	if appState.GetSession() != nil {
+		t.Fatal("Expected expired session not to be restored")
+	}
+}
@@ -1,7 +1,15 @@
 package state
 
 import (
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/audit"
+	"github.com/StarTerrarium/hisame/internal/auth"
+	"github.com/StarTerrarium/hisame/internal/backup"
 	"github.com/StarTerrarium/hisame/internal/config"
+	"github.com/StarTerrarium/hisame/internal/control"
+	"github.com/StarTerrarium/hisame/internal/images"
+	"github.com/StarTerrarium/hisame/internal/library"
+	"github.com/StarTerrarium/hisame/internal/tasks"
 	"github.com/StarTerrarium/hisame/internal/utils"
 	"github.com/sirupsen/logrus"
 	"sync"
@@ -10,7 +18,22 @@ import (
 type AppState struct {
 	mutex sync.RWMutex
 
-	config *config.UserConfig
+	config   *config.UserConfig
+	accounts *auth.Accounts
+	store    *auth.SessionStore
+	client   *anilist.Client
+	library  *library.Library
+	images   *images.Cache
+	// Set once opening the image cache has failed, so it isn't retried for every image.
+	imagesUnavailable bool
+	backups           *backup.Scheduler
+	auditLog          *audit.Log
+	control           *control.Server
+	mutationMode      anilist.MutationMode
+	tasks             *tasks.Tracker
+
+	sessionExpiredHandler func(session *auth.Session)
+	conflictResolver      library.ConflictResolver
 }
 
 // Use a Singleton to manage the application state
@@ -22,7 +45,23 @@ var once sync.Once
 func InitialiseAppState(cfg *config.UserConfig) *AppState {
 	once.Do(func() {
 		instance = &AppState{
-			config: cfg,
+			config:   cfg,
+			accounts: auth.NewAccounts(),
+			tasks:    tasks.NewTracker(),
+		}
+		switch {
+		case cfg.ReadOnly:
+			instance.mutationMode = anilist.MutationsReadOnly
+		case cfg.DryRun:
+			instance.mutationMode = anilist.MutationsDryRun
+		}
+		if instance.mutationMode != anilist.MutationsEnabled {
+			logrus.Warnf("Starting in %s mode.  Nothing will be changed on AniList", instance.mutationMode)
+		}
+		if path, err := audit.DefaultPath(); err != nil {
+			logrus.Errorf("Unable to locate audit log; mutations won't be recorded: %v", err)
+		} else {
+			instance.auditLog = audit.Open(path)
 		}
 
 		// Set log level if it is configured in the user configuration
@@ -48,8 +87,138 @@ func GetAppState() *AppState {
 	return instance
 }
 
+// GetConfig returns the user config, with the active account's preferences applied.
 func (s *AppState) GetConfig() *config.UserConfig {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
-	return s.config
+	return s.config.ForAccount(s.accounts.Active)
+}
+
+// GetClient returns an API client authenticated as the logged in user, or nil if not logged in.
+func (s *AppState) GetClient() *anilist.Client {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.client
+}
+
+// GetAuditLog returns the log of every mutation sent to AniList, or nil if it couldn't be located.
+func (s *AppState) GetAuditLog() *audit.Log {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.auditLog
+}
+
+// GetTasks returns the tracker of tasks running in the background.
+func (s *AppState) GetTasks() *tasks.Tracker {
+	return s.tasks
+}
+
+// GetMutationMode returns whether changes are sent to AniList.
+func (s *AppState) GetMutationMode() anilist.MutationMode {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.mutationMode
+}
+
+// SetMutationMode changes whether changes are sent to AniList, until the app is restarted.
+func (s *AppState) SetMutationMode(mode anilist.MutationMode) {
+	s.mutex.Lock()
+	logrus.Infof("Switching to %s mode", mode)
+	previous := s.mutationMode
+	s.mutationMode = mode
+	if s.client != nil {
+		s.client.SetMutationMode(mode)
+	}
+	lib := s.library
+	s.mutex.Unlock()
+
+	if lib == nil {
+		return
+	}
+	if previous == anilist.MutationsDryRun && mode != previous {
+		// Dry run changes only exist locally.  Subscribers are told outside the lock, as they read the state.
+		lib.DiscardDryRunEdits()
+	}
+	if mode != anilist.MutationsReadOnly {
+		// Edits queued while read-only or in dry run can be sent, or simulated, now.
+		lib.Queue().Kick()
+	}
+}
+
+// ReadOnly reports whether read-only mode is on, so controls that change the lists should be disabled.
+func (s *AppState) ReadOnly() bool {
+	return s.GetMutationMode() == anilist.MutationsReadOnly
+}
+
+// GetImageCache returns the cache of cover and banner images, opening it on first use.  It returns nil if the
+// cache can't be opened, in which case images are shown as placeholders.
+func (s *AppState) GetImageCache() *images.Cache {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.images != nil || s.imagesUnavailable {
+		return s.images
+	}
+
+	dir, err := images.DefaultDir()
+	if err != nil {
+		logrus.Errorf("Unable to locate image cache directory: %v", err)
+		s.imagesUnavailable = true
+		return nil
+	}
+	cacheConfig := s.config.CacheConfig
+	cache, err := images.New(dir, int64(cacheConfig.ImageSizeMB)<<20, cacheConfig.ImageMemoryEntries)
+	if err != nil {
+		logrus.Errorf("Unable to open image cache: %v", err)
+		s.imagesUnavailable = true
+		return nil
+	}
+	s.images = cache
+	return s.images
+}
+
+// SetSessionExpiredHandler registers the function called with the expired session when AniList rejects its token.
+// It is called from the goroutine of the request that failed.
+func (s *AppState) SetSessionExpiredHandler(handler func(session *auth.Session)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sessionExpiredHandler = handler
+}
+
+// handleSessionExpired logs out of the account whose token AniList rejected, leaving no account active until the
+// user logs in again.  Several in flight requests can fail at once, so only the first for a session is handled.
+func (s *AppState) handleSessionExpired(session *auth.Session) {
+	s.mutex.Lock()
+	if s.accounts.ActiveSession() != session {
+		s.mutex.Unlock()
+		return
+	}
+	s.accounts.Expire(session.Name())
+	s.activateSession()
+	if err := s.saveAccounts(); err != nil {
+		logrus.Errorf("Error saving accounts after %s's session expired: %v", session.Name(), err)
+	}
+	handler := s.sessionExpiredHandler
+	s.mutex.Unlock()
+
+	if handler != nil {
+		handler(session)
+	}
+}
+
+// SetConflictResolver registers the function asked what to do when a queued edit conflicts with a change made
+// elsewhere.  It is kept across account switches.
+func (s *AppState) SetConflictResolver(resolver library.ConflictResolver) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.conflictResolver = resolver
+}
+
+func (s *AppState) resolveConflict(conflict *library.Conflict) library.ConflictResolution {
+	s.mutex.RLock()
+	resolver := s.conflictResolver
+	s.mutex.RUnlock()
+	if resolver == nil {
+		return library.ConflictResolution{Resolution: library.ResolveLater}
+	}
+	return resolver(conflict)
 }
@@ -2,10 +2,16 @@
 package state
 
 import (
+	"context"
 	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"sync"
 	"testing"
 
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/auth"
 	"github.com/StarTerrarium/hisame/internal/config"
 )
 
@@ -13,6 +19,7 @@ import (
 func TestInitialiseAppState(t *testing.T) {
 	instance = nil
 	once = sync.Once{}
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
 
 	cfg := &config.UserConfig{
 		LogLevel: "trace",
@@ -46,6 +53,7 @@ func TestInitialiseAppState(t *testing.T) {
 func TestGetAppStateWithoutInitialization(t *testing.T) {
 	instance = nil
 	once = sync.Once{}
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
 
 	defer func() {
 		if r := recover(); r == nil {
@@ -56,3 +64,101 @@ func TestGetAppStateWithoutInitialization(t *testing.T) {
 	// This should cause a panic
 	_ = GetAppState()
 }
+
+func TestSessionExpiredHandler(t *testing.T) {
+	instance = nil
+	once = sync.Once{}
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	appState := InitialiseAppState(&config.UserConfig{})
+	if err := appState.AddAccount(&auth.Session{Token: "other", UserID: 2, Username: "Other"}); err != nil {
+		t.Fatalf("Failed to add account: %v", err)
+	}
+	if err := appState.AddAccount(&auth.Session{Token: "expired", UserID: 1, Username: "Tester"}); err != nil {
+		t.Fatalf("Failed to add account: %v", err)
+	}
+	if appState.GetClient() == nil {
+		t.Fatal("Expected a client to be created for the session")
+	}
+
+	called := 0
+	appState.SetSessionExpiredHandler(func(*auth.Session) { called++ })
+
+	// Point the session's handler at a client using the fake server
+	session := appState.GetSession()
+	client := anilist.NewClientWithEndpoint(ts.URL, "expired")
+	client.SetSessionExpiredHandler(func(error) { appState.handleSessionExpired(session) })
+	for i := 0; i < 2; i++ {
+		if _, err := client.Viewer(context.Background()); err == nil {
+			t.Fatal("Expected the request to fail")
+		}
+	}
+	if called != 1 {
+		t.Fatalf("Expected session expired handler to be called once, got %d", called)
+	}
+	names, active := appState.GetAccountNames()
+	if active != "" || len(names) != 1 || names[0] != "Other" {
+		t.Errorf("Expected the expired account to be removed without another becoming active, got %v with '%s' active", names, active)
+	}
+}
+
+func TestMutationMode(t *testing.T) {
+	instance = nil
+	once = sync.Once{}
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	cfg := config.DefaultConfig()
+	cfg.DryRun = true
+	appState := InitialiseAppState(cfg)
+	if err := appState.LoadAccounts(auth.NewSessionStoreAt(filepath.Join(t.TempDir(), "accounts.json"))); err != nil {
+		t.Fatalf("Failed to load accounts: %v", err)
+	}
+	appState.AddAccount(&auth.Session{Token: "token", UserID: 1, Username: "Main"})
+
+	if mode := appState.GetClient().MutationMode(); mode != anilist.MutationsDryRun {
+		t.Fatalf("Expected the client to start in dry run mode, got %s", mode)
+	}
+	appState.SetMutationMode(anilist.MutationsReadOnly)
+	if !appState.ReadOnly() || appState.GetClient().MutationMode() != anilist.MutationsReadOnly {
+		t.Fatalf("Expected read-only mode to apply to the client")
+	}
+	appState.AddAccount(&auth.Session{Token: "alt_token", UserID: 2, Username: "Alt"})
+	if mode := appState.GetClient().MutationMode(); mode != anilist.MutationsReadOnly {
+		t.Errorf("Expected a new account's client to stay read-only, got %s", mode)
+	}
+}
+
+func TestStartControl(t *testing.T) {
+	instance = nil
+	once = sync.Once{}
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	cfg := config.DefaultConfig()
+	cfg.ControlConfig = config.ControlConfig{Enabled: true, Address: "127.0.0.1:0"}
+	appState := InitialiseAppState(cfg)
+	if err := appState.LoadAccounts(auth.NewSessionStoreAt(filepath.Join(t.TempDir(), "accounts.json"))); err != nil {
+		t.Fatalf("Failed to load accounts: %v", err)
+	}
+	appState.StartControl()
+	server := appState.GetControl()
+	if server == nil || server.Address() == "" || server.Token() == "" {
+		t.Fatalf("Expected the control API to be listening with a generated token")
+	}
+	defer server.Close()
+
+	backend := controlBackend{appState}
+	if status := backend.Status(); status.LoggedIn {
+		t.Errorf("Expected no account, got %+v", status)
+	}
+	appState.AddAccount(&auth.Session{Token: "token", UserID: 1, Username: "Main"})
+	if status := backend.Status(); !status.LoggedIn || status.Account != "Main" || status.Mode != "normal" {
+		t.Errorf("Expected the active account, got %+v", status)
+	}
+}
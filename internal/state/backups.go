@@ -0,0 +1,84 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/auth"
+	"github.com/StarTerrarium/hisame/internal/backup"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// StartBackups starts backing up every logged in account on the configured schedule, for the rest of the app's
+// life.  It does nothing if automatic backups are turned off.
+func (s *AppState) StartBackups() {
+	interval := s.config.BackupInterval()
+	if interval == 0 {
+		logrus.Info("Automatic backups are turned off")
+		return
+	}
+	dir, err := s.config.BackupDirectory()
+	if err != nil {
+		logrus.Errorf("Unable to locate backup directory; automatic backups disabled: %v", err)
+		return
+	}
+
+	scheduler := backup.NewScheduler(backup.Schedule{
+		Dir:        dir,
+		Interval:   interval,
+		KeepCount:  s.config.BackupConfig.KeepCount,
+		MaxAge:     s.config.BackupMaxAge(),
+		Passphrase: s.config.BackupPassphrase(),
+	}, s.backupAccounts)
+
+	s.mutex.Lock()
+	s.backups = scheduler
+	s.mutex.Unlock()
+	logrus.Infof("Backing up lists to %s every %s", dir, interval)
+	go scheduler.Run(context.Background())
+}
+
+// GetBackups returns the automatic backup scheduler, or nil if automatic backups are off.
+func (s *AppState) GetBackups() *backup.Scheduler {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.backups
+}
+
+// backupAccounts lists the logged in accounts for the backup scheduler.
+func (s *AppState) backupAccounts() []backup.Account {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var accounts []backup.Account
+	for _, name := range s.accounts.Names() {
+		session := s.accounts.Sessions[name]
+		if session.Expired(time.Now()) {
+			continue
+		}
+		accounts = append(accounts, backup.Account{Key: session.CacheKey(), Name: name, Create: s.backupCreator(session)})
+	}
+	return accounts
+}
+
+// backupCreator returns a function backing up an account's lists.  The active account is backed up through its
+// library, so a backup can still be made from the cache while offline.
+func (s *AppState) backupCreator(session *auth.Session) func(ctx context.Context) (*backup.Backup, error) {
+	return func(ctx context.Context) (*backup.Backup, error) {
+		task := s.tasks.Start(fmt.Sprintf("Backing up %s", session.Name()))
+		defer task.Finish()
+		if active := s.GetSession(); active != nil && active.UserID == session.UserID {
+			if lib := s.GetLibrary(); lib != nil {
+				return lib.Backup(ctx)
+			}
+		}
+		client := anilist.NewClient(session.Token)
+		viewer, err := client.Viewer(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return backup.Create(ctx, viewer, func(ctx context.Context, mediaType anilist.MediaType) (*anilist.MediaListCollection, error) {
+			return client.MediaListCollection(ctx, session.UserID, mediaType)
+		})
+	}
+}
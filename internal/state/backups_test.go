@@ -0,0 +1,34 @@
+package state
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/StarTerrarium/hisame/internal/auth"
+	"github.com/StarTerrarium/hisame/internal/config"
+)
+
+func TestBackupAccounts_SkipsExpiredSessions(t *testing.T) {
+	instance = nil
+	once = sync.Once{}
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	appState := InitialiseAppState(config.DefaultConfig())
+	if err := appState.LoadAccounts(auth.NewSessionStoreAt(filepath.Join(t.TempDir(), "accounts.json"))); err != nil {
+		t.Fatalf("Failed to load accounts: %v", err)
+	}
+	expiring := &auth.Session{Token: "old_token", UserID: 1, Username: "Old"}
+	appState.AddAccount(expiring)
+	appState.AddAccount(&auth.Session{Token: "new_token", UserID: 2, Username: "New"})
+	expiring.ExpiresAt = time.Now().Add(-time.Minute)
+
+	accounts := appState.backupAccounts()
+	if len(accounts) != 1 || accounts[0].Key != "2" || accounts[0].Name != "New" {
+		t.Fatalf("Expected only the unexpired account to be backed up, got %+v", accounts)
+	}
+	if appState.GetBackups() != nil {
+		t.Error("Expected no scheduler until backups are started")
+	}
+}
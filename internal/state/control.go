@@ -0,0 +1,79 @@
+package state
+
+import (
+	"context"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/control"
+	"github.com/sirupsen/logrus"
+)
+
+// StartControl starts the local control API, if it is turned on, for the rest of the app's life.
+func (s *AppState) StartControl() {
+	if !s.config.ControlConfig.Enabled {
+		return
+	}
+	token := s.config.ControlToken()
+	if token == "" {
+		path, err := control.DefaultTokenPath()
+		if err == nil {
+			token, err = control.LoadOrCreateToken(path)
+		}
+		if err != nil {
+			logrus.Errorf("Unable to create a control API token; the control API is disabled: %v", err)
+			return
+		}
+	}
+
+	server := control.NewServer(controlBackend{s}, token)
+	if err := server.Start(s.config.ControlConfig.Address); err != nil {
+		logrus.Errorf("Unable to start the control API: %v", err)
+		return
+	}
+	s.mutex.Lock()
+	s.control = server
+	s.mutex.Unlock()
+}
+
+// GetControl returns the control API server, or nil if it isn't running.
+func (s *AppState) GetControl() *control.Server {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.control
+}
+
+// controlBackend gives the control API the active account's library, so its edits share the GUI's lists and queue.
+type controlBackend struct {
+	s *AppState
+}
+
+func (b controlBackend) Status() control.Status {
+	status := control.Status{Mode: b.s.GetMutationMode().String()}
+	if session := b.s.GetSession(); session != nil {
+		status.LoggedIn = true
+		status.Account = session.Name()
+		status.UserID = session.UserID
+	}
+	if lib := b.s.GetLibrary(); lib != nil {
+		status.PendingEdits = len(lib.Queue().Pending())
+	}
+	return status
+}
+
+func (b controlBackend) Lists(ctx context.Context, mediaType anilist.MediaType) (*anilist.MediaListCollection, error) {
+	lib := b.s.GetLibrary()
+	if lib == nil {
+		return nil, control.ErrNotLoggedIn
+	}
+	if collection := lib.CachedListCollection(mediaType); collection != nil {
+		return collection, nil
+	}
+	return lib.RefreshListCollection(ctx, mediaType)
+}
+
+func (b controlBackend) SaveEntry(mediaType anilist.MediaType, entry *anilist.MediaListEntry, input anilist.SaveMediaListEntryInput) error {
+	lib := b.s.GetLibrary()
+	if lib == nil {
+		return control.ErrNotLoggedIn
+	}
+	return lib.SaveEntry(mediaType, entry, entry.MediaID, input)
+}
@@ -0,0 +1,221 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schemaVersion is bumped whenever the layout or format of the cached files changes.  An account's cache written
+// with a different version is discarded rather than migrated, as everything in it can be fetched again.
+const schemaVersion = 1
+
+// ErrNotCached is returned when the requested data has not been cached yet.
+var ErrNotCached = errors.New("not cached")
+
+// Store is the on-disk cache of a single account's AniList data.
+type Store struct {
+	mutex sync.RWMutex
+	dir   string
+}
+
+// envelope wraps every cached file with the schema version and the time the data was fetched.
+type envelope struct {
+	Version   int             `json:"version"`
+	FetchedAt time.Time       `json:"fetchedAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// DefaultDir returns the base directory of the cache.
+func DefaultDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user cache directory: %w", err)
+	}
+	return filepath.Join(cacheDir, "hisame"), nil
+}
+
+// Open opens the cache of the account with the given key under baseDir, creating it if needed.
+func Open(baseDir, accountKey string) (*Store, error) {
+	s := &Store{dir: filepath.Join(baseDir, "accounts", accountKey)}
+	if err := s.checkVersion(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Dir returns the account's cache directory.  Other subsystems keep their per account files here.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// checkVersion wipes the account's cache if it was written with a different schema version.
+func (s *Store) checkVersion() error {
+	versionPath := filepath.Join(s.dir, "version")
+	data, err := os.ReadFile(versionPath)
+	if err == nil && strings.TrimSpace(string(data)) == strconv.Itoa(schemaVersion) {
+		return nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read cache version: %w", err)
+	}
+
+	if err == nil {
+		logrus.Infof("Cache in %s has version %s, expected %d.  Clearing it.", s.dir, strings.TrimSpace(string(data)), schemaVersion)
+		for _, sub := range []string{"lists", "media", "viewer.json"} {
+			if err := os.RemoveAll(filepath.Join(s.dir, sub)); err != nil {
+				return fmt.Errorf("failed to clear outdated cache: %w", err)
+			}
+		}
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return os.WriteFile(versionPath, []byte(strconv.Itoa(schemaVersion)), 0o600)
+}
+
+// SaveListCollection caches all of the user's lists of one media type.
+func (s *Store) SaveListCollection(mediaType anilist.MediaType, collection *anilist.MediaListCollection) error {
+	return s.write(s.listPath(mediaType), collection)
+}
+
+// LoadListCollection returns the cached lists of one media type, and when they were fetched.
+func (s *Store) LoadListCollection(mediaType anilist.MediaType) (*anilist.MediaListCollection, time.Time, error) {
+	var collection anilist.MediaListCollection
+	fetchedAt, err := s.read(s.listPath(mediaType), &collection)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return &collection, fetchedAt, nil
+}
+
+// SaveMedia caches a media's metadata.
+func (s *Store) SaveMedia(media *anilist.Media) error {
+	return s.write(s.mediaPath(media.ID), media)
+}
+
+// LoadMedia returns the cached metadata of a media, and when it was fetched.
+func (s *Store) LoadMedia(id int) (*anilist.Media, time.Time, error) {
+	var media anilist.Media
+	fetchedAt, err := s.read(s.mediaPath(id), &media)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return &media, fetchedAt, nil
+}
+
+// SaveViewer caches the user's profile.
+func (s *Store) SaveViewer(viewer *anilist.Viewer) error {
+	return s.write(filepath.Join(s.dir, "viewer.json"), viewer)
+}
+
+// LoadViewer returns the cached profile of the user, and when it was fetched.
+func (s *Store) LoadViewer() (*anilist.Viewer, time.Time, error) {
+	var viewer anilist.Viewer
+	fetchedAt, err := s.read(filepath.Join(s.dir, "viewer.json"), &viewer)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return &viewer, fetchedAt, nil
+}
+
+// SaveSyncCursor records the newest updatedAt seen when syncing the lists of one media type.  Entries updated
+// before the cursor don't need fetching again.
+func (s *Store) SaveSyncCursor(mediaType anilist.MediaType, updatedAt int64) error {
+	return s.write(s.syncPath(mediaType), updatedAt)
+}
+
+// LoadSyncCursor returns the sync cursor of one media type, and when the lists were last synced.
+func (s *Store) LoadSyncCursor(mediaType anilist.MediaType) (int64, time.Time, error) {
+	var updatedAt int64
+	syncedAt, err := s.read(s.syncPath(mediaType), &updatedAt)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return updatedAt, syncedAt, nil
+}
+
+func (s *Store) listPath(mediaType anilist.MediaType) string {
+	return filepath.Join(s.dir, "lists", strings.ToLower(string(mediaType))+".json")
+}
+
+func (s *Store) syncPath(mediaType anilist.MediaType) string {
+	return filepath.Join(s.dir, "sync", strings.ToLower(string(mediaType))+".json")
+}
+
+func (s *Store) mediaPath(id int) string {
+	return filepath.Join(s.dir, "media", strconv.Itoa(id)+".json")
+}
+
+// write atomically replaces the file at path with the value wrapped in an envelope.
+func (s *Store) write(path string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache data: %w", err)
+	}
+	wrapped, err := json.Marshal(envelope{Version: schemaVersion, FetchedAt: time.Now(), Data: data})
+	if err != nil {
+		return fmt.Errorf("failed to encode cache data: %w", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return WriteFileAtomic(path, wrapped)
+}
+
+// read decodes the file at path into out, returning when it was written.
+func (s *Store) read(path string, out interface{}) (time.Time, error) {
+	s.mutex.RLock()
+	data, err := os.ReadFile(path)
+	s.mutex.RUnlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return time.Time{}, ErrNotCached
+		}
+		return time.Time{}, err
+	}
+
+	var wrapped envelope
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		logrus.Warnf("Ignoring corrupt cache file %s: %v", path, err)
+		return time.Time{}, ErrNotCached
+	}
+	if wrapped.Version != schemaVersion {
+		return time.Time{}, ErrNotCached
+	}
+	if err := json.Unmarshal(wrapped.Data, out); err != nil {
+		logrus.Warnf("Ignoring corrupt cache file %s: %v", path, err)
+		return time.Time{}, ErrNotCached
+	}
+	return wrapped.FetchedAt, nil
+}
+
+// WriteFileAtomic writes data to a temporary file and renames it over path, so a crash mid write never leaves a
+// truncated file behind.
+func WriteFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/StarTerrarium/hisame/internal/anilist"
+)
+
+func TestListCollection(t *testing.T) {
+	s, err := Open(t.TempDir(), "1")
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	if _, _, err := s.LoadListCollection(anilist.MediaTypeAnime); !errors.Is(err, ErrNotCached) {
+		t.Fatalf("Expected ErrNotCached before saving, got %v", err)
+	}
+
+	collection := &anilist.MediaListCollection{Lists: []*anilist.MediaListGroup{{
+		Name:    "Watching",
+		Status:  anilist.StatusCurrent,
+		Entries: []*anilist.MediaListEntry{{ID: 1, MediaID: 10, Progress: 4}},
+	}}}
+	before := time.Now()
+	if err := s.SaveListCollection(anilist.MediaTypeAnime, collection); err != nil {
+		t.Fatalf("Failed to save list collection: %v", err)
+	}
+
+	loaded, fetchedAt, err := s.LoadListCollection(anilist.MediaTypeAnime)
+	if err != nil {
+		t.Fatalf("Failed to load list collection: %v", err)
+	}
+	if fetchedAt.Before(before.Add(-time.Second)) {
+		t.Errorf("Expected fetchedAt to be around now, got %v", fetchedAt)
+	}
+	if len(loaded.Lists) != 1 || loaded.Lists[0].Entries[0].Progress != 4 {
+		t.Fatalf("Unexpected collection %+v", loaded)
+	}
+
+	// Lists of the other media type are stored separately
+	if _, _, err := s.LoadListCollection(anilist.MediaTypeManga); !errors.Is(err, ErrNotCached) {
+		t.Fatalf("Expected manga lists not to be cached, got %v", err)
+	}
+}
+
+func TestMediaAndViewer(t *testing.T) {
+	s, err := Open(t.TempDir(), "1")
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	if err := s.SaveMedia(&anilist.Media{ID: 5, Title: anilist.MediaTitle{English: "Five"}}); err != nil {
+		t.Fatalf("Failed to save media: %v", err)
+	}
+	media, _, err := s.LoadMedia(5)
+	if err != nil || media.Title.English != "Five" {
+		t.Fatalf("Expected cached media, got %+v, %v", media, err)
+	}
+
+	if err := s.SaveViewer(&anilist.Viewer{ID: 1, Name: "Tester"}); err != nil {
+		t.Fatalf("Failed to save viewer: %v", err)
+	}
+	viewer, _, err := s.LoadViewer()
+	if err != nil || viewer.Name != "Tester" {
+		t.Fatalf("Expected cached viewer, got %+v, %v", viewer, err)
+	}
+}
+
+func TestSyncCursor(t *testing.T) {
+	s, err := Open(t.TempDir(), "1")
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	if _, _, err := s.LoadSyncCursor(anilist.MediaTypeAnime); !errors.Is(err, ErrNotCached) {
+		t.Fatalf("Expected ErrNotCached before syncing, got %v", err)
+	}
+	if err := s.SaveSyncCursor(anilist.MediaTypeAnime, 1700000000); err != nil {
+		t.Fatalf("Failed to save sync cursor: %v", err)
+	}
+	cursor, syncedAt, err := s.LoadSyncCursor(anilist.MediaTypeAnime)
+	if err != nil || cursor != 1700000000 || syncedAt.IsZero() {
+		t.Errorf("Expected cursor 1700000000 with a sync time, got %d, %v, %v", cursor, syncedAt, err)
+	}
+}
+
+func TestAccountsAreSeparate(t *testing.T) {
+	base := t.TempDir()
+	main, _ := Open(base, "1")
+	alt, _ := Open(base, "2")
+
+	if err := main.SaveViewer(&anilist.Viewer{ID: 1, Name: "Main"}); err != nil {
+		t.Fatalf("Failed to save viewer: %v", err)
+	}
+	if _, _, err := alt.LoadViewer(); !errors.Is(err, ErrNotCached) {
+		t.Fatalf("Expected the alt account not to see the main account's data, got %v", err)
+	}
+}
+
+func TestOpen_ClearsOutdatedVersion(t *testing.T) {
+	base := t.TempDir()
+	s, _ := Open(base, "1")
+	if err := s.SaveViewer(&anilist.Viewer{ID: 1, Name: "Tester"}); err != nil {
+		t.Fatalf("Failed to save viewer: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(s.Dir(), "version"), []byte("0"), 0o600); err != nil {
+		t.Fatalf("Failed to write version: %v", err)
+	}
+
+	s, err := Open(base, "1")
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	if _, _, err := s.LoadViewer(); !errors.Is(err, ErrNotCached) {
+		t.Fatalf("Expected outdated cache to be cleared, got %v", err)
+	}
+}
+
+func TestRead_CorruptFile(t *testing.T) {
+	s, _ := Open(t.TempDir(), "1")
+	path := filepath.Join(s.Dir(), "viewer.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, _, err := s.LoadViewer(); !errors.Is(err, ErrNotCached) {
+		t.Fatalf("Expected a corrupt file to be treated as not cached, got %v", err)
+	}
+}
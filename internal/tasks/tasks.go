@@ -0,0 +1,123 @@
+package tasks
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status is the progress of a running task.
+type Status struct {
+	Name string
+	// Done and Total count the task's steps.  Total is 0 while the number of steps isn't known.
+	Done  int
+	Total int
+	// Started is when the task started.
+	Started time.Time
+}
+
+// Tracker follows the tasks running in the background, such as backups and restores, so their progress can be shown.
+type Tracker struct {
+	mutex       sync.Mutex
+	tasks       map[int]*Status
+	nextTask    int
+	subscribers map[int]func([]Status)
+	nextID      int
+}
+
+// NewTracker creates a tracker with no tasks running.
+func NewTracker() *Tracker {
+	return &Tracker{tasks: map[int]*Status{}, subscribers: map[int]func([]Status){}}
+}
+
+// Task is a running task, which reports its progress to the tracker that started it.
+type Task struct {
+	tracker *Tracker
+	id      int
+}
+
+// Start records a task as running until Finish is called on it.
+func (t *Tracker) Start(name string) *Task {
+	t.mutex.Lock()
+	id := t.nextTask
+	t.nextTask++
+	t.tasks[id] = &Status{Name: name, Started: time.Now()}
+	t.mutex.Unlock()
+	t.notify()
+	return &Task{tracker: t, id: id}
+}
+
+// Progress records how many of the task's steps are done, out of total.
+func (task *Task) Progress(done, total int) {
+	t := task.tracker
+	t.mutex.Lock()
+	status, ok := t.tasks[task.id]
+	if ok {
+		status.Done, status.Total = done, total
+	}
+	t.mutex.Unlock()
+	if ok {
+		t.notify()
+	}
+}
+
+// Finish records the task as no longer running.  Calling it again does nothing.
+func (task *Task) Finish() {
+	t := task.tracker
+	t.mutex.Lock()
+	_, ok := t.tasks[task.id]
+	delete(t.tasks, task.id)
+	t.mutex.Unlock()
+	if ok {
+		t.notify()
+	}
+}
+
+// Running returns the tasks running, oldest first.
+func (t *Tracker) Running() []Status {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.running()
+}
+
+func (t *Tracker) running() []Status {
+	ids := make([]int, 0, len(t.tasks))
+	for id := range t.tasks {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	running := make([]Status, len(ids))
+	for i, id := range ids {
+		running[i] = *t.tasks[id]
+	}
+	return running
+}
+
+// Subscribe registers a function called with the running tasks whenever a task starts, progresses or finishes.  The
+// returned function unsubscribes.
+func (t *Tracker) Subscribe(fn func([]Status)) func() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	id := t.nextID
+	t.nextID++
+	t.subscribers[id] = fn
+	return func() {
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		delete(t.subscribers, id)
+	}
+}
+
+func (t *Tracker) notify() {
+	t.mutex.Lock()
+	running := t.running()
+	subscribers := make([]func([]Status), 0, len(t.subscribers))
+	for _, fn := range t.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	t.mutex.Unlock()
+
+	for _, fn := range subscribers {
+		fn(running)
+	}
+}
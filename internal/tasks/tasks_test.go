@@ -0,0 +1,96 @@
+package tasks
+
+import (
+	"sync"
+	"testing"
+)
+
+func names(statuses []Status) []string {
+	var result []string
+	for _, status := range statuses {
+		result = append(result, status.Name)
+	}
+	return result
+}
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker()
+	backup := tracker.Start("Backing up")
+	restore := tracker.Start("Restoring")
+
+	running := tracker.Running()
+	if len(running) != 2 || running[0].Name != "Backing up" || running[1].Name != "Restoring" {
+		t.Fatalf("Expected both tasks running oldest first, got %v", names(running))
+	}
+
+	restore.Progress(3, 10)
+	running = tracker.Running()
+	if running[1].Done != 3 || running[1].Total != 10 {
+		t.Errorf("Expected progress 3/10, got %d/%d", running[1].Done, running[1].Total)
+	}
+	if running[0].Total != 0 {
+		t.Errorf("Expected the other task's progress to be unknown, got %d/%d", running[0].Done, running[0].Total)
+	}
+
+	backup.Finish()
+	backup.Finish()
+	if running := tracker.Running(); len(running) != 1 || running[0].Name != "Restoring" {
+		t.Errorf("Expected only the restore to be running, got %v", names(running))
+	}
+
+	restore.Finish()
+	restore.Progress(4, 10)
+	if running := tracker.Running(); len(running) != 0 {
+		t.Errorf("Expected nothing running, got %v", names(running))
+	}
+}
+
+func TestTracker_Subscribe(t *testing.T) {
+	tracker := NewTracker()
+	var updates [][]Status
+	unsubscribe := tracker.Subscribe(func(running []Status) {
+		updates = append(updates, running)
+	})
+
+	task := tracker.Start("Exporting")
+	task.Progress(1, 2)
+	task.Finish()
+	unsubscribe()
+	tracker.Start("Ignored")
+
+	if len(updates) != 3 {
+		t.Fatalf("Expected 3 updates, got %d", len(updates))
+	}
+	if len(updates[0]) != 1 || updates[0][0].Done != 0 {
+		t.Errorf("Expected the start to be reported, got %+v", updates[0])
+	}
+	if len(updates[1]) != 1 || updates[1][0].Done != 1 {
+		t.Errorf("Expected the progress to be reported, got %+v", updates[1])
+	}
+	if len(updates[2]) != 0 {
+		t.Errorf("Expected the finish to be reported, got %+v", updates[2])
+	}
+}
+
+func TestTracker_Concurrent(t *testing.T) {
+	tracker := NewTracker()
+	tracker.Subscribe(func([]Status) {})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			task := tracker.Start("Task")
+			for done := 1; done <= 5; done++ {
+				task.Progress(done, 5)
+			}
+			task.Finish()
+		}()
+	}
+	wg.Wait()
+
+	if running := tracker.Running(); len(running) != 0 {
+		t.Errorf("Expected every task to have finished, got %d running", len(running))
+	}
+}
@@ -1,19 +1,47 @@
 package ui
 
 import (
+	"fmt"
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/keymap"
+	"github.com/StarTerrarium/hisame/internal/library"
+	"github.com/StarTerrarium/hisame/internal/state"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
 )
 
 // AnimeListPage represents the page displaying the user's anime list.
 type AnimeListPage struct {
-	content fyne.CanvasObject
+	basePage
+
+	content     fyne.CanvasObject
+	tabs        *container.AppTabs
+	statusLabel *widget.Label
+	listArea    *fyne.Container
+
+	// Guards the lists and the state kept about them.  Updates from syncs and edits are passed to the UI goroutine
+	// with runOnUI, but it runs them straight away on drivers without an event queue.
+	mutex sync.Mutex
+	// Each list shown, its entries, how far down it was scrolled and the row selected, by list name.
+	lists    map[string]*widget.List
+	entries  map[string][]*anilist.MediaListEntry
+	offsets  map[string]float32
+	selected map[string]widget.ListItemID
+	tabNames map[*container.TabItem]string
+
+	work        pageWork
+	unsubscribe func()
 }
 
 // NewAnimeListPage creates a new instance of AnimeListPage.
 func NewAnimeListPage() *AnimeListPage {
-	alp := &AnimeListPage{}
+	alp := &AnimeListPage{offsets: map[string]float32{}, selected: map[string]widget.ListItemID{}}
 	alp.content = alp.buildContent()
 	return alp
 }
@@ -25,8 +53,259 @@ func (alp *AnimeListPage) Content() fyne.CanvasObject {
 
 // buildContent constructs the UI elements for the AnimeListPage.
 func (alp *AnimeListPage) buildContent() fyne.CanvasObject {
-	// Placeholder content
-	label := widget.NewLabel("Anime List Page - Content Coming Soon")
-	content := container.NewCenter(label)
-	return content
+	alp.statusLabel = widget.NewLabel("")
+	alp.listArea = container.NewStack(container.NewCenter(widget.NewLabel("Loading your anime list..")))
+	return container.NewBorder(nil, alp.statusLabel, nil, nil, alp.listArea)
+}
+
+// OnShow shows the cached list straight away if there is one, refreshes it from AniList, and shows edits as they
+// are made while the page is showing.
+func (alp *AnimeListPage) OnShow() {
+	lib := state.GetAppState().GetLibrary()
+	if lib == nil {
+		logrus.Warn("Anime list page shown without an active account")
+		return
+	}
+	ctx := alp.work.start()
+	window := getScreenManager().window
+	lib.ListCollection(ctx, anilist.MediaTypeAnime, func(update library.ListUpdate) {
+		runOnUI(window, func() {
+			// A refresh cut short by hiding the page isn't worth reporting.
+			if ctx.Err() != nil {
+				return
+			}
+			alp.handleUpdate(update)
+		})
+	})
+
+	// Show local edits and replayed mutations as they happen.
+	alp.unsubscribe = lib.SubscribeLists(func(mediaType anilist.MediaType) {
+		if mediaType != anilist.MediaTypeAnime {
+			return
+		}
+		if collection := lib.CachedListCollection(mediaType); collection != nil {
+			runOnUI(window, func() { alp.showCollection(collection) })
+		}
+	})
+	alp.mutex.Lock()
+	alp.restoreOffsets()
+	alp.mutex.Unlock()
+}
+
+// OnHide stops refreshing the list, and remembers how far down each list is scrolled.  The selected tab is kept.
+func (alp *AnimeListPage) OnHide() {
+	alp.mutex.Lock()
+	alp.saveOffsets()
+	alp.mutex.Unlock()
+	alp.work.stop()
+	if alp.unsubscribe != nil {
+		alp.unsubscribe()
+		alp.unsubscribe = nil
+	}
+}
+
+// saveOffsets remembers how far down each list is scrolled.  Must be called with the mutex held.
+func (alp *AnimeListPage) saveOffsets() {
+	for name, list := range alp.lists {
+		alp.offsets[name] = list.GetScrollOffset()
+	}
+}
+
+// restoreOffsets scrolls each list back to where it was.  Must be called with the mutex held.
+func (alp *AnimeListPage) restoreOffsets() {
+	for name, list := range alp.lists {
+		restoreListOffset(list, alp.offsets[name])
+	}
+}
+
+func (alp *AnimeListPage) handleUpdate(update library.ListUpdate) {
+	if update.Collection != nil {
+		alp.showCollection(update.Collection)
+	}
+
+	switch {
+	case update.Err == nil && update.Fresh:
+		alp.statusLabel.SetText("")
+	case update.Err == nil:
+		alp.statusLabel.SetText(fmt.Sprintf("Showing list cached %s.  Refreshing..", update.FetchedAt.Format(time.DateTime)))
+	case update.Collection == nil:
+		alp.mutex.Lock()
+		alp.listArea.Objects = []fyne.CanvasObject{container.NewCenter(widget.NewLabel("Unable to load your anime list.  Check your connection and try again."))}
+		alp.listArea.Refresh()
+		alp.mutex.Unlock()
+		alp.statusLabel.SetText(update.Err.Error())
+	case anilist.IsOffline(update.Err):
+		alp.statusLabel.SetText(fmt.Sprintf("Offline.  Showing list cached %s", update.FetchedAt.Format(time.DateTime)))
+	default:
+		alp.statusLabel.SetText(fmt.Sprintf("Unable to refresh list, showing list cached %s: %v", update.FetchedAt.Format(time.DateTime), update.Err))
+	}
+}
+
+// showCollection replaces the displayed lists, keeping the selected tab and scroll positions where possible.
+func (alp *AnimeListPage) showCollection(collection *anilist.MediaListCollection) {
+	alp.mutex.Lock()
+	defer alp.mutex.Unlock()
+
+	selected := ""
+	if alp.tabs != nil && alp.tabs.Selected() != nil {
+		selected = alp.tabs.Selected().Text
+	}
+	alp.saveOffsets()
+
+	titleLanguage := state.GetAppState().GetConfig().AnimeConfig.TitleLanguage
+	alp.tabs = container.NewAppTabs()
+	alp.lists = map[string]*widget.List{}
+	alp.entries = map[string][]*anilist.MediaListEntry{}
+	alp.tabNames = map[*container.TabItem]string{}
+	for _, list := range collection.Lists {
+		name := list.Name
+		view := newMediaListView(anilist.MediaTypeAnime, list.Entries, titleLanguage)
+		// Keep the row picked with the mouse or keyboard selected as the list is rebuilt.  This is done before
+		// OnSelected is set, as it runs straight away and would wait on the mutex held here.
+		if row, ok := alp.selected[name]; ok && len(list.Entries) > 0 {
+			view.Select(min(row, len(list.Entries)-1))
+		}
+		view.OnSelected = func(id widget.ListItemID) {
+			alp.mutex.Lock()
+			alp.selected[name] = id
+			alp.mutex.Unlock()
+			// Clicking a row focuses the list, which would then swallow the keyboard shortcuts.
+			getScreenManager().window.Canvas().Unfocus()
+		}
+		alp.lists[name] = view
+		alp.entries[name] = list.Entries
+		tab := container.NewTabItem(fmt.Sprintf("%s (%d)", name, len(list.Entries)), view)
+		alp.tabNames[tab] = name
+		alp.tabs.Append(tab)
+		if tab.Text == selected {
+			alp.tabs.Select(tab)
+		}
+	}
+	alp.restoreOffsets()
+	if len(collection.Lists) == 0 {
+		alp.listArea.Objects = []fyne.CanvasObject{container.NewCenter(widget.NewLabel("Your anime list is empty"))}
+	} else {
+		alp.listArea.Objects = []fyne.CanvasObject{alp.tabs}
+	}
+	alp.listArea.Refresh()
+}
+
+// handleAction moves through the rows of the list showing, or acts on the selected row's entry.
+func (alp *AnimeListPage) handleAction(action keymap.Action) {
+	alp.mutex.Lock()
+	if alp.tabs == nil || alp.tabs.Selected() == nil {
+		alp.mutex.Unlock()
+		return
+	}
+	name := alp.tabNames[alp.tabs.Selected()]
+	list, entries := alp.lists[name], alp.entries[name]
+	row, ok := alp.selected[name]
+	if !ok {
+		row = -1
+	}
+	// Moving the selection runs OnSelected, which takes the mutex.
+	alp.mutex.Unlock()
+
+	switch action {
+	case keymap.ActionNext:
+		moveSelection(list, row, 1, len(entries))
+		return
+	case keymap.ActionPrevious:
+		moveSelection(list, row, -1, len(entries))
+		return
+	}
+	if row < 0 || row >= len(entries) {
+		return
+	}
+	entry := entries[row]
+	switch action {
+	case keymap.ActionOpen:
+		getScreenManager().ShowPage(NewMediaPage(entry.MediaID))
+	case keymap.ActionEdit:
+		if !state.GetAppState().ReadOnly() {
+			showEntryEditor(getScreenManager().window, anilist.MediaTypeAnime, entry)
+		}
+	case keymap.ActionIncrement, keymap.ActionDecrement:
+		if !state.GetAppState().ReadOnly() {
+			changeProgress(anilist.MediaTypeAnime, entry, progressDelta(action))
+		}
+	}
+}
+
+// Size of the cover shown on each list row.  AniList covers are roughly 2:3.
+const (
+	coverThumbnailWidth  = 32
+	coverThumbnailHeight = 48
+)
+
+// newMediaListView creates a list widget showing one row per entry, with buttons to add progress and edit.
+func newMediaListView(mediaType anilist.MediaType, entries []*anilist.MediaListEntry, titleLanguage string) *widget.List {
+	return widget.NewList(
+		func() int {
+			return len(entries)
+		},
+		func() fyne.CanvasObject {
+			return container.NewHBox(
+				NewCoverImage(fyne.NewSize(coverThumbnailWidth, coverThumbnailHeight)),
+				widget.NewLabel("Title"),
+				layout.NewSpacer(),
+				widget.NewLabel("Progress"),
+				widget.NewButton("+1", nil),
+				widget.NewLabel("Score"),
+				widget.NewButtonWithIcon("", theme.DocumentCreateIcon(), nil),
+			)
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			entry := entries[id]
+			row := item.(*fyne.Container)
+			cover := ""
+			if entry.Media != nil {
+				cover = entry.Media.CoverImage.Medium
+			}
+			row.Objects[0].(*CoverImage).SetURL(cover)
+			row.Objects[1].(*widget.Label).SetText(entryTitle(entry, titleLanguage))
+			row.Objects[3].(*widget.Label).SetText(entryProgress(entry))
+			incrementButton := row.Objects[4].(*widget.Button)
+			incrementButton.OnTapped = func() {
+				changeProgress(mediaType, entry, 1)
+			}
+			row.Objects[5].(*widget.Label).SetText(fmt.Sprintf("%g", entry.Score))
+			editButton := row.Objects[6].(*widget.Button)
+			editButton.OnTapped = func() {
+				showEntryEditor(getScreenManager().window, mediaType, entry)
+			}
+			enableMutationControls(incrementButton, editButton)
+			if total := entryTotal(entry); total != nil && *total > 0 && entry.Progress >= *total {
+				incrementButton.Disable()
+			}
+		},
+	)
+}
+
+// entryTitle returns the title of the entry's media in the user's preferred language.
+func entryTitle(entry *anilist.MediaListEntry, titleLanguage string) string {
+	if entry.Media == nil {
+		return fmt.Sprintf("Media %d", entry.MediaID)
+	}
+	return entry.Media.Title.Preferred(titleLanguage)
+}
+
+// entryTotal returns the number of episodes or chapters of the entry's media, when known.
+func entryTotal(entry *anilist.MediaListEntry) *int {
+	if entry.Media == nil {
+		return nil
+	}
+	if entry.Media.Type == anilist.MediaTypeManga {
+		return entry.Media.Chapters
+	}
+	return entry.Media.Episodes
+}
+
+// entryProgress formats the entry's progress against the total episodes or chapters, when known.
+func entryProgress(entry *anilist.MediaListEntry) string {
+	total := entryTotal(entry)
+	if total == nil {
+		return fmt.Sprintf("%d/?", entry.Progress)
+	}
+	return fmt.Sprintf("%d/%d", entry.Progress, *total)
 }
@@ -0,0 +1,206 @@
+package ui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"github.com/StarTerrarium/hisame/internal/audit"
+	"github.com/StarTerrarium/hisame/internal/state"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+// allAccounts is the account filter option showing every account's records.
+const allAccounts = "All accounts"
+
+// auditPeriods are the choices of how far back to show records.  A zero age shows everything.
+var auditPeriods = []struct {
+	label string
+	age   time.Duration
+}{
+	{"All time", 0},
+	{"Last 24 hours", 24 * time.Hour},
+	{"Last 7 days", 7 * 24 * time.Hour},
+	{"Last 30 days", 30 * 24 * time.Hour},
+}
+
+// auditActionLabels describes each kind of mutation.
+var auditActionLabels = map[audit.Action]string{
+	audit.ActionSave:   "Saved",
+	audit.ActionDelete: "Deleted",
+}
+
+// AuditPage browses the log of every mutation Hisame has sent to AniList.
+type AuditPage struct {
+	basePage
+
+	content fyne.CanvasObject
+
+	accountSelect *widget.Select
+	periodSelect  *widget.Select
+	filterEntry   *widget.Entry
+	failedCheck   *widget.Check
+	statusLabel   *widget.Label
+	list          *widget.List
+
+	records     []audit.Record
+	shown       []audit.Record
+	unsubscribe func()
+
+	listOffset float32
+}
+
+// NewAuditPage creates a new instance of AuditPage.
+func NewAuditPage() *AuditPage {
+	ap := &AuditPage{}
+	ap.content = ap.buildContent()
+	return ap
+}
+
+// Content returns the root content object of the AuditPage.
+func (ap *AuditPage) Content() fyne.CanvasObject {
+	return ap.content
+}
+
+func (ap *AuditPage) buildContent() fyne.CanvasObject {
+	names, _ := state.GetAppState().GetAccountNames()
+	ap.accountSelect = widget.NewSelect(append([]string{allAccounts}, names...), func(string) { ap.showRecords() })
+	periodOptions := make([]string, len(auditPeriods))
+	for i, period := range auditPeriods {
+		periodOptions[i] = period.label
+	}
+	ap.periodSelect = widget.NewSelect(periodOptions, func(string) { ap.showRecords() })
+	ap.filterEntry = widget.NewEntry()
+	ap.filterEntry.SetPlaceHolder("Filter by title, media ID or field")
+	ap.filterEntry.OnChanged = func(string) { ap.showRecords() }
+	ap.failedCheck = widget.NewCheck("Failed only", func(bool) { ap.showRecords() })
+	ap.statusLabel = widget.NewLabel("")
+	ap.statusLabel.Wrapping = fyne.TextWrapWord
+
+	ap.list = widget.NewList(
+		func() int { return len(ap.shown) },
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.Truncation = fyne.TextTruncateEllipsis
+			return label
+		},
+		func(id widget.ListItemID, object fyne.CanvasObject) {
+			object.(*widget.Label).SetText(describeAuditRecord(ap.shown[id]))
+		},
+	)
+
+	ap.accountSelect.SetSelectedIndex(0)
+	ap.periodSelect.SetSelectedIndex(0)
+	filters := container.NewBorder(nil, nil, container.NewHBox(ap.accountSelect, ap.periodSelect), ap.failedCheck, ap.filterEntry)
+	return container.NewBorder(container.NewVBox(filters, ap.statusLabel), nil, nil, nil, ap.list)
+}
+
+// OnShow reads the log, and adds records to the page as they are written while it is showing.
+func (ap *AuditPage) OnShow() {
+	ap.load()
+	restoreListOffset(ap.list, ap.listOffset)
+}
+
+// OnHide stops adding records, and remembers how far down they are scrolled.  The filters keep their values.
+func (ap *AuditPage) OnHide() {
+	ap.listOffset = ap.list.GetScrollOffset()
+	if ap.unsubscribe != nil {
+		ap.unsubscribe()
+		ap.unsubscribe = nil
+	}
+}
+
+func (ap *AuditPage) load() {
+	log := state.GetAppState().GetAuditLog()
+	if log == nil {
+		ap.statusLabel.SetText("The audit log couldn't be located, so changes aren't being recorded.")
+		return
+	}
+	ap.statusLabel.SetText("")
+	records, err := log.Read()
+	if err != nil {
+		logrus.Errorf("Error reading audit log: %v", err)
+		ap.statusLabel.SetText(fmt.Sprintf("Couldn't read the whole audit log: %v", err))
+	}
+	ap.records = records
+	ap.showRecords()
+
+	// Records are added from the goroutine of the request that made them.
+	window := getScreenManager().window
+	ap.unsubscribe = log.Subscribe(func(record audit.Record) {
+		runOnUI(window, func() {
+			ap.records = append(ap.records, record)
+			ap.showRecords()
+		})
+	})
+}
+
+// filter returns the filter chosen on the page.
+func (ap *AuditPage) filter() audit.Filter {
+	filter := audit.Filter{Text: ap.filterEntry.Text, FailedOnly: ap.failedCheck.Checked}
+	if ap.accountSelect.Selected != allAccounts {
+		filter.Account = ap.accountSelect.Selected
+	}
+	if age := auditPeriods[max(ap.periodSelect.SelectedIndex(), 0)].age; age > 0 {
+		filter.Since = time.Now().Add(-age)
+	}
+	return filter
+}
+
+// showRecords lists the records matching the filter, newest first.
+func (ap *AuditPage) showRecords() {
+	if ap.list == nil || ap.periodSelect.SelectedIndex() < 0 {
+		return
+	}
+	filter := ap.filter()
+	var shown []audit.Record
+	for i := len(ap.records) - 1; i >= 0; i-- {
+		if filter.Match(ap.records[i]) {
+			shown = append(shown, ap.records[i])
+		}
+	}
+	ap.shown = shown
+	ap.list.Refresh()
+
+	switch {
+	case len(ap.records) == 0:
+		ap.statusLabel.SetText("Hisame hasn't changed anything on AniList yet.")
+	case len(shown) != len(ap.records):
+		ap.statusLabel.SetText(fmt.Sprintf("%d of %d changes match.", len(shown), len(ap.records)))
+	default:
+		ap.statusLabel.SetText(fmt.Sprintf("%d changes made by Hisame.", len(ap.records)))
+	}
+}
+
+// describeAuditRecord summarises a record on one line.
+func describeAuditRecord(record audit.Record) string {
+	title := record.Title
+	if title == "" {
+		title = fmt.Sprintf("media %d", record.MediaID)
+		if record.MediaID == 0 {
+			title = fmt.Sprintf("entry %d", record.EntryID)
+		}
+	}
+	text := fmt.Sprintf("%s  %s  %s %s", record.Time.Local().Format("2 Jan 2006 15:04"), record.Account, auditActionLabels[record.Action], title)
+
+	var changes []string
+	for _, change := range record.Changes {
+		if record.BeforeKnown {
+			changes = append(changes, fmt.Sprintf("%s %s → %s", change.Field, change.Before, change.After))
+		} else {
+			changes = append(changes, fmt.Sprintf("%s → %s", change.Field, change.After))
+		}
+	}
+	if len(changes) > 0 {
+		text += " (" + strings.Join(changes, "; ") + ")"
+	}
+	if record.DryRun {
+		text += "  Dry run, not sent"
+	}
+	if !record.Succeeded() {
+		text += "  Failed: " + record.Error
+	}
+	return text
+}
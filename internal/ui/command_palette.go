@@ -0,0 +1,293 @@
+package ui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/palette"
+	"github.com/StarTerrarium/hisame/internal/state"
+	"github.com/sirupsen/logrus"
+)
+
+// paletteResultCount is how many commands the palette lists at once.
+const paletteResultCount = 50
+
+// Size of the command palette.
+const (
+	paletteWidth  = 560
+	paletteHeight = 420
+)
+
+// Commands returns the commands the command palette offers, for features to register their own into.
+func (sm *ScreenManager) Commands() *palette.Registry {
+	return sm.commands
+}
+
+// registerDefaultCommands registers the pages, actions and list entries the palette offers out of the box.
+func (sm *ScreenManager) registerDefaultCommands() {
+	sm.commands.Register(
+		palette.Command{Title: "Go to Anime list", Detail: "Page", Run: sm.showAnimeList},
+		palette.Command{Title: "Go to Search", Detail: "Page", Run: func() { sm.showSearch() }},
+		palette.Command{Title: "Go to Settings", Detail: "Page", Run: func() { sm.showSettings() }},
+		palette.Command{Title: "Go to Audit log", Detail: "Page", Run: func() {
+			sm.ShowCachedPage(auditPageKey, func() Page { return NewAuditPage() })
+		}},
+		palette.Command{Title: "Go to Backup history", Detail: "Page", Run: func() { sm.ShowPage(NewHistoryPage()) }},
+		palette.Command{Title: "Sync now", Detail: "Action", Run: func() {
+			if lib := state.GetAppState().GetLibrary(); lib != nil {
+				lib.Syncer().SyncNow()
+			}
+		}},
+		palette.Command{Title: "Export backup", Detail: "Action", Run: func() { sm.showSettings().export() }},
+		palette.Command{Title: "Back up now", Detail: "Action", Run: func() {
+			if scheduler := state.GetAppState().GetBackups(); scheduler != nil {
+				scheduler.BackupNow()
+			} else {
+				logrus.Warn("Automatic backups aren't running, so there's nothing to back up now")
+			}
+		}},
+		palette.Command{Title: "Switch account", Detail: "Action", Options: sm.accountCommands},
+		palette.Command{Title: "Keyboard shortcuts", Detail: "Help", Run: func() { showKeymapHelp(sm.window, sm.keymap) }},
+	)
+	sm.commands.RegisterSource(entryCommands)
+}
+
+// accountCommands offers the other logged in accounts to switch to, and logging in to another.
+func (sm *ScreenManager) accountCommands() []palette.Command {
+	names, active := state.GetAppState().GetAccountNames()
+	var commands []palette.Command
+	for _, name := range names {
+		if name == active {
+			continue
+		}
+		name := name
+		commands = append(commands, palette.Command{Title: name, Detail: "Switch to this account", Run: func() { sm.SwitchAccount(name) }})
+	}
+	return append(commands, palette.Command{Title: addAccountOption, Run: sm.ShowAddAccount})
+}
+
+// entryCommands offers each entry in the cached lists of the active account.
+func entryCommands() []palette.Command {
+	lib := state.GetAppState().GetLibrary()
+	if lib == nil {
+		return nil
+	}
+	titleLanguage := state.GetAppState().GetConfig().AnimeConfig.TitleLanguage
+	var commands []palette.Command
+	for _, list := range []struct {
+		label     string
+		mediaType anilist.MediaType
+	}{{"Anime", anilist.MediaTypeAnime}, {"Manga", anilist.MediaTypeManga}} {
+		mediaType := list.mediaType
+		collection := lib.CachedListCollection(mediaType)
+		if collection == nil {
+			continue
+		}
+		for _, entry := range collection.Entries() {
+			entry := entry
+			commands = append(commands, palette.Command{
+				Title:   entryTitle(entry, titleLanguage),
+				Detail:  fmt.Sprintf("%s · %s · %s", list.label, entry.Status, entryProgress(entry)),
+				Options: func() []palette.Command { return entryActions(mediaType, entry) },
+			})
+		}
+	}
+	return commands
+}
+
+// entryActions are the quick actions offered once an entry is picked.  Those that change the entry are left out in
+// read-only mode.
+func entryActions(mediaType anilist.MediaType, entry *anilist.MediaListEntry) []palette.Command {
+	var commands []palette.Command
+	if !state.GetAppState().ReadOnly() {
+		commands = append(commands,
+			palette.Command{Title: "+1 progress", Detail: entryProgress(entry), Run: func() { changeProgress(mediaType, entry, 1) }},
+			palette.Command{Title: "Set status", Detail: string(entry.Status), Options: func() []palette.Command {
+				statuses := make([]palette.Command, 0, len(listStatuses))
+				for _, status := range listStatuses {
+					status := status
+					detail := ""
+					if status == entry.Status {
+						detail = "Current status"
+					}
+					statuses = append(statuses, palette.Command{Title: string(status), Detail: detail, Run: func() { setStatus(mediaType, entry, status) }})
+				}
+				return statuses
+			}},
+		)
+	}
+	commands = append(commands, palette.Command{Title: "Open details", Run: func() {
+		getScreenManager().ShowPage(NewMediaPage(entry.MediaID))
+	}})
+	if !state.GetAppState().ReadOnly() {
+		commands = append(commands, palette.Command{Title: "Edit…", Run: func() {
+			showEntryEditor(getScreenManager().window, mediaType, entry)
+		}})
+	}
+	return commands
+}
+
+// paletteLevel is one step of the palette: the commands searched first, or the options of a command picked.
+type paletteLevel struct {
+	title   string
+	options []palette.Command
+}
+
+// CommandPalette searches commands as the user types, and runs the one picked.  Picking a command with options
+// lists them instead, and Backspace in an empty search goes back.
+type CommandPalette struct {
+	registry *palette.Registry
+	canvas   fyne.Canvas
+	popUp    *widget.PopUp
+
+	titleLabel  *widget.Label
+	searchEntry *paletteEntry
+	list        *widget.List
+
+	// The commands picked so far, each listing its options.  The registry is searched when it is empty.
+	levels   []paletteLevel
+	results  []palette.Command
+	selected widget.ListItemID
+	// Set while the keyboard moves the selection, so the command isn't run as a click would run it.
+	selecting bool
+}
+
+// showCommandPalette opens the command palette over the window.
+func showCommandPalette(window fyne.Window, registry *palette.Registry) {
+	cp := &CommandPalette{registry: registry, canvas: window.Canvas(), selected: -1}
+	cp.popUp = widget.NewModalPopUp(cp.buildContent(), cp.canvas)
+	cp.popUp.Resize(fyne.NewSize(paletteWidth, paletteHeight))
+	cp.update()
+	cp.popUp.Show()
+	cp.canvas.Focus(cp.searchEntry)
+}
+
+func (cp *CommandPalette) buildContent() fyne.CanvasObject {
+	cp.titleLabel = widget.NewLabel("")
+	cp.titleLabel.TextStyle = fyne.TextStyle{Bold: true}
+	cp.searchEntry = newPaletteEntry(cp)
+	cp.searchEntry.SetPlaceHolder("Type a command, page or title")
+	cp.searchEntry.OnChanged = func(string) { cp.update() }
+	cp.searchEntry.OnSubmitted = func(string) { cp.pick(cp.selected) }
+
+	cp.list = widget.NewList(
+		func() int {
+			return len(cp.results)
+		},
+		func() fyne.CanvasObject {
+			return container.NewHBox(widget.NewLabel("Title"), layout.NewSpacer(), widget.NewLabel("Detail"))
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			command := cp.results[id]
+			row := item.(*fyne.Container)
+			title := command.Title
+			if command.Options != nil {
+				title += " ›"
+			}
+			row.Objects[0].(*widget.Label).SetText(title)
+			row.Objects[2].(*widget.Label).SetText(command.Detail)
+		},
+	)
+	cp.list.OnSelected = func(id widget.ListItemID) {
+		cp.selected = id
+		if !cp.selecting {
+			cp.pick(id)
+		}
+	}
+
+	header := container.NewVBox(cp.titleLabel, cp.searchEntry)
+	return container.NewBorder(header, nil, nil, nil, cp.list)
+}
+
+// update lists the commands matching the search, selecting the best match.
+func (cp *CommandPalette) update() {
+	query := cp.searchEntry.Text
+	if len(cp.levels) == 0 {
+		cp.titleLabel.SetText("Command palette")
+		cp.results = cp.registry.Search(query, paletteResultCount)
+	} else {
+		level := cp.levels[len(cp.levels)-1]
+		cp.titleLabel.SetText(level.title)
+		cp.results = palette.Search(level.options, query, paletteResultCount)
+	}
+	cp.list.UnselectAll()
+	cp.list.Refresh()
+	cp.selected = -1
+	cp.move(1)
+}
+
+// move selects the command delta rows from the selected one.
+func (cp *CommandPalette) move(delta int) {
+	cp.selecting = true
+	moveSelection(cp.list, cp.selected, delta, len(cp.results))
+	cp.selecting = false
+}
+
+// pick runs the command at id, or lists its options.
+func (cp *CommandPalette) pick(id widget.ListItemID) {
+	if id < 0 || id >= len(cp.results) {
+		return
+	}
+	command := cp.results[id]
+	if command.Options != nil {
+		cp.levels = append(cp.levels, paletteLevel{title: command.Title, options: command.Options()})
+		cp.searchEntry.SetText("")
+		cp.update()
+		// Clicking the command moved the focus to the list.
+		cp.canvas.Focus(cp.searchEntry)
+		return
+	}
+	cp.close()
+	if command.Run != nil {
+		logrus.Debugf("Running command %q from the palette", command.Title)
+		command.Run()
+	}
+}
+
+// back returns to the commands listed before the last was picked, returning false if there were none.
+func (cp *CommandPalette) back() bool {
+	if len(cp.levels) == 0 {
+		return false
+	}
+	cp.levels = cp.levels[:len(cp.levels)-1]
+	cp.update()
+	return true
+}
+
+func (cp *CommandPalette) close() {
+	cp.popUp.Hide()
+}
+
+// paletteEntry is the palette's search box, which also takes the keys for moving through and leaving the palette.
+type paletteEntry struct {
+	widget.Entry
+	palette *CommandPalette
+}
+
+func newPaletteEntry(cp *CommandPalette) *paletteEntry {
+	entry := &paletteEntry{palette: cp}
+	entry.ExtendBaseWidget(entry)
+	return entry
+}
+
+// TypedKey moves through the commands with the arrow keys and closes the palette with Escape.  Other keys edit the
+// search.
+func (e *paletteEntry) TypedKey(event *fyne.KeyEvent) {
+	switch event.Name {
+	case fyne.KeyDown:
+		e.palette.move(1)
+	case fyne.KeyUp:
+		e.palette.move(-1)
+	case fyne.KeyEscape:
+		e.palette.close()
+	case fyne.KeyBackspace:
+		if e.Text != "" || !e.palette.back() {
+			e.Entry.TypedKey(event)
+		}
+	default:
+		e.Entry.TypedKey(event)
+	}
+}
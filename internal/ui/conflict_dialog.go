@@ -0,0 +1,100 @@
+package ui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/StarTerrarium/hisame/internal/library"
+	"github.com/StarTerrarium/hisame/internal/state"
+)
+
+// resolveConflict asks the user what to do about an edit that conflicts with a change made elsewhere.  It is
+// called from the replay goroutine, and blocks it until the user chooses.
+func (sm *ScreenManager) resolveConflict(conflict *library.Conflict) library.ConflictResolution {
+	choice := make(chan library.ConflictResolution, 1)
+	// The queue asks from its own goroutine, and waits there for the answer.
+	runOnUI(sm.window, func() {
+		showConflictDialog(sm.window, conflict, func(resolution library.ConflictResolution) {
+			choice <- resolution
+		})
+	})
+	return <-choice
+}
+
+// showConflictDialog shows the differing fields side by side.  Each field's checkbox keeps the local value when
+// merging.  Closing the dialog leaves the conflict to be resolved later, from the pending changes in the status bar.
+func showConflictDialog(window fyne.Window, conflict *library.Conflict, onChosen func(library.ConflictResolution)) {
+	m := conflict.Mutation
+	titleLanguage := state.GetAppState().GetConfig().AnimeConfig.TitleLanguage
+	title := fmt.Sprintf("Media %d", m.MediaID)
+	if lib := state.GetAppState().GetLibrary(); lib != nil && lib.Store() != nil {
+		if media, _, err := lib.Store().LoadMedia(m.MediaID); err == nil {
+			title = media.Title.Preferred(titleLanguage)
+		}
+	}
+
+	var message string
+	switch {
+	case m.Kind == library.MutationDelete:
+		message = fmt.Sprintf("%s was changed on AniList after you deleted it here.", title)
+	case conflict.Server == nil:
+		message = fmt.Sprintf("%s was removed from your list on AniList after you edited it here.", title)
+	default:
+		message = fmt.Sprintf("%s was changed on AniList after you edited it here.", title)
+	}
+
+	grid := container.NewGridWithColumns(3,
+		widget.NewLabelWithStyle("Keep mine", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		widget.NewLabelWithStyle("Mine", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		widget.NewLabelWithStyle("Theirs", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+	)
+	checks := map[string]*widget.Check{}
+	for _, diff := range conflict.Diffs() {
+		check := widget.NewCheck(diff.Field, nil)
+		check.SetChecked(true)
+		checks[diff.Field] = check
+		grid.Add(check)
+		grid.Add(widget.NewLabel(diff.Input))
+		grid.Add(widget.NewLabel(diff.Entry))
+	}
+
+	chosen := false
+	var d dialog.Dialog
+	choose := func(resolution library.ConflictResolution) func() {
+		return func() {
+			chosen = true
+			d.Hide()
+			onChosen(resolution)
+		}
+	}
+	mergeButton := widget.NewButton("Merge selected", func() {
+		var mine []string
+		for field, check := range checks {
+			if check.Checked {
+				mine = append(mine, field)
+			}
+		}
+		choose(library.ConflictResolution{Resolution: library.MergeFields, MineFields: mine})()
+	})
+	if len(checks) == 0 {
+		mergeButton.Disable()
+	}
+	buttons := container.NewHBox(
+		widget.NewButton("Keep mine", choose(library.ConflictResolution{Resolution: library.KeepMine})),
+		widget.NewButton("Keep theirs", choose(library.ConflictResolution{Resolution: library.KeepTheirs})),
+		mergeButton,
+		widget.NewButton("Decide later", choose(library.ConflictResolution{Resolution: library.ResolveLater})),
+	)
+
+	content := container.NewVBox(widget.NewLabel(message), grid, buttons)
+	d = dialog.NewCustomWithoutButtons("Edit conflict", content, window)
+	d.SetOnClosed(func() {
+		if !chosen {
+			chosen = true
+			onChosen(library.ConflictResolution{Resolution: library.ResolveLater})
+		}
+	})
+	d.Show()
+}
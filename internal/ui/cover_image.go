@@ -0,0 +1,87 @@
+package ui
+
+import (
+	"context"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/StarTerrarium/hisame/internal/state"
+	"github.com/sirupsen/logrus"
+	"image"
+	"sync"
+)
+
+// CoverImage shows a cover or banner from the image cache, with a placeholder until it has loaded.  It can be
+// reused for different images, as list rows are, and ignores images that finish loading after it has moved on.
+type CoverImage struct {
+	widget.BaseWidget
+
+	image *canvas.Image
+	mutex sync.Mutex
+	url   string
+}
+
+// NewCoverImage creates an empty CoverImage of the given size.
+func NewCoverImage(size fyne.Size) *CoverImage {
+	ci := &CoverImage{image: canvas.NewImageFromResource(theme.MediaPhotoIcon())}
+	ci.image.FillMode = canvas.ImageFillContain
+	ci.image.SetMinSize(size)
+	ci.ExtendBaseWidget(ci)
+	return ci
+}
+
+// CreateRenderer is a private method to Fyne which links this widget to its renderer.
+func (ci *CoverImage) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(ci.image)
+}
+
+// SetURL shows the image at url, loading it in the background if it isn't already in memory.
+func (ci *CoverImage) SetURL(url string) {
+	ci.mutex.Lock()
+	if url == ci.url {
+		ci.mutex.Unlock()
+		return
+	}
+	ci.url = url
+	ci.mutex.Unlock()
+
+	cache := state.GetAppState().GetImageCache()
+	if url == "" || cache == nil {
+		ci.showPlaceholder()
+		return
+	}
+	if img, ok := cache.Cached(url); ok {
+		ci.show(img)
+		return
+	}
+
+	ci.showPlaceholder()
+	go func() {
+		img, err := cache.Load(context.Background(), url)
+		if err != nil {
+			logrus.Debugf("Error loading image: %v", err)
+			return
+		}
+		runOnUI(getScreenManager().window, func() {
+			ci.mutex.Lock()
+			current := ci.url == url
+			ci.mutex.Unlock()
+			if current {
+				ci.show(img)
+			}
+		})
+	}()
+}
+
+func (ci *CoverImage) show(img image.Image) {
+	ci.image.Resource = nil
+	ci.image.Image = img
+	ci.image.Refresh()
+}
+
+func (ci *CoverImage) showPlaceholder() {
+	ci.image.Image = nil
+	ci.image.Resource = theme.MediaPhotoIcon()
+	ci.image.Refresh()
+}
@@ -0,0 +1,199 @@
+package ui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/library"
+	"github.com/StarTerrarium/hisame/internal/state"
+	"github.com/sirupsen/logrus"
+	"strconv"
+)
+
+// listStatuses are the statuses an entry can be given, in the order AniList shows them.
+var listStatuses = []anilist.MediaListStatus{
+	anilist.StatusCurrent,
+	anilist.StatusPlanning,
+	anilist.StatusCompleted,
+	anilist.StatusRepeating,
+	anilist.StatusPaused,
+	anilist.StatusDropped,
+}
+
+// showEntryEditor shows a dialog for editing a list entry.  Changes are queued, so they are saved even while
+// offline.  An entry without an ID adds its media to the list.
+func showEntryEditor(window fyne.Window, mediaType anilist.MediaType, entry *anilist.MediaListEntry) {
+	lib := state.GetAppState().GetLibrary()
+	if lib == nil {
+		return
+	}
+	isNew := entry.ID == 0
+
+	statusOptions := make([]string, len(listStatuses))
+	for i, status := range listStatuses {
+		statusOptions[i] = string(status)
+	}
+	statusSelect := widget.NewSelect(statusOptions, nil)
+	statusSelect.SetSelected(string(entry.Status))
+
+	progressEntry := widget.NewEntry()
+	progressEntry.SetText(strconv.Itoa(entry.Progress))
+	scoreEntry := widget.NewEntry()
+	scoreEntry.SetText(strconv.FormatFloat(entry.Score, 'g', -1, 64))
+	notesEntry := widget.NewMultiLineEntry()
+	notesEntry.SetText(entry.Notes)
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Status", statusSelect),
+		widget.NewFormItem("Progress", progressEntry),
+		widget.NewFormItem("Score", scoreEntry),
+		widget.NewFormItem("Notes", notesEntry),
+	}
+
+	title := entryTitle(entry, state.GetAppState().GetConfig().AnimeConfig.TitleLanguage)
+	var form dialog.Dialog
+	onSubmit := func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		progress, err := strconv.Atoi(progressEntry.Text)
+		if err != nil || progress < 0 {
+			dialog.ShowError(fmt.Errorf("progress must be a whole number"), window)
+			return
+		}
+		score, err := strconv.ParseFloat(scoreEntry.Text, 64)
+		if err != nil || score < 0 {
+			dialog.ShowError(fmt.Errorf("score must be a number"), window)
+			return
+		}
+
+		var input anilist.SaveMediaListEntryInput
+		if status := anilist.MediaListStatus(statusSelect.Selected); status != entry.Status || isNew {
+			input.Status = &status
+		}
+		if progress != entry.Progress {
+			input.Progress = &progress
+		}
+		if score != entry.Score {
+			input.Score = &score
+		}
+		if notes := notesEntry.Text; notes != entry.Notes {
+			input.Notes = &notes
+		}
+		if input.IsEmpty() {
+			return
+		}
+		previous := entry
+		if isNew {
+			previous = nil
+		}
+		if err := lib.SaveEntry(mediaType, previous, entry.MediaID, input); err != nil {
+			logrus.Errorf("Error queueing edit to %s: %v", title, err)
+		}
+	}
+	confirm := "Add"
+	if !isNew {
+		confirm = "Save"
+		removeButton := widget.NewButton("Remove from list", func() {
+			form.Hide()
+			confirmDeleteEntry(window, mediaType, entry)
+		})
+		removeButton.Importance = widget.DangerImportance
+		items = append(items, widget.NewFormItem("", removeButton))
+	}
+	form = dialog.NewForm(title, confirm, "Cancel", items, onSubmit, window)
+	form.Resize(fyne.NewSize(480, 0))
+	form.Show()
+}
+
+// confirmDeleteEntry asks before removing an entry from the user's list.
+func confirmDeleteEntry(window fyne.Window, mediaType anilist.MediaType, entry *anilist.MediaListEntry) {
+	lib := state.GetAppState().GetLibrary()
+	if lib == nil {
+		return
+	}
+	title := entryTitle(entry, state.GetAppState().GetConfig().AnimeConfig.TitleLanguage)
+	dialog.ShowConfirm("Remove from list", fmt.Sprintf("Remove %s from your list?", title), func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		if err := lib.DeleteEntry(mediaType, entry); err != nil {
+			logrus.Errorf("Error queueing removal of %s: %v", title, err)
+		}
+	}, window)
+}
+
+// changeProgress adds delta to an entry's progress, which can't go below zero or past the episode or chapter total.
+func changeProgress(mediaType anilist.MediaType, entry *anilist.MediaListEntry, delta int) {
+	lib := state.GetAppState().GetLibrary()
+	if lib == nil {
+		return
+	}
+	progress := max(entry.Progress+delta, 0)
+	if total := entryTotal(entry); total != nil && *total > 0 {
+		progress = min(progress, *total)
+	}
+	if progress == entry.Progress {
+		return
+	}
+	input := anilist.SaveMediaListEntryInput{Progress: &progress}
+	if err := lib.SaveEntry(mediaType, entry, entry.MediaID, input); err != nil {
+		logrus.Errorf("Error queueing progress for media %d: %v", entry.MediaID, err)
+	}
+}
+
+// setStatus moves an entry to another status.
+func setStatus(mediaType anilist.MediaType, entry *anilist.MediaListEntry, status anilist.MediaListStatus) {
+	lib := state.GetAppState().GetLibrary()
+	if lib == nil || status == entry.Status {
+		return
+	}
+	input := anilist.SaveMediaListEntryInput{Status: &status}
+	if err := lib.SaveEntry(mediaType, entry, entry.MediaID, input); err != nil {
+		logrus.Errorf("Error queueing status for media %d: %v", entry.MediaID, err)
+	}
+}
+
+// userEntry returns the user's entry for a media from their cached list, or nil if it isn't on their list.  The
+// entry is given the media when the cache left it out.
+func userEntry(lib *library.Library, media *anilist.Media) *anilist.MediaListEntry {
+	collection := lib.CachedListCollection(media.Type)
+	if collection == nil {
+		return nil
+	}
+	for _, entry := range collection.Entries() {
+		if entry.MediaID != media.ID {
+			continue
+		}
+		if entry.Media == nil {
+			copied := *entry
+			copied.Media = media
+			entry = &copied
+		}
+		return entry
+	}
+	return nil
+}
+
+// editMedia opens the editor for the user's entry for a media, or to add the media to their list.
+func editMedia(window fyne.Window, lib *library.Library, media *anilist.Media) {
+	entry := userEntry(lib, media)
+	if entry == nil {
+		entry = &anilist.MediaListEntry{MediaID: media.ID, Status: anilist.StatusPlanning, Media: media}
+	}
+	showEntryEditor(window, media.Type, entry)
+}
+
+// enableMutationControls enables controls that change lists on AniList, or disables them while read-only mode is on.
+func enableMutationControls(controls ...fyne.Disableable) {
+	readOnly := state.GetAppState().ReadOnly()
+	for _, control := range controls {
+		if readOnly {
+			control.Disable()
+		} else {
+			control.Enable()
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/backup"
+	"github.com/StarTerrarium/hisame/internal/state"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+	"time"
+)
+
+// historyNow is the point in history standing for the lists as they are now.
+const historyNow = "Now"
+
+// historyKindLabels describes each kind of change between two points in history.
+var historyKindLabels = map[backup.ChangeKind]string{
+	backup.ChangeMissing:  "Removed",
+	backup.ChangeModified: "Changed",
+	backup.ChangeAdded:    "Added",
+}
+
+// HistoryPage compares the lists at two points in time, using the automatic backup snapshots, and reverts
+// individual changes.
+type HistoryPage struct {
+	basePage
+
+	content fyne.CanvasObject
+
+	snapshots []backup.Snapshot
+	// Loaded snapshots by path, as encrypted snapshots are slow to decrypt.
+	loaded      map[string]*backup.Backup
+	loadedMutex sync.Mutex
+
+	fromSelect  *widget.Select
+	toSelect    *widget.Select
+	filterEntry *widget.Entry
+	statusLabel *widget.Label
+	list        *widget.List
+
+	changes []*backup.Change
+	shown   []*backup.Change
+
+	listOffset float32
+}
+
+// NewHistoryPage creates a new instance of HistoryPage.
+func NewHistoryPage() *HistoryPage {
+	hp := &HistoryPage{loaded: map[string]*backup.Backup{}}
+	hp.content = hp.buildContent()
+	return hp
+}
+
+// Content returns the root content object of the HistoryPage.
+func (hp *HistoryPage) Content() fyne.CanvasObject {
+	return hp.content
+}
+
+func (hp *HistoryPage) buildContent() fyne.CanvasObject {
+	hp.statusLabel = widget.NewLabel("")
+	hp.statusLabel.Wrapping = fyne.TextWrapWord
+
+	scheduler := state.GetAppState().GetBackups()
+	session := state.GetAppState().GetSession()
+	if scheduler == nil || session == nil {
+		hp.statusLabel.SetText("History is built from automatic backups, which are turned off.")
+		return container.NewCenter(hp.statusLabel)
+	}
+	snapshots, err := scheduler.Snapshots(session.CacheKey()).List()
+	if err != nil {
+		logrus.Errorf("Error listing backup snapshots: %v", err)
+	}
+	if len(snapshots) == 0 {
+		hp.statusLabel.SetText("There is no history yet.  It builds up as your lists are backed up automatically.")
+		return container.NewCenter(hp.statusLabel)
+	}
+	hp.snapshots = snapshots
+
+	options := make([]string, len(snapshots))
+	for i, snapshot := range snapshots {
+		options[i] = snapshot.CreatedAt.Local().Format("2 Jan 2006 15:04")
+	}
+	hp.fromSelect = widget.NewSelect(options, func(string) { hp.compare() })
+	hp.toSelect = widget.NewSelect(append([]string{historyNow}, options...), func(string) { hp.compare() })
+	hp.filterEntry = widget.NewEntry()
+	hp.filterEntry.SetPlaceHolder("Filter by title")
+	hp.filterEntry.OnChanged = func(string) { hp.showChanges() }
+
+	hp.list = widget.NewList(
+		func() int { return len(hp.shown) },
+		func() fyne.CanvasObject {
+			details := widget.NewLabel("")
+			details.Truncation = fyne.TextTruncateEllipsis
+			return container.NewBorder(nil, nil, nil, widget.NewButton("Revert", nil), details)
+		},
+		func(id widget.ListItemID, object fyne.CanvasObject) {
+			change := hp.shown[id]
+			row := object.(*fyne.Container)
+			row.Objects[0].(*widget.Label).SetText(describeHistoryChange(change, hp.titleLanguage()))
+			button := row.Objects[1].(*widget.Button)
+			button.OnTapped = func() { hp.revert(change) }
+			enableMutationControls(button)
+		},
+	)
+
+	points := widget.NewForm(
+		widget.NewFormItem("From", hp.fromSelect),
+		widget.NewFormItem("To", hp.toSelect),
+	)
+	top := container.NewVBox(points, hp.filterEntry, hp.statusLabel)
+
+	hp.toSelect.SetSelectedIndex(0)
+	hp.fromSelect.SetSelectedIndex(0)
+	return container.NewBorder(top, nil, nil, nil, hp.list)
+}
+
+// OnShow scrolls back to where the changes were left.
+func (hp *HistoryPage) OnShow() {
+	if hp.list != nil {
+		restoreListOffset(hp.list, hp.listOffset)
+	}
+}
+
+// OnHide remembers how far down the changes are scrolled.  The chosen points and filter keep their values.
+func (hp *HistoryPage) OnHide() {
+	if hp.list != nil {
+		hp.listOffset = hp.list.GetScrollOffset()
+	}
+}
+
+// OnDestroy lets go of the loaded snapshots, which hold whole lists and may have been decrypted.
+func (hp *HistoryPage) OnDestroy() {
+	hp.loadedMutex.Lock()
+	defer hp.loadedMutex.Unlock()
+	hp.loaded = map[string]*backup.Backup{}
+}
+
+func (hp *HistoryPage) titleLanguage() string {
+	return state.GetAppState().GetConfig().AnimeConfig.TitleLanguage
+}
+
+// compare loads the two chosen points in history, then lists the changes between them.
+func (hp *HistoryPage) compare() {
+	if hp.fromSelect.SelectedIndex() < 0 || hp.toSelect.SelectedIndex() < 0 {
+		return
+	}
+	from := hp.snapshots[hp.fromSelect.SelectedIndex()]
+	toIndex := hp.toSelect.SelectedIndex()
+	hp.statusLabel.SetText("Comparing..")
+
+	fromName, toName := hp.fromSelect.Selected, hp.toSelect.Selected
+	window := getScreenManager().window
+
+	go func() {
+		older, err := hp.load(from)
+		if err != nil {
+			runOnUI(window, func() { hp.statusLabel.SetText(fmt.Sprintf("Couldn't read the backup from %s: %v", fromName, err)) })
+			return
+		}
+		var newer *backup.Backup
+		if toIndex == 0 {
+			newer = hp.currentLists(older)
+		} else if newer, err = hp.load(hp.snapshots[toIndex-1]); err != nil {
+			runOnUI(window, func() { hp.statusLabel.SetText(fmt.Sprintf("Couldn't read the backup from %s: %v", toName, err)) })
+			return
+		}
+		// Always show changes going forward in time.
+		if newer.CreatedAt.Before(older.CreatedAt) {
+			older, newer = newer, older
+		}
+
+		changes := backup.History(older, newer)
+		runOnUI(window, func() {
+			hp.changes = changes
+			hp.showChanges()
+		})
+	}()
+}
+
+// load reads a snapshot, or returns it from the cache if it has been read before.
+func (hp *HistoryPage) load(snapshot backup.Snapshot) (*backup.Backup, error) {
+	hp.loadedMutex.Lock()
+	defer hp.loadedMutex.Unlock()
+	if b, ok := hp.loaded[snapshot.Path]; ok {
+		return b, nil
+	}
+	scheduler := state.GetAppState().GetBackups()
+	session := state.GetAppState().GetSession()
+	if scheduler == nil || session == nil {
+		return nil, fmt.Errorf("automatic backups are turned off")
+	}
+	b, err := scheduler.Snapshots(session.CacheKey()).Load(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	hp.loaded[snapshot.Path] = b
+	return b, nil
+}
+
+// currentLists returns the cached lists as they are now, for the media types in the compared backup.
+func (hp *HistoryPage) currentLists(compared *backup.Backup) *backup.Backup {
+	now := &backup.Backup{CreatedAt: time.Now(), Lists: map[anilist.MediaType]*anilist.MediaListCollection{}}
+	if lib := state.GetAppState().GetLibrary(); lib != nil {
+		for mediaType := range compared.Lists {
+			if collection := lib.CachedListCollection(mediaType); collection != nil {
+				now.Lists[mediaType] = collection
+			}
+		}
+	}
+	// Lists that haven't been loaded yet would show every entry as removed.
+	for mediaType := range compared.Lists {
+		if now.Lists[mediaType] == nil {
+			now.Lists[mediaType] = compared.Lists[mediaType]
+		}
+	}
+	return now
+}
+
+// showChanges lists the changes matching the filter.
+func (hp *HistoryPage) showChanges() {
+	filter := strings.ToLower(strings.TrimSpace(hp.filterEntry.Text))
+	titleLanguage := hp.titleLanguage()
+	var shown []*backup.Change
+	for _, change := range hp.changes {
+		if filter == "" || strings.Contains(strings.ToLower(change.Title(titleLanguage)), filter) {
+			shown = append(shown, change)
+		}
+	}
+	hp.shown = shown
+	hp.list.Refresh()
+
+	switch {
+	case len(hp.changes) == 0:
+		hp.statusLabel.SetText("Nothing changed between these points.")
+	case len(shown) != len(hp.changes):
+		hp.statusLabel.SetText(fmt.Sprintf("%d of %d changes match.", len(shown), len(hp.changes)))
+	default:
+		hp.statusLabel.SetText(fmt.Sprintf("%d changes.", len(hp.changes)))
+	}
+}
+
+// revert undoes one change on AniList, after confirming.
+func (hp *HistoryPage) revert(change *backup.Change) {
+	lib := state.GetAppState().GetLibrary()
+	if lib == nil {
+		return
+	}
+	window := getScreenManager().window
+	title := change.Title(hp.titleLanguage())
+	message := fmt.Sprintf("Undo this change to %s?  This changes your list on AniList.", title)
+
+	dialog.ShowConfirm("Revert", message, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		go func() {
+			ctx := context.Background()
+			collection, err := lib.RefreshListCollection(ctx, change.MediaType)
+			if err != nil {
+				runOnUI(window, func() {
+					dialog.ShowError(fmt.Errorf("couldn't fetch your current %s list: %w", strings.ToLower(string(change.MediaType)), err), window)
+				})
+				return
+			}
+			revert := backup.Revert(change, map[anilist.MediaType]*anilist.MediaListCollection{change.MediaType: collection})
+			if revert == nil {
+				runOnUI(window, func() { dialog.ShowInformation("Revert", fmt.Sprintf("%s is already back as it was.", title), window) })
+				return
+			}
+			result, err := backup.Restore(ctx, lib.Client(), []*backup.Change{revert}, advancedScoringFor(ctx, lib), "", nil)
+			if err == nil && len(result.Failed) > 0 {
+				err = result.Failed[0].Err
+			}
+			if err != nil {
+				logrus.Errorf("Error reverting %s: %v", revert.Key(), err)
+				runOnUI(window, func() { dialog.ShowError(fmt.Errorf("couldn't revert %s: %w", title, err), window) })
+				return
+			}
+			logrus.Infof("Reverted %s change to %s", change.Kind, revert.Key())
+			lib.Syncer().SyncNow()
+			runOnUI(window, func() { hp.statusLabel.SetText(fmt.Sprintf("Reverted %s.", title)) })
+		}()
+	}, window)
+}
+
+// describeHistoryChange summarises a change between two points in history on one line.
+func describeHistoryChange(change *backup.Change, titleLanguage string) string {
+	text := fmt.Sprintf("%s %s: %s", historyKindLabels[change.Kind], strings.ToLower(string(change.MediaType)), change.Title(titleLanguage))
+	var details []string
+	switch change.Kind {
+	case backup.ChangeMissing:
+		details = append(details, fmt.Sprintf("was %s", strings.ToLower(string(change.Backup.Status))))
+	case backup.ChangeAdded:
+		details = append(details, fmt.Sprintf("as %s", strings.ToLower(string(change.Current.Status))))
+	default:
+		for _, diff := range change.Diffs {
+			detail := fmt.Sprintf("%s %s → %s", diff.Field, diff.Input, diff.Entry)
+			if diff.Field == "progress" {
+				detail += fmt.Sprintf(" (%+d)", change.ProgressDelta())
+			}
+			details = append(details, detail)
+		}
+	}
+	if len(details) > 0 {
+		text += " (" + strings.Join(details, "; ") + ")"
+	}
+	return text
+}
@@ -0,0 +1,137 @@
+package ui
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+	"github.com/StarTerrarium/hisame/internal/keymap"
+	"github.com/sirupsen/logrus"
+)
+
+// keyboardPage is a page with rows, or an entry, that the keymap's row actions work on.
+type keyboardPage interface {
+	Page
+	// handleAction does one of the row actions, such as moving to the next row or editing the row's entry.
+	handleAction(action keymap.Action)
+}
+
+// fyneModifiers maps the keymap's modifiers to Fyne's.
+var fyneModifiers = []struct {
+	modifier keymap.Modifier
+	fyne     fyne.KeyModifier
+}{
+	{keymap.ModifierShift, fyne.KeyModifierShift},
+	{keymap.ModifierCtrl, fyne.KeyModifierControl},
+	{keymap.ModifierAlt, fyne.KeyModifierAlt},
+	{keymap.ModifierSuper, fyne.KeyModifierSuper},
+}
+
+// bindKeys makes the keymap's keys do their actions.  Bindings with modifiers are window shortcuts, and the rest
+// are picked up as keys are typed.  Neither reach the window while a text box has focus, so typing isn't mistaken
+// for shortcuts.
+func (sm *ScreenManager) bindKeys() {
+	canvas := sm.window.Canvas()
+	for action, binding := range sm.keymap {
+		if binding.Modifiers == 0 {
+			continue
+		}
+		var modifier fyne.KeyModifier
+		for _, m := range fyneModifiers {
+			if binding.Modifiers&m.modifier != 0 {
+				modifier |= m.fyne
+			}
+		}
+		action := action
+		shortcut := &desktop.CustomShortcut{KeyName: fyne.KeyName(binding.Key), Modifier: modifier}
+		canvas.AddShortcut(shortcut, func(fyne.Shortcut) { sm.doAction(action) })
+	}
+	canvas.SetOnTypedRune(func(r rune) {
+		if action, ok := sm.keymap.Action(keymap.Binding{Key: string(r)}); ok {
+			sm.doAction(action)
+		}
+	})
+	canvas.SetOnTypedKey(func(event *fyne.KeyEvent) {
+		name := event.Name
+		if name == fyne.KeyEnter {
+			name = fyne.KeyReturn
+		}
+		binding := keymap.Binding{Key: string(name)}
+		// Keys that type a character are handled as the character, so "J" isn't mistaken for "j".
+		if binding.Typed() {
+			return
+		}
+		if action, ok := sm.keymap.Action(binding); ok {
+			sm.doAction(action)
+		}
+	})
+}
+
+// doAction does what a key is bound to.  Keys are ignored while logged out and while a dialog is open.
+func (sm *ScreenManager) doAction(action keymap.Action) {
+	if !sm.isAuth || sm.window.Canvas().Overlays().Top() != nil {
+		return
+	}
+	logrus.Debugf("Keyboard shortcut for %s pressed", action)
+	switch action {
+	case keymap.ActionAnime:
+		sm.showAnimeList()
+	case keymap.ActionSearch:
+		sm.showSearch()
+	case keymap.ActionFocusSearch:
+		sm.showSearch().focusSearch()
+	case keymap.ActionPalette:
+		showCommandPalette(sm.window, sm.commands)
+	case keymap.ActionHelp:
+		showKeymapHelp(sm.window, sm.keymap)
+	default:
+		if page, ok := sm.currentPage.(keyboardPage); ok {
+			page.handleAction(action)
+		}
+	}
+}
+
+// showKeymapHelp shows a dialog listing the keyboard shortcuts.
+func showKeymapHelp(window fyne.Window, keys keymap.Keymap) {
+	grid := container.New(layout.NewFormLayout())
+	for _, a := range keymap.Actions {
+		binding, ok := keys[a.Action]
+		if !ok {
+			continue
+		}
+		key := widget.NewLabel(binding.String())
+		key.TextStyle = fyne.TextStyle{Monospace: true}
+		grid.Add(key)
+		grid.Add(widget.NewLabel(a.Description))
+	}
+	note := widget.NewLabel("Alt+Left and Alt+Right go back and forward.  The mouse's back and forward buttons aren't " +
+		"supported yet, as Fyne doesn't report them.  Keys can be changed under keymap in the config file.")
+	note.Wrapping = fyne.TextWrapWord
+	help := dialog.NewCustom("Keyboard shortcuts", "Close", container.NewVBox(grid, note), window)
+	help.Resize(fyne.NewSize(480, 0))
+	help.Show()
+}
+
+// progressDelta returns how much a progress action changes progress by.
+func progressDelta(action keymap.Action) int {
+	if action == keymap.ActionDecrement {
+		return -1
+	}
+	return 1
+}
+
+// moveSelection selects the row delta rows from the selected row of a list of length rows, or the first row when
+// none is selected, and returns the row selected.
+func moveSelection(list *widget.List, selected widget.ListItemID, delta int, length int) widget.ListItemID {
+	if length == 0 {
+		return -1
+	}
+	row := 0
+	if selected >= 0 {
+		row = min(max(selected+delta, 0), length-1)
+	}
+	list.Select(row)
+	return row
+}
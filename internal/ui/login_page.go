@@ -2,20 +2,33 @@ package ui
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
 	"github.com/StarTerrarium/hisame/internal/auth"
+	"github.com/StarTerrarium/hisame/internal/state"
 	"github.com/sirupsen/logrus"
+	"time"
 )
 
 type LoginPage struct {
+	basePage
+
 	content fyne.CanvasObject
+	message string
 }
 
 func NewLoginPage() *LoginPage {
-	lp := &LoginPage{}
+	return NewLoginPageWithMessage("")
+}
+
+// NewLoginPageWithMessage creates a login page showing an explanation of why the user needs to log in.
+func NewLoginPageWithMessage(message string) *LoginPage {
+	lp := &LoginPage{message: message}
 	lp.content = lp.buildContent()
 	return lp
 }
@@ -25,27 +38,34 @@ func (lp *LoginPage) Content() fyne.CanvasObject {
 }
 
 func (lp *LoginPage) buildContent() fyne.CanvasObject {
-	authInstance := auth.NewAuth()
+	authInstance := auth.NewAuthFromConfig(state.GetAppState().GetConfig().AuthConfig)
 
 	loginButton := widget.NewButton("Login with AniList", func() {
 		lp.startLoginFlow(authInstance)
 	})
+	// The browser flow needs a browser that can reach localhost, which isn't the case over SSH, in containers or
+	// in some sandboxes.  Pasting the token lets those users log in from a browser anywhere.
+	pasteTokenButton := widget.NewButton("Paste a token instead", func() {
+		lp.showPasteTokenDialog(authInstance)
+	})
+
+	loginItems := container.NewVBox()
+	if lp.message != "" {
+		loginItems.Add(widget.NewLabelWithStyle(lp.message, fyne.TextAlignCenter, fyne.TextStyle{Bold: true}))
+	}
+	loginItems.Add(widget.NewLabel("Login to AniList to use Hisame"))
+	loginItems.Add(loginButton)
+	loginItems.Add(pasteTokenButton)
 
 	loginContent := container.NewVBox(
 		layout.NewSpacer(),
-		container.NewCenter(
-			container.NewVBox(
-				widget.NewLabel("Login to AniList to use Hisame"),
-				loginButton,
-			),
-		),
+		container.NewCenter(loginItems),
 		layout.NewSpacer(),
 	)
 	return loginContent
 }
 
 func (lp *LoginPage) startLoginFlow(authInstance *auth.Auth) {
-	logrus.Infof("Starting login.  Login URL: %s", authInstance.LoginURL)
 	err := authInstance.StartCallbackServer()
 	if err != nil {
 		logrus.Errorf("Error starting login flow: %v", err)
@@ -56,6 +76,8 @@ func (lp *LoginPage) startLoginFlow(authInstance *auth.Auth) {
 		// TODO:  Figure out how to do proper error feedback here.  Notification is good enough for now.
 		return
 	}
+	// The login URL depends on which callback port could be bound, so only log it once the server is up.
+	logrus.Infof("Starting login.  Login URL: %s", authInstance.LoginURL)
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -73,7 +95,8 @@ func (lp *LoginPage) startLoginFlow(authInstance *auth.Auth) {
 	})
 
 	loadingContent := container.NewVBox(loadingLabel, loadingSpinner, manualLink, cancelButton)
-	loadingDialog = widget.NewModalPopUp(loadingContent, getScreenManager().window.Canvas())
+	window := getScreenManager().window
+	loadingDialog = widget.NewModalPopUp(loadingContent, window.Canvas())
 	loadingDialog.Show()
 
 	err = fyne.CurrentApp().OpenURL(authInstance.LoginURL)
@@ -92,17 +115,83 @@ func (lp *LoginPage) startLoginFlow(authInstance *auth.Auth) {
 		token, err := authInstance.WaitForToken(ctx)
 		if err != nil {
 			logrus.Error("Error waiting for token", err)
+			content := "There was an error reading the auth token.  Please check the logs and try again."
+			if errors.Is(err, auth.ErrAccessDenied) {
+				content = "Access to your AniList account was denied."
+			}
 			fyne.CurrentApp().SendNotification(&fyne.Notification{
 				Title:   "Login error",
-				Content: "There was an error reading the auth token.  Please check the logs and try again.",
+				Content: content,
 			})
-			loadingDialog.Hide()
+			runOnUI(window, loadingDialog.Hide)
 			return
 		}
 		logrus.Tracef("Received token: %s", token)
 
-		loadingDialog.Hide()
-		logrus.Info("Login complete")
-		getScreenManager().HandleLoginSuccess()
+		runOnUI(window, func() { loadingLabel.SetText("Verifying token..") })
+		err = lp.completeLogin(token)
+		runOnUI(window, func() {
+			loadingDialog.Hide()
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("could not verify the token with AniList: %w", err), window)
+			}
+		})
 	}()
 }
+
+// showPasteTokenDialog lets the user log in by pasting a token obtained from a browser on any machine.
+func (lp *LoginPage) showPasteTokenDialog(authInstance *auth.Auth) {
+	window := getScreenManager().window
+
+	instructions := widget.NewLabel("Open the link below in any browser and log in.  Then paste the token, or the\n" +
+		"full address of the page you were sent to, even if that page failed to load.")
+	loginLink := widget.NewHyperlink("Open AniList login", authInstance.LoginURL)
+	tokenEntry := widget.NewPasswordEntry()
+	tokenEntry.SetPlaceHolder("Token or redirect URL")
+
+	content := container.NewVBox(instructions, loginLink, tokenEntry)
+	dialog.ShowCustomConfirm("Login with a token", "Login", "Cancel", content, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		token, err := auth.ParseTokenInput(tokenEntry.Text)
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+
+		progress := dialog.NewCustomWithoutButtons("Verifying token..", widget.NewProgressBarInfinite(), window)
+		progress.Show()
+		go func() {
+			err := lp.completeLogin(token)
+			runOnUI(window, func() {
+				progress.Hide()
+				if err != nil {
+					dialog.ShowError(fmt.Errorf("could not verify the token with AniList: %w", err), window)
+				}
+			})
+		}()
+	}, window)
+}
+
+// completeLogin checks the token with AniList and, if valid, logs the user in with it.  It is called from a
+// background goroutine, as verifying the token is a request.
+func (lp *LoginPage) completeLogin(token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	session, err := auth.VerifyToken(ctx, token)
+	if err != nil {
+		logrus.Errorf("Error verifying token: %v", err)
+		return err
+	}
+
+	logrus.Info("Login complete")
+	fyne.CurrentApp().SendNotification(&fyne.Notification{
+		Title:   "Logged in",
+		Content: fmt.Sprintf("Logged in to AniList as %s", session.Username),
+	})
+	sm := getScreenManager()
+	runOnUI(sm.window, func() { sm.HandleLoginSuccess(session) })
+	return nil
+}
@@ -0,0 +1,246 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/keymap"
+	"github.com/StarTerrarium/hisame/internal/library"
+	"github.com/StarTerrarium/hisame/internal/state"
+	"github.com/sirupsen/logrus"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Size of the cover shown on the media page.
+const (
+	mediaCoverWidth  = 230
+	mediaCoverHeight = 345
+)
+
+// MediaPage shows one anime or manga, and the user's entry for it.  It is where deep links to media lead.
+type MediaPage struct {
+	basePage
+
+	mediaID int
+	content fyne.CanvasObject
+
+	cover        *CoverImage
+	titleLabel   *widget.Label
+	detailsLabel *widget.Label
+	genresLabel  *widget.Label
+	entryLabel   *widget.Label
+	entryButton  *widget.Button
+	siteLink     *widget.Hyperlink
+	statusLabel  *widget.Label
+	scroll       *container.Scroll
+	scrollOffset fyne.Position
+
+	mutex sync.Mutex
+	media *anilist.Media
+	// Whether the media has been revalidated against AniList since the page was created.
+	fresh bool
+
+	work        pageWork
+	unsubscribe func()
+}
+
+// NewMediaPage creates a new instance of MediaPage for the media with the given AniList ID.
+func NewMediaPage(mediaID int) *MediaPage {
+	mp := &MediaPage{mediaID: mediaID}
+	mp.content = mp.buildContent()
+	return mp
+}
+
+// Content returns the root content object of the MediaPage.
+func (mp *MediaPage) Content() fyne.CanvasObject {
+	return mp.content
+}
+
+func (mp *MediaPage) buildContent() fyne.CanvasObject {
+	mp.cover = NewCoverImage(fyne.NewSize(mediaCoverWidth, mediaCoverHeight))
+	mp.titleLabel = widget.NewLabel(fmt.Sprintf("Media %d", mp.mediaID))
+	mp.titleLabel.TextStyle = fyne.TextStyle{Bold: true}
+	mp.titleLabel.Wrapping = fyne.TextWrapWord
+	mp.detailsLabel = widget.NewLabel("")
+	mp.genresLabel = widget.NewLabel("")
+	mp.genresLabel.Wrapping = fyne.TextWrapWord
+	mp.entryLabel = widget.NewLabel("")
+	mp.entryButton = widget.NewButton("Add to list", nil)
+	mp.entryButton.Hide()
+	mp.siteLink = widget.NewHyperlink("Open on AniList", nil)
+	mp.siteLink.Hide()
+	mp.statusLabel = widget.NewLabel("Loading..")
+	mp.statusLabel.Wrapping = fyne.TextWrapWord
+
+	details := container.NewVBox(
+		mp.titleLabel,
+		mp.detailsLabel,
+		mp.genresLabel,
+		container.NewHBox(mp.entryLabel, mp.entryButton),
+		mp.siteLink,
+	)
+	mp.scroll = container.NewVScroll(details)
+	return container.NewBorder(nil, mp.statusLabel, container.NewVBox(mp.cover), nil, mp.scroll)
+}
+
+// OnShow loads the media, showing the cached copy straight away if there is one, until it has been refreshed from
+// AniList.  The user's entry is kept up to date while the page is showing.
+func (mp *MediaPage) OnShow() {
+	lib := state.GetAppState().GetLibrary()
+	if lib == nil {
+		logrus.Warn("Media page shown without an active account")
+		return
+	}
+	ctx := mp.work.start()
+	mp.mutex.Lock()
+	media, fresh := mp.media, mp.fresh
+	mp.mutex.Unlock()
+	if !fresh {
+		mp.load(ctx, lib)
+	} else {
+		mp.showEntry(lib, media)
+	}
+
+	// Keep the entry up to date as it is edited, here or elsewhere.
+	window := getScreenManager().window
+	mp.unsubscribe = lib.SubscribeLists(func(mediaType anilist.MediaType) {
+		runOnUI(window, func() {
+			mp.mutex.Lock()
+			media := mp.media
+			mp.mutex.Unlock()
+			if media != nil && media.Type == mediaType {
+				mp.showEntry(lib, media)
+			}
+		})
+	})
+	mp.scroll.Offset = mp.scrollOffset
+	mp.scroll.Refresh()
+}
+
+// OnHide stops loading and following the entry, and remembers how far down the page is scrolled.
+func (mp *MediaPage) OnHide() {
+	mp.scrollOffset = mp.scroll.Offset
+	mp.work.stop()
+	if mp.unsubscribe != nil {
+		mp.unsubscribe()
+		mp.unsubscribe = nil
+	}
+}
+
+// load shows the cached media straight away if there is one, and refreshes it once AniList responds.
+func (mp *MediaPage) load(ctx context.Context, lib *library.Library) {
+	window := getScreenManager().window
+	lib.Media(ctx, mp.mediaID, func(media *anilist.Media, fresh bool, err error) {
+		runOnUI(window, func() {
+			if ctx.Err() != nil {
+				return
+			}
+			switch {
+			case media == nil && anilist.IsNotFound(err):
+				mp.statusLabel.SetText(fmt.Sprintf("AniList has no media with ID %d", mp.mediaID))
+			case media == nil && err != nil:
+				mp.statusLabel.SetText(fmt.Sprintf("Unable to load media %d: %v", mp.mediaID, err))
+			case media == nil:
+			case err != nil:
+				mp.showMedia(ctx, lib, media, false)
+				mp.statusLabel.SetText(fmt.Sprintf("Unable to refresh, showing cached details: %v", err))
+			default:
+				mp.showMedia(ctx, lib, media, fresh)
+				if fresh {
+					mp.statusLabel.SetText("")
+				}
+			}
+		})
+	})
+}
+
+// showMedia shows the media's details, then the user's entry for it.
+func (mp *MediaPage) showMedia(ctx context.Context, lib *library.Library, media *anilist.Media, fresh bool) {
+	mp.mutex.Lock()
+	mp.media = media
+	mp.fresh = mp.fresh || fresh
+	mp.mutex.Unlock()
+
+	mp.cover.SetURL(media.CoverImage.Large)
+	mp.titleLabel.SetText(media.Title.Preferred(state.GetAppState().GetConfig().AnimeConfig.TitleLanguage))
+	mp.detailsLabel.SetText(mediaDetails(media))
+	mp.genresLabel.SetText(strings.Join(media.Genres, ", "))
+	if u, err := url.Parse(media.SiteURL); err == nil && media.SiteURL != "" {
+		mp.siteLink.SetURL(u)
+		mp.siteLink.Show()
+	}
+
+	if lib.CachedListCollection(media.Type) != nil {
+		mp.showEntry(lib, media)
+		return
+	}
+	window := getScreenManager().window
+	lib.ListCollection(ctx, media.Type, func(update library.ListUpdate) {
+		runOnUI(window, func() {
+			if update.Collection != nil && ctx.Err() == nil {
+				mp.showEntry(lib, media)
+			}
+		})
+	})
+}
+
+// showEntry shows the user's entry for the media, with a button to edit it or add the media to their list.
+func (mp *MediaPage) showEntry(lib *library.Library, media *anilist.Media) {
+	if entry := userEntry(lib, media); entry == nil {
+		mp.entryLabel.SetText("Not on your list")
+		mp.entryButton.SetText("Add to list")
+	} else {
+		mp.entryLabel.SetText(fmt.Sprintf("On your list: %s, %s", entry.Status, entryProgress(entry)))
+		mp.entryButton.SetText("Edit")
+	}
+	mp.entryButton.OnTapped = func() {
+		editMedia(getScreenManager().window, lib, media)
+	}
+	mp.entryButton.Show()
+	enableMutationControls(mp.entryButton)
+}
+
+// handleAction edits the user's entry for the media, or changes its progress.
+func (mp *MediaPage) handleAction(action keymap.Action) {
+	lib := state.GetAppState().GetLibrary()
+	mp.mutex.Lock()
+	media := mp.media
+	mp.mutex.Unlock()
+	if lib == nil || media == nil || state.GetAppState().ReadOnly() {
+		return
+	}
+	switch action {
+	case keymap.ActionEdit:
+		editMedia(getScreenManager().window, lib, media)
+	case keymap.ActionIncrement, keymap.ActionDecrement:
+		if entry := userEntry(lib, media); entry != nil {
+			changeProgress(media.Type, entry, progressDelta(action))
+		}
+	}
+}
+
+// mediaDetails summarises a media's format, airing status, length and score.
+func mediaDetails(media *anilist.Media) string {
+	var details []string
+	if media.Format != "" {
+		details = append(details, media.Format)
+	}
+	if media.Status != "" {
+		details = append(details, media.Status)
+	}
+	if media.Episodes != nil {
+		details = append(details, fmt.Sprintf("%d episodes", *media.Episodes))
+	}
+	if media.Chapters != nil {
+		details = append(details, fmt.Sprintf("%d chapters", *media.Chapters))
+	}
+	if media.AverageScore != nil {
+		details = append(details, fmt.Sprintf("Average score %d%%", *media.AverageScore))
+	}
+	return strings.Join(details, " · ")
+}
@@ -4,14 +4,24 @@ import (
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 	"github.com/sirupsen/logrus"
 )
 
+// addAccountOption is the entry at the end of the account switcher used to log in to another account.
+const addAccountOption = "Add account…"
+
 type NavigationBar struct {
 	content fyne.CanvasObject
 
+	accountSelect *widget.Select
+	// Set while the account options are updated programmatically, so it isn't mistaken for the user switching.
+	updatingAccounts bool
+
 	// Buttons
+	backButton     *widget.Button
+	forwardButton  *widget.Button
 	animeButton    *widget.Button
 	mangaButton    *widget.Button
 	searchButton   *widget.Button
@@ -31,9 +41,19 @@ func (nb *NavigationBar) Content() fyne.CanvasObject {
 
 func (nb *NavigationBar) buildContent() fyne.CanvasObject {
 	// Left side buttons
+	nb.backButton = widget.NewButtonWithIcon("", theme.NavigateBackIcon(), func() {
+		logrus.Debug("Back navigation button clicked")
+		getScreenManager().Back()
+	})
+	nb.forwardButton = widget.NewButtonWithIcon("", theme.NavigateNextIcon(), func() {
+		logrus.Debug("Forward navigation button clicked")
+		getScreenManager().Forward()
+	})
+	nb.backButton.Disable()
+	nb.forwardButton.Disable()
 	nb.animeButton = widget.NewButton("Anime", func() {
 		logrus.Debug("Anime navigation button clicked")
-		getScreenManager().ShowPage(NewAnimeListPage())
+		getScreenManager().showAnimeList()
 	})
 	nb.mangaButton = widget.NewButton("Manga", func() {
 		logrus.Debug("Manga navigation button clicked")
@@ -41,17 +61,30 @@ func (nb *NavigationBar) buildContent() fyne.CanvasObject {
 	})
 	nb.searchButton = widget.NewButton("Search/Add", func() {
 		logrus.Debug("Search navigation button clicked")
-		// Implement Search/Add page navigation when ready
+		getScreenManager().showSearch()
 	})
 
 	// Right side buttons
 	nb.settingsButton = widget.NewButton("Settings", func() {
 		logrus.Debug("Settings navigation button clicked")
-		// Implement Settings page navigation when ready
+		getScreenManager().showSettings()
 	})
+	nb.accountSelect = widget.NewSelect(nil, func(selected string) {
+		if nb.updatingAccounts {
+			return
+		}
+		if selected == addAccountOption {
+			logrus.Debug("Add account selected")
+			getScreenManager().ShowAddAccount()
+			return
+		}
+		logrus.Debugf("Switching to account %s", selected)
+		getScreenManager().SwitchAccount(selected)
+	})
+	nb.accountSelect.PlaceHolder = "Account"
 	nb.logoutButton = widget.NewButton("Logout", func() {
 		logrus.Debug("Logout button clicked")
-		// Handle logout logic
+		getScreenManager().HandleLogout()
 	})
 
 	// Initially disable all buttons
@@ -59,10 +92,11 @@ func (nb *NavigationBar) buildContent() fyne.CanvasObject {
 	for _, btn := range buttonsToDisable {
 		btn.Disable()
 	}
+	nb.accountSelect.Disable()
 
 	// Left and right containers
-	leftContainer := container.NewHBox(nb.animeButton, nb.mangaButton, nb.searchButton)
-	rightContainer := container.NewHBox(nb.settingsButton, nb.logoutButton)
+	leftContainer := container.NewHBox(nb.backButton, nb.forwardButton, nb.animeButton, nb.mangaButton, nb.searchButton)
+	rightContainer := container.NewHBox(nb.accountSelect, nb.settingsButton, nb.logoutButton)
 
 	// Spacer between left and right
 	spacer := layout.NewSpacer()
@@ -81,4 +115,37 @@ func (nb *NavigationBar) UpdateAuthenticationState(isAuthenticated bool) {
 			btn.Disable()
 		}
 	}
+	if isAuthenticated {
+		nb.accountSelect.Enable()
+	} else {
+		nb.accountSelect.Disable()
+	}
+}
+
+// UpdateAccounts sets the accounts listed in the account switcher, and which one is shown as active.
+func (nb *NavigationBar) UpdateAccounts(names []string, active string) {
+	nb.updatingAccounts = true
+	defer func() { nb.updatingAccounts = false }()
+
+	nb.accountSelect.Options = append(append([]string{}, names...), addAccountOption)
+	if active == "" {
+		nb.accountSelect.ClearSelected()
+	} else {
+		nb.accountSelect.SetSelected(active)
+	}
+	nb.accountSelect.Refresh()
+}
+
+// UpdateHistory enables the back and forward buttons when there is a page to go to.
+func (nb *NavigationBar) UpdateHistory(canGoBack, canGoForward bool) {
+	if canGoBack {
+		nb.backButton.Enable()
+	} else {
+		nb.backButton.Disable()
+	}
+	if canGoForward {
+		nb.forwardButton.Enable()
+	} else {
+		nb.forwardButton.Disable()
+	}
 }
@@ -1,8 +1,68 @@
 package ui
 
-import "fyne.io/fyne/v2"
+import (
+	"context"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+)
 
-// Page defines the interface that all pages must implement.
+// Page defines the interface that all pages must implement.  The ScreenManager calls the lifecycle hooks as the
+// user navigates, so pages only listen for updates and run background work while they are showing.
 type Page interface {
 	Content() fyne.CanvasObject
+	// OnShow is called each time the page is shown, including when the user returns to it.  Pages start loading
+	// and subscribe to updates here, and put back their scroll position.
+	OnShow()
+	// OnHide is called when another page is shown in its place.  The page may be shown again, so it keeps its
+	// filters and remembers its scroll position, but stops its subscriptions and background work.
+	OnHide()
+	// OnDestroy is called once the page can no longer be shown, to let go of anything it still holds.
+	OnDestroy()
+}
+
+// basePage gives pages lifecycle hooks that do nothing, for the hooks they don't need.
+type basePage struct{}
+
+func (basePage) OnShow()    {}
+func (basePage) OnHide()    {}
+func (basePage) OnDestroy() {}
+
+// pageWork gives the background work a page starts while showing a context that is cancelled when it is hidden.
+// It is only used from the UI goroutine.
+type pageWork struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// start gives work started from now on a new context.  Call it from OnShow.
+func (w *pageWork) start() context.Context {
+	w.stop()
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	return w.ctx
+}
+
+// stop cancels the work started since the page was shown.  Call it from OnHide.
+func (w *pageWork) stop() {
+	if w.cancel != nil {
+		w.cancel()
+		w.cancel = nil
+	}
+}
+
+// context returns the context for work being started, which is already cancelled if the page isn't showing.
+func (w *pageWork) context() context.Context {
+	if w.ctx == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		return ctx
+	}
+	return w.ctx
+}
+
+// restoreListOffset scrolls a list back to where it was.
+func restoreListOffset(list *widget.List, offset float32) {
+	// A list's renderer is freed when it hasn't been shown for a while, and it can't scroll without one.  MinSize
+	// creates it again.
+	list.MinSize()
+	list.ScrollToOffset(offset)
 }
@@ -0,0 +1,251 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/backup"
+	"github.com/StarTerrarium/hisame/internal/library"
+	"github.com/StarTerrarium/hisame/internal/state"
+	"github.com/sirupsen/logrus"
+	"io"
+	"strings"
+)
+
+// restoreModeLabels names the restore modes, in the order they are offered.
+var restoreModeLabels = []string{"Everything", "Only missing entries", "Selected entries"}
+
+// changeKindLabels describes each kind of change from the point of view of restoring it.
+var changeKindLabels = map[backup.ChangeKind]string{
+	backup.ChangeMissing:  "Add back",
+	backup.ChangeModified: "Revert",
+	backup.ChangeAdded:    "Remove",
+}
+
+// chooseRestoreFile asks for a backup file, then compares it with the current lists and offers to restore it.
+func chooseRestoreFile(window fyne.Window) {
+	lib := state.GetAppState().GetLibrary()
+	if lib == nil {
+		return
+	}
+	open := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+		if reader == nil {
+			return
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+		decodeRestoreFile(window, data, state.GetAppState().GetConfig().BackupPassphrase(), func(b *backup.Backup) {
+			compareWithBackup(window, lib, b, data)
+		})
+	}, window)
+	open.SetFilter(storage.NewExtensionFileFilter([]string{backup.FormatJSON.Extension(), ".enc"}))
+	open.Show()
+}
+
+// decodeRestoreFile reads a backup, asking for the passphrase if it is encrypted with a different one than the
+// configured passphrase.
+func decodeRestoreFile(window fyne.Window, data []byte, passphrase string, onDecoded func(b *backup.Backup)) {
+	b, err := backup.Decode(data, passphrase)
+	switch {
+	case err == nil:
+		onDecoded(b)
+	case errors.Is(err, backup.ErrPassphraseRequired), errors.Is(err, backup.ErrWrongPassphrase):
+		passphraseEntry := widget.NewPasswordEntry()
+		message := "This backup is encrypted."
+		if passphrase != "" {
+			message = "This backup was encrypted with a different passphrase."
+		}
+		items := []*widget.FormItem{widget.NewFormItem("Passphrase", passphraseEntry)}
+		form := dialog.NewForm(message, "Open", "Cancel", items, func(confirmed bool) {
+			if confirmed && passphraseEntry.Text != "" {
+				decodeRestoreFile(window, data, passphraseEntry.Text, onDecoded)
+			}
+		}, window)
+		form.Resize(fyne.NewSize(400, 0))
+		form.Show()
+		window.Canvas().Focus(passphraseEntry)
+	default:
+		dialog.ShowError(err, window)
+	}
+}
+
+// compareWithBackup fetches the current lists, then offers to restore the backup over them.
+func compareWithBackup(window fyne.Window, lib *library.Library, b *backup.Backup, data []byte) {
+	loading := dialog.NewCustomWithoutButtons("Comparing with your lists", widget.NewProgressBarInfinite(), window)
+	loading.Show()
+	go func() {
+		current := map[anilist.MediaType]*anilist.MediaListCollection{}
+		for mediaType := range b.Lists {
+			collection, err := lib.RefreshListCollection(context.Background(), mediaType)
+			if err != nil {
+				runOnUI(window, func() {
+					loading.Hide()
+					dialog.ShowError(fmt.Errorf("couldn't fetch your current %s list: %w", strings.ToLower(string(mediaType)), err), window)
+				})
+				return
+			}
+			current[mediaType] = collection
+		}
+		changes := backup.Compare(b, current)
+		runOnUI(window, func() {
+			loading.Hide()
+			showRestoreDialog(window, lib, b, data, changes)
+		})
+	}()
+}
+
+// showRestoreDialog lists how the current lists differ from a backup, and lets the user choose what to restore.
+func showRestoreDialog(window fyne.Window, lib *library.Library, b *backup.Backup, data []byte, changes []*backup.Change) {
+	if len(changes) == 0 {
+		dialog.ShowInformation("Restore", "Your lists already match the backup.", window)
+		return
+	}
+	titleLanguage := state.GetAppState().GetConfig().AnimeConfig.TitleLanguage
+
+	selected := map[string]bool{}
+	var modeGroup *widget.RadioGroup
+	list := widget.NewList(
+		func() int { return len(changes) },
+		func() fyne.CanvasObject {
+			details := widget.NewLabel("")
+			details.Truncation = fyne.TextTruncateEllipsis
+			return container.NewBorder(nil, nil, widget.NewCheck("", nil), nil, details)
+		},
+		func(id widget.ListItemID, object fyne.CanvasObject) {
+			change := changes[id]
+			row := object.(*fyne.Container)
+			details := row.Objects[0].(*widget.Label)
+			check := row.Objects[1].(*widget.Check)
+
+			text := fmt.Sprintf("%s %s: %s", changeKindLabels[change.Kind], strings.ToLower(string(change.MediaType)), change.Title(titleLanguage))
+			var diffs []string
+			for _, diff := range change.Diffs {
+				diffs = append(diffs, fmt.Sprintf("%s %s → %s", diff.Field, diff.Entry, diff.Input))
+			}
+			if len(diffs) > 0 {
+				text += " (" + strings.Join(diffs, "; ") + ")"
+			}
+			details.SetText(text)
+
+			mode := restoreModeFor(modeGroup)
+			check.OnChanged = nil
+			check.SetChecked(mode == backup.RestoreAll ||
+				mode == backup.RestoreMissing && change.Kind == backup.ChangeMissing ||
+				mode == backup.RestoreSelected && selected[change.Key()])
+			if mode == backup.RestoreSelected {
+				check.Enable()
+			} else {
+				check.Disable()
+			}
+			check.OnChanged = func(checked bool) { selected[change.Key()] = checked }
+		},
+	)
+	modeGroup = widget.NewRadioGroup(restoreModeLabels, func(string) { list.Refresh() })
+	modeGroup.Horizontal = true
+	modeGroup.Required = true
+	modeGroup.SetSelected(restoreModeLabels[backup.RestoreMissing])
+
+	summary := widget.NewLabel(fmt.Sprintf("%d entries differ from the backup made %s.", len(changes), b.CreatedAt.Local().Format("2 Jan 2006 15:04")))
+	content := container.NewBorder(container.NewVBox(summary, modeGroup), nil, nil, nil, list)
+
+	restore := dialog.NewCustomConfirm("Restore from backup", "Restore…", "Cancel", content, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		chosen := backup.Select(changes, restoreModeFor(modeGroup), selected)
+		if len(chosen) == 0 {
+			return
+		}
+		message := fmt.Sprintf("Restore %d entries?  This changes your lists on AniList.", len(chosen))
+		dialog.ShowConfirm("Restore from backup", message, func(confirmed bool) {
+			if confirmed {
+				runRestore(window, lib, data, chosen)
+			}
+		}, window)
+	}, window)
+	restore.Resize(fyne.NewSize(700, 600))
+	restore.Show()
+}
+
+// restoreModeFor returns the mode picked in the restore dialog's mode group.
+func restoreModeFor(group *widget.RadioGroup) backup.RestoreMode {
+	for i, label := range restoreModeLabels {
+		if group.Selected == label {
+			return backup.RestoreMode(i)
+		}
+	}
+	return backup.RestoreMissing
+}
+
+// runRestore applies the chosen changes, showing progress, then syncs the lists.
+func runRestore(window fyne.Window, lib *library.Library, data []byte, changes []*backup.Change) {
+	progressBar := widget.NewProgressBar()
+	progressBar.Max = float64(len(changes))
+	progressLabel := widget.NewLabel("")
+	progress := dialog.NewCustomWithoutButtons("Restoring", container.NewVBox(progressBar, progressLabel), window)
+	progress.Resize(fyne.NewSize(400, 0))
+	progress.Show()
+
+	go func() {
+		ctx := context.Background()
+		checkpointPath := ""
+		if lib.Store() != nil {
+			checkpointPath = backup.CheckpointPath(lib.Store().Dir(), data)
+		}
+		titleLanguage := state.GetAppState().GetConfig().AnimeConfig.TitleLanguage
+		task := state.GetAppState().GetTasks().Start("Restoring backup")
+		result, err := backup.Restore(ctx, lib.Client(), changes, advancedScoringFor(ctx, lib), checkpointPath, func(p backup.RestoreProgress) {
+			runOnUI(window, func() {
+				progressBar.SetValue(float64(p.Done))
+				progressLabel.SetText(p.Current.Title(titleLanguage))
+			})
+			task.Progress(p.Done, p.Total)
+		})
+		task.Finish()
+		lib.Syncer().SyncNow()
+		runOnUI(window, func() { showRestoreResult(window, progress, titleLanguage, result, err) })
+	}()
+}
+
+// showRestoreResult closes the progress of a restore and says how it went.
+func showRestoreResult(window fyne.Window, progress dialog.Dialog, titleLanguage string, result *backup.RestoreResult, err error) {
+	progress.Hide()
+	switch {
+	case err != nil:
+		logrus.Errorf("Restore interrupted: %v", err)
+		dialog.ShowError(fmt.Errorf("%w.  Restore the same backup again to carry on", err), window)
+	case len(result.Failed) > 0:
+		var failed []string
+		for _, failure := range result.Failed {
+			failed = append(failed, fmt.Sprintf("%s: %v", failure.Change.Title(titleLanguage), failure.Err))
+		}
+		dialog.ShowError(fmt.Errorf("restored %d entries, but %d failed:\n%s", result.Applied, len(failed), strings.Join(failed, "\n")), window)
+	default:
+		dialog.ShowInformation("Restore", fmt.Sprintf("Restored %d entries.", result.Applied+result.Resumed), window)
+	}
+}
+
+// advancedScoringFor returns the user's advanced scoring categories, which restored advanced scores are saved in
+// the order of.  Advanced scores are left out if the viewer can't be fetched.
+func advancedScoringFor(ctx context.Context, lib *library.Library) func(anilist.MediaType) []string {
+	viewer, err := lib.Client().Viewer(ctx)
+	if err != nil {
+		logrus.Warnf("Unable to fetch advanced scoring categories: %v", err)
+		return func(anilist.MediaType) []string { return nil }
+	}
+	return viewer.AdvancedScoring
+}
@@ -0,0 +1,147 @@
+package ui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+	"github.com/StarTerrarium/hisame/internal/links"
+	"github.com/sirupsen/logrus"
+	"net/url"
+	"sync"
+)
+
+// Route creates the page a link leads to.
+type Route func(link links.Link) Page
+
+// Router maps the kinds of link to the pages that show them.
+type Router struct {
+	mutex  sync.RWMutex
+	routes map[links.Kind]Route
+}
+
+// NewRouter creates a router with no routes.
+func NewRouter() *Router {
+	return &Router{routes: map[links.Kind]Route{}}
+}
+
+// Handle sets the route for a kind of link, replacing any route already set.
+func (r *Router) Handle(kind links.Kind, route Route) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.routes[kind] = route
+}
+
+// Resolve returns the page for a link.
+func (r *Router) Resolve(link links.Link) (Page, error) {
+	r.mutex.RLock()
+	route, ok := r.routes[link.Kind]
+	r.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no page for %s links", link.Kind)
+	}
+	return route(link), nil
+}
+
+// newDefaultRouter routes each kind of link to its page.
+func newDefaultRouter() *Router {
+	router := NewRouter()
+	router.Handle(links.KindMedia, func(link links.Link) Page {
+		return NewMediaPage(link.MediaID)
+	})
+	router.Handle(links.KindSearch, func(link links.Link) Page {
+		return NewSearchPage(link.Query, link.MediaType)
+	})
+	router.Handle(links.KindUser, func(link links.Link) Page {
+		return NewUserPage(link.UserName)
+	})
+	return router
+}
+
+// OpenLink shows the page for a hisame:// or AniList URL.  Links opened while logged out are shown once the user
+// logs in.
+func (sm *ScreenManager) OpenLink(raw string) error {
+	link, err := links.Parse(raw)
+	if err != nil {
+		return err
+	}
+	return sm.openLink(link)
+}
+
+func (sm *ScreenManager) openLink(link links.Link) error {
+	if !sm.isAuth {
+		logrus.Infof("Opening %s after logging in", link)
+		sm.pendingLink = &link
+		return nil
+	}
+	page, err := sm.router.Resolve(link)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Opening %s", link)
+	sm.ShowPage(page)
+	return nil
+}
+
+// openPendingLink shows the page for a link opened while logged out, returning false if there wasn't one.
+func (sm *ScreenManager) openPendingLink() bool {
+	link := sm.pendingLink
+	sm.pendingLink = nil
+	if link == nil {
+		return false
+	}
+	if err := sm.openLink(*link); err != nil {
+		logrus.Errorf("Error opening %s: %v", link, err)
+		return false
+	}
+	return true
+}
+
+// pasteLink opens a link pasted while nothing that takes text has focus.  Other text is ignored.
+func (sm *ScreenManager) pasteLink(shortcut fyne.Shortcut) {
+	paste, ok := shortcut.(*fyne.ShortcutPaste)
+	if !ok || paste.Clipboard == nil {
+		return
+	}
+	content := paste.Clipboard.Content()
+	if !links.IsLink(content) {
+		return
+	}
+	if err := sm.OpenLink(content); err != nil {
+		logrus.Errorf("Error opening pasted link %q: %v", content, err)
+	}
+}
+
+// OpenLink shows the page for a hisame:// or AniList URL.  It is used for links passed on the command line, and
+// forwarded from later launches.
+func OpenLink(raw string) error {
+	return getScreenManager().OpenLink(raw)
+}
+
+// routeHyperlinks makes the links in rich text, such as a user's markdown bio, open AniList pages in the app.
+func routeHyperlinks(text *widget.RichText) {
+	routeSegments(text.Segments)
+	text.Refresh()
+}
+
+func routeSegments(segments []widget.RichTextSegment) {
+	for _, segment := range segments {
+		switch segment := segment.(type) {
+		case *widget.HyperlinkSegment:
+			if u := segment.URL; u != nil {
+				segment.OnTapped = func() { openURL(u) }
+			}
+		case *widget.ListSegment:
+			routeSegments(segment.Items)
+		}
+	}
+}
+
+// openURL shows the page for a link Hisame can route, or opens it in the browser.
+func openURL(u *url.URL) {
+	if err := getScreenManager().OpenLink(u.String()); err == nil {
+		return
+	}
+	if err := fyne.CurrentApp().OpenURL(u); err != nil {
+		logrus.Errorf("Error opening %s: %v", u, err)
+	}
+}
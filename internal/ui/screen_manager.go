@@ -1,18 +1,74 @@
 package ui
 
 import (
+	"context"
+	"fmt"
 	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/audit"
+	"github.com/StarTerrarium/hisame/internal/auth"
+	"github.com/StarTerrarium/hisame/internal/keymap"
+	"github.com/StarTerrarium/hisame/internal/library"
+	"github.com/StarTerrarium/hisame/internal/links"
+	"github.com/StarTerrarium/hisame/internal/palette"
+	"github.com/StarTerrarium/hisame/internal/state"
+	"github.com/StarTerrarium/hisame/internal/tasks"
 	"github.com/sirupsen/logrus"
 	"sync"
+	"time"
 )
 
 // ScreenManager acts as a central management tool for changing between the main screens available in the app.
 type ScreenManager struct {
-	window     fyne.Window
-	mainScreen *MainScreen
-	isAuth     bool
+	window      fyne.Window
+	mainScreen  *MainScreen
+	isAuth      bool
+	currentPage Page
+
+	// Pages the user can go back and forward through, with the current page at historyIndex.
+	history      []Page
+	historyIndex int
+	// Pages kept so they are as the user left them when shown again, by key.
+	pageCache map[string]Page
+
+	// Page to return to after logging back in from an expired session, so unsaved edits aren't lost.
+	resumePage   Page
+	resumeUserID int
+
+	// Maps hisame:// and AniList links to pages.
+	router *Router
+	// Link opened while logged out, shown after logging in.
+	pendingLink *links.Link
+	// Keys bound to keyboard shortcuts.
+	keymap keymap.Keymap
+	// Commands offered by the command palette.
+	commands *palette.Registry
+
+	// Stop updating the status bar from the previous account's queue, syncer and client.
+	unsubscribePending   func()
+	unsubscribeSync      func()
+	unsubscribeRateLimit func()
+
+	// Changes held back by dry run mode since the app started.
+	dryRunMutex sync.Mutex
+	dryRunCount int
 }
 
+// Keys of the pages kept in the page cache.
+const (
+	animePageKey    = "anime"
+	searchPageKey   = "search"
+	settingsPageKey = "settings"
+	auditPageKey    = "audit"
+)
+
+// maxHistory bounds how many pages are kept for going back to.
+const maxHistory = 50
+
+// expiryCheckInterval is how often the session token's expiry is re-checked while the app is running.
+const expiryCheckInterval = time.Hour
+
 var (
 	instance          *ScreenManager
 	screenManagerOnce sync.Once
@@ -30,39 +86,404 @@ func getScreenManager() *ScreenManager {
 
 func InitialiseScreenManager(window fyne.Window) {
 	screenManagerOnce.Do(func() {
+		session := state.GetAppState().GetSession()
 		instance = &ScreenManager{
 			window: window,
-			isAuth: false,
+			isAuth: session != nil,
+			router: newDefaultRouter(),
+			keymap: keymap.New(state.GetAppState().GetConfig().Keymap),
+
+			commands: palette.NewRegistry(),
+
+			pageCache: map[string]Page{},
 		}
 		instance.mainScreen = NewMainScreen(window)
+		instance.mainScreen.navigationBar.UpdateAuthenticationState(instance.isAuth)
+		instance.refreshAccountState()
 		instance.showInitialPage()
+		window.Canvas().AddShortcut(&fyne.ShortcutPaste{}, instance.pasteLink)
+		window.Canvas().AddShortcut(&desktop.CustomShortcut{KeyName: fyne.KeyLeft, Modifier: fyne.KeyModifierAlt}, func(fyne.Shortcut) { instance.Back() })
+		window.Canvas().AddShortcut(&desktop.CustomShortcut{KeyName: fyne.KeyRight, Modifier: fyne.KeyModifierAlt}, func(fyne.Shortcut) { instance.Forward() })
+		instance.bindKeys()
+		instance.registerDefaultCommands()
+		instance.mainScreen.statusBar.UpdateTasks(state.GetAppState().GetTasks().Running())
+		state.GetAppState().GetTasks().Subscribe(func(running []tasks.Status) {
+			runOnUI(window, func() { instance.mainScreen.statusBar.UpdateTasks(running) })
+		})
+
+		state.GetAppState().SetSessionExpiredHandler(instance.HandleSessionExpired)
+		state.GetAppState().SetConflictResolver(instance.resolveConflict)
+		if log := state.GetAppState().GetAuditLog(); log != nil {
+			log.Subscribe(func(record audit.Record) {
+				runOnUI(window, func() { instance.countDryRun(record) })
+			})
+		}
+		instance.UpdateMutationMode()
+		go instance.watchTokenExpiry()
 	})
 }
 
 func (sm *ScreenManager) showInitialPage() {
 	if sm.isAuth {
-		sm.ShowPage(NewAnimeListPage())
+		sm.resetPages(sm.showAnimeList)
 	} else {
-		sm.ShowPage(NewLoginPage())
+		sm.resetPages(func() { sm.ShowPage(NewLoginPage()) })
 	}
 }
 
+// runOnUI runs fn on the goroutine that delivers the window's input events, after the events already waiting.
+// Widgets are only changed from there, so anything finishing on a background goroutine, such as a request or a
+// subscription to the library, goes through here rather than racing with taps and key presses.
+//
+// Fyne 2.5 has no public way to do this; fyne.Do only arrives in 2.6, and should replace this on upgrading.  Until
+// then QueueEvent is used, as it is how the driver itself queues input events: every window in Fyne 2.5, on the
+// desktop and mobile drivers alike, embeds the driver's common window and has it.  It isn't part of fyne.Window, so
+// it is looked up at run time, and fn is run straight away on a window without it.
+func runOnUI(window fyne.Window, fn func()) {
+	if queue, ok := window.(interface{ QueueEvent(fn func()) }); ok {
+		queue.QueueEvent(fn)
+		return
+	}
+	fn()
+}
+
+// RunOnUI runs fn with runOnUI and waits for it, returning its error.  It is for work arriving from outside the
+// app, such as links forwarded by a later launch, and must not be called from the UI goroutine.
+func RunOnUI(fn func() error) error {
+	done := make(chan error, 1)
+	runOnUI(getScreenManager().window, func() { done <- fn() })
+	return <-done
+}
+
+// ShowPage navigates to a page.  Pages the user had gone back from are dropped from the history.
 func (sm *ScreenManager) ShowPage(page Page) {
+	if page == sm.currentPage {
+		return
+	}
+	var dropped []Page
+	if len(sm.history) > 0 {
+		dropped = append(dropped, sm.history[sm.historyIndex+1:]...)
+		sm.history = sm.history[:sm.historyIndex+1]
+	}
+	sm.history = append(sm.history, page)
+	if len(sm.history) > maxHistory {
+		dropped = append(dropped, sm.history[:len(sm.history)-maxHistory]...)
+		sm.history = sm.history[len(sm.history)-maxHistory:]
+	}
+	sm.historyIndex = len(sm.history) - 1
+	sm.display(page)
+	sm.destroyUnreachable(dropped)
+}
+
+// ShowCachedPage shows the page kept under key, so it is as the user left it, creating it the first time.  The
+// pages reached from the navigation bar are kept like this until the account changes.
+func (sm *ScreenManager) ShowCachedPage(key string, create func() Page) {
+	page, ok := sm.pageCache[key]
+	if !ok {
+		page = create()
+		sm.pageCache[key] = page
+	}
+	sm.ShowPage(page)
+}
+
+// resetPages empties the history and page cache, such as after logging in or switching account when earlier pages
+// no longer apply, then calls show to show the first page.
+func (sm *ScreenManager) resetPages(show func()) {
+	dropped := sm.clearPages()
+	show()
+	sm.destroyUnreachable(dropped)
+}
+
+// showAnimeList shows the user's anime list, which is kept between visits.
+func (sm *ScreenManager) showAnimeList() {
+	sm.ShowCachedPage(animePageKey, func() Page { return NewAnimeListPage() })
+}
+
+// showSearch shows the search page, which is kept between visits.
+func (sm *ScreenManager) showSearch() *SearchPage {
+	sm.ShowCachedPage(searchPageKey, func() Page { return NewSearchPage("", "") })
+	return sm.pageCache[searchPageKey].(*SearchPage)
+}
+
+// showSettings shows the settings page, which is kept between visits.
+func (sm *ScreenManager) showSettings() *SettingsPage {
+	sm.ShowCachedPage(settingsPageKey, func() Page { return NewSettingsPage() })
+	return sm.pageCache[settingsPageKey].(*SettingsPage)
+}
+
+// replacePage shows a page in place of the current one, both in the history and the page cache, so going back
+// skips the current page.
+func (sm *ScreenManager) replacePage(page Page) {
+	if len(sm.history) == 0 {
+		sm.ShowPage(page)
+		return
+	}
+	replaced := sm.history[sm.historyIndex]
+	sm.history[sm.historyIndex] = page
+	for key, cached := range sm.pageCache {
+		if cached == replaced {
+			sm.pageCache[key] = page
+		}
+	}
+	sm.display(page)
+	sm.destroyUnreachable([]Page{replaced})
+}
+
+// clearPages empties the history and page cache, returning the pages that were in them.
+func (sm *ScreenManager) clearPages() []Page {
+	dropped := sm.history
+	for _, page := range sm.pageCache {
+		dropped = append(dropped, page)
+	}
+	sm.history = nil
+	sm.historyIndex = 0
+	sm.pageCache = map[string]Page{}
+	return dropped
+}
+
+// Back returns to the previous page, as it was left.
+func (sm *ScreenManager) Back() {
+	if sm.isAuth && sm.historyIndex > 0 {
+		sm.moveInHistory(sm.historyIndex - 1)
+	}
+}
+
+// Forward goes to the page the user last went back from.
+func (sm *ScreenManager) Forward() {
+	if sm.isAuth && sm.historyIndex < len(sm.history)-1 {
+		sm.moveInHistory(sm.historyIndex + 1)
+	}
+}
+
+func (sm *ScreenManager) moveInHistory(index int) {
+	sm.historyIndex = index
+	sm.display(sm.history[index])
+}
+
+// display swaps the current page for another, calling their lifecycle hooks.
+func (sm *ScreenManager) display(page Page) {
+	previous := sm.currentPage
+	sm.currentPage = page
+	if previous != nil && previous != page {
+		previous.OnHide()
+		// A list or entry on the hidden page would otherwise keep receiving key presses.
+		sm.window.Canvas().Unfocus()
+	}
 	sm.mainScreen.ShowPage(page)
+	if previous != page {
+		page.OnShow()
+	}
+	sm.mainScreen.navigationBar.UpdateHistory(sm.isAuth && sm.historyIndex > 0, sm.isAuth && sm.historyIndex < len(sm.history)-1)
 }
 
-func (sm *ScreenManager) HandleLoginSuccess() {
+// destroyUnreachable destroys those of pages that are no longer showing, in the history or in the page cache.
+func (sm *ScreenManager) destroyUnreachable(pages []Page) {
+	reachable := map[Page]bool{sm.currentPage: true}
+	for _, page := range sm.history {
+		reachable[page] = true
+	}
+	for _, page := range sm.pageCache {
+		reachable[page] = true
+	}
+	for _, page := range pages {
+		if !reachable[page] {
+			// Mark it, so a page dropped twice is only destroyed once.
+			reachable[page] = true
+			page.OnDestroy()
+		}
+	}
+}
+
+// HandleLoginSuccess adds the newly logged in account, makes it active and switches to the main pages.  Any
+// other accounts stay logged in.
+func (sm *ScreenManager) HandleLoginSuccess(session *auth.Session) {
+	if err := state.GetAppState().AddAccount(session); err != nil {
+		logrus.Errorf("Error saving session; login will not be remembered: %v", err)
+	}
+
 	sm.isAuth = true
 	// Enable navigation buttons
 	sm.mainScreen.navigationBar.UpdateAuthenticationState(sm.isAuth)
-	sm.ShowPage(NewAnimeListPage())
+	sm.refreshAccountState()
+
+	resumePage := sm.resumePage
+	sm.resumePage = nil
+	if resumePage != nil && sm.resumeUserID == session.UserID {
+		logrus.Info("Returning to the page shown before the session expired")
+		// The login page takes the resumed page's place, so going back leads to the pages before it.
+		sm.replacePage(resumePage)
+		return
+	}
+	sm.resetPages(func() {
+		if !sm.openPendingLink() {
+			sm.showAnimeList()
+		}
+	})
+}
+
+// HandleSessionExpired sends the user back to the login page when AniList stops accepting the token.  The page
+// that was showing is kept, and shown again if the same user logs back in.  It is called from the goroutine of the
+// request that failed, once the expired account has been logged out of.
+func (sm *ScreenManager) HandleSessionExpired(expired *auth.Session) {
+	runOnUI(sm.window, func() {
+		if !sm.isAuth {
+			return
+		}
+		logrus.Warn("AniList session expired.  Returning to login page")
+
+		sm.resumeUserID = expired.UserID
+		sm.resumePage = sm.currentPage
+		sm.isAuth = false
+		sm.mainScreen.statusBar.UpdateLeft("Session expired")
+		sm.mainScreen.statusBar.UpdateRight("")
+		sm.mainScreen.navigationBar.UpdateAuthenticationState(sm.isAuth)
+		sm.ShowPage(NewLoginPageWithMessage("Your AniList session has expired.  Log in again to carry on where you left off."))
+	})
 }
 
+// updateExpiryWarning shows a warning in the status bar when the session token is close to expiring.
+func (sm *ScreenManager) updateExpiryWarning() {
+	session := state.GetAppState().GetSession()
+	if session == nil || !session.ExpiresSoon(time.Now()) {
+		sm.mainScreen.statusBar.UpdateRight("")
+		return
+	}
+
+	remaining := time.Until(session.ExpiresAt)
+	var warning string
+	switch {
+	case remaining <= 0:
+		warning = "AniList login has expired.  Please log in again"
+	case remaining < 24*time.Hour:
+		warning = "AniList login expires today.  Log out and in again to renew"
+	default:
+		warning = fmt.Sprintf("AniList login expires in %d days.  Log out and in again to renew", int(remaining.Hours()/24))
+	}
+	logrus.Warn(warning)
+	sm.mainScreen.statusBar.UpdateRight(warning)
+}
+
+// watchTokenExpiry periodically refreshes the expiry warning, as the app may be left running for days.
+func (sm *ScreenManager) watchTokenExpiry() {
+	ticker := time.NewTicker(expiryCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		runOnUI(sm.window, sm.updateExpiryWarning)
+	}
+}
+
+// Activate brings the window to the front.  It is called when Hisame is launched again while already running.
+func Activate() {
+	sm := getScreenManager()
+	sm.window.Show()
+	sm.window.RequestFocus()
+}
+
+// UpdateMutationMode shows whether changes are being sent to AniList.  Call it after changing the mode.
+func (sm *ScreenManager) UpdateMutationMode() {
+	sm.dryRunMutex.Lock()
+	count := sm.dryRunCount
+	sm.dryRunMutex.Unlock()
+	sm.mainScreen.statusBar.UpdateMode(state.GetAppState().GetMutationMode(), count)
+}
+
+// countDryRun counts the changes held back by dry run mode, from the audit log.
+func (sm *ScreenManager) countDryRun(record audit.Record) {
+	if !record.DryRun {
+		return
+	}
+	sm.dryRunMutex.Lock()
+	sm.dryRunCount++
+	sm.dryRunMutex.Unlock()
+	sm.UpdateMutationMode()
+}
+
+// HandleLogout logs out of the active account.  If other accounts are logged in the next one becomes active,
+// otherwise the login page is shown.
 func (sm *ScreenManager) HandleLogout() {
+	sm.resumePage = nil
+	if session := state.GetAppState().GetSession(); session != nil {
+		if err := state.GetAppState().RemoveAccount(session.Name()); err != nil {
+			logrus.Errorf("Error removing account: %v", err)
+		}
+	}
+	sm.refreshAccountState()
+
+	if state.GetAppState().GetSession() != nil {
+		sm.resetPages(sm.showAnimeList)
+		return
+	}
+
 	sm.isAuth = false
-	// Clear authentication tokens and state
-	//sm.appState.ClearAuthToken()
 	// Disable navigation buttons
 	sm.mainScreen.navigationBar.UpdateAuthenticationState(sm.isAuth)
-	sm.ShowPage(NewLoginPage())
+	sm.resetPages(func() { sm.ShowPage(NewLoginPage()) })
+}
+
+// SwitchAccount makes another logged in account active without restarting.
+func (sm *ScreenManager) SwitchAccount(name string) {
+	if err := state.GetAppState().SwitchAccount(name); err != nil {
+		logrus.Errorf("Error switching to account %s: %v", name, err)
+		return
+	}
+	sm.resumePage = nil
+	sm.refreshAccountState()
+	sm.resetPages(sm.showAnimeList)
+}
+
+// ShowAddAccount shows the login page to log in to an additional account.
+func (sm *ScreenManager) ShowAddAccount() {
+	sm.ShowPage(NewLoginPageWithMessage("Log in to another AniList account.  Your current accounts stay logged in."))
+}
+
+// refreshAccountState updates the parts of the UI that show the active account.
+func (sm *ScreenManager) refreshAccountState() {
+	names, active := state.GetAppState().GetAccountNames()
+	sm.mainScreen.navigationBar.UpdateAccounts(names, active)
+	statusBar := sm.mainScreen.statusBar
+	session := state.GetAppState().GetSession()
+	if session != nil {
+		statusBar.UpdateAccount(session.Username, session.AvatarURL)
+	} else {
+		statusBar.UpdateAccount("", "")
+	}
+	sm.updateExpiryWarning()
+
+	if sm.unsubscribePending != nil {
+		sm.unsubscribePending()
+		sm.unsubscribeSync()
+		sm.unsubscribeRateLimit()
+		sm.unsubscribePending, sm.unsubscribeSync, sm.unsubscribeRateLimit = nil, nil, nil
+	}
+	statusBar.UpdatePending(0)
+	statusBar.UpdateSync(library.SyncStatus{})
+	statusBar.UpdateRateLimit(anilist.RateLimit{})
+
+	if lib := state.GetAppState().GetLibrary(); lib != nil {
+		statusBar.UpdatePending(len(lib.Queue().Pending()))
+		// The queue, syncer and client report from their own goroutines.
+		sm.unsubscribePending = lib.Queue().Subscribe(func(pending int) {
+			runOnUI(sm.window, func() { statusBar.UpdatePending(pending) })
+		})
+		statusBar.UpdateSync(lib.Syncer().Status())
+		sm.unsubscribeSync = lib.Syncer().Subscribe(func(status library.SyncStatus) {
+			runOnUI(sm.window, func() { statusBar.UpdateSync(status) })
+		})
+		statusBar.UpdateRateLimit(lib.Client().RateLimit())
+		sm.unsubscribeRateLimit = lib.Client().SubscribeRateLimit(func(limit anilist.RateLimit) {
+			runOnUI(sm.window, func() { statusBar.UpdateRateLimit(limit) })
+		})
+
+		// Refresh the cached profile, in case the user was renamed or changed their avatar since logging in.
+		lib.Viewer(context.Background(), func(viewer *anilist.Viewer, fresh bool, err error) {
+			if viewer == nil || !fresh {
+				return
+			}
+			runOnUI(sm.window, func() {
+				if current := state.GetAppState().GetSession(); current != nil && current.UserID == viewer.ID {
+					statusBar.UpdateAccount(viewer.Name, viewer.Avatar.Medium)
+				}
+			})
+		})
+	}
 }
@@ -0,0 +1,281 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/keymap"
+	"github.com/StarTerrarium/hisame/internal/links"
+	"github.com/StarTerrarium/hisame/internal/state"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// searchResultCount is how many results are shown for a search.
+	searchResultCount = 30
+	// searchTimeout bounds each search request.
+	searchTimeout = 30 * time.Second
+)
+
+// searchTypeOptions are the choices of media type to search, with the type each searches.
+var searchTypeOptions = []struct {
+	label     string
+	mediaType anilist.MediaType
+}{
+	{"Anime", anilist.MediaTypeAnime},
+	{"Manga", anilist.MediaTypeManga},
+	{"Anime and manga", ""},
+}
+
+// SearchPage searches AniList for media to open or add to the user's lists.  Pasting a Hisame or AniList link into
+// the search box opens the page it leads to instead.
+type SearchPage struct {
+	basePage
+
+	content fyne.CanvasObject
+
+	typeSelect  *widget.Select
+	searchEntry *widget.Entry
+	statusLabel *widget.Label
+	list        *widget.List
+
+	mutex   sync.Mutex
+	results []*anilist.Media
+	// Counts searches, so results arriving after a newer search has started are dropped.
+	generation int
+	// Whether a search is waiting to run, because the page was created with a query or left mid-search.
+	pending bool
+	// Result picked with the keyboard, or -1.
+	selected widget.ListItemID
+
+	// Set while the keyboard picks a result, so it isn't opened as a click would.
+	selecting bool
+
+	work       pageWork
+	listOffset float32
+}
+
+// NewSearchPage creates a new instance of SearchPage, searching for query as soon as the page is shown unless it is
+// empty.  An empty media type searches anime.
+func NewSearchPage(query string, mediaType anilist.MediaType) *SearchPage {
+	sp := &SearchPage{selected: -1}
+	sp.content = sp.buildContent()
+	for i, option := range searchTypeOptions {
+		if option.mediaType == mediaType || (mediaType == "" && i == 0) {
+			sp.typeSelect.SetSelectedIndex(i)
+			break
+		}
+	}
+	if query != "" {
+		sp.searchEntry.SetText(query)
+		sp.pending = true
+	}
+	return sp
+}
+
+// Content returns the root content object of the SearchPage.
+func (sp *SearchPage) Content() fyne.CanvasObject {
+	return sp.content
+}
+
+func (sp *SearchPage) buildContent() fyne.CanvasObject {
+	options := make([]string, len(searchTypeOptions))
+	for i, option := range searchTypeOptions {
+		options[i] = option.label
+	}
+	sp.typeSelect = widget.NewSelect(options, func(string) {
+		if strings.TrimSpace(sp.searchEntry.Text) != "" {
+			sp.search()
+		}
+	})
+	sp.searchEntry = widget.NewEntry()
+	sp.searchEntry.SetPlaceHolder("Search AniList, or paste an AniList link")
+	sp.searchEntry.OnSubmitted = func(string) {
+		// Leave the keyboard free to move through the results.
+		getScreenManager().window.Canvas().Unfocus()
+		sp.search()
+	}
+	searchButton := widget.NewButton("Search", sp.search)
+	sp.statusLabel = widget.NewLabel("")
+	sp.statusLabel.Wrapping = fyne.TextWrapWord
+
+	titleLanguage := state.GetAppState().GetConfig().AnimeConfig.TitleLanguage
+	sp.list = widget.NewList(
+		func() int {
+			sp.mutex.Lock()
+			defer sp.mutex.Unlock()
+			return len(sp.results)
+		},
+		func() fyne.CanvasObject {
+			return container.NewHBox(
+				NewCoverImage(fyne.NewSize(coverThumbnailWidth, coverThumbnailHeight)),
+				widget.NewLabel("Title"),
+				layout.NewSpacer(),
+				widget.NewLabel("Details"),
+			)
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			sp.mutex.Lock()
+			media := sp.results[id]
+			sp.mutex.Unlock()
+			row := item.(*fyne.Container)
+			row.Objects[0].(*CoverImage).SetURL(media.CoverImage.Medium)
+			row.Objects[1].(*widget.Label).SetText(media.Title.Preferred(titleLanguage))
+			row.Objects[3].(*widget.Label).SetText(mediaDetails(media))
+		},
+	)
+	sp.list.OnSelected = func(id widget.ListItemID) {
+		if sp.selecting {
+			sp.mutex.Lock()
+			sp.selected = id
+			sp.mutex.Unlock()
+			return
+		}
+		sp.mutex.Lock()
+		media := sp.results[id]
+		sp.mutex.Unlock()
+		sp.list.UnselectAll()
+		getScreenManager().ShowPage(NewMediaPage(media.ID))
+	}
+
+	searchBar := container.NewBorder(nil, nil, sp.typeSelect, searchButton, sp.searchEntry)
+	return container.NewBorder(container.NewVBox(searchBar, sp.statusLabel), nil, nil, nil, sp.list)
+}
+
+// OnShow runs a search that is waiting, and scrolls back to where the results were left.  The search and results
+// are kept while the page is hidden.
+func (sp *SearchPage) OnShow() {
+	sp.work.start()
+	sp.mutex.Lock()
+	pending := sp.pending
+	sp.mutex.Unlock()
+	if pending {
+		sp.search()
+	}
+	restoreListOffset(sp.list, sp.listOffset)
+}
+
+// OnHide cancels a search still running, and remembers how far down the results are scrolled.
+func (sp *SearchPage) OnHide() {
+	sp.listOffset = sp.list.GetScrollOffset()
+	sp.work.stop()
+}
+
+// search runs the search in the search box, or opens the page for a pasted link.
+func (sp *SearchPage) search() {
+	query := strings.TrimSpace(sp.searchEntry.Text)
+	if query == "" {
+		return
+	}
+	if links.IsLink(query) {
+		if err := getScreenManager().OpenLink(query); err != nil {
+			sp.statusLabel.SetText(fmt.Sprintf("Unable to open %s: %v", query, err))
+		}
+		return
+	}
+	lib := state.GetAppState().GetLibrary()
+	if lib == nil {
+		logrus.Warn("Search page used without an active account")
+		return
+	}
+	mediaType := searchTypeOptions[max(sp.typeSelect.SelectedIndex(), 0)].mediaType
+
+	sp.mutex.Lock()
+	sp.generation++
+	generation := sp.generation
+	sp.pending = false
+	sp.mutex.Unlock()
+	sp.statusLabel.SetText(fmt.Sprintf("Searching for %q..", query))
+	window := getScreenManager().window
+
+	go func() {
+		ctx, cancel := context.WithTimeout(sp.work.context(), searchTimeout)
+		defer cancel()
+		results, err := lib.Client().SearchMedia(ctx, query, mediaType, searchResultCount)
+		runOnUI(window, func() { sp.showResults(generation, query, results, err) })
+	}()
+}
+
+// showResults shows the results of a search, unless another search has been started since.
+func (sp *SearchPage) showResults(generation int, query string, results []*anilist.Media, err error) {
+	sp.mutex.Lock()
+	if generation != sp.generation {
+		sp.mutex.Unlock()
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		// Left mid-search, so search again when the page is next shown.
+		sp.pending = true
+		sp.mutex.Unlock()
+		return
+	}
+	if err == nil {
+		sp.results = results
+		sp.selected = -1
+	}
+	sp.mutex.Unlock()
+
+	switch {
+	case err != nil:
+		logrus.Errorf("Error searching for %q: %v", query, err)
+		sp.statusLabel.SetText(fmt.Sprintf("Search failed: %v", err))
+	case len(results) == 0:
+		sp.statusLabel.SetText(fmt.Sprintf("Nothing found for %q", query))
+	default:
+		sp.statusLabel.SetText("")
+	}
+	sp.list.Refresh()
+	if err == nil {
+		sp.list.UnselectAll()
+		sp.list.ScrollToTop()
+	}
+}
+
+// focusSearch puts the cursor in the search box, selecting what was searched last so typing replaces it.
+func (sp *SearchPage) focusSearch() {
+	getScreenManager().window.Canvas().Focus(sp.searchEntry)
+	sp.searchEntry.TypedShortcut(&fyne.ShortcutSelectAll{})
+}
+
+// handleAction moves through the results, or acts on the selected result.
+func (sp *SearchPage) handleAction(action keymap.Action) {
+	sp.mutex.Lock()
+	results, selected := sp.results, sp.selected
+	sp.mutex.Unlock()
+
+	switch action {
+	case keymap.ActionNext, keymap.ActionPrevious:
+		delta := 1
+		if action == keymap.ActionPrevious {
+			delta = -1
+		}
+		sp.selecting = true
+		moveSelection(sp.list, selected, delta, len(results))
+		sp.selecting = false
+		return
+	}
+	if selected < 0 || selected >= len(results) {
+		return
+	}
+	media := results[selected]
+	lib := state.GetAppState().GetLibrary()
+	switch {
+	case action == keymap.ActionOpen:
+		getScreenManager().ShowPage(NewMediaPage(media.ID))
+	case lib == nil || state.GetAppState().ReadOnly():
+	case action == keymap.ActionEdit:
+		editMedia(getScreenManager().window, lib, media)
+	case action == keymap.ActionIncrement || action == keymap.ActionDecrement:
+		if entry := userEntry(lib, media); entry != nil {
+			changeProgress(media.Type, entry, progressDelta(action))
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/backup"
+	"github.com/StarTerrarium/hisame/internal/state"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// exportFormatLabels names the export formats in the format picker.
+var exportFormatLabels = map[backup.Format]string{
+	backup.FormatJSON: "Hisame backup (JSON)",
+	backup.FormatCSV:  "Spreadsheet (CSV)",
+	backup.FormatMAL:  "MyAnimeList (XML)",
+}
+
+// exportListLabels names the choice of lists to export.  An empty media type is both lists.
+var exportListLabels = []struct {
+	label     string
+	mediaType anilist.MediaType
+}{
+	{"Anime and manga", ""},
+	{"Anime", anilist.MediaTypeAnime},
+	{"Manga", anilist.MediaTypeManga},
+}
+
+// mutationModes are the choices of whether changes are sent to AniList, in the order they are offered.
+var mutationModes = []anilist.MutationMode{anilist.MutationsEnabled, anilist.MutationsDryRun, anilist.MutationsReadOnly}
+
+// mutationModeLabels names the mutation modes in the Safety section.
+var mutationModeLabels = map[anilist.MutationMode]string{
+	anilist.MutationsEnabled:  "Normal",
+	anilist.MutationsDryRun:   "Dry run",
+	anilist.MutationsReadOnly: "Read-only",
+}
+
+// SettingsPage holds the app's settings and tools that act on the whole account.
+type SettingsPage struct {
+	basePage
+
+	content fyne.CanvasObject
+
+	formatSelect *widget.Select
+	listSelect   *widget.Select
+	exportButton *widget.Button
+	exportStatus *widget.Label
+
+	backups           *backup.Scheduler
+	backupStatus      *widget.Label
+	backupNowButton   *widget.Button
+	unsubscribeBackup func()
+
+	scroll       *container.Scroll
+	scrollOffset fyne.Position
+}
+
+// NewSettingsPage creates a new instance of SettingsPage.
+func NewSettingsPage() *SettingsPage {
+	sp := &SettingsPage{}
+	sp.content = sp.buildContent()
+	return sp
+}
+
+// Content returns the root content object of the SettingsPage.
+func (sp *SettingsPage) Content() fyne.CanvasObject {
+	return sp.content
+}
+
+func (sp *SettingsPage) buildContent() fyne.CanvasObject {
+	sp.scroll = container.NewVScroll(container.NewVBox(sp.buildExportCard(), sp.buildAutomaticBackupCard(), sp.buildAuditCard(), sp.buildSafetyCard(), sp.buildControlCard()))
+	return sp.scroll
+}
+
+// OnShow follows the automatic backups while the page is showing, and scrolls back to where it was left.
+func (sp *SettingsPage) OnShow() {
+	if sp.backups != nil {
+		scheduler := sp.backups
+		sp.updateBackupStatus(scheduler)
+		sp.unsubscribeBackup = scheduler.Subscribe(func() {
+			runOnUI(getScreenManager().window, func() { sp.updateBackupStatus(scheduler) })
+		})
+	}
+	sp.scroll.Offset = sp.scrollOffset
+	sp.scroll.Refresh()
+}
+
+// OnHide stops following the automatic backups, and remembers how far down the settings are scrolled.
+func (sp *SettingsPage) OnHide() {
+	sp.scrollOffset = sp.scroll.Offset
+	if sp.unsubscribeBackup != nil {
+		sp.unsubscribeBackup()
+		sp.unsubscribeBackup = nil
+	}
+}
+
+// buildExportCard builds the section exporting the lists to a file.
+func (sp *SettingsPage) buildExportCard() fyne.CanvasObject {
+	formatOptions := make([]string, len(backup.Formats))
+	for i, format := range backup.Formats {
+		formatOptions[i] = exportFormatLabels[format]
+	}
+	sp.formatSelect = widget.NewSelect(formatOptions, func(string) { sp.updateExportOptions() })
+	listOptions := make([]string, len(exportListLabels))
+	for i, option := range exportListLabels {
+		listOptions[i] = option.label
+	}
+	sp.listSelect = widget.NewSelect(listOptions, func(string) { sp.updateExportOptions() })
+	sp.exportButton = widget.NewButton("Export…", sp.export)
+	restoreButton := widget.NewButton("Restore from backup…", func() { chooseRestoreFile(getScreenManager().window) })
+	enableMutationControls(restoreButton)
+	sp.exportStatus = widget.NewLabel("")
+	sp.exportStatus.Wrapping = fyne.TextWrapWord
+
+	sp.formatSelect.SetSelectedIndex(0)
+	sp.listSelect.SetSelectedIndex(0)
+
+	form := widget.NewForm(
+		widget.NewFormItem("Format", sp.formatSelect),
+		widget.NewFormItem("Lists", sp.listSelect),
+	)
+	return widget.NewCard("Backup and restore",
+		"Save a copy of your lists that doesn't depend on AniList.  Hisame backups keep everything, including notes, custom lists and advanced scores, and can be restored from.",
+		container.NewVBox(form, container.NewHBox(sp.exportButton, restoreButton), sp.exportStatus))
+}
+
+// buildAutomaticBackupCard builds the section showing the state of scheduled backups.
+func (sp *SettingsPage) buildAutomaticBackupCard() fyne.CanvasObject {
+	const title = "Automatic backups"
+	scheduler := state.GetAppState().GetBackups()
+	if scheduler == nil {
+		return widget.NewCard(title, "", widget.NewLabel("Automatic backups are turned off.  Set backup.interval in the config file to turn them on."))
+	}
+
+	config := state.GetAppState().GetConfig()
+	schedule := fmt.Sprintf("Every %s, keeping the newest %d", config.BackupInterval(), config.BackupConfig.KeepCount)
+	if config.BackupConfig.KeepCount == 0 {
+		schedule = fmt.Sprintf("Every %s", config.BackupInterval())
+	}
+	if maxAge := config.BackupMaxAge(); maxAge > 0 {
+		schedule += fmt.Sprintf(" for up to %s", maxAge)
+	}
+	if config.BackupPassphrase() != "" {
+		schedule += ", encrypted"
+	}
+
+	sp.backups = scheduler
+	sp.backupStatus = widget.NewLabel("")
+	sp.backupStatus.Wrapping = fyne.TextWrapWord
+	sp.backupNowButton = widget.NewButton("Back up now", scheduler.BackupNow)
+
+	historyButton := widget.NewButton("History…", func() { getScreenManager().ShowPage(NewHistoryPage()) })
+
+	folder := ""
+	if session := state.GetAppState().GetSession(); session != nil {
+		folder = scheduler.Snapshots(session.CacheKey()).Dir()
+	}
+	folderLabel := widget.NewLabel(folder)
+	folderLabel.Truncation = fyne.TextTruncateEllipsis
+	form := widget.NewForm(
+		widget.NewFormItem("Schedule", widget.NewLabel(schedule)),
+		widget.NewFormItem("Folder", folderLabel),
+	)
+	return widget.NewCard(title, "", container.NewVBox(form, sp.backupStatus, container.NewHBox(sp.backupNowButton, historyButton)))
+}
+
+// updateBackupStatus shows the state of the active account's scheduled backups.
+func (sp *SettingsPage) updateBackupStatus(scheduler *backup.Scheduler) {
+	session := state.GetAppState().GetSession()
+	if session == nil {
+		return
+	}
+	status := scheduler.Status(session.CacheKey())
+	switch {
+	case status.Running:
+		sp.backupNowButton.Disable()
+		sp.backupStatus.SetText("Backing up..")
+		return
+	case status.Err != nil:
+		sp.backupStatus.SetText(fmt.Sprintf("The last backup failed: %v", status.Err))
+	case status.LastBackup.IsZero():
+		sp.backupStatus.SetText("No backups yet.")
+	default:
+		sp.backupStatus.SetText(fmt.Sprintf("Last backed up %s.", status.LastBackup.Local().Format("2 Jan 2006 15:04")))
+	}
+	sp.backupNowButton.Enable()
+}
+
+// buildSafetyCard builds the section choosing whether changes are sent to AniList.
+func (sp *SettingsPage) buildSafetyCard() fyne.CanvasObject {
+	options := make([]string, len(mutationModes))
+	for i, mode := range mutationModes {
+		options[i] = mutationModeLabels[mode]
+	}
+	modeRadio := widget.NewRadioGroup(options, nil)
+	modeRadio.Required = true
+	modeRadio.SetSelected(mutationModeLabels[state.GetAppState().GetMutationMode()])
+	modeRadio.OnChanged = func(selected string) {
+		for _, mode := range mutationModes {
+			if mutationModeLabels[mode] == selected {
+				sp.setMutationMode(mode)
+			}
+		}
+	}
+	return widget.NewCard("Safety",
+		"Dry run records the changes Hisame would make in the audit log without sending them.  Read-only turns off everything that changes your lists.  This lasts until Hisame is closed.  Set readOnly or dryRun in the config file, or pass --read-only or --dry-run, to keep it.",
+		modeRadio)
+}
+
+// setMutationMode switches whether changes are sent, then rebuilds the page so its controls match.
+func (sp *SettingsPage) setMutationMode(mode anilist.MutationMode) {
+	previous := state.GetAppState().GetMutationMode()
+	if mode == previous {
+		return
+	}
+	state.GetAppState().SetMutationMode(mode)
+	getScreenManager().UpdateMutationMode()
+	logrus.Infof("Switched from %s to %s mode", previous, mode)
+	getScreenManager().replacePage(NewSettingsPage())
+}
+
+// buildControlCard builds the section showing where the control API can be reached.
+func (sp *SettingsPage) buildControlCard() fyne.CanvasObject {
+	const title = "Control API"
+	const subtitle = "Lets media players, scripts and other programs on this computer read your lists and update progress."
+	server := state.GetAppState().GetControl()
+	if server == nil {
+		message := "The control API is off.  Set control.enabled in the config file to turn it on."
+		if state.GetAppState().GetConfig().ControlConfig.Enabled {
+			message = "The control API couldn't start.  Check the log for details."
+		}
+		label := widget.NewLabel(message)
+		label.Wrapping = fyne.TextWrapWord
+		return widget.NewCard(title, subtitle, label)
+	}
+
+	address := widget.NewLabel(fmt.Sprintf("Listening on %s", server.Address()))
+	copyButton := widget.NewButton("Copy token", func() {
+		getScreenManager().window.Clipboard().SetContent(server.Token())
+	})
+	return widget.NewCard(title, subtitle, container.NewHBox(address, copyButton))
+}
+
+// buildAuditCard builds the section leading to the audit log.
+func (sp *SettingsPage) buildAuditCard() fyne.CanvasObject {
+	openButton := widget.NewButton("View audit log", func() { getScreenManager().ShowCachedPage(auditPageKey, func() Page { return NewAuditPage() }) })
+	return widget.NewCard("Audit log", "Every change Hisame sends to AniList is recorded, with the values before and after, so you can tell whether Hisame made a change.",
+		container.NewHBox(openButton))
+}
+
+func (sp *SettingsPage) selectedExport() (backup.Format, anilist.MediaType) {
+	format := backup.Formats[max(sp.formatSelect.SelectedIndex(), 0)]
+	mediaType := exportListLabels[max(sp.listSelect.SelectedIndex(), 0)].mediaType
+	return format, mediaType
+}
+
+// updateExportOptions disables exporting combinations a format can't hold.
+func (sp *SettingsPage) updateExportOptions() {
+	if sp.exportButton == nil || sp.listSelect == nil {
+		return
+	}
+	format, mediaType := sp.selectedExport()
+	if format == backup.FormatMAL && mediaType == "" {
+		sp.exportButton.Disable()
+		sp.exportStatus.SetText("MyAnimeList exports hold a single list.  Choose anime or manga.")
+		return
+	}
+	sp.exportButton.Enable()
+	sp.exportStatus.SetText("")
+}
+
+// export asks where to save the export, then fetches the latest lists and writes them.
+func (sp *SettingsPage) export() {
+	lib := state.GetAppState().GetLibrary()
+	if lib == nil {
+		return
+	}
+	format, mediaType := sp.selectedExport()
+	window := getScreenManager().window
+
+	save := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+		if writer == nil {
+			return
+		}
+		sp.exportButton.Disable()
+		sp.exportStatus.SetText("Exporting..")
+		go func() {
+			task := state.GetAppState().GetTasks().Start("Exporting lists")
+			defer task.Finish()
+			err := func() error {
+				defer writer.Close()
+				b, err := lib.Backup(context.Background())
+				if err != nil {
+					return err
+				}
+				return b.Export(writer, format, mediaType)
+			}()
+			runOnUI(window, func() {
+				sp.exportButton.Enable()
+				if err != nil {
+					logrus.Errorf("Error exporting lists: %v", err)
+					sp.exportStatus.SetText("")
+					dialog.ShowError(fmt.Errorf("export failed: %w", err), window)
+					return
+				}
+				logrus.Infof("Exported lists to %s", writer.URI())
+				sp.exportStatus.SetText(fmt.Sprintf("Exported to %s", writer.URI().Path()))
+			})
+		}()
+	}, window)
+	save.SetFileName(backup.FileName(format, mediaType, time.Now()))
+	save.Show()
+}
@@ -1,34 +1,96 @@
 package ui
 
 import (
+	"fmt"
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/library"
+	"github.com/StarTerrarium/hisame/internal/tasks"
+	"sync"
+	"time"
 )
 
+// statusAvatarSize is the size of the avatar shown beside the account in the status bar.
+const statusAvatarSize = 24
+
+// StatusBar shows the state of the app along the bottom of the window.  Each section opens more detail when
+// clicked.
 type StatusBar struct {
 	content    fyne.CanvasObject
-	leftLabel  *widget.Label
 	rightLabel *widget.Label
+
+	// Shows the logged in account, and opens its profile.
+	avatar        *CoverImage
+	accountButton *widget.Button
+	// Shows how many edits are waiting to be sent to AniList, and lists them.
+	pendingButton *widget.Button
+	// Shows when the lists were last synced, or the progress of a running sync, and offers to sync now.
+	syncButton *widget.Button
+	// Shows how many requests AniList will take before rate limiting, and explains the limit.
+	rateLimitButton *widget.Button
+	// Shows the progress of tasks running in the background, and lists them.
+	tasksButton *widget.Button
+	// Warns that changes aren't being sent to AniList, and opens the audit log.
+	modeButton *widget.Button
+
+	// The latest state shown by each section, for its detail view.
+	mutex     sync.Mutex
+	username  string
+	sync      library.SyncStatus
+	rateLimit anilist.RateLimit
+	tasks     []tasks.Status
 }
 
 func NewStatusBar() *StatusBar {
 	sb := &StatusBar{
-		leftLabel:  widget.NewLabel(""),
 		rightLabel: widget.NewLabel(""),
+		avatar:     NewCoverImage(fyne.NewSize(statusAvatarSize, statusAvatarSize)),
+
+		modeButton: widget.NewButton("", func() {
+			getScreenManager().ShowCachedPage(auditPageKey, func() Page { return NewAuditPage() })
+		}),
 	}
+	sb.accountButton = newStatusButton(sb.openAccount)
+	sb.pendingButton = newStatusButton(showPendingDetails)
+	sb.syncButton = newStatusButton(sb.showSyncDetails)
+	sb.rateLimitButton = newStatusButton(sb.showRateLimitDetails)
+	sb.tasksButton = newStatusButton(sb.showTaskDetails)
+	sb.avatar.Hide()
+	sb.modeButton.Importance = widget.WarningImportance
+	sb.modeButton.Hide()
 	sb.content = sb.buildContent()
 	return sb
 }
 
+// newStatusButton creates a section of the status bar, which looks like text until hovered and is hidden while it
+// has nothing to show.
+func newStatusButton(tapped func()) *widget.Button {
+	button := widget.NewButton("", tapped)
+	button.Importance = widget.LowImportance
+	button.Hide()
+	return button
+}
+
+// setSection shows text in a section, hiding the section when text is empty.
+func setSection(button *widget.Button, text string) {
+	button.SetText(text)
+	if text == "" {
+		button.Hide()
+	} else {
+		button.Show()
+	}
+}
+
 func (sb *StatusBar) Content() fyne.CanvasObject {
 	return sb.content
 }
 
 func (sb *StatusBar) buildContent() fyne.CanvasObject {
-	leftContainer := container.NewHBox(sb.leftLabel)
-	rightContainer := container.NewHBox(sb.rightLabel)
+	leftContainer := container.NewHBox(container.NewCenter(sb.avatar), sb.accountButton, sb.modeButton)
+	rightContainer := container.NewHBox(sb.tasksButton, sb.rateLimitButton, sb.syncButton, sb.pendingButton, sb.rightLabel)
 
 	// Spacer between left and right
 	spacer := layout.NewSpacer()
@@ -38,10 +100,153 @@ func (sb *StatusBar) buildContent() fyne.CanvasObject {
 	return statusBar
 }
 
+// UpdateLeft shows a message in place of the logged in account.
 func (sb *StatusBar) UpdateLeft(text string) {
-	sb.leftLabel.SetText(text)
+	sb.mutex.Lock()
+	sb.username = ""
+	sb.mutex.Unlock()
+	sb.avatar.Hide()
+	setSection(sb.accountButton, text)
 }
 
 func (sb *StatusBar) UpdateRight(text string) {
 	sb.rightLabel.SetText(text)
 }
+
+// UpdateAccount shows the logged in account with its avatar, or nothing when name is empty.
+func (sb *StatusBar) UpdateAccount(name, avatarURL string) {
+	sb.mutex.Lock()
+	sb.username = name
+	sb.mutex.Unlock()
+	if name == "" {
+		sb.avatar.Hide()
+		setSection(sb.accountButton, "")
+		return
+	}
+	if avatarURL == "" {
+		sb.avatar.Hide()
+	} else {
+		sb.avatar.SetURL(avatarURL)
+		sb.avatar.Show()
+	}
+	setSection(sb.accountButton, fmt.Sprintf("Logged in as %s", name))
+}
+
+// openAccount shows the profile of the logged in account.
+func (sb *StatusBar) openAccount() {
+	sb.mutex.Lock()
+	name := sb.username
+	sb.mutex.Unlock()
+	if name != "" {
+		getScreenManager().ShowPage(NewUserPage(name))
+	}
+}
+
+// UpdatePending shows the number of edits waiting to be sent to AniList, or nothing when all are sent.
+func (sb *StatusBar) UpdatePending(count int) {
+	switch count {
+	case 0:
+		setSection(sb.pendingButton, "")
+	case 1:
+		setSection(sb.pendingButton, "1 change not yet synced")
+	default:
+		setSection(sb.pendingButton, fmt.Sprintf("%d changes not yet synced", count))
+	}
+}
+
+// UpdateMode shows whether changes are being sent to AniList, and how many a dry run has held back.
+func (sb *StatusBar) UpdateMode(mode anilist.MutationMode, dryRunCount int) {
+	switch mode {
+	case anilist.MutationsReadOnly:
+		sb.modeButton.SetText("Read-only")
+		sb.modeButton.Show()
+	case anilist.MutationsDryRun:
+		if dryRunCount == 1 {
+			sb.modeButton.SetText("Dry run: 1 change not sent")
+		} else {
+			sb.modeButton.SetText(fmt.Sprintf("Dry run: %d changes not sent", dryRunCount))
+		}
+		sb.modeButton.Show()
+	default:
+		sb.modeButton.Hide()
+	}
+}
+
+// UpdateSync shows the progress of a running sync, or when the lists were last synced.
+func (sb *StatusBar) UpdateSync(status library.SyncStatus) {
+	sb.mutex.Lock()
+	sb.sync = status
+	sb.mutex.Unlock()
+
+	lastSynced := "never"
+	if !status.LastSynced.IsZero() {
+		lastSynced = formatSyncTime(status.LastSynced)
+	}
+
+	switch {
+	case status.Syncing && status.Fetched > 0:
+		setSection(sb.syncButton, fmt.Sprintf("Syncing.. %d changes", status.Fetched))
+	case status.Syncing:
+		setSection(sb.syncButton, "Syncing..")
+	case anilist.IsOffline(status.Err):
+		setSection(sb.syncButton, fmt.Sprintf("Offline.  Last synced %s", lastSynced))
+	case status.Err != nil:
+		setSection(sb.syncButton, fmt.Sprintf("Sync failed.  Last synced %s", lastSynced))
+	case status.LastSynced.IsZero():
+		setSection(sb.syncButton, "")
+	default:
+		setSection(sb.syncButton, fmt.Sprintf("Last synced %s", lastSynced))
+	}
+}
+
+// UpdateRateLimit shows how many more requests AniList will take this minute, or how long it has asked Hisame to
+// wait.  A zero limit hides the section.
+func (sb *StatusBar) UpdateRateLimit(limit anilist.RateLimit) {
+	sb.mutex.Lock()
+	sb.rateLimit = limit
+	sb.mutex.Unlock()
+
+	switch {
+	case limit.Limit == 0:
+		setSection(sb.rateLimitButton, "")
+	case limit.BlockedUntil.After(time.Now()):
+		sb.rateLimitButton.Importance = widget.WarningImportance
+		setSection(sb.rateLimitButton, fmt.Sprintf("Rate limited until %s", limit.BlockedUntil.Format(time.TimeOnly)))
+	default:
+		sb.rateLimitButton.Importance = widget.LowImportance
+		setSection(sb.rateLimitButton, fmt.Sprintf("API %d/%d", limit.Remaining, limit.Limit))
+	}
+}
+
+// UpdateTasks shows the progress of the tasks running in the background, or nothing when none are.
+func (sb *StatusBar) UpdateTasks(running []tasks.Status) {
+	sb.mutex.Lock()
+	sb.tasks = running
+	sb.mutex.Unlock()
+
+	switch len(running) {
+	case 0:
+		setSection(sb.tasksButton, "")
+	case 1:
+		setSection(sb.tasksButton, taskProgress(running[0]))
+	default:
+		setSection(sb.tasksButton, fmt.Sprintf("%d tasks running", len(running)))
+	}
+}
+
+// taskProgress describes a running task, with how far through it is when known.
+func taskProgress(task tasks.Status) string {
+	if task.Total == 0 {
+		return task.Name + ".."
+	}
+	return fmt.Sprintf("%s.. %d/%d", task.Name, task.Done, task.Total)
+}
+
+// formatSyncTime shows just the time for syncs today, and the date as well for older ones.
+func formatSyncTime(t time.Time) string {
+	now := time.Now()
+	if t.Year() == now.Year() && t.YearDay() == now.YearDay() {
+		return t.Format(time.TimeOnly)
+	}
+	return t.Format(time.DateTime)
+}
@@ -0,0 +1,182 @@
+package ui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/library"
+	"github.com/StarTerrarium/hisame/internal/state"
+	"strings"
+	"time"
+)
+
+// Size of the dialogs opened from the status bar.
+const (
+	statusDetailsWidth  = 480
+	statusDetailsHeight = 360
+)
+
+// showPendingDetails lists the edits waiting to be sent to AniList.
+func showPendingDetails() {
+	lib := state.GetAppState().GetLibrary()
+	if lib == nil {
+		return
+	}
+	pending := lib.Queue().Pending()
+	titleLanguage := state.GetAppState().GetConfig().AnimeConfig.TitleLanguage
+
+	var details dialog.Dialog
+	rows := container.New(layout.NewFormLayout())
+	for _, mutation := range pending {
+		rows.Add(widget.NewLabel(mutationTitle(lib, mutation, titleLanguage)))
+		summary := widget.NewLabel(fmt.Sprintf("%s, queued %s", describeMutation(mutation), formatSyncTime(mutation.QueuedAt)))
+		if !mutation.Deferred {
+			rows.Add(summary)
+			continue
+		}
+		// Conflicts left to decide later wait here until the user comes back to them.
+		id := mutation.ID
+		decide := widget.NewButton("Decide", func() {
+			details.Hide()
+			lib.Queue().Resume(id)
+		})
+		summary.SetText(summary.Text + ", changed on AniList too")
+		rows.Add(container.NewBorder(nil, nil, nil, decide, summary))
+	}
+	note := widget.NewLabel("These changes are saved on this computer, and are sent once AniList can be reached.  Changes to entries that were also changed on AniList wait until you decide which to keep.")
+	note.Wrapping = fyne.TextWrapWord
+
+	window := getScreenManager().window
+	details = dialog.NewCustom("Changes not yet synced", "Close",
+		container.NewBorder(note, nil, nil, nil, container.NewVScroll(rows)), window)
+	details.Resize(fyne.NewSize(statusDetailsWidth, statusDetailsHeight))
+	details.Show()
+}
+
+// mutationTitle returns the title of the media a pending edit changes, from the cached lists.
+func mutationTitle(lib *library.Library, mutation *library.Mutation, titleLanguage string) string {
+	if collection := lib.CachedListCollection(mutation.MediaType); collection != nil {
+		for _, entry := range collection.Entries() {
+			if entry.MediaID == mutation.MediaID {
+				return entryTitle(entry, titleLanguage)
+			}
+		}
+	}
+	return fmt.Sprintf("Media %d", mutation.MediaID)
+}
+
+// describeMutation summarises what a pending edit changes.
+func describeMutation(mutation *library.Mutation) string {
+	if mutation.Kind == library.MutationDelete {
+		return "Remove from list"
+	}
+	input := mutation.Input
+	var changes []string
+	if input.Status != nil {
+		changes = append(changes, fmt.Sprintf("status %s", *input.Status))
+	}
+	if input.Progress != nil {
+		changes = append(changes, fmt.Sprintf("progress %d", *input.Progress))
+	}
+	if input.Score != nil {
+		changes = append(changes, fmt.Sprintf("score %g", *input.Score))
+	}
+	if input.Notes != nil {
+		changes = append(changes, "notes")
+	}
+	if len(changes) == 0 {
+		return "Update"
+	}
+	return "Set " + strings.Join(changes, ", ")
+}
+
+// showSyncDetails shows how the last sync went, and offers to sync now.
+func (sb *StatusBar) showSyncDetails() {
+	lib := state.GetAppState().GetLibrary()
+	if lib == nil {
+		return
+	}
+	sb.mutex.Lock()
+	status := sb.sync
+	sb.mutex.Unlock()
+
+	lastSynced := "Never"
+	if !status.LastSynced.IsZero() {
+		lastSynced = status.LastSynced.Format(time.DateTime)
+	}
+	summary := "Up to date"
+	switch {
+	case status.Syncing:
+		summary = fmt.Sprintf("Syncing, %d changes fetched so far", status.Fetched)
+	case anilist.IsOffline(status.Err):
+		summary = "Offline"
+	case status.Err != nil:
+		summary = fmt.Sprintf("Failed: %v", status.Err)
+	}
+	summaryLabel := widget.NewLabel(summary)
+	summaryLabel.Wrapping = fyne.TextWrapWord
+	form := widget.NewForm(
+		widget.NewFormItem("Last synced", widget.NewLabel(lastSynced)),
+		widget.NewFormItem("State", summaryLabel),
+	)
+
+	details := dialog.NewCustomConfirm("Sync", "Sync now", "Close", form, func(confirmed bool) {
+		if confirmed {
+			lib.Syncer().SyncNow()
+		}
+	}, getScreenManager().window)
+	details.Resize(fyne.NewSize(statusDetailsWidth, 0))
+	details.Show()
+}
+
+// showRateLimitDetails explains how close Hisame is to AniList's rate limit.
+func (sb *StatusBar) showRateLimitDetails() {
+	sb.mutex.Lock()
+	limit := sb.rateLimit
+	sb.mutex.Unlock()
+
+	message := fmt.Sprintf("AniList allows %d requests a minute.  %d are left this minute, as of the last response.", limit.Limit, limit.Remaining)
+	if limit.BlockedUntil.After(time.Now()) {
+		message += fmt.Sprintf("\n\nAniList has asked Hisame to wait until %s.  Requests are held until then.", limit.BlockedUntil.Format(time.TimeOnly))
+	} else {
+		message += "\n\nRequests are spaced out as the limit gets close, so it is rarely reached."
+	}
+	label := widget.NewLabel(message)
+	label.Wrapping = fyne.TextWrapWord
+	details := dialog.NewCustom("AniList rate limit", "Close", label, getScreenManager().window)
+	details.Resize(fyne.NewSize(statusDetailsWidth, 0))
+	details.Show()
+}
+
+// showTaskDetails lists the tasks running in the background, with their progress when it is known.
+func (sb *StatusBar) showTaskDetails() {
+	sb.mutex.Lock()
+	running := sb.tasks
+	sb.mutex.Unlock()
+
+	rows := container.NewVBox()
+	for _, task := range running {
+		var progress fyne.CanvasObject
+		if task.Total == 0 {
+			progress = widget.NewProgressBarInfinite()
+		} else {
+			bar := widget.NewProgressBar()
+			bar.Max = float64(task.Total)
+			bar.SetValue(float64(task.Done))
+			progress = bar
+		}
+		started := widget.NewLabel(fmt.Sprintf("Started %s", task.Started.Format(time.TimeOnly)))
+		rows.Add(container.NewBorder(nil, nil, widget.NewLabel(task.Name), started, progress))
+	}
+	if len(running) == 0 {
+		rows.Add(widget.NewLabel("Nothing is running"))
+	}
+
+	details := dialog.NewCustom("Background tasks", "Close", rows, getScreenManager().window)
+	details.Resize(fyne.NewSize(statusDetailsWidth, 0))
+	details.Show()
+}
@@ -0,0 +1,146 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"github.com/StarTerrarium/hisame/internal/anilist"
+	"github.com/StarTerrarium/hisame/internal/state"
+	"github.com/sirupsen/logrus"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// userAvatarSize is the size of the avatar shown on the user page.
+const userAvatarSize = 100
+
+// userTimeout bounds fetching a user's profile.
+const userTimeout = 30 * time.Second
+
+// UserPage shows an AniList user's public profile.  It is where deep links to users lead.
+type UserPage struct {
+	basePage
+
+	name    string
+	content fyne.CanvasObject
+
+	avatar      *CoverImage
+	nameLabel   *widget.Label
+	animeLabel  *widget.Label
+	mangaLabel  *widget.Label
+	siteLink    *widget.Hyperlink
+	about       *widget.RichText
+	statusLabel *widget.Label
+	scroll      *container.Scroll
+
+	scrollOffset fyne.Position
+
+	work   pageWork
+	mutex  sync.Mutex
+	loaded bool
+}
+
+// NewUserPage creates a new instance of UserPage for the user with the given name.
+func NewUserPage(name string) *UserPage {
+	up := &UserPage{name: name}
+	up.content = up.buildContent()
+	return up
+}
+
+// Content returns the root content object of the UserPage.
+func (up *UserPage) Content() fyne.CanvasObject {
+	return up.content
+}
+
+func (up *UserPage) buildContent() fyne.CanvasObject {
+	up.avatar = NewCoverImage(fyne.NewSize(userAvatarSize, userAvatarSize))
+	up.nameLabel = widget.NewLabel(up.name)
+	up.nameLabel.TextStyle = fyne.TextStyle{Bold: true}
+	up.animeLabel = widget.NewLabel("")
+	up.mangaLabel = widget.NewLabel("")
+	up.siteLink = widget.NewHyperlink("Open on AniList", nil)
+	up.siteLink.Hide()
+	up.about = widget.NewRichText()
+	up.about.Wrapping = fyne.TextWrapWord
+	up.statusLabel = widget.NewLabel("Loading..")
+	up.statusLabel.Wrapping = fyne.TextWrapWord
+
+	header := container.NewBorder(nil, nil, up.avatar, nil,
+		container.NewVBox(up.nameLabel, up.animeLabel, up.mangaLabel, up.siteLink))
+	up.scroll = container.NewVScroll(up.about)
+	return container.NewBorder(header, up.statusLabel, nil, nil, up.scroll)
+}
+
+// OnShow fetches the user's profile, unless it has already been loaded, and scrolls back to where the bio was left.
+func (up *UserPage) OnShow() {
+	up.mutex.Lock()
+	loaded := up.loaded
+	up.mutex.Unlock()
+	if !loaded {
+		up.load(up.work.start())
+	}
+	up.scroll.Offset = up.scrollOffset
+	up.scroll.Refresh()
+}
+
+// OnHide stops fetching the profile, and remembers how far down the bio is scrolled.
+func (up *UserPage) OnHide() {
+	up.scrollOffset = up.scroll.Offset
+	up.work.stop()
+}
+
+// load fetches the user's profile in the background.  A fetch cancelled by leaving the page is retried when the page
+// is shown again.
+func (up *UserPage) load(ctx context.Context) {
+	lib := state.GetAppState().GetLibrary()
+	if lib == nil {
+		logrus.Warn("User page shown without an active account")
+		return
+	}
+	up.statusLabel.SetText("Loading..")
+	window := getScreenManager().window
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, userTimeout)
+		defer cancel()
+		user, err := lib.Client().User(ctx, up.name)
+		runOnUI(window, func() { up.showResult(user, err) })
+	}()
+}
+
+// showResult shows the fetched profile, or why it couldn't be fetched.
+func (up *UserPage) showResult(user *anilist.User, err error) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return
+	case anilist.IsNotFound(err):
+		up.statusLabel.SetText(fmt.Sprintf("AniList has no user called %s", up.name))
+	case err != nil:
+		logrus.Errorf("Error fetching user %s: %v", up.name, err)
+		up.statusLabel.SetText(fmt.Sprintf("Unable to load %s's profile: %v", up.name, err))
+	default:
+		up.mutex.Lock()
+		up.loaded = true
+		up.mutex.Unlock()
+		up.showUser(user)
+		up.statusLabel.SetText("")
+	}
+}
+
+func (up *UserPage) showUser(user *anilist.User) {
+	up.avatar.SetURL(user.Avatar.Large)
+	up.nameLabel.SetText(user.Name)
+	anime, manga := user.Statistics.Anime, user.Statistics.Manga
+	up.animeLabel.SetText(fmt.Sprintf("Anime: %d titles, %d episodes watched, mean score %.1f", anime.Count, anime.EpisodesWatched, anime.MeanScore))
+	up.mangaLabel.SetText(fmt.Sprintf("Manga: %d titles, %d chapters read, mean score %.1f", manga.Count, manga.ChaptersRead, manga.MeanScore))
+	if u, err := url.Parse(user.SiteURL); err == nil && user.SiteURL != "" {
+		up.siteLink.SetURL(u)
+		up.siteLink.Show()
+	}
+	up.about.ParseMarkdown(user.About)
+	// Links to AniList pages in the bio open in the app.
+	routeHyperlinks(up.about)
+}
@@ -20,9 +20,9 @@ var (
 	errInvalidLogLevel = errors.New("invalid log level")
 )
 
-// InitLogger sets up the global logger with a level and file.
+// InitLogger sets up the global logger with a level and file, also writing to the console writer.
 // It returns a cleanup function to be called when the application exits.
-func InitLogger() func() {
+func InitLogger(console io.Writer) func() {
 	level := defaultLogLevel
 
 	envLevel, err := getLogLevelFromEnv()
@@ -41,7 +41,7 @@ func InitLogger() func() {
 	}
 
 	logrus.SetLevel(level)
-	logrus.SetOutput(os.Stdout) // Default output
+	logrus.SetOutput(console) // Default output
 
 	var logFile *os.File
 
@@ -57,7 +57,7 @@ func InitLogger() func() {
 			if err != nil {
 				logrus.Warnf("Error opening log file; file logging will be disabled: %v", err)
 			} else {
-				logrus.SetOutput(io.MultiWriter(os.Stdout, logFile))
+				logrus.SetOutput(io.MultiWriter(console, logFile))
 				logrus.Infof("Logging to file %s", logPath)
 			}
 		}